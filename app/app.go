@@ -0,0 +1,482 @@
+// Package app is the trail program: cmd/trail's main calls Main. A custom
+// build can import it from its own main package after registering extra
+// log formats with the logformat package.
+package app
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	trail "github.com/open-wander/trail"
+	"github.com/open-wander/trail/internal/aggregator"
+	"github.com/open-wander/trail/internal/backfill"
+	"github.com/open-wander/trail/internal/config"
+	"github.com/open-wander/trail/internal/db"
+	"github.com/open-wander/trail/internal/parser"
+	"github.com/open-wander/trail/internal/retention"
+	"github.com/open-wander/trail/internal/server"
+	"github.com/open-wander/trail/internal/syslog"
+	"github.com/open-wander/trail/internal/tailer"
+)
+
+// Main runs trail as configured by the TRAIL_* environment variables, or
+// the one-shot subcommand named in os.Args, and exits on fatal errors
+func Main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// trail --stdin is TRAIL_LOG_FILE=-
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "--stdin" {
+		cfg.LogFiles, cfg.LogFile = []string{config.Stdin}, config.Stdin
+		args = args[1:]
+	}
+
+	// One-shot subcommands (export/import/backfill) exit without starting the service
+	if handled, err := runCommand(cfg, args); handled {
+		if err != nil {
+			log.Fatalf("%s failed: %v", args[0], err)
+		}
+		return
+	}
+
+	// Open database
+	database, err := db.OpenWithOptions(cfg.DBPath, db.Options{
+		ReadOnlyIfNewer: cfg.NewerSchema == "readonly",
+		SeparateState:   cfg.StateDBPath != "",
+	})
+	if errors.Is(err, db.ErrNewerSchema) {
+		log.Fatalf("Failed to open database: %v. Upgrade trail, or set TRAIL_NEWER_SCHEMA=readonly to serve it without ingesting", err)
+	}
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	// A database from a newer trail is only shown, never written to
+	if db.IsReadOnly(database) {
+		log.Printf("Warning: %s was written by a newer trail; serving it read-only, logs are not ingested", cfg.DBPath)
+		serveReadOnly(cfg, database)
+		return
+	}
+
+	// Positions and metadata live in the data DB unless TRAIL_STATE_DB is set
+	stateDB := database
+	if cfg.StateDBPath != "" {
+		stateDB, err = db.OpenState(cfg.StateDBPath)
+		if err != nil {
+			log.Fatalf("Failed to open state database: %v", err)
+		}
+		defer stateDB.Close()
+		log.Printf("Using state database %s", cfg.StateDBPath)
+	}
+
+	// Standard input is read as a stream; the rest are files to tail and
+	// backfill. Only a file can be sampled for format detection.
+	logFiles := slices.DeleteFunc(slices.Clone(cfg.LogFiles), func(f string) bool { return f == config.Stdin })
+	readStdin := len(logFiles) < len(cfg.LogFiles)
+	sampleFile := cfg.LogFile
+	if sampleFile == config.Stdin {
+		sampleFile = ""
+	}
+
+	// Create parser with configured format
+	p := parser.NewParser(cfg.LogFormat)
+	p.SetDurationUnit(parser.DurationUnit(cfg.DurationUnit))
+
+	// A custom Traefik field layout replaces format detection
+	if cfg.TraefikTemplate != "" {
+		tmpl, err := parser.CompileTemplate(cfg.TraefikTemplate)
+		if err != nil {
+			log.Fatalf("Invalid TRAIL_TRAEFIK_TEMPLATE: %v", err)
+		}
+		if err := tmpl.SetBytesField(cfg.BytesField); err != nil {
+			log.Fatalf("Invalid TRAIL_BYTES_FIELD: %v", err)
+		}
+		p.SetTemplate(tmpl)
+		if lines, err := readFirstLines(sampleFile, 10); err == nil && len(lines) > 0 {
+			if n := tmpl.Matches(lines); n < len(lines) {
+				log.Printf("Warning: TRAIL_TRAEFIK_TEMPLATE matches %d of the first %d log lines", n, len(lines))
+			} else {
+				log.Printf("Using custom Traefik field template")
+			}
+		}
+	}
+
+	// Auto-detect format from first 10 lines of the log file
+	if p.Format() == parser.FormatAuto {
+		if lines, err := readFirstLines(sampleFile, 10); err == nil && len(lines) > 0 {
+			log.Printf("Auto-detected log format: %s", p.Detect(lines))
+		}
+	}
+
+	// Fail early on an active log the tailer can't follow
+	for _, path := range logFiles {
+		if err := tailer.CheckFile(path); err != nil {
+			log.Fatalf("Unsupported log file: %v", err)
+		}
+	}
+
+	// One set of aggregator options for the live aggregator and backfill
+	aggOpts, err := aggregatorOptions(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	aggOpts.StateDB = stateDB
+
+	// Import rotated log files: before starting live tail, or with
+	// TRAIL_BACKFILL_ASYNC in the background once the server is up
+	progress := &backfill.Progress{}
+	runBackfill := func(ctx context.Context) {
+		if err := backfill.RunFiles(ctx, database, logFiles, p, backfill.Options{
+			StateDB:    stateDB,
+			Pattern:    cfg.RotationPattern,
+			MaxFiles:   cfg.BackfillMax,
+			Progress:   progress,
+			Aggregator: aggOpts,
+		}); err != nil && err != context.Canceled {
+			log.Printf("Backfill failed: %v", err)
+		}
+	}
+	if !cfg.BackfillAsync {
+		runBackfill(context.Background())
+	}
+
+	// Bind the syslog listener before anything is written, so a busy port
+	// fails startup
+	var syslogSrv *syslog.Server
+	if cfg.SyslogListen != "" {
+		if syslogSrv, err = syslog.Listen(cfg.SyslogListen); err != nil {
+			log.Fatalf("Invalid TRAIL_SYSLOG_LISTEN: %v", err)
+		}
+	}
+
+	// Create components: a tailer and lines channel (buffered, capacity
+	// 10000) per log file and one each for stdin and syslog, all feeding
+	// one aggregator
+	tails := make(tailer.Group, len(logFiles))
+	lines := make([]chan string, len(logFiles))
+	sources := make(map[string]<-chan string, len(cfg.LogFiles)+1)
+	for i, path := range logFiles {
+		tails[i] = tailer.New(path, stateDB)
+		tails[i].SetPollOnly(cfg.TailMode == "poll")
+		lines[i] = make(chan string, 10000)
+		sources[path] = lines[i]
+	}
+	var stdin *tailer.Stream
+	var stdinLines chan string
+	if readStdin {
+		stdin = tailer.NewStream("stdin", os.Stdin)
+		stdinLines = make(chan string, 10000)
+		sources["stdin"] = stdinLines
+	}
+	var syslogLines chan string
+	if syslogSrv != nil {
+		syslogLines = make(chan string, 10000)
+		sources["syslog"] = syslogLines
+	}
+	pushLines := make(chan string, 10000)
+	if cfg.IngestToken != "" {
+		sources["POST /api/ingest"] = pushLines
+	}
+	agg := aggregator.NewWithOptions(database, p, aggOpts)
+	cleaner := retention.New(database, cfg.RetentionDays)
+	cleaner.SetHourlyCaps(cfg.MaxPaths, cfg.MaxReferrers)
+	cleaner.SetRouterRetention(cfg.RouterRetention)
+	cleaner.SetDeleteGuard(cfg.RetentionMaxDeletePct, cfg.LargeDelete)
+	if cfg.FineBucketMinutes > 0 {
+		cleaner.SetFineRetention(time.Duration(cfg.FineRetentionHours) * time.Hour)
+	}
+	srv, err := server.New(cfg, database, trail.TemplatesFS, trail.StaticFS)
+	if err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+	srv.SetFlusher(agg)
+	var ingest pausers
+	if len(tails) > 0 {
+		ingest = append(ingest, tails)
+	}
+	if stdin != nil {
+		ingest = append(ingest, stdin)
+	}
+	if syslogSrv != nil {
+		ingest = append(ingest, syslogSrv)
+	}
+	if cfg.IngestToken != "" {
+		ingest = append(ingest, &pauseFlag{})
+	}
+	srv.SetPauser(ingest)
+	srv.SetParser(p)
+	srv.SetBackfillProgress(progress)
+	srv.SetIngestLines(pushLines)
+
+	// Create root context with cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Setup shutdown signal handler
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	// Start goroutines for background services
+	for i, tail := range tails {
+		go func() {
+			if err := tail.Run(ctx, lines[i]); err != nil {
+				if err != context.Canceled {
+					log.Printf("Tailer error: %v", err)
+				}
+			}
+		}()
+	}
+
+	// At the end of piped input the aggregator flushes what it read and,
+	// without other sources, stops; the dashboard stays up to look at it
+	if stdin != nil {
+		go func() {
+			if err := stdin.Run(ctx, stdinLines); err != nil {
+				if err != context.Canceled {
+					log.Printf("Stdin error: %v", err)
+				}
+			}
+		}()
+	}
+
+	if syslogSrv != nil {
+		go func() {
+			if err := syslogSrv.Run(ctx, syslogLines); err != nil {
+				if err != context.Canceled {
+					log.Printf("Syslog listener error: %v", err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		if err := agg.RunSources(ctx, sources); err != nil {
+			if err != context.Canceled {
+				log.Printf("Aggregator error: %v", err)
+			}
+		}
+	}()
+
+	if aggOpts.ThreatList != nil {
+		go aggOpts.ThreatList.Watch(ctx)
+	}
+
+	go func() {
+		if err := cleaner.Run(ctx); err != nil {
+			if err != context.Canceled {
+				log.Printf("Retention cleaner error: %v", err)
+			}
+		}
+	}()
+
+	// Start server in goroutine (since it blocks)
+	serverErrors := make(chan error, 1)
+	go func() {
+		log.Printf("Trail starting - listening on %s, watching %s", cfg.Listen, describeInputs(cfg))
+		if err := srv.Start(); err != nil {
+			serverErrors <- err
+		}
+	}()
+
+	// The live aggregator has loaded (or created) the IP salt by now, so
+	// the backfill's aggregator hashes visitors with the same one
+	if cfg.BackfillAsync {
+		go runBackfill(ctx)
+	}
+
+	// Wait for shutdown signal or server error
+	select {
+	case <-sigCh:
+		log.Println("Shutting down...")
+	case err := <-serverErrors:
+		log.Fatalf("Server failed to start: %v", err)
+	}
+
+	// Cancel context to stop all goroutines
+	cancel()
+
+	// Shutdown server with timeout
+	if err := srv.Shutdown(); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	// Give goroutines a moment to finish cleanup
+	time.Sleep(100 * time.Millisecond)
+
+	log.Println("Shutdown complete")
+}
+
+// serveReadOnly runs just the dashboard over database, without tailing,
+// aggregation, retention or backfill, until SIGINT or SIGTERM
+func serveReadOnly(cfg *config.Config, database *sql.DB) {
+	srv, err := server.New(cfg, database, trail.TemplatesFS, trail.StaticFS)
+	if err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		log.Printf("Trail starting read-only - listening on %s", cfg.Listen)
+		if err := srv.Start(); err != nil {
+			serverErrors <- err
+		}
+	}()
+
+	select {
+	case <-sigCh:
+		log.Println("Shutting down...")
+	case err := <-serverErrors:
+		log.Fatalf("Server failed to start: %v", err)
+	}
+	if err := srv.Shutdown(); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+}
+
+// aggregatorOptions builds the aggregator options from cfg, shared by the
+// live aggregator and backfill so both count lines the same way. StateDB is
+// left for the caller.
+func aggregatorOptions(cfg *config.Config) (aggregator.Options, error) {
+	pathRules, err := aggregator.ParsePathRules(cfg.PathRules)
+	if err != nil {
+		return aggregator.Options{}, fmt.Errorf("invalid TRAIL_PATH_RULES: %w", err)
+	}
+
+	// Load the known-bad IP list before the aggregator starts tagging
+	var threats *aggregator.ThreatList
+	if cfg.ThreatIPsFile != "" {
+		if threats, err = aggregator.LoadThreatList(cfg.ThreatIPsFile); err != nil {
+			return aggregator.Options{}, fmt.Errorf("failed to load TRAIL_THREAT_IPS_FILE: %w", err)
+		}
+		log.Printf("Loaded threat list %s: %d entries", cfg.ThreatIPsFile, threats.Len())
+	}
+
+	var rawRequests int
+	if cfg.StoreRaw {
+		rawRequests = cfg.RawMaxRows
+	}
+	return aggregator.Options{
+		GeoIPPath:       cfg.GeoIPPath,
+		GeoCacheSize:    cfg.GeoIPCacheSize,
+		UnknownCountry:  cfg.GeoIPUnknown,
+		UACacheSize:     cfg.UACacheSize,
+		MaxPaths:        cfg.MaxPaths,
+		MaxReferrers:    cfg.MaxReferrers,
+		DedupWindow:     cfg.DedupWindow,
+		MaxBufferedKeys: cfg.FlushMaxKeys,
+		CaptureParams:   cfg.CaptureParams,
+		UnroutedIsReal:  cfg.UnroutedIsReal,
+		FineBucket:      time.Duration(cfg.FineBucketMinutes) * time.Minute,
+		ReferrerPaths:   cfg.ReferrerDetail == "path",
+		MergeWWW:        cfg.MergeWWW,
+		RequestIDs:      cfg.RequestIDs,
+		RawRequests:     rawRequests,
+		RawUserAgents:   cfg.RawUserAgents,
+		RateLimitIPs:    cfg.RateLimitIPs,
+		ScannerPaths:    cfg.ScannerPaths,
+		AuthPaths:       cfg.AuthPaths,
+		GoalPath:        cfg.GoalPath,
+		DurationSamples: cfg.DurationSamples,
+		ThreatList:      threats,
+		NormalizeIDs:    cfg.NormalizeIDs,
+		PathRules:       pathRules,
+		ExcludePaths:    cfg.ExcludePaths,
+		IncludePaths:    cfg.IncludePaths,
+	}, nil
+}
+
+// describeInputs says where log lines come from, for the startup message
+func describeInputs(cfg *config.Config) string {
+	var names []string
+	for _, f := range cfg.LogFiles {
+		if f == config.Stdin {
+			f = "stdin"
+		}
+		names = append(names, f)
+	}
+	if cfg.SyslogListen != "" {
+		names = append(names, "syslog "+cfg.SyslogListen)
+	}
+	if cfg.IngestToken != "" {
+		names = append(names, "POST /api/ingest")
+	}
+	return strings.Join(names, ", ")
+}
+
+// pausers pauses and resumes several log inputs together
+type pausers []server.Pauser
+
+// Pause pauses every input
+func (ps pausers) Pause() {
+	for _, p := range ps {
+		p.Pause()
+	}
+}
+
+// Resume resumes every input
+func (ps pausers) Resume() {
+	for _, p := range ps {
+		p.Resume()
+	}
+}
+
+// Paused reports whether every input is paused
+func (ps pausers) Paused() bool {
+	for _, p := range ps {
+		if !p.Paused() {
+			return false
+		}
+	}
+	return true
+}
+
+// pauseFlag is the paused state of pushes to /api/ingest, which are turned
+// away while paused rather than stopped at the source
+type pauseFlag struct{ paused atomic.Bool }
+
+// Pause sets the flag
+func (f *pauseFlag) Pause() { f.paused.Store(true) }
+
+// Resume clears the flag
+func (f *pauseFlag) Resume() { f.paused.Store(false) }
+
+// Paused reports the flag
+func (f *pauseFlag) Paused() bool { return f.paused.Load() }
+
+// readFirstLines reads up to n non-empty lines from a file.
+func readFirstLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && len(lines) < n {
+		line := scanner.Text()
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/open-wander/trail/internal/backfill"
+	"github.com/open-wander/trail/internal/config"
+	"github.com/open-wander/trail/internal/db"
+	"github.com/open-wander/trail/internal/export"
+	"github.com/open-wander/trail/internal/parser"
+)
+
+// runCommand handles one-shot subcommands. It returns false when args name
+// no subcommand, in which case the caller starts the normal service.
+func runCommand(cfg *config.Config, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "export":
+		// trail export [file]  (default stdout)
+		database, err := db.OpenWithOptions(cfg.DBPath, db.Options{SeparateState: cfg.StateDBPath != ""})
+		if err != nil {
+			return true, fmt.Errorf("open database: %w", err)
+		}
+		defer database.Close()
+
+		out := os.Stdout
+		if len(args) > 1 {
+			f, err := os.Create(args[1])
+			if err != nil {
+				return true, err
+			}
+			defer f.Close()
+			out = f
+		}
+		w := bufio.NewWriter(out)
+		if err := export.Dump(context.Background(), database, w); err != nil {
+			return true, err
+		}
+		return true, w.Flush()
+
+	case "import":
+		// trail import <file>
+		if len(args) < 2 {
+			return true, fmt.Errorf("usage: trail import <file.jsonl>")
+		}
+		database, err := db.OpenWithOptions(cfg.DBPath, db.Options{SeparateState: cfg.StateDBPath != ""})
+		if err != nil {
+			return true, fmt.Errorf("open database: %w", err)
+		}
+		defer database.Close()
+
+		f, err := os.Open(args[1])
+		if err != nil {
+			return true, err
+		}
+		defer f.Close()
+
+		n, err := export.Load(context.Background(), database, f)
+		if err != nil {
+			return true, fmt.Errorf("import %s: %w", args[1], err)
+		}
+		fmt.Fprintf(os.Stderr, "imported %d rows from %s into %s\n", n, args[1], cfg.DBPath)
+		return true, nil
+
+	case "backfill":
+		// trail backfill <dir>  (e.g. ALB logs synced from S3)
+		if len(args) < 2 {
+			return true, fmt.Errorf("usage: trail backfill <dir>")
+		}
+		database, err := db.OpenWithOptions(cfg.DBPath, db.Options{SeparateState: cfg.StateDBPath != ""})
+		if err != nil {
+			return true, fmt.Errorf("open database: %w", err)
+		}
+		defer database.Close()
+
+		stateDB := database
+		if cfg.StateDBPath != "" {
+			if stateDB, err = db.OpenState(cfg.StateDBPath); err != nil {
+				return true, fmt.Errorf("open state database: %w", err)
+			}
+			defer stateDB.Close()
+		}
+
+		aggOpts, err := aggregatorOptions(cfg)
+		if err != nil {
+			return true, err
+		}
+		p := parser.NewParser(cfg.LogFormat)
+		p.SetDurationUnit(parser.DurationUnit(cfg.DurationUnit))
+		return true, backfill.RunDir(context.Background(), database, args[1], p, backfill.Options{
+			StateDB:    stateDB,
+			MaxFiles:   cfg.BackfillMax,
+			Aggregator: aggOpts,
+		})
+	}
+
+	return false, nil
+}
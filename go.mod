@@ -6,6 +6,7 @@ require (
 	github.com/gofiber/fiber/v2 v2.52.11
 	github.com/oschwald/geoip2-golang/v2 v2.1.0
 	golang.org/x/crypto v0.47.0
+	golang.org/x/sys v0.40.0
 	modernc.org/sqlite v1.44.3
 )
 
@@ -25,7 +26,6 @@ require (
 	github.com/valyala/fasthttp v1.51.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
-	golang.org/x/sys v0.40.0 // indirect
 	modernc.org/libc v1.67.6 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -7,12 +7,18 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"log"
+	"maps"
+	"net"
 	"net/netip"
 	"net/url"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/open-wander/trail/internal/bot"
+	traildb "github.com/open-wander/trail/internal/db"
+	"github.com/open-wander/trail/internal/metrics"
 	"github.com/open-wander/trail/internal/parser"
 	"github.com/oschwald/geoip2-golang/v2"
 )
@@ -20,31 +26,148 @@ import (
 const (
 	defaultFlushInterval = 10 * time.Second
 	bufferSizeThreshold  = 1000
+
+	// DefaultMaxPaths caps distinct request keys held between flushes
+	DefaultMaxPaths = 10000
+	// DefaultMaxReferrers caps distinct referrer keys held between flushes
+	DefaultMaxReferrers = 2000
+	// DefaultMaxParamValues caps distinct captured query-param values held between flushes
+	DefaultMaxParamValues = 2000
+	// maxParamValueLen truncates captured query-param names and values
+	maxParamValueLen = 200
+	// AllParams in Options.CaptureParams counts the names of every
+	// query-string param, without their values
+	AllParams = "*"
+	// maxRawUserAgentLen truncates stored raw User-Agent strings
+	maxRawUserAgentLen = 500
+	// maxHostLen drops requested hosts longer than a DNS name can be
+	maxHostLen = 253
+	// maxCacheStatusLen drops cache status values too long to be one
+	maxCacheStatusLen = 32
+	// parseWarnLimit caps unparseable-line warnings per parseWarnWindow;
+	// further failures in the window are only counted
+	parseWarnLimit  = 5
+	parseWarnWindow = time.Minute
+	// parseSnippetLen truncates the offending line in parse warnings
+	parseSnippetLen = 200
+	// DefaultMaxBufferedKeys triggers an early flush once this many distinct
+	// keys are buffered across all maps
+	DefaultMaxBufferedKeys = 50000
 )
 
+// MaxErrorRequests caps the error_requests table (and the per-flush buffer
+// feeding it) to the newest rows
+const MaxErrorRequests = 1000
+
+// OtherKey is the bucket that absorbs paths and referrers once a cap is hit
+const OtherKey = "(other)"
+
+// UnknownCountry is the country recorded for IPs GeoIP can't place (private
+// ranges, unlisted addresses) when Options.UnknownCountry is set
+const UnknownCountry = "Unknown"
+
+// Options configures an Aggregator. Zero values fall back to defaults.
+type Options struct {
+	GeoIPPath       string        // optional GeoIP mmdb path; empty disables country lookup
+	GeoCacheSize    int           // IPs whose country is cached between lookups
+	UnknownCountry  bool          // count failed GeoIP lookups as UnknownCountry instead of dropping them
+	UACacheSize     int           // User-Agents whose classification is cached
+	StateDB         *sql.DB       // database holding the meta table (IP salt); nil means db
+	MaxPaths        int           // cap on distinct request keys per flush window
+	MaxReferrers    int           // cap on distinct referrer keys per flush window
+	DedupWindow     int           // drop lines identical to one of the last N lines; 0 disables
+	MaxBufferedKeys int           // flush once this many distinct keys are buffered across all maps
+	CaptureParams   []string      // query-string params whose values are counted for human traffic, e.g. "q"; AllParams counts every param's name
+	MaxParamValues  int           // cap on distinct param values per flush window
+	Source          string        // where lines come from (e.g. the log path), used in warnings
+	UnroutedIsReal  bool          // count visitors for unrouted human traffic too
+	ReferrerPaths   bool          // store referrers as host+path instead of host only
+	MergeWWW        bool          // store www.example.com referrers and hosts as example.com
+	RequestIDs      bool          // keep the request IDs of 5xx responses in error_requests
+	RawRequests     int           // keep the newest this many requests one by one in requests_raw; 0 disables
+	RawUserAgents   bool          // also count full User-Agent strings in raw_user_agents
+	ThreatList      *ThreatList   // known-bad IPs whose requests are counted in threat_requests; nil disables
+	RateLimitIPs    bool          // count 429 responses per client IP in rate_limited
+	ScannerPaths    bool          // record the paths each client requests without a router in scanner_paths
+	AuthPaths       []string      // path globs whose 401/403 responses are counted per client IP in auth_failures; empty disables
+	GoalPath        string        // record each visitor-hour's entry and whether it reached this path in visitor_entries; empty disables
+	DurationSamples int           // keep a random sample of this many durations per hour and router in duration_samples; 0 disables
+	FineBucket      time.Duration // also count requests per bucket of this width in requests_fine; 0 disables
+	NormalizeIDs    bool          // count numeric, UUID and hex digest path segments as :id, :uuid and :hash
+	PathRules       []PathRule    // regex rewrites applied to paths, after NormalizeIDs
+	ExcludePaths    []string      // path globs left out of all counts, e.g. "/api/*"
+	IncludePaths    []string      // path globs counted even when they match ExcludePaths
+}
+
 // Aggregator batches log entries in memory and periodically flushes to SQLite
 type Aggregator struct {
 	db            *sql.DB
 	parser        *parser.Parser
 	flushInterval time.Duration
 	ipSalt        string
-	geoReader     *geoip2.Reader
-
-	mu            sync.Mutex
-	requests      map[requestKey]*requestVal
-	visitors      map[visitorKey]struct{}
-	referrers     map[referrerKey]int
-	userAgents    map[userAgentKey]int
-	countries     map[countryKey]int
-	browsers      map[browserKey]int
-	osStats       map[osKey]int
-	durationHist  map[durationHistKey]int
-	bufferSize    int
+	geo           *lruCache[string] // IP -> country; nil when GeoIP is disabled
+	uaClasses     *lruCache[bot.UAClass]
+	unknownGeo    bool // see Options.UnknownCountry
+	maxPaths      int
+	maxReferrers  int
+	maxKeys       int
+	captureParams map[string]bool
+	maxParams     int
+	dedup         *lineDeduper    // nil unless Options.DedupWindow > 0
+	paths         *pathFilter     // nil unless Options.ExcludePaths
+	normalizer    *pathNormalizer // nil unless Options.NormalizeIDs or PathRules
+	source        string
+	unroutedReal  bool
+	fineBucket    time.Duration
+	referrerPaths bool
+	mergeWWW      bool
+	requestIDs    bool
+	rawMax        int         // see Options.RawRequests
+	threats       *ThreatList // nil unless Options.ThreatList
+	sampleSize    int         // see Options.DurationSamples
+	goalPath      string      // see Options.GoalPath
+	authPaths     []string    // see Options.AuthPaths
+
+	// Parse warning rate limiting; only touched by the Run goroutine
+	parseWarnStart  time.Time
+	parseWarned     int
+	parseSuppressed map[string]int // suppressed warnings by source
+
+	mu           sync.Mutex
+	requests     map[requestKey]*requestVal
+	fine         map[requestKey]*requestVal // Hour holds the fine bucket; nil unless fineBucket > 0
+	visitors     map[visitorKey]struct{}
+	entries      map[visitorKey]*visitorEntry // nil unless Options.GoalPath
+	referrers    map[referrerKey]int
+	userAgents   map[userAgentKey]int
+	rawUAs       map[rawUserAgentKey]int // nil unless Options.RawUserAgents
+	rateLimited  map[rateLimitKey]int    // nil unless Options.RateLimitIPs
+	scannerPaths map[threatKey]int       // nil unless Options.ScannerPaths
+	authFailures map[threatKey]int       // nil unless Options.AuthPaths
+	countries    map[countryKey]int
+	hosts        map[hostKey]int
+	cacheStatus  map[cacheStatusKey]int
+	threatHits   map[threatKey]int
+	pathClasses  map[pathCategoryKey]int
+	browsers     map[browserKey]int
+	osStats      map[osKey]int
+	durationHist map[durationHistKey]int
+	durSamples   map[durationSampleKey]*reservoir // nil unless sampleSize > 0
+	upstream     map[upstreamKey]*upstreamVal
+	sizeHist     map[sizeHistKey]int
+	queryParams  map[queryParamKey]int
+	errRequests  []errorRequest // newest last, at most MaxErrorRequests
+	rawRequests  []rawRequest   // newest last, at most rawMax
+	bufferSize   int
+	distinctKeys int
+	dupes        int       // lines dropped by dedup since the last flush
+	lastFlush    time.Time // when entries were last written to the database
 }
 
 type requestKey struct {
 	Hour   string
 	Router string
+	Host   string
 	Path   string
 	Method string
 	Status int
@@ -56,6 +179,18 @@ type requestVal struct {
 	Duration int64
 }
 
+// upstreamKey sums lines that logged both a total and an upstream time
+type upstreamKey struct {
+	Hour   string
+	Router string
+}
+
+type upstreamVal struct {
+	Count    int
+	Duration int64 // total ms
+	Upstream int64 // backend ms
+}
+
 type visitorKey struct {
 	Hour   string
 	Router string
@@ -80,6 +215,61 @@ type countryKey struct {
 	Country string
 }
 
+type rawUserAgentKey struct {
+	Hour      string
+	Router    string
+	UserAgent string
+}
+
+type hostKey struct {
+	Hour   string
+	Router string
+	Host   string
+}
+
+type cacheStatusKey struct {
+	Hour   string
+	Router string
+	Status string
+}
+
+// visitorEntry is how a visitor-hour started, and whether it reached the
+// goal path
+type visitorEntry struct {
+	Referrer string // first referrer label; "" for none, InternalReferrer for the site itself
+	Path     string // first path, without query string
+	Goal     bool
+}
+
+// InternalReferrer marks a visitor-hour whose first request was referred by
+// the requested host itself, i.e. it continued a visit from an earlier hour
+const InternalReferrer = "(internal)"
+
+// threatKey counts a client's requests to a path, for threat_requests,
+// scanner_paths and auth_failures
+type threatKey struct {
+	Hour   string
+	Router string
+	IPHash string
+	Path   string
+}
+
+// rateLimitKey counts a client's 429 responses
+type rateLimitKey struct {
+	Hour   string
+	Router string
+	IPHash string
+}
+
+// pathCategoryKey counts a path's routed requests by bot.Category (human
+// or bot), for spotting paths only bots request
+type pathCategoryKey struct {
+	Hour     string
+	Router   string
+	Path     string
+	Category string
+}
+
 type browserKey struct {
 	Hour    string
 	Router  string
@@ -98,51 +288,263 @@ type durationHistKey struct {
 	Bucket string
 }
 
+type sizeHistKey struct {
+	Hour   string
+	Router string
+	Bucket string
+}
+
+// errorRequest is one 5xx response with a proxy-assigned request ID
+type errorRequest struct {
+	Hour      string
+	Timestamp string
+	Router    string
+	Path      string
+	Method    string
+	Status    int
+	RequestID string
+}
+
+// rawRequest is one request as kept in requests_raw
+type rawRequest struct {
+	Hour      string
+	Timestamp string
+	Router    string
+	Host      string
+	Path      string
+	Method    string
+	Status    int
+	Bytes     int64
+	Duration  int
+	IPHash    string
+	Country   string
+	Referrer  string
+	UserAgent string
+}
+
+type queryParamKey struct {
+	Hour   string
+	Router string
+	Param  string
+	Value  string
+}
+
 // New creates a new Aggregator with a 10-second flush interval.
 // If p is nil, defaults to a Traefik parser.
 // geoDBPath is optional; if empty or the file can't be opened, GeoIP lookup is disabled.
 func New(db *sql.DB, p *parser.Parser, geoDBPath string) *Aggregator {
+	return NewWithOptions(db, p, Options{GeoIPPath: geoDBPath})
+}
+
+// NewWithOptions creates a new Aggregator like New, with explicit options.
+func NewWithOptions(db *sql.DB, p *parser.Parser, opts Options) *Aggregator {
 	if p == nil {
 		p = parser.NewParser("traefik")
 	}
+	if opts.MaxPaths <= 0 {
+		opts.MaxPaths = DefaultMaxPaths
+	}
+	if opts.MaxReferrers <= 0 {
+		opts.MaxReferrers = DefaultMaxReferrers
+	}
+	if opts.MaxBufferedKeys <= 0 {
+		opts.MaxBufferedKeys = DefaultMaxBufferedKeys
+	}
+	if opts.MaxParamValues <= 0 {
+		opts.MaxParamValues = DefaultMaxParamValues
+	}
+	if opts.GeoCacheSize <= 0 {
+		opts.GeoCacheSize = DefaultGeoCacheSize
+	}
+	if opts.UACacheSize <= 0 {
+		opts.UACacheSize = DefaultUACacheSize
+	}
+	var captureParams map[string]bool
+	if len(opts.CaptureParams) > 0 {
+		captureParams = make(map[string]bool, len(opts.CaptureParams))
+		for _, name := range opts.CaptureParams {
+			captureParams[name] = true
+		}
+	}
+	geoDBPath := opts.GeoIPPath
 
-	// Generate random salt for IP hashing
-	saltBytes := make([]byte, 16)
-	if _, err := rand.Read(saltBytes); err != nil {
-		log.Printf("warning: failed to generate salt, using empty: %v", err)
+	stateDB := opts.StateDB
+	if stateDB == nil {
+		stateDB = db
 	}
-	salt := hex.EncodeToString(saltBytes)
+	salt := loadOrCreateSalt(stateDB)
 
-	var geoReader *geoip2.Reader
+	var geo *lruCache[string]
 	if geoDBPath != "" {
-		var err error
-		geoReader, err = geoip2.Open(geoDBPath)
+		geoReader, err := geoip2.Open(geoDBPath)
 		if err != nil {
 			log.Printf("warning: failed to open GeoIP database at %s: %v (country lookup disabled)", geoDBPath, err)
 		} else {
 			log.Printf("GeoIP database loaded: %s", geoDBPath)
+			geo = newLRUCache(opts.GeoCacheSize, func(ip string) string {
+				return lookupCountry(geoReader, ip)
+			})
 		}
 	}
 
+	var dedup *lineDeduper
+	if opts.DedupWindow > 0 {
+		dedup = newLineDeduper(opts.DedupWindow)
+	}
+
 	return &Aggregator{
 		db:            db,
 		parser:        p,
 		flushInterval: defaultFlushInterval,
 		ipSalt:        salt,
-		geoReader:     geoReader,
+		geo:           geo,
+		unknownGeo:    opts.UnknownCountry,
+		uaClasses:     newLRUCache(opts.UACacheSize, bot.ClassifyAll),
+		maxPaths:      opts.MaxPaths,
+		maxReferrers:  opts.MaxReferrers,
+		maxKeys:       opts.MaxBufferedKeys,
+		captureParams: captureParams,
+		maxParams:     opts.MaxParamValues,
+		dedup:         dedup,
+		paths:         newPathFilter(opts.ExcludePaths, opts.IncludePaths),
+		normalizer:    newPathNormalizer(opts.NormalizeIDs, opts.PathRules),
+		source:        opts.Source,
+		unroutedReal:  opts.UnroutedIsReal,
+		fineBucket:    opts.FineBucket,
+		referrerPaths: opts.ReferrerPaths,
+		mergeWWW:      opts.MergeWWW,
+		requestIDs:    opts.RequestIDs,
+		rawMax:        max(opts.RawRequests, 0),
+		threats:       opts.ThreatList,
+		sampleSize:    min(opts.DurationSamples, MaxDurationSamples),
+		goalPath:      opts.GoalPath,
+		authPaths:     opts.AuthPaths,
+		entries:       newEntryMap(opts.GoalPath),
+		fine:          newFineMap(opts.FineBucket),
 		requests:      make(map[requestKey]*requestVal),
 		visitors:      make(map[visitorKey]struct{}),
 		referrers:     make(map[referrerKey]int),
 		userAgents:    make(map[userAgentKey]int),
+		rawUAs:        newRawUAMap(opts.RawUserAgents),
+		rateLimited:   newRateLimitMap(opts.RateLimitIPs),
+		scannerPaths:  newScannerPathMap(opts.ScannerPaths),
+		authFailures:  newScannerPathMap(len(opts.AuthPaths) > 0),
 		countries:     make(map[countryKey]int),
+		hosts:         make(map[hostKey]int),
+		cacheStatus:   make(map[cacheStatusKey]int),
+		threatHits:    make(map[threatKey]int),
+		pathClasses:   make(map[pathCategoryKey]int),
 		browsers:      make(map[browserKey]int),
 		osStats:       make(map[osKey]int),
 		durationHist:  make(map[durationHistKey]int),
+		durSamples:    newSampleMap(opts.DurationSamples),
+		upstream:      make(map[upstreamKey]*upstreamVal),
+		sizeHist:      make(map[sizeHistKey]int),
+		queryParams:   make(map[queryParamKey]int),
 	}
 }
 
+// newFineMap returns the buffer for requests_fine, or nil when fine buckets
+// are disabled
+func newFineMap(bucket time.Duration) map[requestKey]*requestVal {
+	if bucket <= 0 {
+		return nil
+	}
+	return make(map[requestKey]*requestVal)
+}
+
+// newRawUAMap returns the buffer for raw_user_agents, or nil when raw
+// User-Agents aren't stored
+func newRawUAMap(enabled bool) map[rawUserAgentKey]int {
+	if !enabled {
+		return nil
+	}
+	return make(map[rawUserAgentKey]int)
+}
+
+// newRateLimitMap returns the buffer for rate_limited, or nil when 429s
+// aren't counted per IP
+func newRateLimitMap(enabled bool) map[rateLimitKey]int {
+	if !enabled {
+		return nil
+	}
+	return make(map[rateLimitKey]int)
+}
+
+// newScannerPathMap returns the buffer for scanner_paths or auth_failures,
+// or nil when they aren't recorded
+func newScannerPathMap(enabled bool) map[threatKey]int {
+	if !enabled {
+		return nil
+	}
+	return make(map[threatKey]int)
+}
+
+// newEntryMap returns the buffer for visitor_entries, or nil without a
+// goal path
+func newEntryMap(goalPath string) map[visitorKey]*visitorEntry {
+	if goalPath == "" {
+		return nil
+	}
+	return make(map[visitorKey]*visitorEntry)
+}
+
+// newSampleMap returns the buffer for duration_samples, or nil when
+// durations aren't sampled
+func newSampleMap(size int) map[durationSampleKey]*reservoir {
+	if size <= 0 {
+		return nil
+	}
+	return make(map[durationSampleKey]*reservoir)
+}
+
+// sourcedLine is a log line and the source it was read from
+type sourcedLine struct {
+	source string
+	text   string
+}
+
 // Run processes log lines from the channel, accumulating in memory and flushing periodically
 func (a *Aggregator) Run(ctx context.Context, lines <-chan string) error {
+	return a.RunSources(ctx, map[string]<-chan string{a.source: lines})
+}
+
+// RunSources is Run over several channels, one per source (e.g. one per
+// tailed log file), keyed by the source named in warnings about its
+// lines. It returns once every channel is closed or ctx is cancelled.
+func (a *Aggregator) RunSources(ctx context.Context, sources map[string]<-chan string) error {
+	lines := make(chan sourcedLine)
+	var wg sync.WaitGroup
+	for source, ch := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case text, ok := <-ch:
+					if !ok {
+						return
+					}
+					select {
+					case lines <- sourcedLine{source: source, text: text}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	return a.run(ctx, lines)
+}
+
+// run is the loop behind RunSources
+func (a *Aggregator) run(ctx context.Context, lines <-chan sourcedLine) error {
 	ticker := time.NewTicker(a.flushInterval)
 	defer ticker.Stop()
 
@@ -162,7 +564,7 @@ func (a *Aggregator) Run(ctx context.Context, lines <-chan string) error {
 				return err
 			}
 
-		case line, ok := <-lines:
+		case sl, ok := <-lines:
 			if !ok {
 				// Channel closed, flush and return
 				if err := a.flush(ctx); err != nil {
@@ -172,22 +574,33 @@ func (a *Aggregator) Run(ctx context.Context, lines <-chan string) error {
 				return nil
 			}
 
+			line := sl.text
+			if a.dedup != nil && a.dedup.Duplicate(line) {
+				a.mu.Lock()
+				a.dupes++
+				a.mu.Unlock()
+				continue
+			}
+
 			// Parse the line
 			entry, err := a.parser.ParseLine(line)
 			if err != nil {
-				log.Printf("warning: skipping unparseable line: %v", err)
+				metrics.Default.Counter("trail_parse_failures_total", "Lines skipped because they didn't parse.", "source", sl.source).Inc()
+				a.warnUnparseable(sl.source, line, err, time.Now())
 				continue
 			}
 
 			// Accumulate in memory
 			a.accumulate(entry)
 
-			// Check if buffer size threshold is reached
+			// Flush early once either the entry count or the number of
+			// distinct keys (high-cardinality floods) crosses its threshold
 			a.mu.Lock()
 			size := a.bufferSize
+			keys := a.distinctKeys
 			a.mu.Unlock()
 
-			if size >= bufferSizeThreshold {
+			if size >= bufferSizeThreshold || keys >= a.maxKeys {
 				if err := a.flush(ctx); err != nil {
 					log.Printf("error during buffer threshold flush: %v", err)
 					return err
@@ -197,8 +610,69 @@ func (a *Aggregator) Run(ctx context.Context, lines <-chan string) error {
 	}
 }
 
-// accumulate adds a log entry to the in-memory buffers
+// warnUnparseable logs a skipped line with a truncated snippet, at most
+// parseWarnLimit times per parseWarnWindow so a whole file in the wrong
+// format doesn't flood the log. Suppressed warnings are summarized per
+// source when the next window opens.
+func (a *Aggregator) warnUnparseable(source, line string, err error, now time.Time) {
+	if now.Sub(a.parseWarnStart) >= parseWarnWindow {
+		for _, src := range slices.Sorted(maps.Keys(a.parseSuppressed)) {
+			log.Printf("warning: %d more unparseable lines%s suppressed in the last %s", a.parseSuppressed[src], sourceSuffix(src), parseWarnWindow)
+		}
+		a.parseWarnStart = now
+		a.parseWarned = 0
+		clear(a.parseSuppressed)
+	}
+	if a.parseWarned >= parseWarnLimit {
+		if a.parseSuppressed == nil {
+			a.parseSuppressed = make(map[string]int)
+		}
+		a.parseSuppressed[source]++
+		return
+	}
+	a.parseWarned++
+
+	snippet := line
+	if len(snippet) > parseSnippetLen {
+		snippet = strings.ToValidUTF8(snippet[:parseSnippetLen], "") + "..."
+	}
+	log.Printf("warning: skipping unparseable line%s: %v: %q", sourceSuffix(source), err, snippet)
+}
+
+// sourceSuffix returns " from <source>" for log messages, or "" when
+// source is empty
+func sourceSuffix(source string) string {
+	if source == "" {
+		return ""
+	}
+	return " from " + source
+}
+
+// accumulate adds a log entry to the in-memory buffers, unless its path is
+// excluded. Exclusions see the path as logged, everything else the
+// normalized one.
 func (a *Aggregator) accumulate(entry *parser.LogEntry) {
+	if a.paths.Excluded(entry.Path) {
+		return
+	}
+	if a.normalizer != nil {
+		normalized := *entry
+		normalized.Path = a.normalizer.Normalize(entry.Path)
+		entry = &normalized
+	}
+
+	// GeoIP and User-Agent lookups stay outside the critical section; the
+	// reader is safe for concurrent reads and the caches have their own locks
+	var country string
+	if a.geo != nil {
+		country = a.geo.Get(entry.IP)
+		if country == "" && a.unknownGeo {
+			country = UnknownCountry
+		}
+	}
+	ua := a.uaClasses.Get(entry.UserAgent)
+	threat := a.threats != nil && a.threats.Contains(entry.IP)
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -211,15 +685,30 @@ func (a *Aggregator) accumulate(entry *parser.LogEntry) {
 	// Get hour bucket
 	hour := parser.HourBucket(entry.Timestamp)
 
+	// Requested host, "" when the format doesn't record one
+	host := hostLabel(entry.Host)
+	if a.mergeWWW {
+		host = stripWWW(host)
+	}
+
 	// Accumulate requests
 	reqKey := requestKey{
 		Hour:   hour,
 		Router: router,
+		Host:   host,
 		Path:   entry.Path,
 		Method: entry.Method,
 		Status: entry.Status,
 	}
 
+	// Once the window holds maxPaths distinct keys, fold new paths and hosts
+	// into OtherKey so a flood of unique URLs or Host headers can't grow the
+	// map without bound
+	if _, exists := a.requests[reqKey]; !exists && len(a.requests) >= a.maxPaths {
+		reqKey.Path = OtherKey
+		reqKey.Host = OtherKey
+	}
+
 	if val, exists := a.requests[reqKey]; exists {
 		val.Count++
 		val.Bytes += entry.Bytes
@@ -232,279 +721,858 @@ func (a *Aggregator) accumulate(entry *parser.LogEntry) {
 		}
 	}
 
+	// Same counters at fine granularity, sharing the request path cap;
+	// requests_fine has no host
+	if a.fine != nil {
+		fineKey := reqKey
+		fineKey.Hour = parser.MinuteBucket(entry.Timestamp, a.fineBucket)
+		fineKey.Host = ""
+		if _, exists := a.fine[fineKey]; !exists && len(a.fine) >= a.maxPaths {
+			fineKey.Path = OtherKey
+		}
+		if val, exists := a.fine[fineKey]; exists {
+			val.Count++
+			val.Bytes += entry.Bytes
+			val.Duration += int64(entry.DurationMs)
+		} else {
+			a.fine[fineKey] = &requestVal{
+				Count:    1,
+				Bytes:    entry.Bytes,
+				Duration: int64(entry.DurationMs),
+			}
+		}
+	}
+
+	// Keep 5xx request IDs for cross-referencing upstream logs
+	if a.requestIDs && entry.Status >= 500 && entry.RequestID != "" {
+		if len(a.errRequests) >= MaxErrorRequests {
+			a.errRequests = a.errRequests[1:]
+		}
+		a.errRequests = append(a.errRequests, errorRequest{
+			Hour:      hour,
+			Timestamp: entry.Timestamp.UTC().Format(time.RFC3339),
+			Router:    router,
+			Path:      entry.Path,
+			Method:    entry.Method,
+			Status:    entry.Status,
+			RequestID: entry.RequestID,
+		})
+	}
+
+	var refLabel string
+	if entry.Referer != "" {
+		refLabel = referrerLabel(entry.Referer, a.referrerPaths)
+		if a.mergeWWW {
+			refLabel = stripWWW(refLabel)
+		}
+	}
+
 	// Accumulate visitors (unique IP per hour per router)
-	// Only count non-bot, routed traffic
-	if bot.Classify(entry) == bot.CategoryHuman {
+	// Only count non-bot, routed traffic (unrouted too with UnroutedIsReal)
+	class := ua.Category(entry.Router != "" || a.unroutedReal)
+	if class == bot.CategoryHuman {
 		visKey := visitorKey{
 			Hour:   hour,
 			Router: router,
 			IPHash: hashIP(entry.IP, a.ipSalt),
 		}
 		a.visitors[visKey] = struct{}{}
+
+		if a.entries != nil {
+			a.accumulateEntry(visKey, entry, refLabel)
+		}
+
+		if a.captureParams != nil {
+			a.accumulateParams(hour, router, entry.Path)
+		}
+	}
+
+	// Split routed requests per path into human and bot, sharing the
+	// request path cap; a path folded into OtherKey above stays folded
+	if class != bot.CategoryUnrouted {
+		pcKey := pathCategoryKey{Hour: hour, Router: router, Path: reqKey.Path, Category: class}
+		if _, exists := a.pathClasses[pcKey]; !exists && len(a.pathClasses) >= a.maxPaths {
+			pcKey.Path = OtherKey
+		}
+		a.pathClasses[pcKey]++
 	}
 
 	// Accumulate referrers
-	if entry.Referer != "" {
-		domain := extractDomain(entry.Referer)
-		if domain != "" {
-			refKey := referrerKey{
-				Hour:     hour,
-				Router:   router,
-				Referrer: domain,
-			}
-			a.referrers[refKey]++
+	if refLabel != "" {
+		refKey := referrerKey{
+			Hour:     hour,
+			Router:   router,
+			Referrer: refLabel,
+		}
+		if _, exists := a.referrers[refKey]; !exists && len(a.referrers) >= a.maxReferrers {
+			refKey.Referrer = OtherKey
 		}
+		a.referrers[refKey]++
 	}
 
-	// Accumulate user agents
-	category := bot.ClassifyUA(entry.UserAgent)
+	// Accumulate user agents (categories are a small fixed set, no cap needed)
 	uaKey := userAgentKey{
 		Hour:     hour,
 		Router:   router,
-		Category: category,
+		Category: ua.Agent,
 	}
 	a.userAgents[uaKey]++
 
+	// Accumulate raw User-Agent strings, sharing the referrer cap
+	if a.rawUAs != nil && entry.UserAgent != "" {
+		rawKey := rawUserAgentKey{Hour: hour, Router: router, UserAgent: entry.UserAgent}
+		if len(rawKey.UserAgent) > maxRawUserAgentLen {
+			rawKey.UserAgent = rawKey.UserAgent[:maxRawUserAgentLen]
+		}
+		if _, exists := a.rawUAs[rawKey]; !exists && len(a.rawUAs) >= a.maxReferrers {
+			rawKey.UserAgent = OtherKey
+		}
+		a.rawUAs[rawKey]++
+	}
+
 	// Accumulate browser breakdown
-	browser := bot.ClassifyBrowser(entry.UserAgent)
 	bKey := browserKey{
 		Hour:    hour,
 		Router:  router,
-		Browser: browser,
+		Browser: ua.Browser,
 	}
 	a.browsers[bKey]++
 
 	// Accumulate OS breakdown
-	osName := bot.ClassifyOS(entry.UserAgent)
 	oKey := osKey{
 		Hour:   hour,
 		Router: router,
-		OS:     osName,
+		OS:     ua.OS,
 	}
 	a.osStats[oKey]++
 
-	// Accumulate duration histogram
-	bucket := durationBucket(entry.DurationMs)
-	dhKey := durationHistKey{
+	// Accumulate duration histogram, only for lines that recorded a duration
+	// so formats without one don't pile everything into the fastest bucket
+	if entry.HasDuration {
+		dhKey := durationHistKey{
+			Hour:   hour,
+			Router: router,
+			Bucket: durationBucket(entry.DurationMs),
+		}
+		a.durationHist[dhKey]++
+
+		if a.durSamples != nil {
+			dsKey := durationSampleKey{Hour: hour, Router: router}
+			r, exists := a.durSamples[dsKey]
+			if !exists {
+				r = &reservoir{}
+				a.durSamples[dsKey] = r
+			}
+			r.add(int64(entry.DurationMs), a.sampleSize)
+		}
+	}
+
+	// Accumulate upstream vs total time where the format records both
+	if entry.HasDuration && entry.HasUpstream {
+		upKey := upstreamKey{Hour: hour, Router: router}
+		val, exists := a.upstream[upKey]
+		if !exists {
+			val = &upstreamVal{}
+			a.upstream[upKey] = val
+		}
+		val.Count++
+		val.Duration += int64(entry.DurationMs)
+		val.Upstream += int64(entry.UpstreamMs)
+	}
+
+	// Accumulate response size histogram
+	shKey := sizeHistKey{
 		Hour:   hour,
 		Router: router,
-		Bucket: bucket,
+		Bucket: sizeBucket(entry.Bytes),
+	}
+	a.sizeHist[shKey]++
+
+	// Accumulate country (looked up above)
+	if country != "" {
+		cKey := countryKey{
+			Hour:    hour,
+			Router:  router,
+			Country: country,
+		}
+		a.countries[cKey]++
 	}
-	a.durationHist[dhKey]++
 
-	// Accumulate country (GeoIP lookup)
-	if a.geoReader != nil {
-		if country := lookupCountry(a.geoReader, entry.IP); country != "" {
-			cKey := countryKey{
-				Hour:    hour,
-				Router:  router,
-				Country: country,
-			}
-			a.countries[cKey]++
+	// Accumulate requested host, sharing the referrer domain cap
+	if host != "" {
+		hKey := hostKey{Hour: hour, Router: router, Host: host}
+		if _, exists := a.hosts[hKey]; !exists && len(a.hosts) >= a.maxReferrers {
+			hKey.Host = OtherKey
+		}
+		a.hosts[hKey]++
+	}
+
+	// Accumulate proxy/CDN cache status, sharing the referrer domain cap
+	if status := cacheStatusLabel(entry.CacheStatus); status != "" {
+		csKey := cacheStatusKey{Hour: hour, Router: router, Status: status}
+		if _, exists := a.cacheStatus[csKey]; !exists && len(a.cacheStatus) >= a.maxReferrers {
+			csKey.Status = OtherKey
+		}
+		a.cacheStatus[csKey]++
+	}
+
+	// Accumulate requests from threat-listed IPs, sharing the referrer
+	// domain cap; past it the path and IP fold into OtherKey
+	if threat {
+		tKey := threatKey{Hour: hour, Router: router, IPHash: hashIP(entry.IP, a.ipSalt), Path: entry.Path}
+		if _, exists := a.threatHits[tKey]; !exists && len(a.threatHits) >= a.maxReferrers {
+			tKey.IPHash, tKey.Path = OtherKey, OtherKey
+		}
+		a.threatHits[tKey]++
+	}
+
+	// Accumulate rate-limited (429) clients, sharing the referrer cap;
+	// past it the IP folds into OtherKey
+	if a.rateLimited != nil && entry.Status == 429 {
+		rlKey := rateLimitKey{Hour: hour, Router: router, IPHash: hashIP(entry.IP, a.ipSalt)}
+		if _, exists := a.rateLimited[rlKey]; !exists && len(a.rateLimited) >= a.maxReferrers {
+			rlKey.IPHash = OtherKey
 		}
+		a.rateLimited[rlKey]++
+	}
+
+	// Accumulate the paths unrouted clients probe, sharing the referrer cap;
+	// past it the path and IP fold into OtherKey
+	if a.scannerPaths != nil && entry.Router == "" {
+		spKey := threatKey{Hour: hour, Router: router, IPHash: hashIP(entry.IP, a.ipSalt), Path: entry.Path}
+		if _, exists := a.scannerPaths[spKey]; !exists && len(a.scannerPaths) >= a.maxReferrers {
+			spKey.IPHash, spKey.Path = OtherKey, OtherKey
+		}
+		a.scannerPaths[spKey]++
+	}
+
+	// Accumulate failed logins (401/403 on an auth path) per client, sharing
+	// the referrer cap; past it the path and IP fold into OtherKey
+	if a.authFailures != nil && (entry.Status == 401 || entry.Status == 403) && a.isAuthPath(entry.Path) {
+		afKey := threatKey{Hour: hour, Router: router, IPHash: hashIP(entry.IP, a.ipSalt), Path: entry.Path}
+		if _, exists := a.authFailures[afKey]; !exists && len(a.authFailures) >= a.maxReferrers {
+			afKey.IPHash, afKey.Path = OtherKey, OtherKey
+		}
+		a.authFailures[afKey]++
+	}
+
+	// Keep the request itself for the recent requests panel and drilldowns
+	if a.rawMax > 0 {
+		if len(a.rawRequests) >= a.rawMax {
+			a.rawRequests = a.rawRequests[1:]
+		}
+		userAgent := entry.UserAgent
+		if len(userAgent) > maxRawUserAgentLen {
+			userAgent = userAgent[:maxRawUserAgentLen]
+		}
+		a.rawRequests = append(a.rawRequests, rawRequest{
+			Hour:      hour,
+			Timestamp: entry.Timestamp.UTC().Format(time.RFC3339),
+			Router:    router,
+			Host:      host,
+			Path:      entry.Path,
+			Method:    entry.Method,
+			Status:    entry.Status,
+			Bytes:     entry.Bytes,
+			Duration:  entry.DurationMs,
+			IPHash:    hashIP(entry.IP, a.ipSalt),
+			Country:   country,
+			Referrer:  refLabel,
+			UserAgent: userAgent,
+		})
 	}
 
 	a.bufferSize++
+	a.distinctKeys = len(a.requests) + len(a.fine) + len(a.visitors) + len(a.entries) + len(a.referrers) +
+		len(a.userAgents) + len(a.rawUAs) + len(a.countries) + len(a.hosts) + len(a.cacheStatus) + len(a.threatHits) + len(a.rateLimited) + len(a.scannerPaths) + len(a.authFailures) + len(a.pathClasses) + len(a.browsers) +
+		len(a.osStats) + len(a.durationHist) + len(a.durSamples) + len(a.upstream) + len(a.sizeHist) + len(a.queryParams)
+}
+
+// accumulateEntry records the first referrer and path of a visitor-hour
+// and whether it reached the goal path. Caller holds a.mu.
+func (a *Aggregator) accumulateEntry(key visitorKey, entry *parser.LogEntry, refLabel string) {
+	path, _, _ := strings.Cut(entry.Path, "?")
+	e, exists := a.entries[key]
+	if !exists {
+		if refLabel != "" && entry.Host != "" && sameSite(refLabel, entry.Host) {
+			refLabel = InternalReferrer
+		}
+		e = &visitorEntry{Referrer: refLabel, Path: path}
+		a.entries[key] = e
+	}
+	if path == a.goalPath {
+		e.Goal = true
+	}
+}
+
+// isAuthPath reports whether p, without its query string, matches one of
+// Options.AuthPaths
+func (a *Aggregator) isAuthPath(p string) bool {
+	p, _, _ = strings.Cut(p, "?")
+	return matchesAny(a.authPaths, p)
+}
+
+// sameSite reports whether a referrer label points at host, ignoring a
+// leading "www." on either
+func sameSite(label, host string) bool {
+	refHost, _, _ := strings.Cut(stripWWW(label), "/")
+	host, _, _ = strings.Cut(host, ":")
+	return refHost == stripWWW(host)
+}
+
+// accumulateParams counts the values of captured query-string params in
+// path, and with AllParams the names of the others under an empty value.
+// Keys past the cap fold into OtherKey. Caller holds a.mu.
+func (a *Aggregator) accumulateParams(hour, router, path string) {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return
+	}
+	values, err := url.ParseQuery(path[i+1:])
+	if err != nil && len(values) == 0 {
+		return
+	}
+	for param, vals := range values {
+		if !a.captureParams[param] {
+			if !a.captureParams[AllParams] || param == "" {
+				continue
+			}
+			if len(param) > maxParamValueLen {
+				param = strings.ToValidUTF8(param[:maxParamValueLen], "")
+			}
+			key := queryParamKey{Hour: hour, Router: router, Param: param}
+			if _, exists := a.queryParams[key]; !exists && len(a.queryParams) >= a.maxParams {
+				key.Param = OtherKey
+			}
+			a.queryParams[key]++
+			continue
+		}
+		for _, v := range vals {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if len(v) > maxParamValueLen {
+				v = strings.ToValidUTF8(v[:maxParamValueLen], "")
+			}
+			key := queryParamKey{Hour: hour, Router: router, Param: param, Value: v}
+			if _, exists := a.queryParams[key]; !exists && len(a.queryParams) >= a.maxParams {
+				key.Value = OtherKey
+			}
+			a.queryParams[key]++
+		}
+	}
 }
 
 // flush writes accumulated data to SQLite in a transaction
 func (a *Aggregator) flush(ctx context.Context) error {
+	_, err := a.Flush(ctx)
+	return err
+}
+
+// Flush writes buffered entries to SQLite now and returns how many were
+// written. Safe to call from other goroutines while Run is active; each call
+// takes its own snapshot of the buffers.
+func (a *Aggregator) Flush(ctx context.Context) (int, error) {
 	a.mu.Lock()
 	// Take snapshots of all buffers
 	requests := a.requests
+	fine := a.fine
 	visitors := a.visitors
 	referrers := a.referrers
 	userAgents := a.userAgents
 	countries := a.countries
+	hosts := a.hosts
+	cacheStatus := a.cacheStatus
+	threatHits := a.threatHits
+	rateLimited := a.rateLimited
+	scannerPaths := a.scannerPaths
+	authFailures := a.authFailures
+	entries := a.entries
+	pathClasses := a.pathClasses
+	rawUAs := a.rawUAs
 	browsers := a.browsers
 	osStats := a.osStats
 	durationHist := a.durationHist
+	durSamples := a.durSamples
+	upstream := a.upstream
+	sizeHist := a.sizeHist
+	queryParams := a.queryParams
+	errRequests := a.errRequests
+	rawRequests := a.rawRequests
 	bufSize := a.bufferSize
 
 	// Reset buffers
 	a.requests = make(map[requestKey]*requestVal)
+	a.fine = newFineMap(a.fineBucket)
 	a.visitors = make(map[visitorKey]struct{})
 	a.referrers = make(map[referrerKey]int)
 	a.userAgents = make(map[userAgentKey]int)
 	a.countries = make(map[countryKey]int)
+	a.hosts = make(map[hostKey]int)
+	a.cacheStatus = make(map[cacheStatusKey]int)
+	a.threatHits = make(map[threatKey]int)
+	a.rateLimited = newRateLimitMap(rateLimited != nil)
+	a.scannerPaths = newScannerPathMap(scannerPaths != nil)
+	a.authFailures = newScannerPathMap(authFailures != nil)
+	a.entries = newEntryMap(a.goalPath)
+	a.pathClasses = make(map[pathCategoryKey]int)
+	a.rawUAs = newRawUAMap(rawUAs != nil)
 	a.browsers = make(map[browserKey]int)
 	a.osStats = make(map[osKey]int)
 	a.durationHist = make(map[durationHistKey]int)
+	a.durSamples = newSampleMap(a.sampleSize)
+	a.upstream = make(map[upstreamKey]*upstreamVal)
+	a.sizeHist = make(map[sizeHistKey]int)
+	a.queryParams = make(map[queryParamKey]int)
+	a.errRequests = nil
+	a.rawRequests = nil
 	a.bufferSize = 0
+	a.distinctKeys = 0
+	dupes := a.dupes
+	a.dupes = 0
 	a.mu.Unlock()
 
+	if dupes > 0 {
+		log.Printf("dedup: dropped %d repeated lines", dupes)
+	}
+
 	// Nothing to flush
 	if bufSize == 0 {
-		return nil
+		return 0, nil
 	}
 
 	// Begin transaction
 	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	// Flush requests
-	reqStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(hour, router, path, method, status) DO UPDATE SET
-			count = count + excluded.count,
-			bytes = bytes + excluded.bytes,
-			duration = duration + excluded.duration
-	`)
+	reqStmt, err := tx.PrepareContext(ctx, UpsertRequestsSQL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer reqStmt.Close()
 
 	for key, val := range requests {
-		if _, err := reqStmt.ExecContext(ctx, key.Hour, key.Router, key.Path, key.Method, key.Status, val.Count, val.Bytes, val.Duration); err != nil {
-			return err
+		if _, err := reqStmt.ExecContext(ctx, key.Hour, key.Router, key.Host, key.Path, key.Method, key.Status, val.Count, val.Bytes, val.Duration); err != nil {
+			return 0, err
+		}
+	}
+
+	// Flush fine-grained requests
+	if len(fine) > 0 {
+		fineStmt, err := tx.PrepareContext(ctx, UpsertRequestsFineSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer fineStmt.Close()
+
+		for key, val := range fine {
+			if _, err := fineStmt.ExecContext(ctx, key.Hour, key.Router, key.Path, key.Method, key.Status, val.Count, val.Bytes, val.Duration); err != nil {
+				return 0, err
+			}
 		}
 	}
 
 	// Flush visitors
-	visStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO visitors (hour, router, ip_hash)
-		VALUES (?, ?, ?)
-		ON CONFLICT(hour, router, ip_hash) DO NOTHING
-	`)
+	visStmt, err := tx.PrepareContext(ctx, UpsertVisitorsSQL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer visStmt.Close()
 
 	for key := range visitors {
 		if _, err := visStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	// Flush referrers
-	refStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO referrers (hour, router, referrer, count)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(hour, router, referrer) DO UPDATE SET
-			count = count + excluded.count
-	`)
+	refStmt, err := tx.PrepareContext(ctx, UpsertReferrersSQL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer refStmt.Close()
 
 	for key, count := range referrers {
 		if _, err := refStmt.ExecContext(ctx, key.Hour, key.Router, key.Referrer, count); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	// Flush user agents
-	uaStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO user_agents (hour, router, category, count)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(hour, router, category) DO UPDATE SET
-			count = count + excluded.count
-	`)
+	uaStmt, err := tx.PrepareContext(ctx, UpsertUserAgentsSQL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer uaStmt.Close()
 
 	for key, count := range userAgents {
 		if _, err := uaStmt.ExecContext(ctx, key.Hour, key.Router, key.Category, count); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	// Flush countries
 	if len(countries) > 0 {
-		countryStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO countries (hour, router, country, count)
-			VALUES (?, ?, ?, ?)
-			ON CONFLICT(hour, router, country) DO UPDATE SET
-				count = count + excluded.count
-		`)
+		countryStmt, err := tx.PrepareContext(ctx, UpsertCountriesSQL)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer countryStmt.Close()
 
 		for key, count := range countries {
 			if _, err := countryStmt.ExecContext(ctx, key.Hour, key.Router, key.Country, count); err != nil {
-				return err
+				return 0, err
+			}
+		}
+	}
+
+	// Flush raw User-Agents
+	if len(rawUAs) > 0 {
+		rawStmt, err := tx.PrepareContext(ctx, UpsertRawUserAgentsSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer rawStmt.Close()
+
+		for key, count := range rawUAs {
+			if _, err := rawStmt.ExecContext(ctx, key.Hour, key.Router, key.UserAgent, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush hosts
+	if len(hosts) > 0 {
+		hostStmt, err := tx.PrepareContext(ctx, UpsertHostsSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer hostStmt.Close()
+
+		for key, count := range hosts {
+			if _, err := hostStmt.ExecContext(ctx, key.Hour, key.Router, key.Host, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush cache statuses
+	if len(cacheStatus) > 0 {
+		csStmt, err := tx.PrepareContext(ctx, UpsertCacheStatusSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer csStmt.Close()
+
+		for key, count := range cacheStatus {
+			if _, err := csStmt.ExecContext(ctx, key.Hour, key.Router, key.Status, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush threat-listed requests
+	if len(threatHits) > 0 {
+		threatStmt, err := tx.PrepareContext(ctx, UpsertThreatRequestsSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer threatStmt.Close()
+
+		for key, count := range threatHits {
+			if _, err := threatStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash, key.Path, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush rate-limited clients
+	if len(rateLimited) > 0 {
+		rlStmt, err := tx.PrepareContext(ctx, UpsertRateLimitedSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer rlStmt.Close()
+
+		for key, count := range rateLimited {
+			if _, err := rlStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush visitor-hour entries; the first flush of an hour keeps its entry
+	if len(entries) > 0 {
+		veStmt, err := tx.PrepareContext(ctx, UpsertVisitorEntriesSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer veStmt.Close()
+
+		for key, e := range entries {
+			goal := ""
+			if e.Goal {
+				goal = a.goalPath
+			}
+			if _, err := veStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash, e.Referrer, e.Path, goal); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush paths probed by unrouted clients
+	if len(scannerPaths) > 0 {
+		spStmt, err := tx.PrepareContext(ctx, UpsertScannerPathsSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer spStmt.Close()
+
+		for key, count := range scannerPaths {
+			if _, err := spStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash, key.Path, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush failed logins on auth paths
+	if len(authFailures) > 0 {
+		afStmt, err := tx.PrepareContext(ctx, UpsertAuthFailuresSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer afStmt.Close()
+
+		for key, count := range authFailures {
+			if _, err := afStmt.ExecContext(ctx, key.Hour, key.Router, key.IPHash, key.Path, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush per-path human/bot splits
+	if len(pathClasses) > 0 {
+		pcStmt, err := tx.PrepareContext(ctx, UpsertPathCategoriesSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer pcStmt.Close()
+
+		for key, count := range pathClasses {
+			if _, err := pcStmt.ExecContext(ctx, key.Hour, key.Router, key.Path, key.Category, count); err != nil {
+				return 0, err
 			}
 		}
 	}
 
 	// Flush browsers
 	if len(browsers) > 0 {
-		browserStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO browsers (hour, router, browser, count)
-			VALUES (?, ?, ?, ?)
-			ON CONFLICT(hour, router, browser) DO UPDATE SET
-				count = count + excluded.count
-		`)
+		browserStmt, err := tx.PrepareContext(ctx, UpsertBrowsersSQL)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer browserStmt.Close()
 
 		for key, count := range browsers {
 			if _, err := browserStmt.ExecContext(ctx, key.Hour, key.Router, key.Browser, count); err != nil {
-				return err
+				return 0, err
 			}
 		}
 	}
 
 	// Flush OS stats
 	if len(osStats) > 0 {
-		osStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO os_stats (hour, router, os, count)
-			VALUES (?, ?, ?, ?)
-			ON CONFLICT(hour, router, os) DO UPDATE SET
-				count = count + excluded.count
-		`)
+		osStmt, err := tx.PrepareContext(ctx, UpsertOSStatsSQL)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer osStmt.Close()
 
 		for key, count := range osStats {
 			if _, err := osStmt.ExecContext(ctx, key.Hour, key.Router, key.OS, count); err != nil {
-				return err
+				return 0, err
 			}
 		}
 	}
 
 	// Flush duration histogram
 	if len(durationHist) > 0 {
-		dhStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO duration_hist (hour, router, bucket, count)
-			VALUES (?, ?, ?, ?)
-			ON CONFLICT(hour, router, bucket) DO UPDATE SET
-				count = count + excluded.count
-		`)
+		dhStmt, err := tx.PrepareContext(ctx, UpsertDurationHistSQL)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer dhStmt.Close()
 
 		for key, count := range durationHist {
 			if _, err := dhStmt.ExecContext(ctx, key.Hour, key.Router, key.Bucket, count); err != nil {
-				return err
+				return 0, err
+			}
+		}
+	}
+
+	// Flush duration samples, merged with what earlier flushes stored for
+	// the same hour
+	if len(durSamples) > 0 {
+		dsStmt, err := tx.PrepareContext(ctx, UpsertDurationSamplesSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer dsStmt.Close()
+
+		for key, r := range durSamples {
+			var stored reservoir
+			var samples string
+			err := tx.QueryRowContext(ctx, "SELECT seen, samples FROM duration_samples WHERE hour = ? AND router = ?",
+				key.Hour, key.Router).Scan(&stored.Seen, &samples)
+			if err != nil && err != sql.ErrNoRows {
+				return 0, err
+			}
+			stored.Samples = DecodeSamples(samples)
+			merged := mergeReservoirs(stored, *r, a.sampleSize)
+			if _, err := dsStmt.ExecContext(ctx, key.Hour, key.Router, merged.Seen, EncodeSamples(merged.Samples)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush upstream vs total times
+	if len(upstream) > 0 {
+		upStmt, err := tx.PrepareContext(ctx, UpsertUpstreamTimesSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer upStmt.Close()
+
+		for key, val := range upstream {
+			if _, err := upStmt.ExecContext(ctx, key.Hour, key.Router, val.Count, val.Duration, val.Upstream); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush response size histogram
+	if len(sizeHist) > 0 {
+		shStmt, err := tx.PrepareContext(ctx, UpsertSizeHistSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer shStmt.Close()
+
+		for key, count := range sizeHist {
+			if _, err := shStmt.ExecContext(ctx, key.Hour, key.Router, key.Bucket, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Flush captured query-param values
+	if len(queryParams) > 0 {
+		qpStmt, err := tx.PrepareContext(ctx, UpsertQueryParamsSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer qpStmt.Close()
+
+		for key, count := range queryParams {
+			if _, err := qpStmt.ExecContext(ctx, key.Hour, key.Router, key.Param, key.Value, count); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Record 5xx request IDs, then trim the table back to its cap
+	if len(errRequests) > 0 {
+		erStmt, err := tx.PrepareContext(ctx, InsertErrorRequestSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer erStmt.Close()
+
+		for _, er := range errRequests {
+			if _, err := erStmt.ExecContext(ctx, er.Hour, er.Timestamp, er.Router, er.Path, er.Method, er.Status, er.RequestID); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, TrimErrorRequestsSQL, MaxErrorRequests); err != nil {
+			return 0, err
+		}
+	}
+
+	// Record single requests, then trim the table back to its cap
+	if len(rawRequests) > 0 {
+		rrStmt, err := tx.PrepareContext(ctx, InsertRequestRawSQL)
+		if err != nil {
+			return 0, err
+		}
+		defer rrStmt.Close()
+
+		for _, r := range rawRequests {
+			if _, err := rrStmt.ExecContext(ctx, r.Hour, r.Timestamp, r.Router, r.Host, r.Path, r.Method, r.Status,
+				r.Bytes, r.Duration, r.IPHash, r.Country, r.Referrer, r.UserAgent); err != nil {
+				return 0, err
 			}
 		}
+		if _, err := tx.ExecContext(ctx, TrimRequestsRawSQL, a.rawMax); err != nil {
+			return 0, err
+		}
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		return err
+		return 0, err
 	}
 
+	a.mu.Lock()
+	a.lastFlush = time.Now()
+	a.mu.Unlock()
+
 	log.Printf("flushed %d entries to database", bufSize)
-	return nil
+	return bufSize, nil
+}
+
+// LastFlush returns when buffered entries were last written to the database,
+// or the zero time if nothing has been written since startup
+func (a *Aggregator) LastFlush() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastFlush
+}
+
+// ipSaltKey is the meta table key holding the persistent IP hashing salt
+const ipSaltKey = "ip_salt"
+
+// loadOrCreateSalt returns the IP hashing salt stored in the database,
+// generating and persisting a new random one on first run. A stable salt
+// makes the same IP hash identically across hours and restarts, so
+// multi-hour ranges can count distinct visitors instead of summing hours.
+// If the database can't be read or written, falls back to a per-process salt.
+func loadOrCreateSalt(db *sql.DB) string {
+	if db != nil {
+		salt, ok, err := traildb.GetMeta(db, ipSaltKey)
+		if err != nil {
+			log.Printf("warning: failed to load IP salt, using per-process salt: %v", err)
+		} else if ok && salt != "" {
+			return salt
+		}
+	}
+
+	saltBytes := make([]byte, 16)
+	if _, err := rand.Read(saltBytes); err != nil {
+		log.Printf("warning: failed to generate salt, using empty: %v", err)
+	}
+	salt := hex.EncodeToString(saltBytes)
+
+	if db != nil {
+		if err := traildb.SetMeta(db, ipSaltKey, salt); err != nil {
+			log.Printf("warning: failed to persist IP salt, visitor hashes will change on restart: %v", err)
+		}
+	}
+	return salt
 }
 
 // hashIP creates a SHA-256 hash of IP + salt, truncated to 16 hex characters
@@ -513,13 +1581,33 @@ func hashIP(ip, salt string) string {
 	return hex.EncodeToString(h[:8])
 }
 
-// extractDomain extracts just the domain from a referrer URL
-func extractDomain(referer string) string {
+// referrerLabel reduces a referrer URL to what gets stored: its host, or with
+// withPath its host and path. The query string and fragment are always
+// dropped since they can carry tokens or personal data from the referring site.
+func referrerLabel(referer string, withPath bool) string {
 	u, err := url.Parse(referer)
-	if err != nil {
+	if err != nil || u.Host == "" {
 		return ""
 	}
-	return u.Host
+	if !withPath || u.Path == "" || u.Path == "/" {
+		return u.Host
+	}
+	return u.Host + u.Path
+}
+
+// stripWWW canonicalizes a referrer or host label for Options.MergeWWW: the
+// host part is lowercased and a leading "www." dropped, so www.example.com
+// and example.com aggregate together. A path after the host is kept as is.
+func stripWWW(label string) string {
+	host, path := label, ""
+	if i := strings.IndexByte(label, '/'); i >= 0 {
+		host, path = label[:i], label[i:]
+	}
+	host = strings.ToLower(host)
+	if trimmed := strings.TrimPrefix(host, "www."); trimmed != "" {
+		host = trimmed
+	}
+	return host + path
 }
 
 // durationBucket returns the histogram bucket label for a given duration in ms.
@@ -540,6 +1628,53 @@ func durationBucket(ms int) string {
 	}
 }
 
+// sizeBucket returns the histogram bucket label for a response size in bytes.
+func sizeBucket(bytes int64) string {
+	switch {
+	case bytes < 1<<10:
+		return "0-1KB"
+	case bytes < 10<<10:
+		return "1-10KB"
+	case bytes < 100<<10:
+		return "10-100KB"
+	case bytes < 1<<20:
+		return "100KB-1MB"
+	case bytes < 10<<20:
+		return "1-10MB"
+	default:
+		return "10MB+"
+	}
+}
+
+// hostLabel normalizes a requested host for storage: lowercased, without a
+// port or trailing dot. "" when there is no usable host.
+func hostLabel(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if len(host) > maxHostLen {
+		return ""
+	}
+	return host
+}
+
+// cacheStatusLabel normalizes a logged cache status for storage: the
+// uppercased first word of the last comma-separated value, so "Hit from
+// cloudfront" is HIT and a Fastly "HIT, MISS" (shield, then edge) is MISS.
+// "" when the line has none.
+func cacheStatusLabel(status string) string {
+	if i := strings.LastIndexByte(status, ','); i >= 0 {
+		status = status[i+1:]
+	}
+	fields := strings.Fields(status)
+	if len(fields) == 0 || fields[0] == "-" || len(fields[0]) > maxCacheStatusLen {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
 // lookupCountry returns the ISO country code for an IP address.
 // Returns empty string on lookup failure.
 func lookupCountry(reader *geoip2.Reader, ipStr string) string {
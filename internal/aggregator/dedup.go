@@ -0,0 +1,47 @@
+package aggregator
+
+import "hash/fnv"
+
+// lineDeduper remembers hashes of the last size raw lines so a line read
+// twice (e.g. after a mis-detected rotation) is only counted once.
+// Genuinely identical lines within the window are dropped too, which is
+// why it is opt-in.
+type lineDeduper struct {
+	ring []uint64
+	seen map[uint64]int // hash -> occurrences in ring
+	next int
+	full bool
+}
+
+func newLineDeduper(size int) *lineDeduper {
+	return &lineDeduper{
+		ring: make([]uint64, size),
+		seen: make(map[uint64]int, size),
+	}
+}
+
+// Duplicate reports whether line is already in the window, recording it if not
+func (d *lineDeduper) Duplicate(line string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	sum := h.Sum64()
+
+	if d.seen[sum] > 0 {
+		return true
+	}
+
+	if d.full {
+		old := d.ring[d.next]
+		if d.seen[old]--; d.seen[old] <= 0 {
+			delete(d.seen, old)
+		}
+	}
+	d.ring[d.next] = sum
+	d.seen[sum]++
+	d.next++
+	if d.next == len(d.ring) {
+		d.next = 0
+		d.full = true
+	}
+	return false
+}
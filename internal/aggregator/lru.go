@@ -0,0 +1,71 @@
+package aggregator
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// DefaultGeoCacheSize caps the IPs whose country is remembered between lookups
+	DefaultGeoCacheSize = 10000
+	// DefaultUACacheSize caps the User-Agents whose classification is remembered
+	DefaultUACacheSize = 1000
+)
+
+// lruCache memoizes an expensive string-keyed lookup, keeping the size most
+// recently used results. It is used in front of the GeoIP reader (IP ->
+// country) and the User-Agent classifiers, since the same IPs and UAs repeat
+// constantly. Callers use it before taking the aggregator lock; lookups of
+// different keys run concurrently.
+type lruCache[V any] struct {
+	lookup func(key string) V
+
+	mu    sync.Mutex
+	size  int
+	order *list.List               // front is most recently used
+	items map[string]*list.Element // key -> element holding an *lruEntry[V]
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRUCache[V any](size int, lookup func(key string) V) *lruCache[V] {
+	return &lruCache[V]{
+		lookup: lookup,
+		size:   size,
+		order:  list.New(),
+		items:  make(map[string]*list.Element, size),
+	}
+}
+
+// Get returns the cached result for key, calling lookup on a miss. Misses
+// are looked up without holding the cache lock.
+func (c *lruCache[V]) Get(key string) V {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		value := el.Value.(*lruEntry[V]).value
+		c.mu.Unlock()
+		return value
+	}
+	c.mu.Unlock()
+
+	value := c.lookup(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		// Another caller filled it meanwhile
+		c.order.MoveToFront(el)
+		return value
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+	}
+	return value
+}
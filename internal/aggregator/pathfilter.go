@@ -0,0 +1,65 @@
+package aggregator
+
+import (
+	"path"
+	"strings"
+)
+
+// pathFilter drops requests for excluded paths before they are counted.
+// Patterns are path.Match globs, and a trailing * also matches across
+// slashes, so /api/* covers /api/v1/users. A path matching an include
+// pattern is kept even when it matches an exclude pattern.
+type pathFilter struct {
+	exclude []string
+	include []string
+}
+
+// newPathFilter returns nil when nothing is excluded, since includes only
+// carve exceptions out of exclusions
+func newPathFilter(exclude, include []string) *pathFilter {
+	if len(exclude) == 0 {
+		return nil
+	}
+	return &pathFilter{exclude: exclude, include: include}
+}
+
+// Excluded reports whether requests for p are left out. The query string
+// is ignored. A nil filter excludes nothing.
+func (f *pathFilter) Excluded(p string) bool {
+	if f == nil {
+		return false
+	}
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	return matchesAny(f.exclude, p) && !matchesAny(f.include, p)
+}
+
+func matchesAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches p against a glob pattern. A pattern ending in * also
+// matches p when it matches a leading part of p cut at a slash.
+func matchPath(pattern, p string) bool {
+	if ok, _ := path.Match(pattern, p); ok {
+		return true
+	}
+	if !strings.HasSuffix(pattern, "*") {
+		return false
+	}
+	for i := 1; i < len(p); i++ {
+		if p[i] != '/' {
+			continue
+		}
+		if ok, _ := path.Match(pattern, p[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
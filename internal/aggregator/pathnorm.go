@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders NormalizeIDs puts in place of ID segments
+const (
+	idPlaceholder   = ":id"
+	uuidPlaceholder = ":uuid"
+	hashPlaceholder = ":hash"
+)
+
+// uuidPattern and hashPattern match whole path segments that are a UUID or
+// a hex digest (16+ hex digits, e.g. a commit SHA or content hash)
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashPattern = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// PathRule rewrites paths matching Pattern to Replacement, which may refer
+// to capture groups as $1 or ${name} (regexp.Regexp.ReplaceAllString)
+type PathRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// ParsePathRules parses TRAIL_PATH_RULES: semicolon-separated
+// "regex=replacement" rules, split at the last "=", e.g.
+// `^/blog/\d{4}/\d{2}/=/blog/:year/:month/;^/u/[^/]+=/u/:name`
+func ParsePathRules(s string) ([]PathRule, error) {
+	var rules []PathRule
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		i := strings.LastIndexByte(part, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("rule %q is not regex=replacement", part)
+		}
+		re, err := regexp.Compile(part[:i])
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", part, err)
+		}
+		rules = append(rules, PathRule{Pattern: re, Replacement: part[i+1:]})
+	}
+	return rules, nil
+}
+
+// pathNormalizer collapses the variable parts of paths before they are
+// counted, so /users/123 and /users/456 aggregate as /users/:id instead
+// of each taking a row and a place in the path cap
+type pathNormalizer struct {
+	ids   bool
+	rules []PathRule
+}
+
+// newPathNormalizer returns nil when there is nothing to normalize
+func newPathNormalizer(ids bool, rules []PathRule) *pathNormalizer {
+	if !ids && len(rules) == 0 {
+		return nil
+	}
+	return &pathNormalizer{ids: ids, rules: rules}
+}
+
+// Normalize rewrites the path part of p: each rule is applied in order,
+// then with ids numeric, UUID and hex digest segments become :id, :uuid
+// and :hash. Rules run first so they can match the numbers they name. The
+// query string is kept as is. A nil normalizer returns p.
+func (n *pathNormalizer) Normalize(p string) string {
+	if n == nil {
+		return p
+	}
+	path, query := p, ""
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		path, query = p[:i], p[i:]
+	}
+	for _, rule := range n.rules {
+		path = rule.Pattern.ReplaceAllString(path, rule.Replacement)
+	}
+	if n.ids {
+		segments := strings.Split(path, "/")
+		for i, seg := range segments {
+			if placeholder := idSegment(seg); placeholder != "" {
+				segments[i] = placeholder
+			}
+		}
+		path = strings.Join(segments, "/")
+	}
+	return path + query
+}
+
+// idSegment returns the placeholder for a path segment that is an ID, or
+// "" for any other segment
+func idSegment(seg string) string {
+	switch {
+	case seg == "":
+		return ""
+	case strings.Trim(seg, "0123456789") == "":
+		return idPlaceholder
+	case uuidPattern.MatchString(seg):
+		return uuidPlaceholder
+	case hashPattern.MatchString(seg) && strings.ContainsAny(seg, "0123456789"):
+		return hashPlaceholder
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package aggregator
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// MaxDurationSamples bounds the reservoir size per (hour, router)
+const MaxDurationSamples = 10000
+
+// durationSampleKey identifies one duration reservoir
+type durationSampleKey struct {
+	Hour   string
+	Router string
+}
+
+// reservoir is a uniform random sample of at most k durations out of the
+// Seen that were offered (Algorithm R)
+type reservoir struct {
+	Seen    int64
+	Samples []int64
+}
+
+// add offers v to the sample, keeping at most k values
+func (r *reservoir) add(v int64, k int) {
+	r.Seen++
+	if len(r.Samples) < k {
+		r.Samples = append(r.Samples, v)
+		return
+	}
+	if j := rand.Int64N(r.Seen); j < int64(k) {
+		r.Samples[j] = v
+	}
+}
+
+// mergeReservoirs combines two samples of disjoint streams into one of at
+// most k values. Each value is drawn from a or b in proportion to how many
+// requests that side saw, so the result stays a uniform sample of both.
+func mergeReservoirs(a, b reservoir, k int) reservoir {
+	out := reservoir{Seen: a.Seen + b.Seen}
+	restA := shuffled(a.Samples)
+	restB := shuffled(b.Samples)
+	seenA, seenB := a.Seen, b.Seen
+	for len(out.Samples) < k && (len(restA) > 0 || len(restB) > 0) {
+		fromA := len(restB) == 0 || (len(restA) > 0 && rand.Int64N(seenA+seenB) < seenA)
+		if fromA {
+			out.Samples = append(out.Samples, restA[0])
+			restA = restA[1:]
+			seenA--
+		} else {
+			out.Samples = append(out.Samples, restB[0])
+			restB = restB[1:]
+			seenB--
+		}
+	}
+	return out
+}
+
+// shuffled returns a shuffled copy of s
+func shuffled(s []int64) []int64 {
+	out := append([]int64(nil), s...)
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// EncodeSamples stores durations as a comma-separated list
+func EncodeSamples(samples []int64) string {
+	var b strings.Builder
+	for i, v := range samples {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatInt(v, 10))
+	}
+	return b.String()
+}
+
+// DecodeSamples parses a list written by EncodeSamples, skipping anything
+// that isn't a number
+func DecodeSamples(s string) []int64 {
+	if s == "" {
+		return nil
+	}
+	fields := strings.Split(s, ",")
+	out := make([]int64, 0, len(fields))
+	for _, f := range fields {
+		if v, err := strconv.ParseInt(f, 10, 64); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// threatReloadInterval is how often Watch checks the list file for changes
+const threatReloadInterval = 30 * time.Second
+
+// ThreatList is a set of known-bad IPs and CIDRs loaded from a file, one
+// per line with # comments. Requests from a listed address are counted in
+// threat_requests. Safe for concurrent use; Watch swaps in a new set when
+// the file changes.
+type ThreatList struct {
+	path    string
+	set     atomic.Pointer[threatSet]
+	modTime time.Time // of the loaded file; only touched by Load/Watch
+}
+
+// threatSet holds single addresses in a map and wider prefixes in a slice,
+// since lists are mostly single IPs with a handful of ranges
+type threatSet struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+// LoadThreatList reads the list at path
+func LoadThreatList(path string) (*ThreatList, error) {
+	t := &ThreatList{path: path}
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load (re)reads the list file. On error the current set is kept.
+func (t *ThreatList) Load() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+	set, err := readThreatSet(t.path)
+	if err != nil {
+		return err
+	}
+	t.set.Store(set)
+	t.modTime = info.ModTime()
+	return nil
+}
+
+// Len returns how many entries the current set holds
+func (t *ThreatList) Len() int {
+	set := t.set.Load()
+	return len(set.addrs) + len(set.prefixes)
+}
+
+// Contains reports whether ip (a log line's client address) is listed
+func (t *ThreatList) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	set := t.set.Load()
+	if _, ok := set.addrs[addr]; ok {
+		return true
+	}
+	for _, p := range set.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the list whenever the file's modification time changes,
+// until ctx is done. A file that fails to load keeps the previous list.
+func (t *ThreatList) Watch(ctx context.Context) error {
+	ticker := time.NewTicker(threatReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			info, err := os.Stat(t.path)
+			if err != nil || info.ModTime().Equal(t.modTime) {
+				continue
+			}
+			if err := t.Load(); err != nil {
+				log.Printf("Warning: failed to reload threat list %s, keeping the previous one: %v", t.path, err)
+				continue
+			}
+			log.Printf("Reloaded threat list %s: %d entries", t.path, t.Len())
+		}
+	}
+}
+
+// readThreatSet parses a list file. Each line is an IP or a CIDR; blank
+// lines and text after # are ignored.
+func readThreatSet(path string) (*threatSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := &threatSet{addrs: make(map[netip.Addr]struct{})}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			addr, err := netip.ParseAddr(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			set.addrs[addr.Unmap()] = struct{}{}
+			continue
+		}
+		prefix, err := netip.ParsePrefix(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if prefix.IsSingleIP() {
+			set.addrs[prefix.Addr().Unmap()] = struct{}{}
+		} else {
+			set.prefixes = append(set.prefixes, prefix.Masked())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
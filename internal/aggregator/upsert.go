@@ -0,0 +1,170 @@
+package aggregator
+
+// Upsert statements shared by flush and the JSONL importer. Counters are
+// added to any existing row, so replaying rows merges rather than overwrites.
+// Placeholders follow the table's column order.
+const (
+	UpsertRequestsSQL = `
+		INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, host, path, method, status) DO UPDATE SET
+			count = count + excluded.count,
+			bytes = bytes + excluded.bytes,
+			duration = duration + excluded.duration`
+
+	UpsertRequestsFineSQL = `
+		INSERT INTO requests_fine (bucket, router, path, method, status, count, bytes, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(bucket, router, path, method, status) DO UPDATE SET
+			count = count + excluded.count,
+			bytes = bytes + excluded.bytes,
+			duration = duration + excluded.duration`
+
+	// InsertErrorRequestSQL records one 5xx request ID; a replayed line is
+	// ignored rather than duplicated
+	InsertErrorRequestSQL = `
+		INSERT INTO error_requests (hour, ts, router, path, method, status, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(request_id, ts) DO NOTHING`
+
+	// TrimErrorRequestsSQL keeps only the newest ? rows of error_requests
+	TrimErrorRequestsSQL = `
+		DELETE FROM error_requests
+		WHERE rowid NOT IN (SELECT rowid FROM error_requests ORDER BY ts DESC LIMIT ?)`
+
+	// InsertRequestRawSQL records one request in requests_raw
+	InsertRequestRawSQL = `
+		INSERT INTO requests_raw (hour, ts, router, host, path, method, status, bytes, duration, ip_hash, country, referrer, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// TrimRequestsRawSQL keeps only the newest ? rows of requests_raw
+	TrimRequestsRawSQL = `
+		DELETE FROM requests_raw
+		WHERE rowid IN (SELECT rowid FROM requests_raw ORDER BY ts DESC, rowid DESC LIMIT -1 OFFSET ?)`
+
+	UpsertVisitorsSQL = `
+		INSERT INTO visitors (hour, router, ip_hash)
+		VALUES (?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash) DO NOTHING`
+
+	UpsertReferrersSQL = `
+		INSERT INTO referrers (hour, router, referrer, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, referrer) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertUserAgentsSQL = `
+		INSERT INTO user_agents (hour, router, category, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, category) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertCountriesSQL = `
+		INSERT INTO countries (hour, router, country, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, country) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertRawUserAgentsSQL = `
+		INSERT INTO raw_user_agents (hour, router, user_agent, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, user_agent) DO UPDATE SET
+			count = count + excluded.count`
+
+	// UpsertVisitorEntriesSQL keeps a visitor-hour's first entry and
+	// records a goal reached in a later flush
+	UpsertVisitorEntriesSQL = `
+		INSERT INTO visitor_entries (hour, router, ip_hash, referrer, entry_path, goal)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash) DO UPDATE SET
+			goal = CASE WHEN goal = '' THEN excluded.goal ELSE goal END`
+
+	UpsertScannerPathsSQL = `
+		INSERT INTO scanner_paths (hour, router, ip_hash, path, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash, path) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertAuthFailuresSQL = `
+		INSERT INTO auth_failures (hour, router, ip_hash, path, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash, path) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertRateLimitedSQL = `
+		INSERT INTO rate_limited (hour, router, ip_hash, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertHostsSQL = `
+		INSERT INTO hosts (hour, router, host, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, host) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertCacheStatusSQL = `
+		INSERT INTO cache_status (hour, router, status, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, status) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertThreatRequestsSQL = `
+		INSERT INTO threat_requests (hour, router, ip_hash, path, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, ip_hash, path) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertPathCategoriesSQL = `
+		INSERT INTO path_categories (hour, router, path, category, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, path, category) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertUpstreamTimesSQL = `
+		INSERT INTO upstream_times (hour, router, count, duration, upstream)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router) DO UPDATE SET
+			count = count + excluded.count,
+			duration = duration + excluded.duration,
+			upstream = upstream + excluded.upstream`
+
+	UpsertBrowsersSQL = `
+		INSERT INTO browsers (hour, router, browser, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, browser) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertOSStatsSQL = `
+		INSERT INTO os_stats (hour, router, os, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, os) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertDurationHistSQL = `
+		INSERT INTO duration_hist (hour, router, bucket, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, bucket) DO UPDATE SET
+			count = count + excluded.count`
+
+	// UpsertDurationSamplesSQL replaces a reservoir: the aggregator merges
+	// the stored sample with the new one before writing
+	UpsertDurationSamplesSQL = `
+		INSERT INTO duration_samples (hour, router, seen, samples)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router) DO UPDATE SET
+			seen = excluded.seen,
+			samples = excluded.samples`
+
+	UpsertSizeHistSQL = `
+		INSERT INTO size_hist (hour, router, bucket, count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hour, router, bucket) DO UPDATE SET
+			count = count + excluded.count`
+
+	UpsertQueryParamsSQL = `
+		INSERT INTO query_params (hour, router, param, value, count)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hour, router, param, value) DO UPDATE SET
+			count = count + excluded.count`
+)
@@ -6,34 +6,166 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/open-wander/trail/internal/aggregator"
 	"github.com/open-wander/trail/internal/parser"
 )
 
+// Rotation naming schemes accepted by Options.Pattern
+const (
+	PatternAuto    = "auto"    // numeric and date-stamped names
+	PatternNumeric = "numeric" // access.log.1, access.log.2.gz, access.log.00
+	PatternDate    = "date"    // access.log-20260208, access-2026-02-08.log.gz
+)
+
+// Options configures a backfill run
+type Options struct {
+	StateDB *sql.DB // import positions and IP salt; nil keeps them in db
+	Pattern string  // rotation naming scheme; empty means PatternAuto
+
+	// MaxFiles limits the import to the newest N rotated files; older ones
+	// are never imported. Zero imports all of them.
+	MaxFiles int
+
+	// Progress, if set, is updated as files are imported so a run in the
+	// background can be watched from the status endpoint
+	Progress *Progress
+
+	// Aggregator configures the import's aggregator. Pass the live
+	// aggregator's options so rotated files are filtered, capped and counted
+	// the same way; StateDB and Source are set by the run, and requests_raw
+	// is never filled.
+	Aggregator aggregator.Options
+}
+
 // Run imports rotated log files (access.log.1, access.log.2.gz, etc.)
 // that haven't been imported yet. It processes them oldest-first using
 // a dedicated aggregator instance, then marks each as imported.
 // If p is nil, defaults to a Traefik parser.
 func Run(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser) error {
-	dir := filepath.Dir(logPath)
-	baseName := filepath.Base(logPath)
+	return RunWithOptions(ctx, db, logPath, p, Options{})
+}
+
+// RunWithState is Run with import positions and the IP salt kept in a
+// separate state database (TRAIL_STATE_DB) while aggregates go to db.
+func RunWithState(ctx context.Context, db, stateDB *sql.DB, logPath string, p *parser.Parser) error {
+	return RunWithOptions(ctx, db, logPath, p, Options{StateDB: stateDB})
+}
+
+// RunWithOptions is Run with the state database and rotation scheme
+// taken from opts.
+func RunWithOptions(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser, opts Options) error {
+	return RunFiles(ctx, db, []string{logPath}, p, opts)
+}
+
+// RunFiles is RunWithOptions for several live logs at once: the rotated
+// files of each are imported, log by log, in one run with one progress.
+// opts.MaxFiles applies to each log.
+func RunFiles(ctx context.Context, db *sql.DB, logPaths []string, p *parser.Parser, opts Options) (err error) {
+	opts.Progress.update(func(s *ProgressState) { *s = ProgressState{Running: true} })
+	defer func() {
+		opts.Progress.update(func(s *ProgressState) {
+			s.Running = false
+			s.Current = ""
+			if err != nil {
+				s.Error = err.Error()
+			}
+			s.Finished = time.Now().UTC().Format(time.RFC3339)
+		})
+	}()
+
+	stateDB := opts.StateDB
+	if stateDB == nil {
+		stateDB = db
+	}
+
+	var pending []rotatedFile
+	for _, logPath := range logPaths {
+		files, err := findRotatedFiles(filepath.Dir(logPath), filepath.Base(logPath), opts.Pattern)
+		if err != nil {
+			return fmt.Errorf("finding rotated files: %w", err)
+		}
+		if opts.MaxFiles > 0 && len(files) > opts.MaxFiles {
+			log.Printf("backfill: skipping the %d oldest of %d rotated file(s) of %s, over TRAIL_BACKFILL_MAX_FILES=%d",
+				len(files)-opts.MaxFiles, len(files), logPath, opts.MaxFiles)
+			files = files[len(files)-opts.MaxFiles:]
+		}
+
+		// Filter out already-imported files
+		for _, f := range files {
+			imported, err := isImported(stateDB, f.path)
+			if err != nil {
+				return fmt.Errorf("checking import status for %s: %w", f.path, err)
+			}
+			if !imported {
+				pending = append(pending, f)
+			}
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	log.Printf("backfill: %d rotated file(s) to import", len(pending))
+	return importFiles(ctx, db, stateDB, "rotated files of "+strings.Join(logPaths, ", "), pending, p, opts)
+}
+
+// RunDir imports every log file under dir, recursively, that hasn't been
+// imported yet: plain files and .gz objects, such as ALB access logs
+// downloaded from S3 (AWSLogs/.../2026/02/08/*.log.gz). Files are imported
+// in path order, which is chronological for date-named directories and
+// files. With an auto-detecting (or nil) parser the format is detected
+// from the first file. opts.Pattern doesn't apply.
+func RunDir(ctx context.Context, db *sql.DB, dir string, p *parser.Parser, opts Options) (err error) {
+	opts.Progress.update(func(s *ProgressState) { *s = ProgressState{Running: true} })
+	defer func() {
+		opts.Progress.update(func(s *ProgressState) {
+			s.Running = false
+			s.Current = ""
+			if err != nil {
+				s.Error = err.Error()
+			}
+			s.Finished = time.Now().UTC().Format(time.RFC3339)
+		})
+	}()
 
-	files, err := findRotatedFiles(dir, baseName)
+	stateDB := opts.StateDB
+	if stateDB == nil {
+		stateDB = db
+	}
+
+	var files []rotatedFile
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && !strings.HasPrefix(d.Name(), ".") {
+			files = append(files, rotatedFile{path: path})
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("finding rotated files: %w", err)
+		return fmt.Errorf("walking %s: %w", dir, err)
+	}
+	// WalkDir visits in lexical order already
+	if opts.MaxFiles > 0 && len(files) > opts.MaxFiles {
+		log.Printf("backfill: skipping the %d oldest of %d file(s) in %s, over the limit of %d",
+			len(files)-opts.MaxFiles, len(files), dir, opts.MaxFiles)
+		files = files[len(files)-opts.MaxFiles:]
 	}
 
-	// Filter out already-imported files
 	var pending []rotatedFile
 	for _, f := range files {
-		imported, err := isImported(db, f.path)
+		imported, err := isImported(stateDB, f.path)
 		if err != nil {
 			return fmt.Errorf("checking import status for %s: %w", f.path, err)
 		}
@@ -41,16 +173,39 @@ func Run(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser) erro
 			pending = append(pending, f)
 		}
 	}
-
 	if len(pending) == 0 {
+		log.Printf("backfill: nothing new to import in %s", dir)
 		return nil
 	}
 
-	log.Printf("backfill: %d rotated file(s) to import", len(pending))
+	if p == nil {
+		p = parser.NewParser("auto")
+	}
+	if p.Format() == parser.FormatAuto {
+		sample, err := readSample(pending[0].path, 10)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", pending[0].path, err)
+		}
+		log.Printf("backfill: detected log format %s in %s", p.Detect(sample), pending[0].path)
+	}
+
+	log.Printf("backfill: %d file(s) to import from %s", len(pending), dir)
+	return importFiles(ctx, db, stateDB, dir, pending, p, opts)
+}
+
+// importFiles feeds files, oldest first, through a dedicated aggregator
+// and marks each imported once read
+func importFiles(ctx context.Context, db, stateDB *sql.DB, source string, pending []rotatedFile, p *parser.Parser, opts Options) error {
+	opts.Progress.update(func(s *ProgressState) { s.FilesTotal = len(pending) })
 
 	// Create dedicated aggregator + channel for backfill
 	lines := make(chan string, 10000)
-	agg := aggregator.New(db, p, "")
+	// requests_raw keeps the newest requests, which old files would push out
+	aggOpts := opts.Aggregator
+	aggOpts.StateDB = stateDB
+	aggOpts.Source = source
+	aggOpts.RawRequests = 0
+	agg := aggregator.NewWithOptions(db, p, aggOpts)
 
 	// Run aggregator in background
 	aggDone := make(chan error, 1)
@@ -67,6 +222,7 @@ func Run(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser) erro
 		}
 
 		log.Printf("backfill: importing %s", f.path)
+		opts.Progress.update(func(s *ProgressState) { s.Current = f.path })
 		if err := processFile(ctx, f, lines); err != nil {
 			close(lines)
 			<-aggDone
@@ -81,11 +237,12 @@ func Run(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser) erro
 			return fmt.Errorf("stat %s: %w", f.path, err)
 		}
 
-		if err := markImported(db, f.path, info.Size()); err != nil {
+		if err := markImported(stateDB, f.path, info.Size()); err != nil {
 			close(lines)
 			<-aggDone
 			return fmt.Errorf("marking %s as imported: %w", f.path, err)
 		}
+		opts.Progress.update(func(s *ProgressState) { s.FilesDone++ })
 	}
 
 	// Close channel to signal aggregator to flush and exit
@@ -100,59 +257,110 @@ func Run(ctx context.Context, db *sql.DB, logPath string, p *parser.Parser) erro
 	return nil
 }
 
-// rotatedFile represents a rotated log file with its numeric suffix for sorting.
+// rotatedFile represents a rotated log file with its numeric suffix or
+// date stamp for sorting. date is zero for numeric names.
 type rotatedFile struct {
 	path string
 	num  int
+	date time.Time
 }
 
-// findRotatedFiles scans dir for files matching {baseName}.{N} and
-// {baseName}.{N}.gz. Returns them sorted by N descending (oldest first,
-// since higher N = older in logrotate convention).
-func findRotatedFiles(dir, baseName string) ([]rotatedFile, error) {
+// dateLayouts are the date stamps recognised in rotated file names
+// (logrotate's dateext default and ISO dates)
+var dateLayouts = []string{"20060102", "2006-01-02"}
+
+// findRotatedFiles scans dir for rotated copies of baseName under pattern
+// (PatternAuto when empty): numeric names {baseName}.{N}[.gz] and
+// date-stamped names {baseName}-{date}[.gz] or {stem}-{date}{ext}[.gz]
+// (either separator '-' or '.'). Returns them oldest first: date-stamped
+// files chronologically, then numeric ones by N descending (higher N =
+// older in logrotate convention).
+func findRotatedFiles(dir, baseName, pattern string) ([]rotatedFile, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, fmt.Errorf("reading directory %s: %w", dir, err)
 	}
+	if pattern == "" {
+		pattern = PatternAuto
+	}
 
-	prefix := baseName + "."
 	var files []rotatedFile
-
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 		name := entry.Name()
-		if !strings.HasPrefix(name, prefix) {
-			continue
-		}
-
-		// Extract the part after baseName.
-		suffix := strings.TrimPrefix(name, prefix)
-
 		// Strip .gz if present
-		suffix = strings.TrimSuffix(suffix, ".gz")
+		trimmed := strings.TrimSuffix(name, ".gz")
 
-		// Must be a pure integer
-		n, err := strconv.Atoi(suffix)
-		if err != nil {
+		f := rotatedFile{path: filepath.Join(dir, name)}
+		switch {
+		case pattern != PatternNumeric && matchDateStamped(trimmed, baseName, &f.date):
+		case pattern != PatternDate && matchNumeric(trimmed, baseName, &f.num):
+		default:
 			continue
 		}
-
-		files = append(files, rotatedFile{
-			path: filepath.Join(dir, name),
-			num:  n,
-		})
+		files = append(files, f)
 	}
 
-	// Sort descending by N (highest number = oldest file, process first)
 	sort.Slice(files, func(i, j int) bool {
-		return files[i].num > files[j].num
+		a, b := files[i], files[j]
+		if a.date.IsZero() != b.date.IsZero() {
+			return !a.date.IsZero()
+		}
+		if !a.date.IsZero() {
+			return a.date.Before(b.date)
+		}
+		return a.num > b.num
 	})
 
 	return files, nil
 }
 
+// matchNumeric reports whether name is {baseName}.{N}, storing N in num.
+// Zero-padded suffixes (.0, .00, .01) are accepted.
+func matchNumeric(name, baseName string, num *int) bool {
+	suffix, ok := strings.CutPrefix(name, baseName+".")
+	if !ok || suffix == "" || strings.Trim(suffix, "0123456789") != "" {
+		return false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil {
+		return false
+	}
+	*num = n
+	return true
+}
+
+// matchDateStamped reports whether name is baseName with a date stamp
+// appended, or inserted before its extension, storing the date in date
+func matchDateStamped(name, baseName string, date *time.Time) bool {
+	var stamps []string
+	for _, sep := range []string{"-", "."} {
+		if stamp, ok := strings.CutPrefix(name, baseName+sep); ok {
+			stamps = append(stamps, stamp)
+		}
+		ext := filepath.Ext(baseName)
+		if ext == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(name, strings.TrimSuffix(baseName, ext)+sep); ok {
+			if stamp, ok := strings.CutSuffix(rest, ext); ok {
+				stamps = append(stamps, stamp)
+			}
+		}
+	}
+	for _, stamp := range stamps {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, stamp); err == nil {
+				*date = t
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // isImported checks if a rotated file has already been fully imported.
 // A file is considered imported if a log_position row exists with offset == size > 0.
 func isImported(db *sql.DB, path string) (bool, error) {
@@ -182,23 +390,24 @@ func markImported(db *sql.DB, path string, size int64) error {
 	return err
 }
 
-// processFile reads all lines from a rotated file and sends them to the channel.
-// Handles both plain text and gzip-compressed files.
-func processFile(ctx context.Context, f rotatedFile, lines chan<- string) error {
-	file, err := os.Open(f.path)
+// openLines opens path for scanning line by line, decompressing .gz files.
+// The returned close function releases the file.
+func openLines(path string) (*bufio.Scanner, func(), error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer file.Close()
 
 	var scanner *bufio.Scanner
+	closeAll := func() { file.Close() }
 
-	if strings.HasSuffix(f.path, ".gz") {
+	if strings.HasSuffix(path, ".gz") {
 		gz, err := gzip.NewReader(file)
 		if err != nil {
-			return fmt.Errorf("opening gzip reader: %w", err)
+			file.Close()
+			return nil, nil, fmt.Errorf("opening gzip reader: %w", err)
 		}
-		defer gz.Close()
+		closeAll = func() { gz.Close(); file.Close() }
 		scanner = bufio.NewScanner(gz)
 	} else {
 		scanner = bufio.NewScanner(file)
@@ -207,6 +416,34 @@ func processFile(ctx context.Context, f rotatedFile, lines chan<- string) error
 	// Set 1MB buffer for long lines
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
+	return scanner, closeAll, nil
+}
+
+// readSample reads up to n non-empty lines from path for format detection
+func readSample(path string, n int) ([]string, error) {
+	scanner, closeFile, err := openLines(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile()
+
+	var lines []string
+	for len(lines) < n && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// processFile reads all lines from a rotated file and sends them to the channel.
+// Handles both plain text and gzip-compressed files.
+func processFile(ctx context.Context, f rotatedFile, lines chan<- string) error {
+	scanner, closeFile, err := openLines(f.path)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
 
 	count := 0
 	for scanner.Scan() {
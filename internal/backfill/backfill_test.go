@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/open-wander/trail/internal/aggregator"
 	traildb "github.com/open-wander/trail/internal/db"
 	_ "modernc.org/sqlite"
 )
@@ -53,7 +54,7 @@ func TestFindRotatedFiles(t *testing.T) {
 		}
 	}
 
-	files, err := findRotatedFiles(dir, "access.log")
+	files, err := findRotatedFiles(dir, "access.log", PatternAuto)
 	if err != nil {
 		t.Fatalf("findRotatedFiles failed: %v", err)
 	}
@@ -79,7 +80,7 @@ func TestFindRotatedFiles_Empty(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	files, err := findRotatedFiles(dir, "access.log")
+	files, err := findRotatedFiles(dir, "access.log", PatternAuto)
 	if err != nil {
 		t.Fatalf("findRotatedFiles failed: %v", err)
 	}
@@ -89,6 +90,78 @@ func TestFindRotatedFiles_Empty(t *testing.T) {
 	}
 }
 
+func TestFindRotatedFiles_DateStamped(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{
+		"access.log",
+		"access.log-20260208",
+		"access.log-20260206.gz",
+		"access-2026-02-07.log",
+		"access.log.2026-02-05.gz",
+		"access.log-notadate",
+		"access-2026-02-09.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+
+	files, err := findRotatedFiles(dir, "access.log", PatternDate)
+	if err != nil {
+		t.Fatalf("findRotatedFiles failed: %v", err)
+	}
+
+	// Chronological, oldest first
+	want := []string{
+		"access.log.2026-02-05.gz",
+		"access.log-20260206.gz",
+		"access-2026-02-07.log",
+		"access.log-20260208",
+	}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d rotated files, got %d: %+v", len(want), len(files), files)
+	}
+	for i, f := range files {
+		if filepath.Base(f.path) != want[i] {
+			t.Errorf("file[%d] = %s, want %s", i, filepath.Base(f.path), want[i])
+		}
+	}
+}
+
+func TestFindRotatedFiles_ZeroPadded(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"access.log.00", "access.log.01.gz", "access.log.02.gz", "access.log-20260208"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+
+	files, err := findRotatedFiles(dir, "access.log", PatternNumeric)
+	if err != nil {
+		t.Fatalf("findRotatedFiles failed: %v", err)
+	}
+	expectedNums := []int{2, 1, 0}
+	if len(files) != len(expectedNums) {
+		t.Fatalf("expected %d rotated files, got %d: %+v", len(expectedNums), len(files), files)
+	}
+	for i, f := range files {
+		if f.num != expectedNums[i] {
+			t.Errorf("file[%d]: expected num=%d, got %d", i, expectedNums[i], f.num)
+		}
+	}
+
+	// Auto picks up both schemes, date-stamped files first
+	files, err = findRotatedFiles(dir, "access.log", PatternAuto)
+	if err != nil {
+		t.Fatalf("findRotatedFiles failed: %v", err)
+	}
+	if len(files) != 4 || filepath.Base(files[0].path) != "access.log-20260208" {
+		t.Errorf("auto pattern = %+v, want the date-stamped file then 3 numeric ones", files)
+	}
+}
+
 func TestProcessFile_PlainText(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "access.log.1")
@@ -330,3 +403,272 @@ func TestProcessFile_ContextCancelled(t *testing.T) {
 		t.Error("expected error from cancelled context")
 	}
 }
+
+func TestRunWithState_SeparateStateDB(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB(t)
+
+	stateDB, err := traildb.OpenState(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open state db: %v", err)
+	}
+	t.Cleanup(func() { stateDB.Close() })
+
+	logPath := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(logPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rotatedPath := filepath.Join(dir, "access.log.1")
+	if err := os.WriteFile(rotatedPath, []byte(sampleLogLine+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunWithState(context.Background(), db, stateDB, logPath, nil); err != nil {
+		t.Fatalf("RunWithState failed: %v", err)
+	}
+
+	// Aggregates go to the data DB
+	var reqCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM requests").Scan(&reqCount); err != nil {
+		t.Fatal(err)
+	}
+	if reqCount == 0 {
+		t.Error("expected requests in data DB after backfill, got 0")
+	}
+
+	// Positions and salt go to the state DB only
+	imported, err := isImported(stateDB, rotatedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imported {
+		t.Error("expected file marked imported in state DB")
+	}
+	if imported, _ := isImported(db, rotatedPath); imported {
+		t.Error("import position leaked into data DB")
+	}
+
+	var saltRows int
+	if err := stateDB.QueryRow("SELECT COUNT(*) FROM meta WHERE key = 'ip_salt'").Scan(&saltRows); err != nil {
+		t.Fatal(err)
+	}
+	if saltRows != 1 {
+		t.Errorf("expected IP salt in state DB, got %d rows", saltRows)
+	}
+	// The data DB only records its own schema version
+	if err := db.QueryRow("SELECT COUNT(*) FROM meta WHERE key != 'schema_version'").Scan(&saltRows); err != nil {
+		t.Fatal(err)
+	}
+	if saltRows != 0 {
+		t.Errorf("expected no state meta rows in data DB, got %d", saltRows)
+	}
+}
+
+func TestRun_MaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB(t)
+
+	logPath := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(logPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var rotated []string
+	for _, name := range []string{"access.log.1", "access.log.2", "access.log.3"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sampleLogLine+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rotated = append(rotated, path)
+	}
+
+	if err := RunWithOptions(context.Background(), db, logPath, nil, Options{MaxFiles: 2}); err != nil {
+		t.Fatalf("RunWithOptions failed: %v", err)
+	}
+
+	// access.log.3 is the oldest and stays out
+	for i, path := range rotated {
+		imported, err := isImported(db, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i < 2; imported != want {
+			t.Errorf("%s imported = %v, want %v", filepath.Base(path), imported, want)
+		}
+	}
+	var count int
+	if err := db.QueryRow("SELECT COALESCE(SUM(count), 0) FROM requests").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("requests = %d, want 2 from the newest two files", count)
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	db := testDB(t)
+	var logPaths []string
+	for _, name := range []string{"edge1", "edge2"} {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		logPath := filepath.Join(dir, "access.log")
+		if err := os.WriteFile(logPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(logPath+".1", []byte(sampleLogLine+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		logPaths = append(logPaths, logPath)
+	}
+
+	progress := &Progress{}
+	if err := RunFiles(context.Background(), db, logPaths, nil, Options{Progress: progress}); err != nil {
+		t.Fatalf("RunFiles failed: %v", err)
+	}
+
+	for _, logPath := range logPaths {
+		if imported, err := isImported(db, logPath+".1"); err != nil || !imported {
+			t.Errorf("%s.1 imported = %v (%v), want true", logPath, imported, err)
+		}
+	}
+	if s := progress.Snapshot(); s.FilesTotal != 2 || s.FilesDone != 2 {
+		t.Errorf("progress = %d/%d files, want 2/2 in one run", s.FilesDone, s.FilesTotal)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COALESCE(SUM(count), 0) FROM requests").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("requests = %d, want 2, one per log", count)
+	}
+}
+
+func TestRunFiles_AggregatorOptions(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(logPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	line := `10.0.0.1 - - [07/Jan/2026:17:00:00 +0000] "GET /about HTTP/1.1" 200 1234 "https://www.news.example.com/story/1?utm=x" "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36" 2 "web@docker" "http://172.19.0.4:80" 5ms`
+	unrouted := `10.0.0.2 - - [07/Jan/2026:17:00:00 +0000] "GET / HTTP/1.1" 404 0 "-" "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36" 3 "-" "-" 0ms`
+	if err := os.WriteFile(logPath+".1", []byte(line+"\n"+unrouted+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Aggregator: aggregator.Options{ReferrerPaths: true, MergeWWW: true, UnroutedIsReal: true, MaxPaths: 1}}
+	if err := RunFiles(context.Background(), db, []string{logPath}, nil, opts); err != nil {
+		t.Fatalf("RunFiles failed: %v", err)
+	}
+
+	var referrer string
+	if err := db.QueryRow("SELECT referrer FROM referrers").Scan(&referrer); err != nil {
+		t.Fatal(err)
+	}
+	if referrer != "news.example.com/story/1" {
+		t.Errorf("referrer = %q, want host and path without www. as with TRAIL_REFERRER_DETAIL=path and TRAIL_MERGE_WWW", referrer)
+	}
+
+	var unroutedVisitors int
+	if err := db.QueryRow("SELECT COUNT(*) FROM visitors WHERE router = 'unrouted'").Scan(&unroutedVisitors); err != nil {
+		t.Fatal(err)
+	}
+	if unroutedVisitors != 1 {
+		t.Errorf("unrouted visitors = %d, want 1 as with TRAIL_UNROUTED_IS_REAL", unroutedVisitors)
+	}
+
+	var folded int
+	if err := db.QueryRow("SELECT COUNT(*) FROM requests WHERE path = ?", aggregator.OtherKey).Scan(&folded); err != nil {
+		t.Fatal(err)
+	}
+	if folded != 1 {
+		t.Errorf("(other) request rows = %d, want 1 as with TRAIL_MAX_PATHS=1", folded)
+	}
+}
+
+func TestRun_Progress(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB(t)
+
+	logPath := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(logPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"access.log.1", "access.log.2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sampleLogLine+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	progress := &Progress{}
+	if err := RunWithOptions(context.Background(), db, logPath, nil, Options{Progress: progress}); err != nil {
+		t.Fatalf("RunWithOptions failed: %v", err)
+	}
+	got := progress.Snapshot()
+	if got.Running || got.FilesDone != 2 || got.FilesTotal != 2 || got.Current != "" || got.Error != "" || got.Finished == "" {
+		t.Errorf("progress = %+v, want 2 of 2 files done and finished", got)
+	}
+
+	// A cancelled run records why it stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := os.WriteFile(filepath.Join(dir, "access.log.3"), []byte(sampleLogLine+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunWithOptions(ctx, db, logPath, nil, Options{Progress: progress}); err == nil {
+		t.Fatal("RunWithOptions with a cancelled context succeeded")
+	}
+	got = progress.Snapshot()
+	if got.Running || got.FilesDone != 0 || got.FilesTotal != 1 || got.Error == "" {
+		t.Errorf("cancelled progress = %+v, want 0 of 1 files with an error", got)
+	}
+}
+
+func TestRunDir_ALB(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB(t)
+
+	albLine := `https 2026-02-08T16:00:00.186641Z app/my-lb/50dc6c495c0c9188 203.0.113.9:2817 10.0.0.1:80 0.001 0.020 0.000 200 200 34 366 "GET https://example.com:443/ HTTP/1.1" "Mozilla/5.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/web/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "example.com" "-" 0 2026-02-08T16:00:00.165000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
+
+	// S3 layout: one directory per day, gzipped objects
+	var objects []string
+	for _, day := range []string{"07", "08"} {
+		sub := filepath.Join(dir, "AWSLogs", "123456789012", "elasticloadbalancing", "us-east-2", "2026", "02", day)
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(sub, "123456789012_elasticloadbalancing_us-east-2_app.my-lb.50dc6c495c0c9188_202602"+day+"T1600Z_203.0.113.1_abc.log.gz")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gw := gzip.NewWriter(f)
+		if _, err := gw.Write([]byte(albLine + "\n" + albLine + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		gw.Close()
+		f.Close()
+		objects = append(objects, path)
+	}
+
+	for run := 1; run <= 2; run++ {
+		if err := RunDir(context.Background(), db, dir, nil, Options{}); err != nil {
+			t.Fatalf("RunDir run %d failed: %v", run, err)
+		}
+	}
+
+	for _, path := range objects {
+		if imported, err := isImported(db, path); err != nil || !imported {
+			t.Errorf("%s imported = %v, %v, want true", filepath.Base(path), imported, err)
+		}
+	}
+	var count int
+	var router string
+	if err := db.QueryRow("SELECT COALESCE(SUM(count), 0), MAX(router) FROM requests").Scan(&count, &router); err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 || router != "web" {
+		t.Errorf("requests = %d under %q, want 4 under the target group web, imported once", count, router)
+	}
+}
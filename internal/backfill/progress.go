@@ -0,0 +1,37 @@
+package backfill
+
+import "sync"
+
+// Progress tracks a backfill run for status reporting while it runs in the
+// background. Safe for concurrent use; a nil *Progress records nothing.
+type Progress struct {
+	mu    sync.Mutex
+	state ProgressState
+}
+
+// ProgressState is a point-in-time copy of a Progress
+type ProgressState struct {
+	Running    bool   `json:"running"`
+	FilesDone  int    `json:"files_done"`
+	FilesTotal int    `json:"files_total"`        // pending files; already-imported ones aren't counted
+	Current    string `json:"current,omitempty"`  // file being imported
+	Error      string `json:"error,omitempty"`    // why the run stopped early
+	Finished   string `json:"finished,omitempty"` // RFC 3339; empty while running
+}
+
+// Snapshot returns the current state
+func (p *Progress) Snapshot() ProgressState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// update applies fn to the state under the lock
+func (p *Progress) update(fn func(*ProgressState)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(&p.state)
+}
@@ -33,6 +33,13 @@ var knownBots = []string{
 	"twitterbot", "linkedinbot", "censysinspect", "cms-checker",
 }
 
+// SearchCrawlers are the knownBots names of search engine crawlers. They
+// crawl the sites they index by host name, so one that matched no router is
+// most likely a scanner borrowing the name.
+var SearchCrawlers = []string{
+	"googlebot", "bingbot", "yandexbot", "baiduspider", "duckduckbot", "slurp",
+}
+
 // Classify determines the category of a log entry based on router and User-Agent.
 // Returns one of: CategoryHuman, CategoryBot, or CategoryUnrouted.
 func Classify(entry *parser.LogEntry) string {
@@ -40,12 +47,15 @@ func Classify(entry *parser.LogEntry) string {
 	if entry.Router == "" {
 		return CategoryUnrouted
 	}
+	return ClassifyRouted(entry.UserAgent)
+}
 
-	// Check User-Agent for bot patterns
-	if isBot(entry.UserAgent) {
+// ClassifyRouted categorizes a request by User-Agent alone, as if a router
+// had matched. Returns CategoryBot or CategoryHuman.
+func ClassifyRouted(userAgent string) string {
+	if isBot(userAgent) {
 		return CategoryBot
 	}
-
 	return CategoryHuman
 }
 
@@ -186,3 +196,35 @@ func ClassifyUA(userAgent string) string {
 
 	return "unknown"
 }
+
+// UAClass is everything derived from a User-Agent string, so callers can
+// classify (and cache) a UA once per request
+type UAClass struct {
+	Bot     bool   // isBot; unrouted requests are categorized separately
+	Agent   string // ClassifyUA
+	Browser string // ClassifyBrowser
+	OS      string // ClassifyOS
+}
+
+// ClassifyAll runs every User-Agent classifier on userAgent
+func ClassifyAll(userAgent string) UAClass {
+	return UAClass{
+		Bot:     isBot(userAgent),
+		Agent:   ClassifyUA(userAgent),
+		Browser: ClassifyBrowser(userAgent),
+		OS:      ClassifyOS(userAgent),
+	}
+}
+
+// Category returns the request category for a UA of this class, matching
+// Classify for a request with or without a router
+func (c UAClass) Category(routed bool) string {
+	switch {
+	case !routed:
+		return CategoryUnrouted
+	case c.Bot:
+		return CategoryBot
+	default:
+		return CategoryHuman
+	}
+}
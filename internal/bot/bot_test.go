@@ -302,3 +302,25 @@ func BenchmarkClassifyUA(b *testing.B) {
 		ClassifyUA(userAgent)
 	}
 }
+
+func TestClassifyAll(t *testing.T) {
+	for _, ua := range []string{
+		"",
+		"Mozilla/5.0",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36 Edg/143.0.0.0",
+	} {
+		got := ClassifyAll(ua)
+		want := UAClass{Bot: isBot(ua), Agent: ClassifyUA(ua), Browser: ClassifyBrowser(ua), OS: ClassifyOS(ua)}
+		if got != want {
+			t.Errorf("ClassifyAll(%q) = %+v, want %+v", ua, got, want)
+		}
+		for _, router := range []string{"", "web@docker"} {
+			entry := &parser.LogEntry{Router: router, UserAgent: ua}
+			if got.Category(router != "") != Classify(entry) {
+				t.Errorf("Category(routed=%v) for %q = %q, want %q", router != "", ua, got.Category(router != ""), Classify(entry))
+			}
+		}
+	}
+}
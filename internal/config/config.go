@@ -3,53 +3,665 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 // Config holds all application configuration
 type Config struct {
-	LogFile       string // Path to Traefik access log file
-	DBPath        string // Path to SQLite database file
-	Listen        string // HTTP listen address
-	RetentionDays int    // Days to retain analytics data
-	LogFormat     string // Log format: "auto", "traefik", or "combined"
+	LogFile          string // Path to Traefik access log file; the first of LogFiles
+	DBPath           string // Path to SQLite database file
+	StateDBPath      string // Optional separate SQLite file for log positions and metadata; empty uses DBPath
+	Listen           string // HTTP listen address
+	RetentionDays    int    // Days to retain analytics data
+	LogFormat        string // Log format: "auto", "traefik", "combined", "caddy", "haproxy", "alb", "envoy", "multi" or a registered custom format
+	TraefikTemplate  string // Custom Traefik field layout, e.g. `{ip} [{time}] "{request}" {status}`; empty uses the stock CLF
+	DefaultRange     string // Dashboard range used when no ?range= is given: "today", "7d", or "30d"
+	RootJSON         string // Answer to / for clients preferring JSON: "json", "redirect" (to /healthz) or "html"
+	ReferrerDetail   string // Stored referrer detail: "domain" or "path" (query strings are always dropped)
+	RotationPattern  string // Rotated file naming for backfill: "auto", "numeric" or "date"
+	TailMode         string // How new log lines are noticed: "auto" (inotify where it works, else polling) or "poll"
+	DurationUnit     string // Unit of Combined request_time and template {duration}: "s", "ms", "us", "ns"; empty keeps the format's own
+	BytesField       string // Template field feeding bandwidth when both exist: "bytes" (on the wire) or "body_bytes"
+	NewerSchema      string // What to do with a database from a newer trail: "refuse" to start or serve it "readonly"
+	LargeDelete      string // Retention pass over RetentionMaxDeletePct: "warn", "block" or "allow"
+	MaxPaths         int    // Cap on distinct request keys per flush window and distinct paths per hour and router in the DB
+	MaxReferrers     int    // Cap on distinct referrer domains per flush window and per hour and router in the DB
+	MaxBreakdownRows int    // Rows shown per breakdown (methods, status codes, user agents, routers) before the rest fold into "Other"
+	DedupWindow      int    // Drop a line identical to one of the last N lines; 0 disables
+	BackfillMax      int    // Import only the newest N rotated files at startup; 0 imports all
+	BackfillAsync    bool   // Import rotated files in the background after the server starts
+	UACacheSize      int    // User-Agents whose bot/browser/OS classification is cached
+	FlushMaxKeys     int    // Flush early once this many distinct keys are buffered in memory
+
+	// Status codes counted as threats for formats without routers (combined);
+	// empty means any status >= 400
+	SuspiciousStatuses []int
+
+	// Methods shown individually alongside GET/POST/PUT/DELETE/PATCH/HEAD/OPTIONS,
+	// e.g. "PROPFIND,MKCOL" for WebDAV; others are grouped as "Other"
+	ExtraMethods []string
+
+	// Query-string params whose values are counted for human traffic,
+	// e.g. "q,category" for on-site search analytics
+	CaptureParams []string
+
+	// Path globs left out of every count, e.g. "/api/*,/healthz", and
+	// globs counted anyway although excluded, e.g. "/api/login"
+	ExcludePaths []string
+	IncludePaths []string
+
+	// Every log file to tail, from TRAIL_LOG_FILE's comma-separated paths
+	// and globs. Empty when logs only arrive over syslog or pushes.
+	LogFiles []string
+
+	// Address of the syslog listener, e.g. ":514" for UDP and TCP or
+	// "udp://:514" (checked by syslog.ParseListen); empty disables it
+	SyslogListen string
+
+	// Apply PathRules, semicolon-separated regex=replacement rewrites
+	// (compiled by aggregator.ParsePathRules), then count ID path segments
+	// (numbers, UUIDs, hex digests) as :id, :uuid and :hash
+	NormalizeIDs bool
+	PathRules    string
+
+	// Routers below this share (%) of all-time requests are grouped under
+	// "(other routers)" in the router selector; 0 lists every router
+	RouterMinPct float64
+
+	// Count traffic no router matched as real traffic (visitors, dashboards)
+	// instead of scanner noise, for single-service setups with a catch-all
+	UnroutedIsReal bool
+
+	// Fold redirects that only add or drop a trailing slash, and whose
+	// target answers 2xx, into one summary row of the redirects panel
+	MergeSlashRedirects bool
+
+	// Hour (UTC, 0-23) the hour-of-day chart starts at, so a business day
+	// reads left to right; 0 keeps the plain 0-23 order
+	HourOfDayStart int
+
+	// Sub-hour bucket width (minutes) for the short-lived requests_fine table
+	// behind near-real-time views; 0 disables it
+	FineBucketMinutes int
+
+	// How long requests_fine rows are kept
+	FineRetentionHours int
+
+	// Leading path segments the sections panel groups by by default, e.g.
+	// 1 for /blog, 2 for /docs/api
+	SectionDepth int
+
+	// Durations kept as a random sample per hour and router for exact
+	// percentiles; 0 (default) interpolates from the histogram instead
+	DurationSamples int
+
+	// Statuses below this count as successes in the success rate card
+	// (400: 2xx and 3xx); with SuccessIgnore404 404s are left out of the rate
+	SuccessStatusBelow int
+	SuccessIgnore404   bool
+
+	// A visitor's hits more than this many hours apart count as separate
+	// visits in the Visits card
+	VisitGapHours int
+
+	// Runs of at least this many hours with (near) no requests are flagged
+	// as possible outages on the requests chart; 0 disables
+	OutageMinHours int
+
+	// Avg and p95 latencies at or above these (ms) are colored amber and
+	// red in the path tables and percentile cards
+	LatencyWarnMs int
+	LatencyCritMs int
+
+	// Keep the proxy-assigned request IDs of recent 5xx responses so they
+	// can be looked up in upstream logs; off by default
+	RequestIDs bool
+
+	// Also count full User-Agent strings (capped like referrers); off by
+	// default because of their cardinality
+	RawUserAgents bool
+
+	// Also count 429 responses per client IP hash (capped like referrers)
+	// for the rate-limit panel; off by default
+	RateLimitIPs bool
+
+	// Keep the newest RawMaxRows parsed requests one by one in requests_raw
+	// for the recent requests panel and drilldowns; off by default
+	StoreRaw   bool
+	RawMaxRows int
+
+	// Record which paths each unrouted client requests (capped like
+	// referrers) to rank scanners by breadth; off by default
+	ScannerPaths bool
+
+	// Path globs of login endpoints, e.g. "/login,/wp-login.php,/api/auth/*",
+	// whose 401/403 responses are counted per client IP hash to spot
+	// credential stuffing; empty disables
+	AuthPaths []string
+
+	// Path whose visits are attributed to the referrer and entry path that
+	// began the visitor-hour, e.g. /signup/complete; empty disables
+	GoalPath string
+
+	// Labels of the trail_requests_current_hour series on /metrics (any of router,
+	// path, status), and how many of the hour's busiest paths get their own
+	// series when path is one; the rest share path="(other)"
+	MetricsLabels   []string
+	MetricsMaxPaths int
+
+	// Store www.example.com referrers and requested hosts as example.com;
+	// off by default for setups that care about the www split
+	MergeWWW bool
+
+	// Warn (or with LargeDelete "block", stop) when a retention pass would
+	// delete more than this percentage of requests rows; 0 disables the check
+	RetentionMaxDeletePct int
+
+	// The newest chart bucket is marked partial (drawn faded) until this
+	// percentage of its hour or day has passed; 0 never marks it
+	MinBucketCompletePct int
+
+	// Per-router retention overrides (router -> days), e.g. "health@docker=3,legacy=14"
+	RouterRetention map[string]int
 
 	// Authentication settings (all optional)
 	HtpasswdFile string // Path to htpasswd file for authentication
 	AuthUser     string // Basic auth username (plaintext)
 	AuthPass     string // Basic auth password (plaintext)
 
+	// Session-cookie login for the dashboard, checked against the same
+	// credentials; basic auth keeps working for API clients
+	SessionLogin    bool
+	SessionTTLHours int    // How long a login cookie stays valid
+	SessionSecret   string // Cookie signing key; empty generates one per start, logging everyone out on restart
+
+	// Bearer token remote hosts push log lines to POST /api/ingest with;
+	// empty disables the endpoint
+	IngestToken string
+
 	// GeoIP settings (optional)
-	GeoIPPath string // Path to MaxMind/DB-IP mmdb file for country lookup
+	GeoIPPath      string // Path to MaxMind/DB-IP mmdb file for country lookup
+	GeoIPCacheSize int    // IPs whose country is cached between lookups
+	GeoIPUnknown   bool   // Count IPs GeoIP can't place as "Unknown" so country percentages cover all traffic
+
+	// Threat list (optional): known-bad IPs/CIDRs, one per line, reloaded on change
+	ThreatIPsFile string
+
+	// Directory of dashboard templates to use instead of the embedded ones
+	// (optional); it must hold every template
+	TemplateDir string
 }
 
+// maxDurationSamples caps TRAIL_DURATION_SAMPLES (aggregator.MaxDurationSamples)
+const maxDurationSamples = 10000
+
+// maxSectionDepth caps TRAIL_SECTION_DEPTH (server.MaxSectionDepth)
+const maxSectionDepth = 5
+
+// Stdin as a TRAIL_LOG_FILE entry reads log lines from standard input
+const Stdin = "-"
+
 // Load reads configuration from environment variables and applies defaults
 func Load() (*Config, error) {
 	cfg := &Config{
-		LogFile:       getEnvOrDefault("TRAIL_LOG_FILE", "/logs/access.log"),
-		DBPath:        getEnvOrDefault("TRAIL_DB_PATH", "/data/trail.db"),
-		Listen:        getEnvOrDefault("TRAIL_LISTEN", ":8080"),
-		LogFormat:     getEnvOrDefault("TRAIL_LOG_FORMAT", "auto"),
-		HtpasswdFile:  os.Getenv("TRAIL_HTPASSWD_FILE"),
-		AuthUser:      os.Getenv("TRAIL_AUTH_USER"),
-		AuthPass:      os.Getenv("TRAIL_AUTH_PASS"),
-		GeoIPPath:     os.Getenv("TRAIL_GEOIP_PATH"),
+		DBPath:          getEnvOrDefault("TRAIL_DB_PATH", "/data/trail.db"),
+		StateDBPath:     os.Getenv("TRAIL_STATE_DB"),
+		Listen:          getEnvOrDefault("TRAIL_LISTEN", ":8080"),
+		LogFormat:       getEnvOrDefault("TRAIL_LOG_FORMAT", "auto"),
+		TraefikTemplate: os.Getenv("TRAIL_TRAEFIK_TEMPLATE"),
+		DurationUnit:    os.Getenv("TRAIL_DURATION_UNIT"),
+		BytesField:      getEnvOrDefault("TRAIL_BYTES_FIELD", "bytes"),
+		NewerSchema:     getEnvOrDefault("TRAIL_NEWER_SCHEMA", "refuse"),
+		DefaultRange:    getEnvOrDefault("TRAIL_DEFAULT_RANGE", "today"),
+		RootJSON:        getEnvOrDefault("TRAIL_ROOT_JSON", "json"),
+		ReferrerDetail:  getEnvOrDefault("TRAIL_REFERRER_DETAIL", "domain"),
+		RotationPattern: getEnvOrDefault("TRAIL_ROTATION_PATTERN", "auto"),
+		TailMode:        getEnvOrDefault("TRAIL_TAIL_MODE", "auto"),
+		LargeDelete:     getEnvOrDefault("TRAIL_RETENTION_LARGE_DELETE", "warn"),
+		HtpasswdFile:    os.Getenv("TRAIL_HTPASSWD_FILE"),
+		AuthUser:        os.Getenv("TRAIL_AUTH_USER"),
+		AuthPass:        os.Getenv("TRAIL_AUTH_PASS"),
+		SessionSecret:   os.Getenv("TRAIL_SESSION_SECRET"),
+		IngestToken:     os.Getenv("TRAIL_INGEST_TOKEN"),
+		GeoIPPath:       os.Getenv("TRAIL_GEOIP_PATH"),
+		ThreatIPsFile:   os.Getenv("TRAIL_THREAT_IPS_FILE"),
+		TemplateDir:     os.Getenv("TRAIL_TEMPLATE_DIR"),
+		GoalPath:        os.Getenv("TRAIL_GOAL_PATH"),
 	}
 
 	// Parse retention days with default
-	retentionStr := getEnvOrDefault("TRAIL_RETENTION_DAYS", "90")
-	retentionDays, err := strconv.Atoi(retentionStr)
+	retentionDays, err := getEnvPositiveInt("TRAIL_RETENTION_DAYS", 90)
 	if err != nil {
-		return nil, fmt.Errorf("invalid TRAIL_RETENTION_DAYS: %w", err)
-	}
-	if retentionDays <= 0 {
-		return nil, fmt.Errorf("TRAIL_RETENTION_DAYS must be positive, got %d", retentionDays)
+		return nil, err
 	}
 	cfg.RetentionDays = retentionDays
 
+	if cfg.RetentionMaxDeletePct, err = strconv.Atoi(getEnvOrDefault("TRAIL_RETENTION_MAX_DELETE_PCT", "50")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_RETENTION_MAX_DELETE_PCT: %w", err)
+	}
+	if cfg.RetentionMaxDeletePct < 0 || cfg.RetentionMaxDeletePct > 100 {
+		return nil, fmt.Errorf("TRAIL_RETENTION_MAX_DELETE_PCT must be between 0 and 100, got %d", cfg.RetentionMaxDeletePct)
+	}
+
+	if cfg.RouterRetention, err = parseRouterRetention(os.Getenv("TRAIL_ROUTER_RETENTION")); err != nil {
+		return nil, err
+	}
+
+	if cfg.SuspiciousStatuses, err = parseStatusList(os.Getenv("TRAIL_SUSPICIOUS_STATUSES")); err != nil {
+		return nil, err
+	}
+
+	cfg.ExtraMethods = parseMethodList(os.Getenv("TRAIL_EXTRA_METHODS"))
+	cfg.CaptureParams = parseNameList(os.Getenv("TRAIL_CAPTURE_PARAMS"))
+	// With a syslog listener or pushes only an explicit TRAIL_LOG_FILE is
+	// tailed too
+	cfg.SyslogListen = os.Getenv("TRAIL_SYSLOG_LISTEN")
+	if (cfg.SyslogListen == "" && cfg.IngestToken == "") || os.Getenv("TRAIL_LOG_FILE") != "" {
+		if cfg.LogFiles, err = parseLogFiles(getEnvOrDefault("TRAIL_LOG_FILE", "/logs/access.log")); err != nil {
+			return nil, err
+		}
+		cfg.LogFile = cfg.LogFiles[0]
+	}
+	if cfg.ExcludePaths, err = parsePathPatterns("TRAIL_EXCLUDE_PATHS", os.Getenv("TRAIL_EXCLUDE_PATHS")); err != nil {
+		return nil, err
+	}
+	if cfg.IncludePaths, err = parsePathPatterns("TRAIL_INCLUDE_PATHS", os.Getenv("TRAIL_INCLUDE_PATHS")); err != nil {
+		return nil, err
+	}
+	cfg.PathRules = os.Getenv("TRAIL_PATH_RULES")
+	if cfg.NormalizeIDs, err = strconv.ParseBool(getEnvOrDefault("TRAIL_NORMALIZE_IDS", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_NORMALIZE_IDS: %w", err)
+	}
+	if cfg.AuthPaths, err = parsePathPatterns("TRAIL_AUTH_PATHS", os.Getenv("TRAIL_AUTH_PATHS")); err != nil {
+		return nil, err
+	}
+
+	// Cardinality caps guarding against floods of unique paths/referrers
+	if cfg.MaxPaths, err = getEnvPositiveInt("TRAIL_MAX_PATHS", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.MaxReferrers, err = getEnvPositiveInt("TRAIL_MAX_REFERRERS", 2000); err != nil {
+		return nil, err
+	}
+	if cfg.MaxBreakdownRows, err = getEnvPositiveInt("TRAIL_MAX_BREAKDOWN_ROWS", 50); err != nil {
+		return nil, err
+	}
+	if cfg.FlushMaxKeys, err = getEnvPositiveInt("TRAIL_FLUSH_MAX_KEYS", 50000); err != nil {
+		return nil, err
+	}
+	if cfg.GeoIPCacheSize, err = getEnvPositiveInt("TRAIL_GEOIP_CACHE_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.UACacheSize, err = getEnvPositiveInt("TRAIL_UA_CACHE_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.GeoIPUnknown, err = strconv.ParseBool(getEnvOrDefault("TRAIL_GEOIP_UNKNOWN", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_GEOIP_UNKNOWN: %w", err)
+	}
+
+	// Opt-in guard against double-reads after a mis-detected rotation
+	if cfg.DedupWindow, err = strconv.Atoi(getEnvOrDefault("TRAIL_DEDUP_WINDOW", "0")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_DEDUP_WINDOW: %w", err)
+	}
+	if cfg.DedupWindow < 0 {
+		return nil, fmt.Errorf("TRAIL_DEDUP_WINDOW must not be negative, got %d", cfg.DedupWindow)
+	}
+
+	if cfg.RouterMinPct, err = strconv.ParseFloat(getEnvOrDefault("TRAIL_ROUTER_MIN_PCT", "0"), 64); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_ROUTER_MIN_PCT: %w", err)
+	}
+	if cfg.RouterMinPct < 0 || cfg.RouterMinPct > 100 {
+		return nil, fmt.Errorf("TRAIL_ROUTER_MIN_PCT must be between 0 and 100, got %g", cfg.RouterMinPct)
+	}
+
+	if cfg.UnroutedIsReal, err = strconv.ParseBool(getEnvOrDefault("TRAIL_UNROUTED_IS_REAL", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_UNROUTED_IS_REAL: %w", err)
+	}
+
+	if cfg.MergeSlashRedirects, err = strconv.ParseBool(getEnvOrDefault("TRAIL_MERGE_SLASH_REDIRECTS", "true")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_MERGE_SLASH_REDIRECTS: %w", err)
+	}
+
+	if cfg.SuccessStatusBelow, err = strconv.Atoi(getEnvOrDefault("TRAIL_SUCCESS_STATUS_BELOW", "400")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_SUCCESS_STATUS_BELOW: %w", err)
+	}
+	if cfg.SuccessStatusBelow < 200 || cfg.SuccessStatusBelow > 600 {
+		return nil, fmt.Errorf("TRAIL_SUCCESS_STATUS_BELOW must be between 200 and 600, got %d", cfg.SuccessStatusBelow)
+	}
+	if cfg.VisitGapHours, err = getEnvPositiveInt("TRAIL_VISIT_GAP_HOURS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.VisitGapHours > 24 {
+		return nil, fmt.Errorf("TRAIL_VISIT_GAP_HOURS must be at most 24, got %d", cfg.VisitGapHours)
+	}
+	if cfg.OutageMinHours, err = strconv.Atoi(getEnvOrDefault("TRAIL_OUTAGE_MIN_HOURS", "3")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_OUTAGE_MIN_HOURS: %w", err)
+	}
+	if cfg.OutageMinHours < 0 {
+		return nil, fmt.Errorf("TRAIL_OUTAGE_MIN_HOURS must not be negative, got %d", cfg.OutageMinHours)
+	}
+
+	if cfg.LatencyWarnMs, err = getEnvPositiveInt("TRAIL_LATENCY_WARN_MS", 300); err != nil {
+		return nil, err
+	}
+	if cfg.LatencyCritMs, err = getEnvPositiveInt("TRAIL_LATENCY_CRIT_MS", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.LatencyWarnMs >= cfg.LatencyCritMs {
+		return nil, fmt.Errorf("TRAIL_LATENCY_WARN_MS must be below TRAIL_LATENCY_CRIT_MS, got %d and %d", cfg.LatencyWarnMs, cfg.LatencyCritMs)
+	}
+	if cfg.SuccessIgnore404, err = strconv.ParseBool(getEnvOrDefault("TRAIL_SUCCESS_IGNORE_404", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_SUCCESS_IGNORE_404: %w", err)
+	}
+
+	if cfg.RequestIDs, err = strconv.ParseBool(getEnvOrDefault("TRAIL_REQUEST_IDS", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_REQUEST_IDS: %w", err)
+	}
+	if cfg.RawUserAgents, err = strconv.ParseBool(getEnvOrDefault("TRAIL_RAW_USER_AGENTS", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_RAW_USER_AGENTS: %w", err)
+	}
+	if cfg.StoreRaw, err = strconv.ParseBool(getEnvOrDefault("TRAIL_STORE_RAW", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_STORE_RAW: %w", err)
+	}
+	if cfg.RateLimitIPs, err = strconv.ParseBool(getEnvOrDefault("TRAIL_RATE_LIMIT_IPS", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_RATE_LIMIT_IPS: %w", err)
+	}
+	if cfg.ScannerPaths, err = strconv.ParseBool(getEnvOrDefault("TRAIL_SCANNER_PATHS", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_SCANNER_PATHS: %w", err)
+	}
+	if cfg.GoalPath != "" && !strings.HasPrefix(cfg.GoalPath, "/") {
+		return nil, fmt.Errorf("TRAIL_GOAL_PATH must be a path starting with /, got %q", cfg.GoalPath)
+	}
+	if cfg.MetricsLabels, err = parseMetricsLabels(getEnvOrDefault("TRAIL_METRICS_LABELS", "router")); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsMaxPaths, err = getEnvPositiveInt("TRAIL_METRICS_MAX_PATHS", 50); err != nil {
+		return nil, err
+	}
+	if cfg.MergeWWW, err = strconv.ParseBool(getEnvOrDefault("TRAIL_MERGE_WWW", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_MERGE_WWW: %w", err)
+	}
+
+	if cfg.SessionLogin, err = strconv.ParseBool(getEnvOrDefault("TRAIL_SESSION_LOGIN", "false")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_SESSION_LOGIN: %w", err)
+	}
+	if cfg.SessionTTLHours, err = getEnvPositiveInt("TRAIL_SESSION_TTL_HOURS", 24); err != nil {
+		return nil, err
+	}
+
+	if cfg.MinBucketCompletePct, err = strconv.Atoi(getEnvOrDefault("TRAIL_MIN_BUCKET_COMPLETE_PCT", "100")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_MIN_BUCKET_COMPLETE_PCT: %w", err)
+	}
+	if cfg.MinBucketCompletePct < 0 || cfg.MinBucketCompletePct > 100 {
+		return nil, fmt.Errorf("TRAIL_MIN_BUCKET_COMPLETE_PCT must be between 0 and 100, got %d", cfg.MinBucketCompletePct)
+	}
+
+	if cfg.HourOfDayStart, err = strconv.Atoi(getEnvOrDefault("TRAIL_HOUR_OF_DAY_START", "0")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_HOUR_OF_DAY_START: %w", err)
+	}
+	if cfg.HourOfDayStart < 0 || cfg.HourOfDayStart > 23 {
+		return nil, fmt.Errorf("TRAIL_HOUR_OF_DAY_START must be between 0 and 23, got %d", cfg.HourOfDayStart)
+	}
+
+	if cfg.FineBucketMinutes, err = strconv.Atoi(getEnvOrDefault("TRAIL_FINE_BUCKET_MINUTES", "0")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_FINE_BUCKET_MINUTES: %w", err)
+	}
+	if cfg.FineBucketMinutes < 0 || cfg.FineBucketMinutes >= 60 || (cfg.FineBucketMinutes > 0 && 60%cfg.FineBucketMinutes != 0) {
+		return nil, fmt.Errorf("TRAIL_FINE_BUCKET_MINUTES must be 0 or divide the hour (e.g. 5, 10, 15), got %d", cfg.FineBucketMinutes)
+	}
+	if cfg.FineRetentionHours, err = getEnvPositiveInt("TRAIL_FINE_RETENTION_HOURS", 48); err != nil {
+		return nil, err
+	}
+	if cfg.RawMaxRows, err = getEnvPositiveInt("TRAIL_RAW_MAX_ROWS", 50000); err != nil {
+		return nil, err
+	}
+	if cfg.SectionDepth, err = getEnvPositiveInt("TRAIL_SECTION_DEPTH", 1); err != nil {
+		return nil, err
+	}
+	if cfg.SectionDepth > maxSectionDepth {
+		return nil, fmt.Errorf("TRAIL_SECTION_DEPTH must be at most %d, got %d", maxSectionDepth, cfg.SectionDepth)
+	}
+	if cfg.DurationSamples, err = strconv.Atoi(getEnvOrDefault("TRAIL_DURATION_SAMPLES", "0")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_DURATION_SAMPLES: %w", err)
+	}
+	if cfg.DurationSamples < 0 || cfg.DurationSamples > maxDurationSamples {
+		return nil, fmt.Errorf("TRAIL_DURATION_SAMPLES must be between 0 and %d, got %d", maxDurationSamples, cfg.DurationSamples)
+	}
+
+	switch cfg.DefaultRange {
+	case "today", "7d", "30d":
+	default:
+		return nil, fmt.Errorf("TRAIL_DEFAULT_RANGE must be one of today, 7d, 30d, got %q", cfg.DefaultRange)
+	}
+
+	switch cfg.DurationUnit {
+	case "", "s", "ms", "us", "ns":
+	default:
+		return nil, fmt.Errorf("TRAIL_DURATION_UNIT must be one of s, ms, us, ns, got %q", cfg.DurationUnit)
+	}
+
+	switch cfg.BytesField {
+	case "bytes", "body_bytes":
+	default:
+		return nil, fmt.Errorf("TRAIL_BYTES_FIELD must be one of bytes, body_bytes, got %q", cfg.BytesField)
+	}
+
+	switch cfg.NewerSchema {
+	case "refuse", "readonly":
+	default:
+		return nil, fmt.Errorf("TRAIL_NEWER_SCHEMA must be one of refuse, readonly, got %q", cfg.NewerSchema)
+	}
+
+	switch cfg.RootJSON {
+	case "json", "redirect", "html":
+	default:
+		return nil, fmt.Errorf("TRAIL_ROOT_JSON must be one of json, redirect, html, got %q", cfg.RootJSON)
+	}
+
+	switch cfg.ReferrerDetail {
+	case "domain", "path":
+	default:
+		return nil, fmt.Errorf("TRAIL_REFERRER_DETAIL must be one of domain, path, got %q", cfg.ReferrerDetail)
+	}
+
+	if cfg.BackfillMax, err = strconv.Atoi(getEnvOrDefault("TRAIL_BACKFILL_MAX_FILES", "0")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_BACKFILL_MAX_FILES: %w", err)
+	}
+	if cfg.BackfillMax < 0 {
+		return nil, fmt.Errorf("TRAIL_BACKFILL_MAX_FILES must not be negative, got %d", cfg.BackfillMax)
+	}
+	if cfg.BackfillAsync, err = strconv.ParseBool(getEnvOrDefault("TRAIL_BACKFILL_ASYNC", "true")); err != nil {
+		return nil, fmt.Errorf("invalid TRAIL_BACKFILL_ASYNC: %w", err)
+	}
+
+	switch cfg.RotationPattern {
+	case "auto", "numeric", "date":
+	default:
+		return nil, fmt.Errorf("TRAIL_ROTATION_PATTERN must be one of auto, numeric, date, got %q", cfg.RotationPattern)
+	}
+
+	switch cfg.TailMode {
+	case "auto", "poll":
+	default:
+		return nil, fmt.Errorf("TRAIL_TAIL_MODE must be one of auto, poll, got %q", cfg.TailMode)
+	}
+
+	switch cfg.LargeDelete {
+	case "warn", "block", "allow":
+	default:
+		return nil, fmt.Errorf("TRAIL_RETENTION_LARGE_DELETE must be one of warn, block, allow, got %q", cfg.LargeDelete)
+	}
+
 	return cfg, nil
 }
 
+// parseRouterRetention parses "router=days,router=days" into a map.
+// An empty string yields a nil map.
+func parseRouterRetention(s string) (map[string]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	out := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid TRAIL_ROUTER_RETENTION entry %q: want router=days", pair)
+		}
+		router := strings.TrimSpace(pair[:i])
+		days, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid TRAIL_ROUTER_RETENTION entry %q: days must be a positive integer", pair)
+		}
+		out[router] = days
+	}
+	return out, nil
+}
+
+// parseStatusList parses a comma-separated list of HTTP status codes.
+// An empty string yields a nil slice.
+func parseStatusList(s string) ([]int, error) {
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid TRAIL_SUSPICIOUS_STATUSES entry %q: want an HTTP status code", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseMethodList parses a comma-separated list of HTTP methods, upper-cased.
+// An empty string yields a nil slice.
+func parseMethodList(s string) []string {
+	var methods []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if part != "" {
+			methods = append(methods, part)
+		}
+	}
+	return methods
+}
+
+// parseNameList parses a comma-separated list of names, trimming spaces.
+// Case is kept. An empty string yields a nil slice.
+func parseNameList(s string) []string {
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			names = append(names, part)
+		}
+	}
+	return names
+}
+
+// parseMetricsLabels parses the comma-separated labels of the
+// trail_requests_current_hour series, lower-cased, rejecting unknown ones.
+// "none" yields a nil slice: one series for the whole hour.
+func parseMetricsLabels(s string) ([]string, error) {
+	var labels []string
+	for _, label := range parseNameList(strings.ToLower(s)) {
+		switch label {
+		case "router", "path", "status":
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		case "none":
+		default:
+			return nil, fmt.Errorf("invalid TRAIL_METRICS_LABELS entry %q: want router, path, status or none", label)
+		}
+	}
+	return labels, nil
+}
+
+// redactedValue stands in for a secret in Redacted
+const redactedValue = "[redacted]"
+
+// Redacted returns a copy of c that is safe to show to operators: secrets
+// that are set read "[redacted]", unset ones stay empty. Slices and maps
+// are shared with c.
+func (c *Config) Redacted() Config {
+	r := *c
+	for _, secret := range []*string{&r.AuthPass, &r.SessionSecret, &r.IngestToken} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return r
+}
+
+// parsePathPatterns parses a comma-separated list of path globs, rejecting
+// malformed ones. An empty string yields a nil slice.
+func parsePathPatterns(key, s string) ([]string, error) {
+	patterns := parseNameList(s)
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", key, p, err)
+		}
+	}
+	return patterns, nil
+}
+
+// parseLogFiles parses TRAIL_LOG_FILE: comma-separated paths, where a path
+// with glob characters expands (once, at startup) to the files it matches,
+// leaving out .gz files. A plain path needn't exist yet, but a glob must
+// match something. Files named twice are tailed once. Stdin ("-") is kept
+// as is.
+func parseLogFiles(s string) ([]string, error) {
+	var files []string
+	add := func(f string) {
+		if !slices.Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+	for _, p := range parseNameList(s) {
+		if !strings.ContainsAny(p, "*?[") {
+			add(p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRAIL_LOG_FILE pattern %q: %w", p, err)
+		}
+		matches = slices.DeleteFunc(matches, func(m string) bool { return strings.HasSuffix(m, ".gz") })
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("TRAIL_LOG_FILE pattern %q matches no log files", p)
+		}
+		for _, m := range matches {
+			add(m)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("TRAIL_LOG_FILE is empty")
+	}
+	return files, nil
+}
+
+// getEnvPositiveInt parses an integer environment variable that must be > 0
+func getEnvPositiveInt(key string, defaultValue int) (int, error) {
+	n, err := strconv.Atoi(getEnvOrDefault(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %d", key, n)
+	}
+	return n, nil
+}
+
 // getEnvOrDefault returns the environment variable value or the default if not set
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
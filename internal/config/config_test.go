@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -16,38 +18,171 @@ func TestLoad(t *testing.T) {
 			name:    "all defaults",
 			envVars: map[string]string{},
 			want: &Config{
-				LogFile:       "/logs/access.log",
-				DBPath:        "/data/trail.db",
-				Listen:        ":8080",
-				RetentionDays: 90,
-				HtpasswdFile:  "",
-				AuthUser:      "",
-				AuthPass:      "",
-				GeoIPPath:     "",
+				LogFile:               "/logs/access.log",
+				DBPath:                "/data/trail.db",
+				Listen:                ":8080",
+				RetentionDays:         90,
+				RetentionMaxDeletePct: 50,
+				LargeDelete:           "warn",
+				DefaultRange:          "today",
+				RootJSON:              "json",
+				ReferrerDetail:        "domain",
+				BytesField:            "bytes",
+				NewerSchema:           "refuse",
+				RotationPattern:       "auto",
+				TailMode:              "auto",
+				BackfillAsync:         true,
+				MergeSlashRedirects:   true,
+				SuccessStatusBelow:    400,
+				VisitGapHours:         1,
+				OutageMinHours:        3,
+				LatencyWarnMs:         300,
+				LatencyCritMs:         1000,
+				MinBucketCompletePct:  100,
+				MaxPaths:              10000,
+				MaxReferrers:          2000,
+				MaxBreakdownRows:      50,
+				FlushMaxKeys:          50000,
+				FineRetentionHours:    48,
+				RawMaxRows:            50000,
+				MetricsMaxPaths:       50,
+				SectionDepth:          1,
+				HtpasswdFile:          "",
+				AuthUser:              "",
+				AuthPass:              "",
+				SessionTTLHours:       24,
+				GeoIPPath:             "",
+				ThreatIPsFile:         "",
+				GeoIPCacheSize:        10000,
+				UACacheSize:           1000,
 			},
 			wantErr: false,
 		},
 		{
 			name: "all custom values",
 			envVars: map[string]string{
-				"TRAIL_LOG_FILE":       "/custom/access.log",
-				"TRAIL_DB_PATH":        "/custom/trail.db",
-				"TRAIL_LISTEN":         ":3000",
-				"TRAIL_RETENTION_DAYS": "30",
-				"TRAIL_HTPASSWD_FILE":  "/etc/htpasswd",
-				"TRAIL_AUTH_USER":      "admin",
-				"TRAIL_AUTH_PASS":      "secret",
-				"TRAIL_GEOIP_PATH":     "/geoip/dbip-country-lite.mmdb",
+				"TRAIL_LOG_FILE":                 "/custom/access.log",
+				"TRAIL_DB_PATH":                  "/custom/trail.db",
+				"TRAIL_STATE_DB":                 "/custom/state.db",
+				"TRAIL_LISTEN":                   ":3000",
+				"TRAIL_RETENTION_DAYS":           "30",
+				"TRAIL_HTPASSWD_FILE":            "/etc/htpasswd",
+				"TRAIL_AUTH_USER":                "admin",
+				"TRAIL_AUTH_PASS":                "secret",
+				"TRAIL_SESSION_LOGIN":            "true",
+				"TRAIL_SESSION_TTL_HOURS":        "8",
+				"TRAIL_SESSION_SECRET":           "s3cret-key",
+				"TRAIL_GEOIP_PATH":               "/geoip/dbip-country-lite.mmdb",
+				"TRAIL_THREAT_IPS_FILE":          "/etc/trail/threats.txt",
+				"TRAIL_TEMPLATE_DIR":             "/etc/trail/templates",
+				"TRAIL_GEOIP_CACHE_SIZE":         "500",
+				"TRAIL_GEOIP_UNKNOWN":            "true",
+				"TRAIL_VISIT_GAP_HOURS":          "3",
+				"TRAIL_OUTAGE_MIN_HOURS":         "0",
+				"TRAIL_LATENCY_WARN_MS":          "200",
+				"TRAIL_LATENCY_CRIT_MS":          "800",
+				"TRAIL_RETENTION_MAX_DELETE_PCT": "80",
+				"TRAIL_RETENTION_LARGE_DELETE":   "block",
+				"TRAIL_UA_CACHE_SIZE":            "64",
+				"TRAIL_DEFAULT_RANGE":            "7d",
+				"TRAIL_ROOT_JSON":                "redirect",
+				"TRAIL_MAX_PATHS":                "500",
+				"TRAIL_MAX_BREAKDOWN_ROWS":       "20",
+				"TRAIL_MAX_REFERRERS":            "50",
+				"TRAIL_DEDUP_WINDOW":             "5000",
+				"TRAIL_FLUSH_MAX_KEYS":           "1000",
+				"TRAIL_ROUTER_MIN_PCT":           "0.5",
+				"TRAIL_UNROUTED_IS_REAL":         "true",
+				"TRAIL_MERGE_SLASH_REDIRECTS":    "false",
+				"TRAIL_HOUR_OF_DAY_START":        "6",
+				"TRAIL_FINE_BUCKET_MINUTES":      "10",
+				"TRAIL_FINE_RETENTION_HOURS":     "24",
+				"TRAIL_METRICS_MAX_PATHS":        "200",
+				"TRAIL_SECTION_DEPTH":            "2",
+				"TRAIL_REFERRER_DETAIL":          "path",
+				"TRAIL_REQUEST_IDS":              "true",
+				"TRAIL_RAW_USER_AGENTS":          "true",
+				"TRAIL_STORE_RAW":                "true",
+				"TRAIL_RAW_MAX_ROWS":             "2000",
+				"TRAIL_RATE_LIMIT_IPS":           "true",
+				"TRAIL_SCANNER_PATHS":            "true",
+				"TRAIL_GOAL_PATH":                "/signup/complete",
+				"TRAIL_DURATION_SAMPLES":         "500",
+				"TRAIL_MERGE_WWW":                "true",
+				"TRAIL_NORMALIZE_IDS":            "true",
+				"TRAIL_PATH_RULES":               "^/u/[^/]+=/u/:name",
+				"TRAIL_ROTATION_PATTERN":         "date",
+				"TRAIL_TAIL_MODE":                "poll",
+				"TRAIL_BACKFILL_MAX_FILES":       "7",
+				"TRAIL_BACKFILL_ASYNC":           "false",
+				"TRAIL_MIN_BUCKET_COMPLETE_PCT":  "90",
+				"TRAIL_DURATION_UNIT":            "us",
+				"TRAIL_BYTES_FIELD":              "body_bytes",
+				"TRAIL_NEWER_SCHEMA":             "readonly",
+				"TRAIL_TRAEFIK_TEMPLATE":         `{ip} [{time}] "{request}" {status}`,
+				"TRAIL_SUCCESS_STATUS_BELOW":     "500",
+				"TRAIL_SUCCESS_IGNORE_404":       "true",
 			},
 			want: &Config{
-				LogFile:       "/custom/access.log",
-				DBPath:        "/custom/trail.db",
-				Listen:        ":3000",
-				RetentionDays: 30,
-				HtpasswdFile:  "/etc/htpasswd",
-				AuthUser:      "admin",
-				AuthPass:      "secret",
-				GeoIPPath:     "/geoip/dbip-country-lite.mmdb",
+				LogFile:               "/custom/access.log",
+				DBPath:                "/custom/trail.db",
+				StateDBPath:           "/custom/state.db",
+				Listen:                ":3000",
+				RetentionDays:         30,
+				RetentionMaxDeletePct: 80,
+				LargeDelete:           "block",
+				DefaultRange:          "7d",
+				RootJSON:              "redirect",
+				MaxPaths:              500,
+				MaxReferrers:          50,
+				MaxBreakdownRows:      20,
+				DedupWindow:           5000,
+				FlushMaxKeys:          1000,
+				RouterMinPct:          0.5,
+				UnroutedIsReal:        true,
+				HourOfDayStart:        6,
+				FineBucketMinutes:     10,
+				DurationSamples:       500,
+				ReferrerDetail:        "path",
+				RotationPattern:       "date",
+				TailMode:              "poll",
+				BackfillMax:           7,
+				TraefikTemplate:       `{ip} [{time}] "{request}" {status}`,
+				SuccessStatusBelow:    500,
+				VisitGapHours:         3,
+				OutageMinHours:        0,
+				LatencyWarnMs:         200,
+				LatencyCritMs:         800,
+				MinBucketCompletePct:  90,
+				DurationUnit:          "us",
+				BytesField:            "body_bytes",
+				NewerSchema:           "readonly",
+				SuccessIgnore404:      true,
+				FineRetentionHours:    24,
+				MetricsMaxPaths:       200,
+				SectionDepth:          2,
+				RequestIDs:            true,
+				RawUserAgents:         true,
+				StoreRaw:              true,
+				RawMaxRows:            2000,
+				RateLimitIPs:          true,
+				ScannerPaths:          true,
+				GoalPath:              "/signup/complete",
+				MergeWWW:              true,
+				NormalizeIDs:          true,
+				PathRules:             "^/u/[^/]+=/u/:name",
+				HtpasswdFile:          "/etc/htpasswd",
+				AuthUser:              "admin",
+				AuthPass:              "secret",
+				SessionLogin:          true,
+				SessionTTLHours:       8,
+				SessionSecret:         "s3cret-key",
+				GeoIPPath:             "/geoip/dbip-country-lite.mmdb",
+				ThreatIPsFile:         "/etc/trail/threats.txt",
+				TemplateDir:           "/etc/trail/templates",
+				GeoIPCacheSize:        500,
+				GeoIPUnknown:          true,
+				UACacheSize:           64,
 			},
 			wantErr: false,
 		},
@@ -75,20 +210,401 @@ func TestLoad(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "invalid default range",
+			envVars: map[string]string{
+				"TRAIL_DEFAULT_RANGE": "90d",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid max paths - zero",
+			envVars: map[string]string{
+				"TRAIL_MAX_PATHS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid max breakdown rows - zero",
+			envVars: map[string]string{
+				"TRAIL_MAX_BREAKDOWN_ROWS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid max referrers - not a number",
+			envVars: map[string]string{
+				"TRAIL_MAX_REFERRERS": "lots",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid dedup window - negative",
+			envVars: map[string]string{
+				"TRAIL_DEDUP_WINDOW": "-1",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid router min pct - over 100",
+			envVars: map[string]string{
+				"TRAIL_ROUTER_MIN_PCT": "150",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid hour of day start - over 23",
+			envVars: map[string]string{
+				"TRAIL_HOUR_OF_DAY_START": "24",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid fine bucket minutes - does not divide the hour",
+			envVars: map[string]string{
+				"TRAIL_FINE_BUCKET_MINUTES": "7",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid referrer detail",
+			envVars: map[string]string{
+				"TRAIL_REFERRER_DETAIL": "full",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "success cutoff out of range",
+			envVars: map[string]string{
+				"TRAIL_SUCCESS_STATUS_BELOW": "700",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid rotation pattern",
+			envVars: map[string]string{
+				"TRAIL_ROTATION_PATTERN": "weekly",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid tail mode",
+			envVars: map[string]string{
+				"TRAIL_TAIL_MODE": "inotify",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid geoip cache size",
+			envVars: map[string]string{
+				"TRAIL_GEOIP_CACHE_SIZE": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid UA cache size",
+			envVars: map[string]string{
+				"TRAIL_UA_CACHE_SIZE": "lots",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid store raw flag",
+			envVars: map[string]string{
+				"TRAIL_STORE_RAW": "maybe",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "zero raw max rows",
+			envVars: map[string]string{
+				"TRAIL_RAW_MAX_ROWS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid raw user agents flag",
+			envVars: map[string]string{
+				"TRAIL_RAW_USER_AGENTS": "maybe",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "duration samples over the cap",
+			envVars: map[string]string{
+				"TRAIL_DURATION_SAMPLES": "100000",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "goal path without leading slash",
+			envVars: map[string]string{
+				"TRAIL_GOAL_PATH": "signup/complete",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid scanner paths flag",
+			envVars: map[string]string{
+				"TRAIL_SCANNER_PATHS": "maybe",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid rate limit IPs flag",
+			envVars: map[string]string{
+				"TRAIL_RATE_LIMIT_IPS": "maybe",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid geoip unknown flag",
+			envVars: map[string]string{
+				"TRAIL_GEOIP_UNKNOWN": "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "visit gap too long",
+			envVars: map[string]string{
+				"TRAIL_VISIT_GAP_HOURS": "48",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "max delete pct out of range",
+			envVars: map[string]string{
+				"TRAIL_RETENTION_MAX_DELETE_PCT": "150",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid large delete mode",
+			envVars: map[string]string{
+				"TRAIL_RETENTION_LARGE_DELETE": "ask",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid metrics label",
+			envVars: map[string]string{
+				"TRAIL_METRICS_LABELS": "router,method",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "zero metrics max paths",
+			envVars: map[string]string{
+				"TRAIL_METRICS_MAX_PATHS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid auth paths glob",
+			envVars: map[string]string{
+				"TRAIL_AUTH_PATHS": "/login,/auth/[",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "section depth too deep",
+			envVars: map[string]string{
+				"TRAIL_SECTION_DEPTH": "6",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid normalize ids",
+			envVars: map[string]string{
+				"TRAIL_NORMALIZE_IDS": "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid merge www",
+			envVars: map[string]string{
+				"TRAIL_MERGE_WWW": "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid session TTL",
+			envVars: map[string]string{
+				"TRAIL_SESSION_TTL_HOURS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid root JSON response",
+			envVars: map[string]string{
+				"TRAIL_ROOT_JSON": "xml",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative backfill max files",
+			envVars: map[string]string{
+				"TRAIL_BACKFILL_MAX_FILES": "-1",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid backfill async flag",
+			envVars: map[string]string{
+				"TRAIL_BACKFILL_ASYNC": "later",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "min bucket completeness over 100",
+			envVars: map[string]string{
+				"TRAIL_MIN_BUCKET_COMPLETE_PCT": "101",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid duration unit",
+			envVars: map[string]string{
+				"TRAIL_DURATION_UNIT": "minutes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "malformed exclude pattern",
+			envVars: map[string]string{
+				"TRAIL_EXCLUDE_PATHS": "/api/[",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "negative outage min hours",
+			envVars: map[string]string{
+				"TRAIL_OUTAGE_MIN_HOURS": "-1",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid bytes field",
+			envVars: map[string]string{
+				"TRAIL_BYTES_FIELD": "content_length",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid newer schema behavior",
+			envVars: map[string]string{
+				"TRAIL_NEWER_SCHEMA": "ignore",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid merge slash redirects",
+			envVars: map[string]string{
+				"TRAIL_MERGE_SLASH_REDIRECTS": "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid latency warn - zero",
+			envVars: map[string]string{
+				"TRAIL_LATENCY_WARN_MS": "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid latency thresholds - warn above crit",
+			envVars: map[string]string{
+				"TRAIL_LATENCY_WARN_MS": "2000",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "partial config with htpasswd only",
 			envVars: map[string]string{
 				"TRAIL_HTPASSWD_FILE": "/etc/htpasswd",
 			},
 			want: &Config{
-				LogFile:       "/logs/access.log",
-				DBPath:        "/data/trail.db",
-				Listen:        ":8080",
-				RetentionDays: 90,
-				HtpasswdFile:  "/etc/htpasswd",
-				AuthUser:      "",
-				AuthPass:      "",
-				GeoIPPath:     "",
+				LogFile:               "/logs/access.log",
+				DBPath:                "/data/trail.db",
+				Listen:                ":8080",
+				RetentionDays:         90,
+				RetentionMaxDeletePct: 50,
+				LargeDelete:           "warn",
+				DefaultRange:          "today",
+				RootJSON:              "json",
+				ReferrerDetail:        "domain",
+				BytesField:            "bytes",
+				NewerSchema:           "refuse",
+				RotationPattern:       "auto",
+				TailMode:              "auto",
+				BackfillAsync:         true,
+				MergeSlashRedirects:   true,
+				SuccessStatusBelow:    400,
+				VisitGapHours:         1,
+				OutageMinHours:        3,
+				LatencyWarnMs:         300,
+				LatencyCritMs:         1000,
+				MinBucketCompletePct:  100,
+				MaxPaths:              10000,
+				MaxReferrers:          2000,
+				MaxBreakdownRows:      50,
+				FlushMaxKeys:          50000,
+				FineRetentionHours:    48,
+				RawMaxRows:            50000,
+				MetricsMaxPaths:       50,
+				SectionDepth:          1,
+				HtpasswdFile:          "/etc/htpasswd",
+				AuthUser:              "",
+				AuthPass:              "",
+				SessionTTLHours:       24,
+				GeoIPPath:             "",
+				ThreatIPsFile:         "",
+				GeoIPCacheSize:        10000,
+				UACacheSize:           1000,
 			},
 			wantErr: false,
 		},
@@ -99,14 +615,43 @@ func TestLoad(t *testing.T) {
 				"TRAIL_AUTH_PASS": "secret",
 			},
 			want: &Config{
-				LogFile:       "/logs/access.log",
-				DBPath:        "/data/trail.db",
-				Listen:        ":8080",
-				RetentionDays: 90,
-				HtpasswdFile:  "",
-				AuthUser:      "admin",
-				AuthPass:      "secret",
-				GeoIPPath:     "",
+				LogFile:               "/logs/access.log",
+				DBPath:                "/data/trail.db",
+				Listen:                ":8080",
+				RetentionDays:         90,
+				RetentionMaxDeletePct: 50,
+				LargeDelete:           "warn",
+				DefaultRange:          "today",
+				RootJSON:              "json",
+				ReferrerDetail:        "domain",
+				BytesField:            "bytes",
+				NewerSchema:           "refuse",
+				RotationPattern:       "auto",
+				TailMode:              "auto",
+				BackfillAsync:         true,
+				MergeSlashRedirects:   true,
+				SuccessStatusBelow:    400,
+				VisitGapHours:         1,
+				OutageMinHours:        3,
+				LatencyWarnMs:         300,
+				LatencyCritMs:         1000,
+				MinBucketCompletePct:  100,
+				MaxPaths:              10000,
+				MaxReferrers:          2000,
+				MaxBreakdownRows:      50,
+				FlushMaxKeys:          50000,
+				FineRetentionHours:    48,
+				RawMaxRows:            50000,
+				MetricsMaxPaths:       50,
+				SectionDepth:          1,
+				HtpasswdFile:          "",
+				AuthUser:              "admin",
+				AuthPass:              "secret",
+				SessionTTLHours:       24,
+				GeoIPPath:             "",
+				ThreatIPsFile:         "",
+				GeoIPCacheSize:        10000,
+				UACacheSize:           1000,
 			},
 			wantErr: false,
 		},
@@ -118,12 +663,73 @@ func TestLoad(t *testing.T) {
 			clearEnv := []string{
 				"TRAIL_LOG_FILE",
 				"TRAIL_DB_PATH",
+				"TRAIL_STATE_DB",
 				"TRAIL_LISTEN",
 				"TRAIL_RETENTION_DAYS",
 				"TRAIL_HTPASSWD_FILE",
 				"TRAIL_AUTH_USER",
 				"TRAIL_AUTH_PASS",
+				"TRAIL_SESSION_LOGIN",
+				"TRAIL_SESSION_TTL_HOURS",
+				"TRAIL_SESSION_SECRET",
 				"TRAIL_GEOIP_PATH",
+				"TRAIL_THREAT_IPS_FILE",
+				"TRAIL_TEMPLATE_DIR",
+				"TRAIL_DEFAULT_RANGE",
+				"TRAIL_ROOT_JSON",
+				"TRAIL_MAX_PATHS",
+				"TRAIL_MAX_REFERRERS",
+				"TRAIL_MAX_BREAKDOWN_ROWS",
+				"TRAIL_EXTRA_METHODS",
+				"TRAIL_DEDUP_WINDOW",
+				"TRAIL_CAPTURE_PARAMS",
+				"TRAIL_EXCLUDE_PATHS",
+				"TRAIL_INCLUDE_PATHS",
+				"TRAIL_AUTH_PATHS",
+				"TRAIL_ROUTER_MIN_PCT",
+				"TRAIL_FLUSH_MAX_KEYS",
+				"TRAIL_UNROUTED_IS_REAL",
+				"TRAIL_MERGE_SLASH_REDIRECTS",
+				"TRAIL_HOUR_OF_DAY_START",
+				"TRAIL_FINE_BUCKET_MINUTES",
+				"TRAIL_FINE_RETENTION_HOURS",
+				"TRAIL_METRICS_LABELS",
+				"TRAIL_METRICS_MAX_PATHS",
+				"TRAIL_SECTION_DEPTH",
+				"TRAIL_REFERRER_DETAIL",
+				"TRAIL_REQUEST_IDS",
+				"TRAIL_ROTATION_PATTERN",
+				"TRAIL_TAIL_MODE",
+				"TRAIL_SYSLOG_LISTEN",
+				"TRAIL_INGEST_TOKEN",
+				"TRAIL_BACKFILL_MAX_FILES",
+				"TRAIL_BACKFILL_ASYNC",
+				"TRAIL_MIN_BUCKET_COMPLETE_PCT",
+				"TRAIL_DURATION_UNIT",
+				"TRAIL_BYTES_FIELD",
+				"TRAIL_NEWER_SCHEMA",
+				"TRAIL_SUCCESS_STATUS_BELOW",
+				"TRAIL_SUCCESS_IGNORE_404",
+				"TRAIL_TRAEFIK_TEMPLATE",
+				"TRAIL_GEOIP_CACHE_SIZE",
+				"TRAIL_UA_CACHE_SIZE",
+				"TRAIL_RAW_USER_AGENTS",
+				"TRAIL_STORE_RAW",
+				"TRAIL_RAW_MAX_ROWS",
+				"TRAIL_RATE_LIMIT_IPS",
+				"TRAIL_SCANNER_PATHS",
+				"TRAIL_GOAL_PATH",
+				"TRAIL_DURATION_SAMPLES",
+				"TRAIL_MERGE_WWW",
+				"TRAIL_NORMALIZE_IDS",
+				"TRAIL_PATH_RULES",
+				"TRAIL_GEOIP_UNKNOWN",
+				"TRAIL_VISIT_GAP_HOURS",
+				"TRAIL_OUTAGE_MIN_HOURS",
+				"TRAIL_LATENCY_WARN_MS",
+				"TRAIL_LATENCY_CRIT_MS",
+				"TRAIL_RETENTION_MAX_DELETE_PCT",
+				"TRAIL_RETENTION_LARGE_DELETE",
 			}
 			for _, key := range clearEnv {
 				os.Unsetenv(key)
@@ -157,12 +763,144 @@ func TestLoad(t *testing.T) {
 			if got.DBPath != tt.want.DBPath {
 				t.Errorf("DBPath = %v, want %v", got.DBPath, tt.want.DBPath)
 			}
+			if got.StateDBPath != tt.want.StateDBPath {
+				t.Errorf("StateDBPath = %v, want %v", got.StateDBPath, tt.want.StateDBPath)
+			}
 			if got.Listen != tt.want.Listen {
 				t.Errorf("Listen = %v, want %v", got.Listen, tt.want.Listen)
 			}
 			if got.RetentionDays != tt.want.RetentionDays {
 				t.Errorf("RetentionDays = %v, want %v", got.RetentionDays, tt.want.RetentionDays)
 			}
+			if got.RetentionMaxDeletePct != tt.want.RetentionMaxDeletePct {
+				t.Errorf("RetentionMaxDeletePct = %v, want %v", got.RetentionMaxDeletePct, tt.want.RetentionMaxDeletePct)
+			}
+			if got.LargeDelete != tt.want.LargeDelete {
+				t.Errorf("LargeDelete = %v, want %v", got.LargeDelete, tt.want.LargeDelete)
+			}
+			if got.DefaultRange != tt.want.DefaultRange {
+				t.Errorf("DefaultRange = %v, want %v", got.DefaultRange, tt.want.DefaultRange)
+			}
+			if got.RootJSON != tt.want.RootJSON {
+				t.Errorf("RootJSON = %v, want %v", got.RootJSON, tt.want.RootJSON)
+			}
+			if got.MaxPaths != tt.want.MaxPaths {
+				t.Errorf("MaxPaths = %v, want %v", got.MaxPaths, tt.want.MaxPaths)
+			}
+			if got.MaxReferrers != tt.want.MaxReferrers {
+				t.Errorf("MaxReferrers = %v, want %v", got.MaxReferrers, tt.want.MaxReferrers)
+			}
+			if got.MaxBreakdownRows != tt.want.MaxBreakdownRows {
+				t.Errorf("MaxBreakdownRows = %v, want %v", got.MaxBreakdownRows, tt.want.MaxBreakdownRows)
+			}
+			if got.UnroutedIsReal != tt.want.UnroutedIsReal {
+				t.Errorf("UnroutedIsReal = %v, want %v", got.UnroutedIsReal, tt.want.UnroutedIsReal)
+			}
+			if got.MergeSlashRedirects != tt.want.MergeSlashRedirects {
+				t.Errorf("MergeSlashRedirects = %v, want %v", got.MergeSlashRedirects, tt.want.MergeSlashRedirects)
+			}
+			if got.SuccessStatusBelow != tt.want.SuccessStatusBelow {
+				t.Errorf("SuccessStatusBelow = %v, want %v", got.SuccessStatusBelow, tt.want.SuccessStatusBelow)
+			}
+			if got.SuccessIgnore404 != tt.want.SuccessIgnore404 {
+				t.Errorf("SuccessIgnore404 = %v, want %v", got.SuccessIgnore404, tt.want.SuccessIgnore404)
+			}
+			if got.VisitGapHours != tt.want.VisitGapHours {
+				t.Errorf("VisitGapHours = %v, want %v", got.VisitGapHours, tt.want.VisitGapHours)
+			}
+			if got.OutageMinHours != tt.want.OutageMinHours {
+				t.Errorf("OutageMinHours = %v, want %v", got.OutageMinHours, tt.want.OutageMinHours)
+			}
+			if got.LatencyWarnMs != tt.want.LatencyWarnMs || got.LatencyCritMs != tt.want.LatencyCritMs {
+				t.Errorf("Latency thresholds = %v/%v, want %v/%v", got.LatencyWarnMs, got.LatencyCritMs, tt.want.LatencyWarnMs, tt.want.LatencyCritMs)
+			}
+			if got.TraefikTemplate != tt.want.TraefikTemplate {
+				t.Errorf("TraefikTemplate = %v, want %v", got.TraefikTemplate, tt.want.TraefikTemplate)
+			}
+			if got.TailMode != tt.want.TailMode {
+				t.Errorf("TailMode = %v, want %v", got.TailMode, tt.want.TailMode)
+			}
+			if got.RotationPattern != tt.want.RotationPattern {
+				t.Errorf("RotationPattern = %v, want %v", got.RotationPattern, tt.want.RotationPattern)
+			}
+			if got.BackfillMax != tt.want.BackfillMax {
+				t.Errorf("BackfillMax = %v, want %v", got.BackfillMax, tt.want.BackfillMax)
+			}
+			if got.DurationUnit != tt.want.DurationUnit {
+				t.Errorf("DurationUnit = %q, want %q", got.DurationUnit, tt.want.DurationUnit)
+			}
+			if got.BytesField != tt.want.BytesField {
+				t.Errorf("BytesField = %q, want %q", got.BytesField, tt.want.BytesField)
+			}
+			if got.NewerSchema != tt.want.NewerSchema {
+				t.Errorf("NewerSchema = %q, want %q", got.NewerSchema, tt.want.NewerSchema)
+			}
+			if got.MinBucketCompletePct != tt.want.MinBucketCompletePct {
+				t.Errorf("MinBucketCompletePct = %v, want %v", got.MinBucketCompletePct, tt.want.MinBucketCompletePct)
+			}
+			if got.BackfillAsync != tt.want.BackfillAsync {
+				t.Errorf("BackfillAsync = %v, want %v", got.BackfillAsync, tt.want.BackfillAsync)
+			}
+			if got.ReferrerDetail != tt.want.ReferrerDetail {
+				t.Errorf("ReferrerDetail = %v, want %v", got.ReferrerDetail, tt.want.ReferrerDetail)
+			}
+			if got.RequestIDs != tt.want.RequestIDs {
+				t.Errorf("RequestIDs = %v, want %v", got.RequestIDs, tt.want.RequestIDs)
+			}
+			if got.RawUserAgents != tt.want.RawUserAgents {
+				t.Errorf("RawUserAgents = %v, want %v", got.RawUserAgents, tt.want.RawUserAgents)
+			}
+			if got.StoreRaw != tt.want.StoreRaw {
+				t.Errorf("StoreRaw = %v, want %v", got.StoreRaw, tt.want.StoreRaw)
+			}
+			if got.RawMaxRows != tt.want.RawMaxRows {
+				t.Errorf("RawMaxRows = %v, want %v", got.RawMaxRows, tt.want.RawMaxRows)
+			}
+			if got.RateLimitIPs != tt.want.RateLimitIPs {
+				t.Errorf("RateLimitIPs = %v, want %v", got.RateLimitIPs, tt.want.RateLimitIPs)
+			}
+			if got.ScannerPaths != tt.want.ScannerPaths {
+				t.Errorf("ScannerPaths = %v, want %v", got.ScannerPaths, tt.want.ScannerPaths)
+			}
+			if got.GoalPath != tt.want.GoalPath {
+				t.Errorf("GoalPath = %v, want %v", got.GoalPath, tt.want.GoalPath)
+			}
+			if got.MergeWWW != tt.want.MergeWWW {
+				t.Errorf("MergeWWW = %v, want %v", got.MergeWWW, tt.want.MergeWWW)
+			}
+			if got.NormalizeIDs != tt.want.NormalizeIDs {
+				t.Errorf("NormalizeIDs = %v, want %v", got.NormalizeIDs, tt.want.NormalizeIDs)
+			}
+			if got.PathRules != tt.want.PathRules {
+				t.Errorf("PathRules = %q, want %q", got.PathRules, tt.want.PathRules)
+			}
+			if got.SectionDepth != tt.want.SectionDepth {
+				t.Errorf("SectionDepth = %v, want %v", got.SectionDepth, tt.want.SectionDepth)
+			}
+			if got.MetricsMaxPaths != tt.want.MetricsMaxPaths {
+				t.Errorf("MetricsMaxPaths = %v, want %v", got.MetricsMaxPaths, tt.want.MetricsMaxPaths)
+			}
+			if got.FineRetentionHours != tt.want.FineRetentionHours {
+				t.Errorf("FineRetentionHours = %v, want %v", got.FineRetentionHours, tt.want.FineRetentionHours)
+			}
+			if got.DurationSamples != tt.want.DurationSamples {
+				t.Errorf("DurationSamples = %v, want %v", got.DurationSamples, tt.want.DurationSamples)
+			}
+			if got.FineBucketMinutes != tt.want.FineBucketMinutes {
+				t.Errorf("FineBucketMinutes = %v, want %v", got.FineBucketMinutes, tt.want.FineBucketMinutes)
+			}
+			if got.HourOfDayStart != tt.want.HourOfDayStart {
+				t.Errorf("HourOfDayStart = %v, want %v", got.HourOfDayStart, tt.want.HourOfDayStart)
+			}
+			if got.RouterMinPct != tt.want.RouterMinPct {
+				t.Errorf("RouterMinPct = %v, want %v", got.RouterMinPct, tt.want.RouterMinPct)
+			}
+			if got.FlushMaxKeys != tt.want.FlushMaxKeys {
+				t.Errorf("FlushMaxKeys = %v, want %v", got.FlushMaxKeys, tt.want.FlushMaxKeys)
+			}
+			if got.DedupWindow != tt.want.DedupWindow {
+				t.Errorf("DedupWindow = %v, want %v", got.DedupWindow, tt.want.DedupWindow)
+			}
 			if got.HtpasswdFile != tt.want.HtpasswdFile {
 				t.Errorf("HtpasswdFile = %v, want %v", got.HtpasswdFile, tt.want.HtpasswdFile)
 			}
@@ -172,9 +910,33 @@ func TestLoad(t *testing.T) {
 			if got.AuthPass != tt.want.AuthPass {
 				t.Errorf("AuthPass = %v, want %v", got.AuthPass, tt.want.AuthPass)
 			}
+			if got.SessionLogin != tt.want.SessionLogin {
+				t.Errorf("SessionLogin = %v, want %v", got.SessionLogin, tt.want.SessionLogin)
+			}
+			if got.SessionTTLHours != tt.want.SessionTTLHours {
+				t.Errorf("SessionTTLHours = %v, want %v", got.SessionTTLHours, tt.want.SessionTTLHours)
+			}
+			if got.SessionSecret != tt.want.SessionSecret {
+				t.Errorf("SessionSecret = %v, want %v", got.SessionSecret, tt.want.SessionSecret)
+			}
 			if got.GeoIPPath != tt.want.GeoIPPath {
 				t.Errorf("GeoIPPath = %v, want %v", got.GeoIPPath, tt.want.GeoIPPath)
 			}
+			if got.ThreatIPsFile != tt.want.ThreatIPsFile {
+				t.Errorf("ThreatIPsFile = %v, want %v", got.ThreatIPsFile, tt.want.ThreatIPsFile)
+			}
+			if got.TemplateDir != tt.want.TemplateDir {
+				t.Errorf("TemplateDir = %v, want %v", got.TemplateDir, tt.want.TemplateDir)
+			}
+			if got.GeoIPCacheSize != tt.want.GeoIPCacheSize {
+				t.Errorf("GeoIPCacheSize = %v, want %v", got.GeoIPCacheSize, tt.want.GeoIPCacheSize)
+			}
+			if got.GeoIPUnknown != tt.want.GeoIPUnknown {
+				t.Errorf("GeoIPUnknown = %v, want %v", got.GeoIPUnknown, tt.want.GeoIPUnknown)
+			}
+			if got.UACacheSize != tt.want.UACacheSize {
+				t.Errorf("UACacheSize = %v, want %v", got.UACacheSize, tt.want.UACacheSize)
+			}
 		})
 	}
 }
@@ -228,3 +990,215 @@ func TestGetEnvOrDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRouterRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]int
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "single", input: "health@docker=3", want: map[string]int{"health@docker": 3}},
+		{
+			name:  "multiple with spaces",
+			input: " health@docker = 3 , legacy=14,",
+			want:  map[string]int{"health@docker": 3, "legacy": 14},
+		},
+		{name: "missing days", input: "legacy=", wantErr: true},
+		{name: "missing router", input: "=5", wantErr: true},
+		{name: "no separator", input: "legacy", wantErr: true},
+		{name: "zero days", input: "legacy=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRouterRetention(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRouterRetention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseRouterRetention() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseRouterRetention()[%q] = %d, want %d", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatusList(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "single", input: "404", want: []int{404}},
+		{name: "list with spaces", input: "404, 405 ,444", want: []int{404, 405, 444}},
+		{name: "not a number", input: "404,abc", wantErr: true},
+		{name: "out of range", input: "99", wantErr: true},
+		{name: "too large", input: "600", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStatusList(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatusList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseStatusList() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseStatusList()[%d] = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMethodList(t *testing.T) {
+	got := parseMethodList(" propfind, MKCOL ,,")
+	want := []string{"PROPFIND", "MKCOL"}
+	if len(got) != len(want) {
+		t.Fatalf("parseMethodList() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseMethodList()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if got := parseMethodList(""); got != nil {
+		t.Errorf("parseMethodList(\"\") = %v, want nil", got)
+	}
+}
+
+func TestParseNameList(t *testing.T) {
+	got := parseNameList(" q, Category ,,")
+	want := []string{"q", "Category"}
+	if len(got) != len(want) {
+		t.Fatalf("parseNameList() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseNameList()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseMetricsLabels(t *testing.T) {
+	got, err := parseMetricsLabels(" Path, status ,path,")
+	if err != nil {
+		t.Fatalf("parseMetricsLabels() error = %v", err)
+	}
+	want := []string{"path", "status"}
+	if len(got) != len(want) {
+		t.Fatalf("parseMetricsLabels() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseMetricsLabels()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if got, err := parseMetricsLabels("none"); err != nil || got != nil {
+		t.Errorf("parseMetricsLabels(\"none\") = %v, %v, want nil", got, err)
+	}
+	if _, err := parseMetricsLabels("router,method"); err == nil {
+		t.Error("parseMetricsLabels() with an unknown label: want error")
+	}
+}
+
+func TestParsePathPatterns(t *testing.T) {
+	got, err := parsePathPatterns("TRAIL_EXCLUDE_PATHS", " /api/*, /healthz ,")
+	if err != nil {
+		t.Fatalf("parsePathPatterns() error = %v", err)
+	}
+	want := []string{"/api/*", "/healthz"}
+	if len(got) != len(want) {
+		t.Fatalf("parsePathPatterns() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parsePathPatterns()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if _, err := parsePathPatterns("TRAIL_EXCLUDE_PATHS", "/ok,/bad["); err == nil {
+		t.Error("parsePathPatterns() with a malformed glob: want error")
+	}
+}
+
+func TestLoadWithoutLogFile(t *testing.T) {
+	t.Setenv("TRAIL_LOG_FILE", "")
+	t.Setenv("TRAIL_SYSLOG_LISTEN", "udp://:514")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.SyslogListen != "udp://:514" || cfg.LogFile != "" || cfg.LogFiles != nil {
+		t.Errorf("syslog only: SyslogListen = %q, LogFile = %q, LogFiles = %v; want no log files", cfg.SyslogListen, cfg.LogFile, cfg.LogFiles)
+	}
+
+	t.Setenv("TRAIL_SYSLOG_LISTEN", "")
+	t.Setenv("TRAIL_INGEST_TOKEN", "push")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.IngestToken != "push" || cfg.LogFiles != nil {
+		t.Errorf("pushes only: IngestToken = %q, LogFiles = %v; want no log files", cfg.IngestToken, cfg.LogFiles)
+	}
+
+	t.Setenv("TRAIL_LOG_FILE", "/logs/access.log")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LogFile != "/logs/access.log" {
+		t.Errorf("explicit TRAIL_LOG_FILE with pushes: LogFile = %q, want it tailed as well", cfg.LogFile)
+	}
+}
+
+func TestParseLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log", "c.log.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := parseLogFiles("/logs/edge.log, " + filepath.Join(dir, "*.log*") + ", " + filepath.Join(dir, "a.log"))
+	if err != nil {
+		t.Fatalf("parseLogFiles() error = %v", err)
+	}
+	want := []string{"/logs/edge.log", filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseLogFiles() = %v, want %v", got, want)
+	}
+
+	if got, err := parseLogFiles("-"); err != nil || !slices.Equal(got, []string{Stdin}) {
+		t.Errorf("parseLogFiles(\"-\") = %v, %v, want stdin", got, err)
+	}
+
+	for _, bad := range []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "[.log"), " , "} {
+		if _, err := parseLogFiles(bad); err == nil {
+			t.Errorf("parseLogFiles(%q): want error", bad)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{LogFile: "/logs/access.log", AuthUser: "admin", AuthPass: "secret", IngestToken: "push"}
+	got := cfg.Redacted()
+	if got.AuthPass != "[redacted]" || got.IngestToken != "[redacted]" || got.AuthUser != "admin" || got.LogFile != "/logs/access.log" {
+		t.Errorf("Redacted() = %+v, want only AuthPass and IngestToken replaced", got)
+	}
+	if got.SessionSecret != "" {
+		t.Errorf("Redacted() SessionSecret = %q, want an unset secret left empty", got.SessionSecret)
+	}
+	if cfg.AuthPass != "secret" {
+		t.Errorf("Redacted() changed the original AuthPass to %q", cfg.AuthPass)
+	}
+}
@@ -2,16 +2,105 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	_ "modernc.org/sqlite"
 )
 
+// schemaVersionKey is the meta key recording the SchemaVersion a database
+// was last opened with
+const schemaVersionKey = "schema_version"
+
+// ErrNewerSchema is returned by Open for a database written by a newer
+// trail, whose tables this build may misread or damage
+var ErrNewerSchema = errors.New("database was written by a newer trail version")
+
+// Options configures OpenWithOptions
+type Options struct {
+	// ReadOnlyIfNewer opens a database from a newer trail read-only (see
+	// IsReadOnly) instead of failing with ErrNewerSchema
+	ReadOnlyIfNewer bool
+
+	// SeparateState skips the log_position table, for a database whose
+	// positions are kept in a state database (OpenState). Its meta table
+	// still records the schema version.
+	SeparateState bool
+}
+
 // Open opens a SQLite database at the given path, enables WAL mode,
 // and runs migrations. Creates the database file if it doesn't exist.
+// A database from a newer trail fails with ErrNewerSchema.
 func Open(dbPath string) (*sql.DB, error) {
+	return OpenWithOptions(dbPath, Options{})
+}
+
+// OpenWithOptions is Open with options
+func OpenWithOptions(dbPath string, opts Options) (*sql.DB, error) {
+	migrate := Migrate
+	if opts.SeparateState {
+		migrate = MigrateData
+	}
+	db, err := open(dbPath, migrate)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSchemaVersion(db)
+	if errors.Is(err, ErrNewerSchema) && opts.ReadOnlyIfNewer {
+		db.Close()
+		return open(dbPath+"?_pragma=query_only(1)", func(*sql.DB) error { return nil })
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkSchemaVersion compares the version recorded in db with
+// SchemaVersion, recording ours when it is missing or older
+func checkSchemaVersion(db *sql.DB) error {
+	value, ok, err := GetMeta(db, schemaVersionKey)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if ok {
+		version, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid schema version %q in database", value)
+		}
+		if version > SchemaVersion {
+			return fmt.Errorf("%w: schema version %d, this build knows up to %d", ErrNewerSchema, version, SchemaVersion)
+		}
+		if version == SchemaVersion {
+			return nil
+		}
+	}
+	if err := SetMeta(db, schemaVersionKey, strconv.Itoa(SchemaVersion)); err != nil {
+		return fmt.Errorf("record schema version: %w", err)
+	}
+	return nil
+}
+
+// IsReadOnly reports whether db was opened read-only because its schema
+// is newer than this build's
+func IsReadOnly(db *sql.DB) bool {
+	var on bool
+	return db.QueryRow("PRAGMA query_only").Scan(&on) == nil && on
+}
+
+// OpenState opens a SQLite database holding only tailer/backfill positions
+// and instance metadata (TRAIL_STATE_DB), keeping the analytics database
+// purely aggregate rows.
+func OpenState(dbPath string) (*sql.DB, error) {
+	return open(dbPath, MigrateState)
+}
+
+// open opens the database, applies connection settings and runs migrate
+func open(dbPath string, migrate func(*sql.DB) error) (*sql.DB, error) {
 	// Ensure parent directory exists
 	if dir := filepath.Dir(dbPath); dir != "" && dir != "." {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -42,7 +131,7 @@ func Open(dbPath string) (*sql.DB, error) {
 	db.SetMaxIdleConns(1)
 
 	// Run migrations to create tables
-	if err := Migrate(db); err != nil {
+	if err := migrate(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
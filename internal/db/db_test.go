@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestOpenSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trail.db")
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if v, ok, err := GetMeta(db, schemaVersionKey); err != nil || !ok || v != strconv.Itoa(SchemaVersion) {
+		t.Errorf("recorded schema version = %q, %v, %v; want %d", v, ok, err, SchemaVersion)
+	}
+	if IsReadOnly(db) {
+		t.Error("IsReadOnly() on a current database = true")
+	}
+
+	// Pretend a newer trail wrote the database
+	if err := SetMeta(db, schemaVersionKey, strconv.Itoa(SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := Open(path); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Open() of a newer database error = %v, want ErrNewerSchema", err)
+	}
+
+	db, err = OpenWithOptions(path, Options{ReadOnlyIfNewer: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions(ReadOnlyIfNewer) error = %v", err)
+	}
+	defer db.Close()
+	if !IsReadOnly(db) {
+		t.Error("IsReadOnly() on a newer database = false")
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM requests").Scan(&n); err != nil {
+		t.Errorf("reading a read-only database: %v", err)
+	}
+	if err := SetMeta(db, "probe", "x"); err == nil {
+		t.Error("writing a read-only database succeeded")
+	}
+	if v, _, _ := GetMeta(db, schemaVersionKey); v != strconv.Itoa(SchemaVersion+1) {
+		t.Errorf("schema version = %q after a read-only open, want it left alone", v)
+	}
+}
+
+func TestOpenSeparateState(t *testing.T) {
+	db, err := OpenWithOptions(filepath.Join(t.TempDir(), "trail.db"), Options{SeparateState: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions(SeparateState) error = %v", err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'log_position'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("data database with a separate state database has a log_position table")
+	}
+	if v, ok, err := GetMeta(db, schemaVersionKey); err != nil || !ok || v != strconv.Itoa(SchemaVersion) {
+		t.Errorf("recorded schema version = %q, %v, %v; want %d", v, ok, err, SchemaVersion)
+	}
+}
+
+func TestOpenAddsRequestsHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trail.db")
+
+	// A requests table as schema version 1 created it, without host
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE requests (
+			hour TEXT NOT NULL, router TEXT NOT NULL, path TEXT NOT NULL, method TEXT NOT NULL, status INTEGER NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0, bytes INTEGER NOT NULL DEFAULT 0, duration INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (hour, router, path, method, status))`,
+		`CREATE INDEX idx_requests_hour ON requests(hour)`,
+		`INSERT INTO requests VALUES ('2026-02-08T10:00:00Z', 'web', '/', 'GET', 200, 5, 500, 50)`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	var host string
+	var count int
+	if err := db.QueryRow(`SELECT host, count FROM requests WHERE router = 'web' AND path = '/'`).Scan(&host, &count); err != nil {
+		t.Fatalf("reading migrated row: %v", err)
+	}
+	if host != "" || count != 5 {
+		t.Errorf("migrated row host = %q, count = %d; want empty host, count 5", host, count)
+	}
+
+	// The same path under another host is a row of its own
+	if _, err := db.Exec(`INSERT INTO requests (hour, router, host, path, method, status, count) VALUES ('2026-02-08T10:00:00Z', 'web', 'example.com', '/', 'GET', 200, 1)`); err != nil {
+		t.Errorf("insert with a host after migration: %v", err)
+	}
+	var indexes int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_requests_hour'`).Scan(&indexes); err != nil || indexes != 1 {
+		t.Errorf("idx_requests_hour after migration: %d, %v", indexes, err)
+	}
+}
+
+// TestSchemaVersionTables pins the tables of the current SchemaVersion, so a
+// new table can't land without a bump
+func TestSchemaVersionTables(t *testing.T) {
+	const version = 2
+	want := []string{
+		"auth_failures", "browsers", "cache_status", "countries", "duration_hist",
+		"duration_samples", "error_requests", "hosts", "log_position", "meta",
+		"os_stats", "path_categories", "query_params", "rate_limited",
+		"raw_user_agents", "referrers", "requests", "requests_fine", "requests_raw",
+		"scanner_paths", "size_hist", "threat_requests", "upstream_times",
+		"user_agents", "visitor_entries", "visitors",
+	}
+	if SchemaVersion != version {
+		t.Fatalf("SchemaVersion = %d: update this test's version and table list", SchemaVersion)
+	}
+
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("tables = %v, want %v: bump SchemaVersion when adding or changing a table", got, want)
+	}
+}
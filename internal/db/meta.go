@@ -0,0 +1,29 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetMeta returns the value stored under key in the meta table.
+// The boolean is false if the key has never been set.
+func GetMeta(db *sql.DB, key string) (string, bool, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetMeta stores value under key in the meta table, replacing any previous value.
+func SetMeta(db *sql.DB, key, value string) error {
+	_, err := db.Exec(`
+		INSERT INTO meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	return err
+}
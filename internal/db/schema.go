@@ -5,18 +5,27 @@ import (
 	"fmt"
 )
 
+// SchemaVersion identifies the layout of the aggregate tables. Bump it when a
+// table is added or a table's columns or keys change, so dumps and older
+// binaries can tell: an older trail would otherwise open the database and
+// never write, clear or export the new table. Version 2 added requests.host
+// and every table added since version 1; TestSchemaVersionTables pins the
+// list.
+const SchemaVersion = 2
+
 const (
 	createRequestsTable = `
 CREATE TABLE IF NOT EXISTS requests (
     hour     TEXT    NOT NULL,
     router   TEXT    NOT NULL,
+    host     TEXT    NOT NULL DEFAULT '',
     path     TEXT    NOT NULL,
     method   TEXT    NOT NULL,
     status   INTEGER NOT NULL,
     count    INTEGER NOT NULL DEFAULT 0,
     bytes    INTEGER NOT NULL DEFAULT 0,
     duration INTEGER NOT NULL DEFAULT 0,
-    PRIMARY KEY (hour, router, path, method, status)
+    PRIMARY KEY (hour, router, host, path, method, status)
 )`
 
 	createVisitorsTable = `
@@ -94,20 +103,232 @@ CREATE TABLE IF NOT EXISTS duration_hist (
     PRIMARY KEY (hour, router, bucket)
 )`
 
-	createCountriesHourIndex    = `CREATE INDEX IF NOT EXISTS idx_countries_hour ON countries(hour)`
-	createBrowsersHourIndex     = `CREATE INDEX IF NOT EXISTS idx_browsers_hour ON browsers(hour)`
-	createOSStatsHourIndex      = `CREATE INDEX IF NOT EXISTS idx_os_stats_hour ON os_stats(hour)`
-	createDurationHistHourIndex = `CREATE INDEX IF NOT EXISTS idx_duration_hist_hour ON duration_hist(hour)`
+	createSizeHistTable = `
+CREATE TABLE IF NOT EXISTS size_hist (
+    hour   TEXT    NOT NULL,
+    router TEXT    NOT NULL,
+    bucket TEXT    NOT NULL,
+    count  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, bucket)
+)`
+
+	createQueryParamsTable = `
+CREATE TABLE IF NOT EXISTS query_params (
+    hour   TEXT    NOT NULL,
+    router TEXT    NOT NULL,
+    param  TEXT    NOT NULL,
+    value  TEXT    NOT NULL,
+    count  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, param, value)
+)`
+
+	// requests at sub-hour granularity (TRAIL_FINE_BUCKET_MINUTES), kept
+	// only for a short window; bucket is minute-aligned, in hour's format
+	createRequestsFineTable = `
+CREATE TABLE IF NOT EXISTS requests_fine (
+    bucket   TEXT    NOT NULL,
+    router   TEXT    NOT NULL,
+    path     TEXT    NOT NULL,
+    method   TEXT    NOT NULL,
+    status   INTEGER NOT NULL,
+    count    INTEGER NOT NULL DEFAULT 0,
+    bytes    INTEGER NOT NULL DEFAULT 0,
+    duration INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, router, path, method, status)
+)`
+
+	// request IDs of recent 5xx responses (TRAIL_REQUEST_IDS), capped to
+	// the newest rows; ts is the request's own RFC3339 timestamp
+	createErrorRequestsTable = `
+CREATE TABLE IF NOT EXISTS error_requests (
+    hour       TEXT    NOT NULL,
+    ts         TEXT    NOT NULL,
+    router     TEXT    NOT NULL,
+    path       TEXT    NOT NULL,
+    method     TEXT    NOT NULL,
+    status     INTEGER NOT NULL,
+    request_id TEXT    NOT NULL,
+    PRIMARY KEY (request_id, ts)
+)`
+
+	// individual parsed requests (TRAIL_STORE_RAW), capped to the newest
+	// TRAIL_RAW_MAX_ROWS; ts is the request's own RFC3339 timestamp, ip_hash
+	// salted like visitors, referrer and user_agent as stored elsewhere
+	createRequestsRawTable = `
+CREATE TABLE IF NOT EXISTS requests_raw (
+    hour       TEXT    NOT NULL,
+    ts         TEXT    NOT NULL,
+    router     TEXT    NOT NULL,
+    host       TEXT    NOT NULL DEFAULT '',
+    path       TEXT    NOT NULL,
+    method     TEXT    NOT NULL,
+    status     INTEGER NOT NULL,
+    bytes      INTEGER NOT NULL DEFAULT 0,
+    duration   INTEGER NOT NULL DEFAULT 0,
+    ip_hash    TEXT    NOT NULL,
+    country    TEXT    NOT NULL DEFAULT '',
+    referrer   TEXT    NOT NULL DEFAULT '',
+    user_agent TEXT    NOT NULL DEFAULT ''
+)`
+
+	createHostsTable = `
+CREATE TABLE IF NOT EXISTS hosts (
+    hour   TEXT    NOT NULL,
+    router TEXT    NOT NULL,
+    host   TEXT    NOT NULL,
+    count  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, host)
+)`
+
+	createRawUserAgentsTable = `
+CREATE TABLE IF NOT EXISTS raw_user_agents (
+    hour       TEXT    NOT NULL,
+    router     TEXT    NOT NULL,
+    user_agent TEXT    NOT NULL,
+    count      INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, user_agent)
+)`
+
+	createCacheStatusTable = `
+CREATE TABLE IF NOT EXISTS cache_status (
+    hour   TEXT    NOT NULL,
+    router TEXT    NOT NULL,
+    status TEXT    NOT NULL,
+    count  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, status)
+)`
+
+	createThreatRequestsTable = `
+CREATE TABLE IF NOT EXISTS threat_requests (
+    hour    TEXT    NOT NULL,
+    router  TEXT    NOT NULL,
+    ip_hash TEXT    NOT NULL,
+    path    TEXT    NOT NULL,
+    count   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, ip_hash, path)
+)`
+
+	createPathCategoriesTable = `
+CREATE TABLE IF NOT EXISTS path_categories (
+    hour     TEXT    NOT NULL,
+    router   TEXT    NOT NULL,
+    path     TEXT    NOT NULL,
+    category TEXT    NOT NULL,
+    count    INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, path, category)
+)`
+
+	// First referrer and path of each human visitor-hour, and the goal path
+	// it reached ('' for none), for goal attribution (TRAIL_GOAL_PATH)
+	createVisitorEntriesTable = `
+CREATE TABLE IF NOT EXISTS visitor_entries (
+    hour       TEXT NOT NULL,
+    router     TEXT NOT NULL,
+    ip_hash    TEXT NOT NULL,
+    referrer   TEXT NOT NULL DEFAULT '',
+    entry_path TEXT NOT NULL DEFAULT '',
+    goal       TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (hour, router, ip_hash)
+)`
+
+	// Paths requested per unrouted client (TRAIL_SCANNER_PATHS), for
+	// ranking scanners by how many distinct paths they probe
+	createScannerPathsTable = `
+CREATE TABLE IF NOT EXISTS scanner_paths (
+    hour    TEXT    NOT NULL,
+    router  TEXT    NOT NULL,
+    ip_hash TEXT    NOT NULL,
+    path    TEXT    NOT NULL,
+    count   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, ip_hash, path)
+)`
+
+	// 401/403 responses per client on auth paths (TRAIL_AUTH_PATHS), for
+	// spotting credential stuffing from many sources
+	createAuthFailuresTable = `
+CREATE TABLE IF NOT EXISTS auth_failures (
+    hour    TEXT    NOT NULL,
+    router  TEXT    NOT NULL,
+    ip_hash TEXT    NOT NULL,
+    path    TEXT    NOT NULL,
+    count   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, ip_hash, path)
+)`
+
+	// Random sample of request durations per hour and router
+	// (TRAIL_DURATION_SAMPLES): seen requests, comma-separated ms values
+	createDurationSamplesTable = `
+CREATE TABLE IF NOT EXISTS duration_samples (
+    hour    TEXT    NOT NULL,
+    router  TEXT    NOT NULL,
+    seen    INTEGER NOT NULL DEFAULT 0,
+    samples TEXT    NOT NULL DEFAULT '',
+    PRIMARY KEY (hour, router)
+)`
+
+	// 429 responses per client (TRAIL_RATE_LIMIT_IPS)
+	createRateLimitedTable = `
+CREATE TABLE IF NOT EXISTS rate_limited (
+    hour    TEXT    NOT NULL,
+    router  TEXT    NOT NULL,
+    ip_hash TEXT    NOT NULL,
+    count   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router, ip_hash)
+)`
+
+	createUpstreamTimesTable = `
+CREATE TABLE IF NOT EXISTS upstream_times (
+    hour     TEXT    NOT NULL,
+    router   TEXT    NOT NULL,
+    count    INTEGER NOT NULL DEFAULT 0,
+    duration INTEGER NOT NULL DEFAULT 0,
+    upstream INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, router)
+)`
+
+	createMetaTable = `
+CREATE TABLE IF NOT EXISTS meta (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+)`
+
+	createCountriesHourIndex      = `CREATE INDEX IF NOT EXISTS idx_countries_hour ON countries(hour)`
+	createBrowsersHourIndex       = `CREATE INDEX IF NOT EXISTS idx_browsers_hour ON browsers(hour)`
+	createOSStatsHourIndex        = `CREATE INDEX IF NOT EXISTS idx_os_stats_hour ON os_stats(hour)`
+	createDurationHistHourIndex   = `CREATE INDEX IF NOT EXISTS idx_duration_hist_hour ON duration_hist(hour)`
+	createQueryParamsHourIndex    = `CREATE INDEX IF NOT EXISTS idx_query_params_hour ON query_params(hour)`
+	createSizeHistHourIndex       = `CREATE INDEX IF NOT EXISTS idx_size_hist_hour ON size_hist(hour)`
+	createErrorRequestsTsIndex    = `CREATE INDEX IF NOT EXISTS idx_error_requests_ts ON error_requests(ts)`
+	createRequestsRawTsIndex      = `CREATE INDEX IF NOT EXISTS idx_requests_raw_ts ON requests_raw(ts)`
+	createRequestsRawPathIndex    = `CREATE INDEX IF NOT EXISTS idx_requests_raw_path ON requests_raw(path, ts)`
+	createHostsHourIndex          = `CREATE INDEX IF NOT EXISTS idx_hosts_hour ON hosts(hour)`
+	createRawUserAgentsHourIndex  = `CREATE INDEX IF NOT EXISTS idx_raw_user_agents_hour ON raw_user_agents(hour)`
+	createCacheStatusHourIndex    = `CREATE INDEX IF NOT EXISTS idx_cache_status_hour ON cache_status(hour)`
+	createThreatRequestsHourIndex = `CREATE INDEX IF NOT EXISTS idx_threat_requests_hour ON threat_requests(hour)`
+	createPathCategoriesHourIndex = `CREATE INDEX IF NOT EXISTS idx_path_categories_hour ON path_categories(hour)`
+	createUpstreamTimesHourIndex  = `CREATE INDEX IF NOT EXISTS idx_upstream_times_hour ON upstream_times(hour)`
+	createRateLimitedHourIndex    = `CREATE INDEX IF NOT EXISTS idx_rate_limited_hour ON rate_limited(hour)`
+	createScannerPathsHourIndex   = `CREATE INDEX IF NOT EXISTS idx_scanner_paths_hour ON scanner_paths(hour)`
+	createAuthFailuresHourIndex   = `CREATE INDEX IF NOT EXISTS idx_auth_failures_hour ON auth_failures(hour)`
 )
 
 // Migrate creates all tables and indexes if they don't exist.
 func Migrate(db *sql.DB) error {
+	if err := MigrateData(db); err != nil {
+		return err
+	}
+	return runStatements(db, []string{createLogPositionTable})
+}
+
+// MigrateData is Migrate without the log_position table, for a data
+// database whose positions live in a separate state database. It keeps meta,
+// which records the schema version the newer-schema guard reads.
+func MigrateData(db *sql.DB) error {
 	statements := []string{
 		createRequestsTable,
 		createVisitorsTable,
 		createReferrersTable,
 		createUserAgentsTable,
-		createLogPositionTable,
 		createRequestsHourIndex,
 		createVisitorsHourIndex,
 		createReferrersHourIndex,
@@ -120,8 +341,88 @@ func Migrate(db *sql.DB) error {
 		createBrowsersHourIndex,
 		createOSStatsHourIndex,
 		createDurationHistHourIndex,
+		createMetaTable,
+		createQueryParamsTable,
+		createQueryParamsHourIndex,
+		createSizeHistTable,
+		createSizeHistHourIndex,
+		createRequestsFineTable,
+		createErrorRequestsTable,
+		createErrorRequestsTsIndex,
+		createHostsTable,
+		createHostsHourIndex,
+		createRawUserAgentsTable,
+		createRawUserAgentsHourIndex,
+		createCacheStatusTable,
+		createCacheStatusHourIndex,
+		createThreatRequestsTable,
+		createThreatRequestsHourIndex,
+		createPathCategoriesTable,
+		createPathCategoriesHourIndex,
+		createUpstreamTimesTable,
+		createUpstreamTimesHourIndex,
+		createRateLimitedTable,
+		createRateLimitedHourIndex,
+		createDurationSamplesTable,
+		createScannerPathsTable,
+		createScannerPathsHourIndex,
+		createVisitorEntriesTable,
+		createAuthFailuresTable,
+		createAuthFailuresHourIndex,
+		createRequestsRawTable,
+		createRequestsRawTsIndex,
+		createRequestsRawPathIndex,
+	}
+
+	if err := runStatements(db, statements); err != nil {
+		return err
+	}
+	return addRequestsHost(db)
+}
+
+// addRequestsHost rebuilds a requests table from before schema version 2,
+// which had no host column. SQLite can't change a primary key in place, so
+// the rows are copied into a new table with an empty host.
+func addRequestsHost(db *sql.DB) error {
+	var hasHost bool
+	if err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('requests') WHERE name = 'host'`).Scan(&hasHost); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
 	}
+	if hasHost {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`ALTER TABLE requests RENAME TO requests_v1`,
+		createRequestsTable,
+		`INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+			SELECT hour, router, '', path, method, status, count, bytes, duration FROM requests_v1`,
+		`DROP TABLE requests_v1`,
+		createRequestsHourIndex,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// MigrateState creates only the state tables (log positions and metadata)
+// used when TRAIL_STATE_DB points at a separate file.
+func MigrateState(db *sql.DB) error {
+	return runStatements(db, []string{
+		createLogPositionTable,
+		createMetaTable,
+	})
+}
 
+// runStatements runs each migration statement in order
+func runStatements(db *sql.DB, statements []string) error {
 	for _, stmt := range statements {
 		if _, err := db.Exec(stmt); err != nil {
 			return fmt.Errorf("migration failed: %w", err)
@@ -0,0 +1,236 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/open-wander/trail/internal/aggregator"
+	traildb "github.com/open-wander/trail/internal/db"
+)
+
+// JSON Lines export/import of the aggregate tables.
+// The first line is a Header; every following line is one Record.
+
+// Header is the first line of a dump
+type Header struct {
+	Format        string   `json:"format"`
+	SchemaVersion int      `json:"schema_version"`
+	Created       string   `json:"created"`
+	Tables        []string `json:"tables,omitempty"` // the tables the dump's rows may name
+}
+
+// Record is one table row in a dump
+type Record struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// formatName marks a file as a trail dump
+const formatName = "trail-export"
+
+// maxLineSize bounds a single JSONL line (rows are small; paths are the long part)
+const maxLineSize = 1 << 20
+
+// table describes how one aggregate table is dumped and replayed.
+// columns match the placeholder order of upsert.
+type table struct {
+	name    string
+	columns []string
+	upsert  string
+}
+
+// tables lists the exported aggregate tables. log_position and meta are
+// instance-specific and deliberately left out, as are error_requests (raw
+// request IDs only meaningful next to this proxy's own logs) and
+// requests_raw (single requests, not aggregates). duration_samples
+// is left out too: replayed samples can't be merged by an upsert, and
+// percentiles fall back to duration_hist without them.
+var tables = []table{
+	{"requests", []string{"hour", "router", "host", "path", "method", "status", "count", "bytes", "duration"}, aggregator.UpsertRequestsSQL},
+	{"requests_fine", []string{"bucket", "router", "path", "method", "status", "count", "bytes", "duration"}, aggregator.UpsertRequestsFineSQL},
+	{"visitors", []string{"hour", "router", "ip_hash"}, aggregator.UpsertVisitorsSQL},
+	{"referrers", []string{"hour", "router", "referrer", "count"}, aggregator.UpsertReferrersSQL},
+	{"user_agents", []string{"hour", "router", "category", "count"}, aggregator.UpsertUserAgentsSQL},
+	{"countries", []string{"hour", "router", "country", "count"}, aggregator.UpsertCountriesSQL},
+	{"browsers", []string{"hour", "router", "browser", "count"}, aggregator.UpsertBrowsersSQL},
+	{"os_stats", []string{"hour", "router", "os", "count"}, aggregator.UpsertOSStatsSQL},
+	{"duration_hist", []string{"hour", "router", "bucket", "count"}, aggregator.UpsertDurationHistSQL},
+	{"size_hist", []string{"hour", "router", "bucket", "count"}, aggregator.UpsertSizeHistSQL},
+	{"query_params", []string{"hour", "router", "param", "value", "count"}, aggregator.UpsertQueryParamsSQL},
+	{"hosts", []string{"hour", "router", "host", "count"}, aggregator.UpsertHostsSQL},
+	{"raw_user_agents", []string{"hour", "router", "user_agent", "count"}, aggregator.UpsertRawUserAgentsSQL},
+	{"cache_status", []string{"hour", "router", "status", "count"}, aggregator.UpsertCacheStatusSQL},
+	{"threat_requests", []string{"hour", "router", "ip_hash", "path", "count"}, aggregator.UpsertThreatRequestsSQL},
+	{"path_categories", []string{"hour", "router", "path", "category", "count"}, aggregator.UpsertPathCategoriesSQL},
+	{"upstream_times", []string{"hour", "router", "count", "duration", "upstream"}, aggregator.UpsertUpstreamTimesSQL},
+	{"rate_limited", []string{"hour", "router", "ip_hash", "count"}, aggregator.UpsertRateLimitedSQL},
+	{"visitor_entries", []string{"hour", "router", "ip_hash", "referrer", "entry_path", "goal"}, aggregator.UpsertVisitorEntriesSQL},
+	{"scanner_paths", []string{"hour", "router", "ip_hash", "path", "count"}, aggregator.UpsertScannerPathsSQL},
+	{"auth_failures", []string{"hour", "router", "ip_hash", "path", "count"}, aggregator.UpsertAuthFailuresSQL},
+}
+
+// Dump writes every aggregate table to w as JSON Lines
+func Dump(ctx context.Context, db *sql.DB, w io.Writer) error {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(Header{
+		Format:        formatName,
+		SchemaVersion: traildb.SchemaVersion,
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		Tables:        names,
+	}); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for _, t := range tables {
+		if err := dumpTable(ctx, db, enc, t); err != nil {
+			return fmt.Errorf("dump %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// dumpTable streams one table's rows through enc
+func dumpTable(ctx context.Context, db *sql.DB, enc *json.Encoder, t table) error {
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(t.columns, ", "), t.name)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(t.columns))
+	ptrs := make([]any, len(t.columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(t.columns))
+		for i, col := range t.columns {
+			row[col] = values[i]
+		}
+		if err := enc.Encode(Record{Table: t.name, Row: row}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Load replays a dump from r into db using the aggregator's upsert
+// statements, so counts add to any existing data. Dumps from a different
+// schema version, or whose header lists a table this build doesn't
+// import, are refused before any row is read. Returns the number of rows
+// applied.
+func Load(ctx context.Context, db *sql.DB, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, fmt.Errorf("read header: %w", err)
+		}
+		return 0, errors.New("empty dump: missing header")
+	}
+	var hdr Header
+	if err := json.Unmarshal(scanner.Bytes(), &hdr); err != nil || hdr.Format != formatName {
+		return 0, errors.New("not a trail dump: first line must be a trail-export header")
+	}
+	if hdr.SchemaVersion != traildb.SchemaVersion {
+		return 0, fmt.Errorf("dump has schema version %d, this build expects %d", hdr.SchemaVersion, traildb.SchemaVersion)
+	}
+
+	byName := make(map[string]table, len(tables))
+	for _, t := range tables {
+		byName[t.name] = t
+	}
+	for _, name := range hdr.Tables {
+		if _, ok := byName[name]; !ok {
+			return 0, fmt.Errorf("dump has table %q, which this build doesn't import; use a trail at least as new as the one that wrote it", name)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmts := make(map[string]*sql.Stmt, len(tables))
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	applied := 0
+	line := 1
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.UseNumber()
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		t, ok := byName[rec.Table]
+		if !ok {
+			return 0, fmt.Errorf("line %d: unknown table %q", line, rec.Table)
+		}
+
+		args := make([]any, len(t.columns))
+		for i, col := range t.columns {
+			v, ok := rec.Row[col]
+			if !ok {
+				return 0, fmt.Errorf("line %d: %s row missing column %q", line, t.name, col)
+			}
+			if n, isNum := v.(json.Number); isNum {
+				iv, err := n.Int64()
+				if err != nil {
+					return 0, fmt.Errorf("line %d: column %q: %w", line, col, err)
+				}
+				v = iv
+			}
+			args[i] = v
+		}
+
+		stmt, ok := stmts[t.name]
+		if !ok {
+			stmt, err = tx.PrepareContext(ctx, t.upsert)
+			if err != nil {
+				return 0, fmt.Errorf("prepare %s: %w", t.name, err)
+			}
+			stmts[t.name] = stmt
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		applied++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read dump: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
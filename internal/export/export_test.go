@@ -0,0 +1,150 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	traildb "github.com/open-wander/trail/internal/db"
+	_ "modernc.org/sqlite"
+)
+
+// testDB creates an in-memory SQLite database for testing
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := traildb.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func seed(t *testing.T, db *sql.DB) {
+	t.Helper()
+	stmts := []string{
+		`INSERT INTO requests VALUES ('2026-02-08T10:00:00Z', 'web', 'example.com', '/', 'GET', 200, 10, 5000, 1200)`,
+		`INSERT INTO requests VALUES ('2026-02-08T10:00:00Z', 'web', '', '/a"quoted"/päth', 'POST', 500, 1, 0, 30)`,
+		`INSERT INTO visitors VALUES ('2026-02-08T10:00:00Z', 'web', 'abcdef0123456789')`,
+		`INSERT INTO referrers VALUES ('2026-02-08T10:00:00Z', 'web', 'example.com', 4)`,
+		`INSERT INTO duration_hist VALUES ('2026-02-08T10:00:00Z', 'web', '0-10ms', 7)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+}
+
+func TestDumpLoadRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := testDB(t)
+	seed(t, src)
+
+	var buf bytes.Buffer
+	if err := Dump(ctx, src, &buf); err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	dump := buf.String()
+	first := strings.SplitN(dump, "\n", 2)[0]
+	if !strings.HasPrefix(first, `{"format":"trail-export","schema_version":`) {
+		t.Errorf("dump does not start with header: %q", first)
+	}
+	if !strings.Contains(first, `"tables":["requests","requests_fine",`) {
+		t.Errorf("header doesn't list the dumped tables: %q", first)
+	}
+
+	dst := testDB(t)
+	n, err := Load(ctx, dst, strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Load() applied %d rows, want 5", n)
+	}
+
+	var count, bytesSum, duration int64
+	var host string
+	err = dst.QueryRow(`SELECT host, count, bytes, duration FROM requests WHERE path = '/'`).Scan(&host, &count, &bytesSum, &duration)
+	if err != nil {
+		t.Fatalf("query requests: %v", err)
+	}
+	if host != "example.com" || count != 10 || bytesSum != 5000 || duration != 1200 {
+		t.Errorf("requests row = (%s, %d, %d, %d), want (example.com, 10, 5000, 1200)", host, count, bytesSum, duration)
+	}
+
+	var path string
+	if err := dst.QueryRow(`SELECT path FROM requests WHERE status = 500`).Scan(&path); err != nil {
+		t.Fatalf("query quoted path: %v", err)
+	}
+	if path != `/a"quoted"/päth` {
+		t.Errorf("path = %q, want it unchanged", path)
+	}
+
+	// Loading the same dump again merges: counters add, visitors dedup
+	if _, err := Load(ctx, dst, strings.NewReader(dump)); err != nil {
+		t.Fatalf("second Load() error = %v", err)
+	}
+	if err := dst.QueryRow(`SELECT count FROM requests WHERE path = '/'`).Scan(&count); err != nil {
+		t.Fatalf("query requests: %v", err)
+	}
+	if count != 20 {
+		t.Errorf("count after second load = %d, want 20", count)
+	}
+	var visitors int
+	if err := dst.QueryRow(`SELECT COUNT(*) FROM visitors`).Scan(&visitors); err != nil {
+		t.Fatalf("query visitors: %v", err)
+	}
+	if visitors != 1 {
+		t.Errorf("visitors after second load = %d, want 1", visitors)
+	}
+}
+
+// header is a dump header of this build's schema version
+var header = fmt.Sprintf(`{"format":"trail-export","schema_version":%d,"created":"x"}`, traildb.SchemaVersion)
+
+func TestLoadRejectsBadDumps(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+	}{
+		{"empty", ""},
+		{"no header", `{"table":"requests","row":{}}`},
+		{"wrong schema version", `{"format":"trail-export","schema_version":999,"created":"x"}`},
+		{"unknown table", header + "\n" +
+			`{"table":"log_position","row":{"file":"/x"}}`},
+		{"unknown table in header", fmt.Sprintf(`{"format":"trail-export","schema_version":%d,"created":"x","tables":["referrers","newer_table"]}`, traildb.SchemaVersion)},
+		{"missing column", header + "\n" +
+			`{"table":"referrers","row":{"hour":"2026-02-08T10:00:00Z","router":"web","count":1}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			if _, err := Load(context.Background(), db, strings.NewReader(tt.dump)); err == nil {
+				t.Error("Load() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestLoadIsAllOrNothing(t *testing.T) {
+	db := testDB(t)
+	dump := header + "\n" +
+		`{"table":"referrers","row":{"hour":"2026-02-08T10:00:00Z","router":"web","referrer":"a.com","count":1}}` + "\n" +
+		`not json`
+
+	if _, err := Load(context.Background(), db, strings.NewReader(dump)); err == nil {
+		t.Fatal("Load() expected error but got none")
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM referrers`).Scan(&n); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("referrers = %d after failed load, want 0", n)
+	}
+}
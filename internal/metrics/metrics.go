@@ -0,0 +1,172 @@
+// Package metrics keeps counters and gauges about Trail itself, such as
+// lines read and dropped by the tailer, and writes them in the Prometheus
+// text format alongside the traffic series on /metrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a value that only goes up
+type Counter struct {
+	v atomic.Int64
+}
+
+// Inc adds one
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add adds n, which should not be negative
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Set sets the value
+func (g *Gauge) Set(n int64) {
+	g.v.Store(n)
+}
+
+// SetMax raises the value to n if n is higher, for high-water marks
+func (g *Gauge) SetMax(n int64) {
+	for {
+		cur := g.v.Load()
+		if n <= cur || g.v.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+// Value returns the current value
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// series is one registered name and label set
+type series struct {
+	name   string
+	help   string
+	kind   string // "counter" or "gauge"
+	labels string // formatted, e.g. `{file="/var/log/access.log"}`
+	value  func() int64
+	metric any // the *Counter or *Gauge
+}
+
+// Registry holds metrics by name and labels
+type Registry struct {
+	mu     sync.Mutex
+	series []*series
+}
+
+// Default is the registry served on /metrics
+var Default = &Registry{}
+
+// labelEscaper escapes label values for the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapeLabel escapes a label value for the text exposition format, for
+// series written outside a Registry
+func EscapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// Counter returns the counter name with the given label name, value
+// pairs, registering it on first use, so a component created again (a
+// tailer restarted for the same file) keeps counting where it left off.
+// It panics if name is already a gauge, or labels has an odd length.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return r.get(name, help, "counter", labels, func() any { return &Counter{} }).(*Counter)
+}
+
+// Gauge returns the gauge name with the given label name, value pairs,
+// registering it on first use. It panics if name is already a counter, or
+// labels has an odd length.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return r.get(name, help, "gauge", labels, func() any { return &Gauge{} }).(*Gauge)
+}
+
+// get finds or registers a series
+func (r *Registry) get(name, help, kind string, labels []string, create func() any) any {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metrics: %s registered with an odd number of label names and values", name))
+	}
+	formatted := formatLabels(labels)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.series {
+		if s.name != name {
+			continue
+		}
+		if s.kind != kind {
+			panic(fmt.Sprintf("metrics: %s registered as both a %s and a %s", name, s.kind, kind))
+		}
+		if s.labels == formatted {
+			return s.metric
+		}
+	}
+
+	s := &series{name: name, help: help, kind: kind, labels: formatted, metric: create()}
+	switch m := s.metric.(type) {
+	case *Counter:
+		s.value = m.Value
+	case *Gauge:
+		s.value = m.Value
+	}
+	r.series = append(r.series, s)
+	return s.metric
+}
+
+// formatLabels renders name, value pairs as {name="value",...}, or "" for
+// none
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteText writes every series in the Prometheus text format, grouped by
+// name with one HELP and TYPE line each, names and label sets sorted
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	sorted := slices.Clone(r.series)
+	r.mu.Unlock()
+	slices.SortStableFunc(sorted, func(a, b *series) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.labels, b.labels)
+	})
+
+	for i, s := range sorted {
+		if i == 0 || sorted[i-1].name != s.name {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", s.name, s.labels, s.value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+	r.Counter("trail_lines_total", "Lines.", "file", "b.log").Add(2)
+	r.Counter("trail_lines_total", "Lines.", "file", `a"1".log`).Inc()
+	r.Counter("trail_lines_total", "Lines.", "file", "b.log").Inc() // same series
+	g := r.Gauge("trail_depth", "Depth.")
+	g.SetMax(5)
+	g.SetMax(3)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP trail_depth Depth.
+# TYPE trail_depth gauge
+trail_depth 5
+# HELP trail_lines_total Lines.
+# TYPE trail_lines_total counter
+trail_lines_total{file="a\"1\".log"} 1
+trail_lines_total{file="b.log"} 3
+`
+	if b.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistry_KindMismatch(t *testing.T) {
+	r := &Registry{}
+	r.Counter("trail_x", "X.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a counter's name as a gauge should panic")
+		}
+	}()
+	r.Gauge("trail_x", "X.")
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// albRequestTypes are the first field of an AWS Application Load Balancer
+// access log entry
+var albRequestTypes = map[string]bool{
+	"http": true, "https": true, "h2": true, "grpcs": true, "ws": true, "wss": true,
+}
+
+// ALB access log fields, space-separated with some quoted; newer ALBs
+// append more after these
+const (
+	albType = iota
+	albTime
+	albELB
+	albClient
+	albTarget
+	albRequestTime
+	albTargetTime
+	albResponseTime
+	albStatus
+	albTargetStatus
+	albReceivedBytes
+	albSentBytes
+	albRequest
+	albUserAgent
+	albSSLCipher
+	albSSLProtocol
+	albTargetGroup
+	albTraceID
+	albDomainName
+	albCertARN
+	albRulePriority
+	albCreationTime
+	albActions
+	albMinFields = albUserAgent + 1
+)
+
+// ParseALB parses a single AWS Application Load Balancer access log entry
+// into a LogEntry. The target group's name becomes Router, or the last
+// action taken (redirect, fixed-response) for requests the load balancer
+// answered itself; the target is Backend. DurationMs is the sum of the
+// three processing times and UpstreamMs the target's, none of them
+// recorded when ALB logs -1 (the target was never reached or the client
+// went away). The X-Amzn-Trace-Id becomes RequestID.
+func ParseALB(line string) (*LogEntry, error) {
+	fields, err := splitALBFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < albMinFields || !albRequestTypes[fields[albType]] {
+		return nil, fmt.Errorf("line does not match ALB access log format")
+	}
+	field := func(i int) string {
+		if i >= len(fields) || fields[i] == "-" {
+			return ""
+		}
+		return fields[i]
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[albTime])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	ip := fields[albClient]
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	var status int
+	if s := field(albStatus); s != "" {
+		if status, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("failed to parse status code: %w", err)
+		}
+	}
+
+	var bytes int64
+	if s := field(albSentBytes); s != "" {
+		if bytes, err = parseNumber(s); err != nil {
+			return nil, fmt.Errorf("failed to parse bytes: %w", err)
+		}
+	}
+
+	// "GET https://example.com:443/path?q HTTP/1.1"; ALB logs requests it
+	// couldn't parse as "- http://example.com:80- -"
+	request := strings.SplitN(fields[albRequest], " ", 3)
+	if len(request) != 3 || request[0] == "-" {
+		return nil, fmt.Errorf("unparsable ALB request %q", fields[albRequest])
+	}
+	u, err := url.Parse(request[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request URL: %w", err)
+	}
+
+	entry := &LogEntry{
+		IP:        ip,
+		Timestamp: timestamp,
+		Method:    request[0],
+		Path:      u.RequestURI(),
+		Protocol:  request[2],
+		Status:    status,
+		Bytes:     bytes,
+		UserAgent: field(albUserAgent),
+		Router:    albRouter(field(albTargetGroup), field(albActions)),
+		Backend:   field(albTarget),
+		Host:      u.Hostname(),
+		RequestID: field(albTraceID),
+	}
+	if entry.Host == "" {
+		entry.Host = field(albDomainName)
+	}
+
+	requestMs, errRequest := parseDurationMs(fields[albRequestTime], UnitSeconds)
+	targetMs, errTarget := parseDurationMs(fields[albTargetTime], UnitSeconds)
+	responseMs, errResponse := parseDurationMs(fields[albResponseTime], UnitSeconds)
+	if errRequest == nil && errTarget == nil && errResponse == nil {
+		entry.DurationMs = requestMs + targetMs + responseMs
+		entry.HasDuration = true
+		entry.UpstreamMs = targetMs
+		entry.HasUpstream = true
+	}
+	return entry, nil
+}
+
+// albRouter names the target group of an ARN
+// (arn:aws:elasticloadbalancing:...:targetgroup/NAME/ID), or the last of
+// the comma-separated actions when no target group took the request
+func albRouter(targetGroup, actions string) string {
+	if _, rest, ok := strings.Cut(targetGroup, ":targetgroup/"); ok {
+		name, _, _ := strings.Cut(rest, "/")
+		return name
+	}
+	if actions == "" {
+		return ""
+	}
+	last := actions[strings.LastIndex(actions, ",")+1:]
+	if last == "forward" {
+		return ""
+	}
+	return last
+}
+
+// splitALBFields splits an ALB log entry on spaces, keeping quoted fields
+// (which ALB never escapes quotes in) whole and unquoted
+func splitALBFields(line string) ([]string, error) {
+	var fields []string
+	for line != "" {
+		if line[0] == ' ' {
+			line = line[1:]
+			continue
+		}
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted field in ALB log entry")
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields, nil
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseALB(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *LogEntry
+		wantErr bool
+	}{
+		{
+			name: "forwarded to a target group",
+			line: `https 2026-02-08T16:00:00.250000Z app/my-lb/50dc6c495c0c9188 203.0.113.9:2817 10.0.0.1:80 0.001 0.020 0.002 200 200 34 366 "GET https://example.com:443/blog/?page=2 HTTP/1.1" "Mozilla/5.0 (X11; Linux x86_64)" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/web/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678" 1 2026-02-08T16:00:00.220000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-" TID_1`,
+			want: &LogEntry{
+				IP:          "203.0.113.9",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 0, 250000000, time.UTC),
+				Method:      "GET",
+				Path:        "/blog/?page=2",
+				Protocol:    "HTTP/1.1",
+				Status:      200,
+				Bytes:       366,
+				UserAgent:   "Mozilla/5.0 (X11; Linux x86_64)",
+				Router:      "web",
+				Backend:     "10.0.0.1:80",
+				Host:        "example.com",
+				DurationMs:  23,
+				HasDuration: true,
+				UpstreamMs:  20,
+				HasUpstream: true,
+				RequestID:   "Root=1-58337262-36d228ad5d99923122bbe354",
+			},
+		},
+		{
+			name: "redirect answered by the load balancer",
+			line: `http 2026-02-08T16:00:01.000000Z app/my-lb/50dc6c495c0c9188 [2001:db8::1]:5555 - -1 -1 -1 301 - 120 190 "GET http://example.com:80/login HTTP/1.1" "curl/8.5.0" - - - "Root=1-58337262-aaaa" "-" "-" 0 2026-02-08T16:00:01.000000Z "redirect" "https://example.com:443/login" "-" "-" "-" "-" "-"`,
+			want: &LogEntry{
+				IP:        "2001:db8::1",
+				Timestamp: time.Date(2026, 2, 8, 16, 0, 1, 0, time.UTC),
+				Method:    "GET",
+				Path:      "/login",
+				Protocol:  "HTTP/1.1",
+				Status:    301,
+				Bytes:     190,
+				UserAgent: "curl/8.5.0",
+				Router:    "redirect",
+				Host:      "example.com",
+				RequestID: "Root=1-58337262-aaaa",
+			},
+		},
+		{
+			name: "classic fields only",
+			line: `h2 2026-02-08T16:00:02Z app/my-lb/50dc6c495c0c9188 198.51.100.4:443 - 0.000 0.000 0.000 404 - 0 0 "POST https://api.example.com:443/v1 HTTP/2.0" "-"`,
+			want: &LogEntry{
+				IP:          "198.51.100.4",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 2, 0, time.UTC),
+				Method:      "POST",
+				Path:        "/v1",
+				Protocol:    "HTTP/2.0",
+				Status:      404,
+				Host:        "api.example.com",
+				HasDuration: true,
+				HasUpstream: true,
+			},
+		},
+		{
+			name:    "unparsable request",
+			line:    `http 2026-02-08T16:00:03Z app/my-lb/50dc6c495c0c9188 198.51.100.4:443 - -1 -1 -1 400 - 0 0 "- http://example.com:80- -" "-" - - - "-" "-" "-" - 2026-02-08T16:00:03Z "-" "-" "-" "-" "-" "-" "-"`,
+			wantErr: true,
+		},
+		{
+			name:    "combined line",
+			line:    `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated quote",
+			line:    `http 2026-02-08T16:00:03Z app/my-lb/50dc6c495c0c9188 198.51.100.4:443 - 0 0 0 200 200 0 0 "GET http://example.com/ HTTP/1.1`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseALB(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseALB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseALB() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserALB(t *testing.T) {
+	albLine := `http 2026-02-08T16:00:00Z app/my-lb/50dc6c495c0c9188 203.0.113.9:2817 10.0.0.1:80 0.001 0.020 0.000 200 200 34 366 "GET http://example.com:80/ HTTP/1.1" "Mozilla/5.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/web/73e2d6bc24d8a067 "Root=1-abc" "-" "-" 0 2026-02-08T16:00:00Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
+	combinedLine := `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`
+
+	p := NewParser("auto")
+	if got := p.Detect([]string{albLine, albLine, combinedLine}); got != FormatALB {
+		t.Fatalf("Detect() = %s, want alb", got)
+	}
+	if entry, err := p.ParseLine(albLine); err != nil || entry.Router != "web" {
+		t.Errorf("ParseLine() = %+v, %v, want the alb entry", entry, err)
+	}
+
+	m := NewParser("multi")
+	for _, line := range []string{albLine, combinedLine} {
+		if _, err := m.ParseLine(line); err != nil {
+			t.Errorf("multi ParseLine(%.20s...) error = %v", line, err)
+		}
+	}
+
+	if f, ok := LookupFormat("alb"); !ok || f != FormatALB {
+		t.Errorf("LookupFormat(alb) = %v, %v, want FormatALB", f, ok)
+	}
+}
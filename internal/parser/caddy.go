@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// caddyLine is the subset of a Caddy JSON access log entry trail reads:
+// {"ts":1770566400.123,"request":{"client_ip":"1.2.3.4","method":"GET",...},"status":200,...}
+type caddyLine struct {
+	TS      json.RawMessage `json:"ts"` // epoch seconds, or a string with a custom time_format
+	Request struct {
+		RemoteIP   string              `json:"remote_ip"`
+		RemoteAddr string              `json:"remote_addr"` // Caddy before 2.5: "ip:port"
+		ClientIP   string              `json:"client_ip"`   // remote_ip resolved through trusted proxies
+		Proto      string              `json:"proto"`
+		Method     string              `json:"method"`
+		Host       string              `json:"host"`
+		URI        string              `json:"uri"`
+		Headers    map[string][]string `json:"headers"`
+	} `json:"request"`
+	Duration    json.RawMessage     `json:"duration"` // seconds, or a string with duration_format "string"
+	Size        int64               `json:"size"`
+	Status      int                 `json:"status"`
+	RespHeaders map[string][]string `json:"resp_headers"`
+}
+
+// ParseCaddyJSON parses a single Caddy JSON access log line into a
+// LogEntry. Like Combined, Caddy has no routers, so Router is "server";
+// the requested host is kept in Host.
+func ParseCaddyJSON(line string) (*LogEntry, error) {
+	if !strings.HasPrefix(line, "{") {
+		return nil, fmt.Errorf("line does not match Caddy JSON log format")
+	}
+	var l caddyLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return nil, fmt.Errorf("line does not match Caddy JSON log format: %w", err)
+	}
+	if l.Request.Method == "" || l.Request.URI == "" || len(l.TS) == 0 {
+		return nil, fmt.Errorf("line does not match Caddy JSON log format: no request")
+	}
+
+	timestamp, err := parseCaddyTime(l.TS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	var durationMs int
+	hasDuration := len(l.Duration) > 0
+	if hasDuration {
+		if durationMs, err = parseCaddyDuration(l.Duration); err != nil {
+			return nil, fmt.Errorf("failed to parse duration: %w", err)
+		}
+	}
+
+	ip := l.Request.ClientIP
+	if ip == "" {
+		ip = l.Request.RemoteIP
+	}
+	if ip == "" {
+		ip = l.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	header := func(h map[string][]string, name string) string {
+		if v := h[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	requestID := header(l.RespHeaders, "X-Request-Id")
+	if requestID == "" {
+		requestID = header(l.Request.Headers, "X-Request-Id")
+	}
+
+	return &LogEntry{
+		IP:          ip,
+		Timestamp:   timestamp,
+		Method:      l.Request.Method,
+		Path:        l.Request.URI,
+		Protocol:    l.Request.Proto,
+		Status:      l.Status,
+		Bytes:       l.Size,
+		Referer:     header(l.Request.Headers, "Referer"),
+		UserAgent:   header(l.Request.Headers, "User-Agent"),
+		Router:      "server",
+		Host:        l.Request.Host,
+		DurationMs:  durationMs,
+		HasDuration: hasDuration,
+		RequestID:   requestID,
+	}, nil
+}
+
+// parseCaddyTime parses ts: a Unix epoch number (Caddy's default), or a
+// string in RFC 3339, CLF or epoch form for a custom time_format
+func parseCaddyTime(raw json.RawMessage) (time.Time, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return ParseEpoch(string(raw))
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return parseTimestamp(s)
+}
+
+// parseCaddyDuration parses duration: seconds as a number (Caddy's
+// default), or a Go duration string such as "1.5ms"
+func parseCaddyDuration(raw json.RawMessage) (int, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return parseDurationMs(string(raw), UnitSeconds)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return int(d.Round(time.Millisecond) / time.Millisecond), nil
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCaddyJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *LogEntry
+		wantErr bool
+	}{
+		{
+			name: "caddy 2.7 default",
+			line: `{"level":"info","ts":1770566400.25,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"10.0.0.2","remote_port":"41342","client_ip":"203.0.113.9","proto":"HTTP/2.0","method":"GET","host":"example.com","uri":"/blog/?page=2","headers":{"User-Agent":["Mozilla/5.0"],"Referer":["https://news.ycombinator.com/"]}},"bytes_read":0,"user_id":"","duration":0.0123,"size":5120,"status":200,"resp_headers":{"Server":["Caddy"],"X-Request-Id":["req-abc-123"]}}`,
+			want: &LogEntry{
+				IP:          "203.0.113.9",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 0, 250000000, time.UTC),
+				Method:      "GET",
+				Path:        "/blog/?page=2",
+				Protocol:    "HTTP/2.0",
+				Status:      200,
+				Bytes:       5120,
+				Referer:     "https://news.ycombinator.com/",
+				UserAgent:   "Mozilla/5.0",
+				Router:      "server",
+				Host:        "example.com",
+				DurationMs:  12,
+				HasDuration: true,
+				RequestID:   "req-abc-123",
+			},
+		},
+		{
+			name: "older caddy with remote_addr, string time and duration",
+			line: `{"ts":"2026-02-08T16:00:00Z","request":{"remote_addr":"198.51.100.4:5555","proto":"HTTP/1.1","method":"POST","host":"api.example.com","uri":"/login","headers":{}},"duration":"1.6ms","size":0,"status":401}`,
+			want: &LogEntry{
+				IP:          "198.51.100.4",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 0, 0, time.UTC),
+				Method:      "POST",
+				Path:        "/login",
+				Protocol:    "HTTP/1.1",
+				Status:      401,
+				Router:      "server",
+				Host:        "api.example.com",
+				DurationMs:  2,
+				HasDuration: true,
+			},
+		},
+		{
+			name:    "caddy runtime log without a request",
+			line:    `{"level":"info","ts":1770566400.25,"logger":"tls","msg":"certificate obtained"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			line:    `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			line:    `{"ts":1770566400.25,"request":{"method":"GET","uri":"/"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCaddyJSON(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCaddyJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCaddyJSON() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserCaddy(t *testing.T) {
+	caddyLine := `{"ts":1770566400.25,"request":{"client_ip":"203.0.113.9","proto":"HTTP/1.1","method":"GET","host":"example.com","uri":"/","headers":{}},"duration":0.001,"size":10,"status":200}`
+	traefikLine := `91.34.143.167 - admin [07/Jan/2026:16:17:08 +0000] "GET /ws HTTP/1.1" 404 555 "-" "Mozilla/5.0" 1 "web@docker" "http://172.19.0.4:80" 1ms`
+
+	p := NewParser("auto")
+	if got := p.Detect([]string{caddyLine, caddyLine, traefikLine}); got != FormatCaddyJSON {
+		t.Fatalf("Detect() = %s, want caddy", got)
+	}
+	if entry, err := p.ParseLine(caddyLine); err != nil || entry.Host != "example.com" {
+		t.Errorf("ParseLine() = %+v, %v, want the caddy entry", entry, err)
+	}
+
+	m := NewParser("multi")
+	for _, line := range []string{caddyLine, traefikLine} {
+		if _, err := m.ParseLine(line); err != nil {
+			t.Errorf("multi ParseLine(%.20s...) error = %v", line, err)
+		}
+	}
+
+	if f, ok := LookupFormat("caddy"); !ok || f != FormatCaddyJSON {
+		t.Errorf("LookupFormat(caddy) = %v, %v, want FormatCaddyJSON", f, ok)
+	}
+}
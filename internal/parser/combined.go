@@ -2,59 +2,76 @@ package parser
 
 import (
 	"fmt"
-	"math"
 	"regexp"
-	"strconv"
-	"time"
+	"strings"
 )
 
 // Compiled regex for Apache/Nginx Combined log format
-// Format: IP - USER [TIMESTAMP] "METHOD PATH PROTOCOL" STATUS BYTES "REFERER" "UA" [optional: request_time]
+// Format: IP - USER [TIMESTAMP] "METHOD PATH PROTOCOL" STATUS BYTES "REFERER" "UA" [optional: request_time] [optional: request_id]
 var combinedRegex = regexp.MustCompile(
 	`^(\S+) ` + // IP
 		`\S+ ` + // ident (always -)
 		`(\S+) ` + // auth user (- or username)
 		`\[([^\]]+)\] ` + // timestamp
 		`"(\S+) (\S+) ([^"]+)" ` + // method path protocol
-		`(\d+) ` + // status
+		`(\d+|-) ` + // status (- for none)
 		`(\d+|-) ` + // bytes (can be - for 0)
 		`"([^"]*)" ` + // referer
 		`"([^"]*)"` + // user-agent
-		`(?:\s+(\S+))?`, // optional: request_time in seconds (float, e.g. "0.003")
+		`(?:\s+(\S+))?` + // optional: request_time, seconds by default (float, e.g. "0.003")
+		`(.*)`, // optional trailing fields, e.g. $request_id
 )
 
+// vhostPrefixRegex matches the virtual host Apache's vhost_combined format
+// (%v:%p) writes before an otherwise Combined line
+var vhostPrefixRegex = regexp.MustCompile(`^(\S+):\d+ (.*)$`)
+
 // ParseCombined parses a single Apache/Nginx Combined log line into a LogEntry.
 // Sets Router to "server" as a synthetic default (no router concept in Combined format).
+// Apache's vhost_combined lines, prefixed with "host:port ", set Host.
 func ParseCombined(line string) (*LogEntry, error) {
+	return parseCombined(line, UnitSeconds)
+}
+
+// parseCombined is ParseCombined with request_time written in unit
+func parseCombined(line string, unit DurationUnit) (*LogEntry, error) {
 	matches := combinedRegex.FindStringSubmatch(line)
 	if matches == nil {
+		if vhost := vhostPrefixRegex.FindStringSubmatch(line); vhost != nil {
+			if entry, err := parseCombined(vhost[2], unit); err == nil {
+				entry.Host = vhost[1]
+				return entry, nil
+			}
+		}
 		return nil, fmt.Errorf("line does not match Combined log format")
 	}
 
-	timestamp, err := time.Parse(clfTimeLayout, matches[3])
+	timestamp, err := parseTimestamp(matches[3])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
 	}
 
-	status, err := strconv.Atoi(matches[7])
+	status, err := parseNumber(matches[7])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse status code: %w", err)
 	}
 
-	var bytes int64
-	if matches[8] != "-" {
-		bytes, err = strconv.ParseInt(matches[8], 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse bytes: %w", err)
-		}
+	bytes, err := parseNumber(matches[8])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bytes: %w", err)
 	}
 
-	// Parse optional request_time (float seconds -> ms)
+	// Parse optional request_time (in unit -> ms). "-" records no timing;
+	// another first trailing field that isn't a number may itself be the
+	// request ID.
 	var durationMs int
-	if matches[11] != "" {
-		seconds, err := strconv.ParseFloat(matches[11], 64)
-		if err == nil {
-			durationMs = int(math.Round(seconds * 1000))
+	var hasDuration bool
+	trailing := strings.Fields(matches[12])
+	if matches[11] != "" && matches[11] != "-" {
+		if durationMs, err = parseDurationMs(matches[11], unit); err == nil {
+			hasDuration = true
+		} else {
+			trailing = append([]string{matches[11]}, trailing...)
 		}
 	}
 
@@ -66,17 +83,19 @@ func ParseCombined(line string) (*LogEntry, error) {
 	}
 
 	return &LogEntry{
-		IP:         matches[1],
-		Timestamp:  timestamp,
-		Method:     matches[4],
-		Path:       matches[5],
-		Protocol:   matches[6],
-		Status:     status,
-		Bytes:      bytes,
-		Referer:    unquote(matches[9]),
-		UserAgent:  unquote(matches[10]),
-		Router:     "server",
-		Backend:    "",
-		DurationMs: durationMs,
+		IP:          matches[1],
+		Timestamp:   timestamp,
+		Method:      matches[4],
+		Path:        matches[5],
+		Protocol:    matches[6],
+		Status:      int(status),
+		Bytes:       bytes,
+		Referer:     unquote(matches[9]),
+		UserAgent:   unquote(matches[10]),
+		Router:      "server",
+		Backend:     "",
+		DurationMs:  durationMs,
+		HasDuration: hasDuration,
+		RequestID:   findRequestID(trailing),
 	}, nil
 }
@@ -34,18 +34,19 @@ func TestParseCombined(t *testing.T) {
 			name: "nginx with request_time",
 			line: `10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "POST /api/data HTTP/1.1" 201 512 "-" "curl/7.68.0" 0.003`,
 			want: &LogEntry{
-				IP:         "10.0.0.1",
-				Timestamp:  time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC),
-				Method:     "POST",
-				Path:       "/api/data",
-				Protocol:   "HTTP/1.1",
-				Status:     201,
-				Bytes:      512,
-				Referer:    "",
-				UserAgent:  "curl/7.68.0",
-				Router:     "server",
-				Backend:    "",
-				DurationMs: 3,
+				IP:          "10.0.0.1",
+				Timestamp:   time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC),
+				Method:      "POST",
+				Path:        "/api/data",
+				Protocol:    "HTTP/1.1",
+				Status:      201,
+				Bytes:       512,
+				Referer:     "",
+				UserAgent:   "curl/7.68.0",
+				Router:      "server",
+				Backend:     "",
+				DurationMs:  3,
+				HasDuration: true,
 			},
 		},
 		{
@@ -88,18 +89,35 @@ func TestParseCombined(t *testing.T) {
 			name: "nginx with longer request time",
 			line: `10.0.0.2 - - [10/Jan/2026:17:00:00 +0000] "GET /slow HTTP/2.0" 200 8192 "https://example.com" "Mozilla/5.0" 2.456`,
 			want: &LogEntry{
-				IP:         "10.0.0.2",
-				Timestamp:  time.Date(2026, 1, 10, 17, 0, 0, 0, time.UTC),
-				Method:     "GET",
-				Path:       "/slow",
-				Protocol:   "HTTP/2.0",
-				Status:     200,
-				Bytes:      8192,
-				Referer:    "https://example.com",
-				UserAgent:  "Mozilla/5.0",
-				Router:     "server",
-				Backend:    "",
-				DurationMs: 2456,
+				IP:          "10.0.0.2",
+				Timestamp:   time.Date(2026, 1, 10, 17, 0, 0, 0, time.UTC),
+				Method:      "GET",
+				Path:        "/slow",
+				Protocol:    "HTTP/2.0",
+				Status:      200,
+				Bytes:       8192,
+				Referer:     "https://example.com",
+				UserAgent:   "Mozilla/5.0",
+				Router:      "server",
+				Backend:     "",
+				DurationMs:  2456,
+				HasDuration: true,
+			},
+		},
+		{
+			name: "apache vhost_combined",
+			line: `blog.example.com:443 10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "Mozilla/5.0"`,
+			want: &LogEntry{
+				IP:        "10.0.0.1",
+				Timestamp: time.Date(2026, 1, 10, 14, 0, 0, 0, time.UTC),
+				Method:    "GET",
+				Path:      "/",
+				Protocol:  "HTTP/1.1",
+				Status:    200,
+				Bytes:     512,
+				UserAgent: "Mozilla/5.0",
+				Router:    "server",
+				Host:      "blog.example.com",
 			},
 		},
 		{
@@ -153,6 +171,12 @@ func TestParseCombined(t *testing.T) {
 			if got.DurationMs != tt.want.DurationMs {
 				t.Errorf("DurationMs = %v, want %v", got.DurationMs, tt.want.DurationMs)
 			}
+			if got.HasDuration != tt.want.HasDuration {
+				t.Errorf("HasDuration = %v, want %v", got.HasDuration, tt.want.HasDuration)
+			}
+			if got.Host != tt.want.Host {
+				t.Errorf("Host = %v, want %v", got.Host, tt.want.Host)
+			}
 		})
 	}
 }
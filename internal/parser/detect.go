@@ -1,29 +1,25 @@
 package parser
 
-// DetectFormat examines sample log lines and returns the most likely format.
-// Traefik wins ties since it's the more specific format.
+// DetectFormat examines sample log lines and returns the most likely format:
+// the one that parses the most lines, each line counting for the first
+// format in registry order that parses it. Ties go to the earlier format,
+// so Traefik, the most specific and the default, wins them.
 func DetectFormat(lines []string) Format {
-	if len(lines) == 0 {
-		return FormatTraefik // default
-	}
-
-	traefikHits := 0
-	combinedHits := 0
-
+	hits := make(map[Format]int)
 	for _, line := range lines {
 		if line == "" {
 			continue
 		}
-		if traefikRegex.MatchString(line) {
-			traefikHits++
-		} else if combinedRegex.MatchString(line) {
-			combinedHits++
+		if _, f, err := parseAnyFormat(line, UnitDefault); err == nil {
+			hits[f]++
 		}
 	}
 
-	// Traefik wins ties (it's more specific, and is the default)
-	if combinedHits > traefikHits {
-		return FormatCombined
+	best := FormatTraefik // default
+	for _, r := range registered() {
+		if hits[r.format] > hits[best] {
+			best = r.format
+		}
 	}
-	return FormatTraefik
+	return best
 }
@@ -128,3 +128,36 @@ func TestParserParseLine(t *testing.T) {
 		t.Error("auto parser should set Router for combined line")
 	}
 }
+
+func TestParserMultiInterleaved(t *testing.T) {
+	traefikLine := `91.34.143.167 - admin [07/Jan/2026:16:17:08 +0000] "GET /ws HTTP/1.1" 404 555 "-" "Mozilla/5.0" 1 "web@docker" "http://172.19.0.4:80" 1ms`
+	combinedLine := `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`
+	lines := []string{combinedLine, combinedLine, traefikLine, combinedLine, traefikLine}
+	wantRouters := []string{"server", "server", "web@docker", "server", "web@docker"}
+
+	p := NewParser("multi")
+	// Detect must not lock a multi parser to the majority format
+	if got := p.Detect(lines); got != FormatMulti {
+		t.Fatalf("Detect() = %d, want FormatMulti", got)
+	}
+	for i, line := range lines {
+		entry, err := p.ParseLine(line)
+		if err != nil {
+			t.Fatalf("line %d: ParseLine() error = %v", i, err)
+		}
+		if entry.Router != wantRouters[i] {
+			t.Errorf("line %d: Router = %q, want %q", i, entry.Router, wantRouters[i])
+		}
+	}
+	if _, err := p.ParseLine("not a log line"); err == nil {
+		t.Error("ParseLine() on garbage should fail")
+	}
+
+	// A locked auto parser reads the minority format through the wrong parser
+	ap := NewParser("auto")
+	ap.Detect(lines)
+	entry, err := ap.ParseLine(traefikLine)
+	if err == nil && entry.Router == "web@docker" {
+		t.Error("auto parser locked to combined should not parse traefik fields")
+	}
+}
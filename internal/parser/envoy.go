@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compiled regex for Envoy's default access log format, optionally with
+// the fields Istio's default adds (response code details, termination
+// details and transport failure before the byte counts; cluster,
+// addresses, SNI and route after the upstream host)
+// Format: [START_TIME] "METHOD PATH PROTOCOL" CODE FLAGS [DETAILS TERMINATION "FAILURE"] RECEIVED SENT DURATION UPSTREAM_TIME "XFF" "UA" "REQUEST_ID" "AUTHORITY" "UPSTREAM_HOST" [CLUSTER LOCAL_ADDR DOWNSTREAM_LOCAL DOWNSTREAM_REMOTE ...]
+var envoyRegex = regexp.MustCompile(
+	`^\[([^\]]+)\] ` + // start time
+		`"(\S+) (\S+) ([^"]*)" ` + // method path protocol
+		`(\d+) (\S+) ` + // response code, response flags
+		`(?:\S+ \S+ "[^"]*" )?` + // Istio: code details, termination details, transport failure
+		`(?:\d+|-) (\d+|-) (\d+|-) (\d+|-) ` + // bytes received, bytes sent, duration, upstream service time
+		`"([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)"` + // XFF, UA, request ID, authority, upstream host
+		`(?: (\S+) \S+ \S+ (\S+))?`, // Istio: upstream cluster, local addresses, downstream remote address
+)
+
+// envoyJSONLine is the subset of an Envoy json_format access log entry
+// trail reads, under the names Istio's JSON encoding uses. Numbers may be
+// strings (header values) or null.
+type envoyJSONLine struct {
+	StartTime           string          `json:"start_time"`
+	Method              string          `json:"method"`
+	Path                string          `json:"path"`
+	Protocol            string          `json:"protocol"`
+	ResponseCode        json.RawMessage `json:"response_code"`
+	ResponseFlags       string          `json:"response_flags"`
+	BytesSent           json.RawMessage `json:"bytes_sent"`
+	Duration            json.RawMessage `json:"duration"`
+	UpstreamServiceTime json.RawMessage `json:"upstream_service_time"`
+	XForwardedFor       string          `json:"x_forwarded_for"`
+	UserAgent           string          `json:"user_agent"`
+	RequestID           string          `json:"request_id"`
+	Authority           string          `json:"authority"`
+	UpstreamHost        string          `json:"upstream_host"`
+	UpstreamCluster     *string         `json:"upstream_cluster"`
+	DownstreamRemote    string          `json:"downstream_remote_address"`
+}
+
+// envoyFields are the fields of an Envoy entry as logged, "-" or "" when
+// absent; cluster is nil when the format has no upstream cluster field
+type envoyFields struct {
+	startTime, method, path, protocol, status, flags string
+	bytesSent, duration, upstreamTime                string
+	forwardedFor, userAgent, requestID, authority    string
+	upstreamHost, downstreamRemote                   string
+	cluster                                          *string
+}
+
+// ParseEnvoy parses a single Envoy (or Istio sidecar) access log line, in
+// the default text format or as JSON, into a LogEntry. The upstream
+// cluster becomes Router; formats without one use "server" like
+// Combined. Requests Envoy found no route or cluster for (NR and NC
+// response flags) have no Router, like Traefik's unrouted requests. The
+// client IP is the first X-Forwarded-For address, else the downstream
+// remote address.
+func ParseEnvoy(line string) (*LogEntry, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseEnvoyJSON(line)
+	}
+	m := envoyRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("line does not match Envoy access log format")
+	}
+	f := envoyFields{
+		startTime: m[1], method: m[2], path: m[3], protocol: m[4], status: m[5], flags: m[6],
+		bytesSent: m[7], duration: m[8], upstreamTime: m[9],
+		forwardedFor: m[10], userAgent: m[11], requestID: m[12], authority: m[13],
+		upstreamHost: m[14], downstreamRemote: m[16],
+	}
+	if m[15] != "" {
+		f.cluster = &m[15]
+	}
+	return f.entry()
+}
+
+// parseEnvoyJSON parses an Envoy json_format access log line
+func parseEnvoyJSON(line string) (*LogEntry, error) {
+	var l envoyJSONLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return nil, fmt.Errorf("line does not match Envoy JSON log format: %w", err)
+	}
+	if l.StartTime == "" || l.Method == "" || l.Path == "" {
+		return nil, fmt.Errorf("line does not match Envoy JSON log format: no request")
+	}
+	return envoyFields{
+		startTime: l.StartTime, method: l.Method, path: l.Path, protocol: l.Protocol,
+		status: jsonScalar(l.ResponseCode), flags: l.ResponseFlags,
+		bytesSent: jsonScalar(l.BytesSent), duration: jsonScalar(l.Duration),
+		upstreamTime: jsonScalar(l.UpstreamServiceTime),
+		forwardedFor: l.XForwardedFor, userAgent: l.UserAgent, requestID: l.RequestID,
+		authority: l.Authority, upstreamHost: l.UpstreamHost, downstreamRemote: l.DownstreamRemote,
+		cluster: l.UpstreamCluster,
+	}.entry()
+}
+
+// jsonScalar returns a JSON number or string as text, "" for null
+func jsonScalar(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// entry converts the logged fields into a LogEntry
+func (f envoyFields) entry() (*LogEntry, error) {
+	timestamp, err := time.Parse(time.RFC3339Nano, f.startTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	// 0 when no response was sent
+	status, err := strconv.Atoi(f.status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status code: %w", err)
+	}
+
+	var bytes int64
+	if envoyValue(f.bytesSent) != "" {
+		if bytes, err = parseNumber(f.bytesSent); err != nil {
+			return nil, fmt.Errorf("failed to parse bytes: %w", err)
+		}
+	}
+
+	entry := &LogEntry{
+		IP:        envoyClientIP(f.forwardedFor, f.downstreamRemote),
+		Timestamp: timestamp,
+		Method:    f.method,
+		Path:      f.path,
+		Protocol:  envoyValue(f.protocol),
+		Status:    status,
+		Bytes:     bytes,
+		UserAgent: envoyValue(f.userAgent),
+		Router:    "server",
+		Backend:   envoyValue(f.upstreamHost),
+		Host:      envoyValue(f.authority),
+		RequestID: envoyValue(f.requestID),
+	}
+	if f.cluster != nil {
+		entry.Router = envoyValue(*f.cluster)
+	}
+	if flags := strings.Split(f.flags, ","); slices.Contains(flags, "NR") || slices.Contains(flags, "NC") {
+		entry.Router = ""
+	}
+
+	if envoyValue(f.duration) != "" {
+		if entry.DurationMs, err = parseDurationMs(f.duration, UnitMillis); err != nil {
+			return nil, fmt.Errorf("failed to parse duration: %w", err)
+		}
+		entry.HasDuration = true
+	}
+	if envoyValue(f.upstreamTime) != "" {
+		if entry.UpstreamMs, err = parseUpstreamMs(f.upstreamTime, UnitMillis); err == nil {
+			entry.HasUpstream = true
+		}
+	}
+	return entry, nil
+}
+
+// envoyValue returns s, or "" for Envoy's "-" placeholder
+func envoyValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// envoyClientIP picks the original client of an Envoy request: the first
+// X-Forwarded-For address, else the host of the downstream remote address
+func envoyClientIP(forwardedFor, remote string) string {
+	if first, _, _ := strings.Cut(envoyValue(forwardedFor), ","); strings.TrimSpace(first) != "" {
+		return strings.TrimSpace(first)
+	}
+	remote = envoyValue(remote)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
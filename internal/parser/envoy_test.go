@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEnvoy(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *LogEntry
+		wantErr bool
+	}{
+		{
+			name: "envoy default",
+			line: `[2026-02-08T16:00:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "203.0.113.9, 10.0.0.1" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"`,
+			want: &LogEntry{
+				IP:          "203.0.113.9",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 0, 310000000, time.UTC),
+				Method:      "POST",
+				Path:        "/api/v1/locations",
+				Protocol:    "HTTP/2",
+				Status:      204,
+				UserAgent:   "nsq2http",
+				Router:      "server",
+				Backend:     "tcp://10.0.2.1:80",
+				Host:        "locations",
+				DurationMs:  226,
+				HasDuration: true,
+				UpstreamMs:  100,
+				HasUpstream: true,
+				RequestID:   "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2",
+			},
+		},
+		{
+			name: "istio default",
+			line: `[2026-02-08T16:00:01.409Z] "GET /status/418 HTTP/1.1" 418 - via_upstream - "-" 0 135 4 4 "-" "curl/7.73.0-DEV" "84961386-6d84-929d-98bd-c5aee93b5c88" "httpbin:8000" "127.0.0.1:80" inbound|8000|| 127.0.0.1:41854 10.44.1.27:80 10.44.1.23:37652 outbound_.8000_._.httpbin.foo.svc.cluster.local default`,
+			want: &LogEntry{
+				IP:          "10.44.1.23",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 1, 409000000, time.UTC),
+				Method:      "GET",
+				Path:        "/status/418",
+				Protocol:    "HTTP/1.1",
+				Status:      418,
+				Bytes:       135,
+				UserAgent:   "curl/7.73.0-DEV",
+				Router:      "inbound|8000||",
+				Backend:     "127.0.0.1:80",
+				Host:        "httpbin:8000",
+				DurationMs:  4,
+				HasDuration: true,
+				UpstreamMs:  4,
+				HasUpstream: true,
+				RequestID:   "84961386-6d84-929d-98bd-c5aee93b5c88",
+			},
+		},
+		{
+			name: "istio no route",
+			line: `[2026-02-08T16:00:02.000Z] "GET /.env HTTP/1.1" 404 NR route_not_found - "-" 0 0 0 - "-" "Go-http-client/1.1" "1c4d7a39-0000-0000-0000-000000000000" "10.44.1.27" "-" - - 10.44.1.27:80 198.51.100.4:51234 - -`,
+			want: &LogEntry{
+				IP:          "198.51.100.4",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 2, 0, time.UTC),
+				Method:      "GET",
+				Path:        "/.env",
+				Protocol:    "HTTP/1.1",
+				Status:      404,
+				UserAgent:   "Go-http-client/1.1",
+				Host:        "10.44.1.27",
+				HasDuration: true,
+				RequestID:   "1c4d7a39-0000-0000-0000-000000000000",
+			},
+		},
+		{
+			name: "istio json",
+			line: `{"start_time":"2026-02-08T16:00:03.000Z","method":"GET","path":"/productpage","protocol":"HTTP/1.1","response_code":200,"response_flags":"-","bytes_received":0,"bytes_sent":5293,"duration":35,"upstream_service_time":"34","x_forwarded_for":"203.0.113.9","user_agent":"Mozilla/5.0","request_id":"9a4c5b6d-1111-2222-3333-444455556666","authority":"bookinfo.example.com","upstream_host":"10.44.2.5:9080","upstream_cluster":"outbound|9080||productpage.default.svc.cluster.local","downstream_remote_address":"10.44.0.1:40000"}`,
+			want: &LogEntry{
+				IP:          "203.0.113.9",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 3, 0, time.UTC),
+				Method:      "GET",
+				Path:        "/productpage",
+				Protocol:    "HTTP/1.1",
+				Status:      200,
+				Bytes:       5293,
+				UserAgent:   "Mozilla/5.0",
+				Router:      "outbound|9080||productpage.default.svc.cluster.local",
+				Backend:     "10.44.2.5:9080",
+				Host:        "bookinfo.example.com",
+				DurationMs:  35,
+				HasDuration: true,
+				UpstreamMs:  34,
+				HasUpstream: true,
+				RequestID:   "9a4c5b6d-1111-2222-3333-444455556666",
+			},
+		},
+		{
+			name:    "caddy json",
+			line:    `{"ts":1770566400.25,"request":{"client_ip":"203.0.113.9","method":"GET","uri":"/"},"status":200}`,
+			wantErr: true,
+		},
+		{
+			name:    "combined line",
+			line:    `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvoy(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEnvoy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnvoy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserEnvoy(t *testing.T) {
+	envoyLine := `[2026-02-08T16:00:00.310Z] "GET / HTTP/1.1" 200 - 0 10 5 4 "-" "Mozilla/5.0" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "example.com" "10.0.2.1:80"`
+	envoyJSON := `{"start_time":"2026-02-08T16:00:03.000Z","method":"GET","path":"/","response_code":200,"duration":1,"upstream_cluster":"web"}`
+	caddyLine := `{"ts":1770566400.25,"request":{"client_ip":"203.0.113.9","proto":"HTTP/1.1","method":"GET","host":"example.com","uri":"/","headers":{}},"duration":0.001,"size":10,"status":200}`
+
+	p := NewParser("auto")
+	if got := p.Detect([]string{envoyLine, envoyJSON, caddyLine}); got != FormatEnvoy {
+		t.Fatalf("Detect() = %s, want envoy", got)
+	}
+	if entry, err := p.ParseLine(envoyJSON); err != nil || entry.Router != "web" {
+		t.Errorf("ParseLine() = %+v, %v, want the envoy JSON entry", entry, err)
+	}
+
+	m := NewParser("multi")
+	for _, line := range []string{envoyLine, envoyJSON, caddyLine} {
+		if _, err := m.ParseLine(line); err != nil {
+			t.Errorf("multi ParseLine(%.20s...) error = %v", line, err)
+		}
+	}
+
+	if f, ok := LookupFormat("envoy"); !ok || f != FormatEnvoy {
+		t.Errorf("LookupFormat(envoy) = %v, %v, want FormatEnvoy", f, ok)
+	}
+}
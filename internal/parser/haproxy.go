@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Compiled regex for HAProxy's HTTP log format (option httplog), with or
+// without a syslog prefix ("Feb  6 12:14:14 localhost haproxy[14389]: ")
+// Format: IP:PORT [ACCEPT_DATE] FRONTEND BACKEND/SERVER TR/Tw/Tc/Tr/Ta STATUS BYTES COOKIE COOKIE TERM CONNS QUEUES [{REQ_HEADERS}] [{RESP_HEADERS}] "METHOD URI PROTOCOL"
+var haproxyRegex = regexp.MustCompile(
+	`^(?:.*?\]: )?` + // optional syslog prefix
+		`(\S+):\d+ ` + // client IP and port
+		`\[([^\]]+)\] ` + // accept date
+		`(\S+) ` + // frontend (a trailing ~ marks TLS)
+		`([^/\s]+)/(\S+) ` + // backend/server
+		`(-?\d+)/(-?\d+)/(-?\d+)/(-?\d+)/\+?(-?\d+) ` + // TR/Tw/Tc/Tr/Ta (Tq/Tw/Tc/Tr/Tt before 1.8)
+		`(-?\d+) ` + // status (-1 without a response)
+		`\+?(\d+) ` + // bytes read by the client
+		`\S+ \S+ \S+ \S+ \S+ ` + // cookies, termination state, connection counts, queues
+		`(?:\{([^}]*)\} )?` + // optional captured request headers
+		`(?:\{([^}]*)\} )?` + // optional captured response headers
+		`"(\S+) (\S+)(?: ([^"]+))?"`, // method path protocol
+)
+
+// HAProxy accept date: [06/Feb/2009:12:14:14.655], local time without a
+// zone, read as UTC
+const haproxyTimeLayout = "02/Jan/2006:15:04:05.000"
+
+// ParseHAProxy parses a single HAProxy HTTP log line into a LogEntry. The
+// backend becomes Router and backend/server Backend; a request that no
+// backend took (backend named like the frontend, server <NOSRV>) has no
+// Router, like Traefik's unrouted requests. DurationMs is the total time
+// (Ta/Tt); -1 timers mean the request was aborted and record no duration.
+func ParseHAProxy(line string) (*LogEntry, error) {
+	matches := haproxyRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("line does not match HAProxy HTTP log format")
+	}
+
+	timestamp, err := time.Parse(haproxyTimeLayout, matches[2])
+	if err != nil {
+		if timestamp, err = parseTimestamp(matches[2]); err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+	}
+
+	status, err := strconv.Atoi(matches[11])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status code: %w", err)
+	}
+	status = max(status, 0)
+
+	bytes, err := parseNumber(matches[12])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bytes: %w", err)
+	}
+
+	var durationMs int
+	hasDuration := !strings.HasPrefix(matches[10], "-")
+	if hasDuration {
+		if durationMs, err = strconv.Atoi(matches[10]); err != nil {
+			return nil, fmt.Errorf("failed to parse duration: %w", err)
+		}
+	}
+
+	frontend := strings.TrimSuffix(matches[3], "~")
+	backend, server := matches[4], matches[5]
+	router := backend
+	if backend == frontend && server == "<NOSRV>" {
+		router = ""
+	}
+
+	entry := &LogEntry{
+		IP:          matches[1],
+		Timestamp:   timestamp,
+		Method:      matches[15],
+		Path:        matches[16],
+		Protocol:    matches[17],
+		Status:      status,
+		Bytes:       bytes,
+		Router:      router,
+		Backend:     backend + "/" + server,
+		DurationMs:  durationMs,
+		HasDuration: hasDuration,
+	}
+	if matches[13] != "" {
+		fillCapturedHeaders(entry, strings.Split(matches[13], "|"))
+	}
+	return entry, nil
+}
+
+// fillCapturedHeaders assigns HAProxy's captured request headers, whose
+// order depends on the capture lines of its config, by their shape: a URL
+// is the Referer, a dotted name without spaces the Host, a long token a
+// request ID, and the first other value the User-Agent
+func fillCapturedHeaders(entry *LogEntry, values []string) {
+	for _, v := range values {
+		switch {
+		case v == "":
+		case strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://"):
+			if entry.Referer == "" {
+				entry.Referer = v
+			}
+		case strings.IndexFunc(v, unicode.IsSpace) < 0 && !strings.Contains(v, "/") && strings.Contains(v, "."):
+			if entry.Host == "" {
+				entry.Host = v
+			}
+		case len(v) >= 16 && !strings.Contains(v, ".") && findRequestID([]string{v}) != "":
+			if entry.RequestID == "" {
+				entry.RequestID = v
+			}
+		default:
+			if entry.UserAgent == "" {
+				entry.UserAgent = v
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHAProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *LogEntry
+		wantErr bool
+	}{
+		{
+			name: "syslog prefix with captured headers",
+			line: `Feb  8 16:00:00 lb1 haproxy[14389]: 203.0.113.9:41342 [08/Feb/2026:16:00:00.250] www~ blog/web2 10/0/30/69/109 200 5120 - - ---- 1/1/0/0/0 0/0 {example.com|Mozilla/5.0 (X11; Linux x86_64)|https://news.ycombinator.com/} {} "GET /blog/?page=2 HTTP/1.1"`,
+			want: &LogEntry{
+				IP:          "203.0.113.9",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 0, 250000000, time.UTC),
+				Method:      "GET",
+				Path:        "/blog/?page=2",
+				Protocol:    "HTTP/1.1",
+				Status:      200,
+				Bytes:       5120,
+				Referer:     "https://news.ycombinator.com/",
+				UserAgent:   "Mozilla/5.0 (X11; Linux x86_64)",
+				Router:      "blog",
+				Backend:     "blog/web2",
+				Host:        "example.com",
+				DurationMs:  109,
+				HasDuration: true,
+			},
+		},
+		{
+			name: "pre-1.8 timers without captures",
+			line: `10.0.0.1:5555 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/+109 304 +243 - - ---- 3/3/3/1/0 0/0 "GET /index.html HTTP/1.1"`,
+			want: &LogEntry{
+				IP:          "10.0.0.1",
+				Timestamp:   time.Date(2009, 2, 6, 12, 14, 14, 655000000, time.UTC),
+				Method:      "GET",
+				Path:        "/index.html",
+				Protocol:    "HTTP/1.1",
+				Status:      304,
+				Bytes:       243,
+				Router:      "static",
+				Backend:     "static/srv1",
+				DurationMs:  109,
+				HasDuration: true,
+			},
+		},
+		{
+			name: "no backend, aborted request",
+			line: `198.51.100.4:1234 [08/Feb/2026:16:00:01.000] www www/<NOSRV> -1/-1/-1/-1/0 -1 0 - - CR-- 1/1/0/0/0 0/0 "GET /.env HTTP/1.1"`,
+			want: &LogEntry{
+				IP:          "198.51.100.4",
+				Timestamp:   time.Date(2026, 2, 8, 16, 0, 1, 0, time.UTC),
+				Method:      "GET",
+				Path:        "/.env",
+				Protocol:    "HTTP/1.1",
+				Backend:     "www/<NOSRV>",
+				HasDuration: true,
+			},
+		},
+		{
+			name: "aborted total time",
+			line: `198.51.100.4:1234 [08/Feb/2026:16:00:01.000] www api/<NOSRV> 5/-1/-1/-1/-1 503 212 - - SC-- 1/1/0/0/0 0/0 "POST /login HTTP/1.1"`,
+			want: &LogEntry{
+				IP:        "198.51.100.4",
+				Timestamp: time.Date(2026, 2, 8, 16, 0, 1, 0, time.UTC),
+				Method:    "POST",
+				Path:      "/login",
+				Protocol:  "HTTP/1.1",
+				Status:    503,
+				Bytes:     212,
+				Router:    "api",
+				Backend:   "api/<NOSRV>",
+			},
+		},
+		{
+			name:    "combined line",
+			line:    `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`,
+			wantErr: true,
+		},
+		{
+			name:    "tcp log",
+			line:    `10.0.0.1:5555 [06/Feb/2009:12:12:51.443] fnt bck/srv1 0/0/5007 212 -- 0/0/0/0/3 0/0`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHAProxy(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHAProxy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHAProxy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserHAProxy(t *testing.T) {
+	haproxyLine := `203.0.113.9:41342 [08/Feb/2026:16:00:00.250] www blog/web2 10/0/30/69/109 200 5120 - - ---- 1/1/0/0/0 0/0 "GET / HTTP/1.1"`
+	combinedLine := `192.168.1.1 - - [10/Jan/2026:13:55:36 +0000] "GET / HTTP/1.1" 200 100 "-" "Chrome"`
+
+	p := NewParser("auto")
+	if got := p.Detect([]string{haproxyLine, haproxyLine, combinedLine}); got != FormatHAProxy {
+		t.Fatalf("Detect() = %s, want haproxy", got)
+	}
+	if entry, err := p.ParseLine(haproxyLine); err != nil || entry.Router != "blog" {
+		t.Errorf("ParseLine() = %+v, %v, want the haproxy entry", entry, err)
+	}
+
+	m := NewParser("multi")
+	for _, line := range []string{haproxyLine, combinedLine} {
+		if _, err := m.ParseLine(line); err != nil {
+			t.Errorf("multi ParseLine(%.20s...) error = %v", line, err)
+		}
+	}
+
+	if f, ok := LookupFormat("haproxy"); !ok || f != FormatHAProxy {
+		t.Errorf("LookupFormat(haproxy) = %v, %v, want FormatHAProxy", f, ok)
+	}
+}
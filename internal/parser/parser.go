@@ -2,8 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 // LogEntry represents a parsed access log line
@@ -14,79 +19,260 @@ type LogEntry struct {
 	Path       string
 	Protocol   string
 	Status     int
-	Bytes      int64
+	Bytes      int64 // response size: Combined's body bytes, Traefik's size sent, or a template's choice (see Template.SetBytesField)
 	Referer    string
 	UserAgent  string
 	Router     string
 	Backend    string
 	DurationMs int
+
+	// Host is the client-requested Host header (or TLS SNI), "" when the
+	// format doesn't record it. Caddy, ALB, Envoy, Apache vhost_combined,
+	// HAProxy with a captured Host header and a {host} template field fill it
+	Host string
+
+	// CacheStatus is a proxy/CDN cache result such as HIT, MISS or BYPASS
+	// (e.g. an X-Cache header), "" unless a {cache_status} template field
+	// records it
+	CacheStatus string
+
+	// HasDuration reports whether the format recorded a request duration
+	// for this line. Traefik always does; Combined only with a trailing
+	// request_time. Without it DurationMs is 0 rather than a real timing.
+	HasDuration bool
+
+	// UpstreamMs is the time the backend took, within DurationMs, when the
+	// format records it separately; only an {upstream_duration} template
+	// field fills it, setting HasUpstream
+	UpstreamMs  int
+	HasUpstream bool
+
+	// RequestID is a proxy-assigned request ID found in the fields after
+	// the format's own (e.g. nginx $request_id), or "" if none
+	RequestID string
+}
+
+// requestIDPattern matches the request IDs proxies emit: nginx $request_id
+// (32 hex chars), UUIDs and similar tokens
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,128}$`)
+
+// findRequestID returns the first of fields (optionally quoted) that looks
+// like a request ID. IPs, plain numbers and "-" never do: an ID needs a
+// letter or hyphen, which keeps an appended $http_x_forwarded_for from being
+// mistaken for one.
+func findRequestID(fields []string) string {
+	for _, f := range fields {
+		f = strings.Trim(f, `"`)
+		if !requestIDPattern.MatchString(f) {
+			continue
+		}
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || r == '-' }) >= 0 {
+			return f
+		}
+	}
+	return ""
 }
 
 // CLF timestamp layout: [07/Jan/2026:16:17:16 +0000]
 const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
 
+// epochMillisThreshold separates epoch seconds from epoch milliseconds.
+// 1e11 seconds is in the year 5138, while 1e11 milliseconds is March 1973,
+// so any realistic timestamp at or above it must be in milliseconds.
+const epochMillisThreshold = 1e11
+
+// parseTimestamp parses a log timestamp. CLF-style values are tried first;
+// purely numeric values are treated as a Unix epoch (see ParseEpoch).
+func parseTimestamp(s string) (time.Time, error) {
+	if t, err := time.Parse(clfTimeLayout, s); err == nil {
+		return t, nil
+	}
+	if t, err := ParseEpoch(s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
+
+// ParseEpoch parses a Unix timestamp in seconds or milliseconds, choosing the
+// unit by magnitude. Fractional values are accepted ("1770000000.123").
+// The result is in UTC.
+func ParseEpoch(s string) (time.Time, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return time.Time{}, fmt.Errorf("invalid epoch timestamp %q", s)
+	}
+	if v >= epochMillisThreshold {
+		return time.UnixMilli(int64(v)).UTC(), nil
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC(), nil
+}
+
+// parseNumber parses a status or byte count field. A missing value ("-"
+// or empty, e.g. for a request aborted before any response) is 0, so the
+// line still counts.
+func parseNumber(s string) (int64, error) {
+	if s == "-" || s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// DurationUnit is the unit a log's duration field is written in
+// (TRAIL_DURATION_UNIT)
+type DurationUnit string
+
+const (
+	UnitDefault DurationUnit = ""   // the format's own: seconds for Combined, ms for templates
+	UnitSeconds DurationUnit = "s"  // nginx $request_time, Apache %T
+	UnitMillis  DurationUnit = "ms" // Traefik
+	UnitMicros  DurationUnit = "us" // Apache %D
+	UnitNanos   DurationUnit = "ns"
+)
+
+// msPerUnit converts one unit of each DurationUnit to milliseconds
+var msPerUnit = map[DurationUnit]float64{
+	UnitSeconds: 1000,
+	UnitMillis:  1,
+	UnitMicros:  1e-3,
+	UnitNanos:   1e-6,
+}
+
+// or returns u, or def for UnitDefault
+func (u DurationUnit) or(def DurationUnit) DurationUnit {
+	if u == UnitDefault {
+		return def
+	}
+	return u
+}
+
+// parseDurationMs parses a duration field written in unit (integer or
+// fractional) into whole milliseconds
+func parseDurationMs(s string, unit DurationUnit) (int, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	factor, ok := msPerUnit[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown duration unit %q", unit)
+	}
+	return int(math.Round(v * factor)), nil
+}
+
+// parseUpstreamMs parses an upstream time field written in unit. A request
+// retried across upstreams lists one time per attempt ("0.002, 0.004", as
+// nginx $upstream_response_time does), and those are summed.
+func parseUpstreamMs(s string, unit DurationUnit) (int, error) {
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		ms, err := parseDurationMs(strings.TrimSpace(part), unit)
+		if err != nil {
+			return 0, err
+		}
+		total += ms
+	}
+	return total, nil
+}
+
 // Format represents a log file format
 type Format int
 
 const (
-	FormatAuto     Format = iota
-	FormatTraefik         // Traefik extended CLF
-	FormatCombined        // Apache/Nginx Combined
+	FormatAuto      Format = iota
+	FormatTraefik          // Traefik extended CLF
+	FormatCombined         // Apache/Nginx Combined
+	FormatMulti            // Per-line detection for mixed files, never locked
+	FormatCaddyJSON        // Caddy structured JSON access log
+	FormatHAProxy          // HAProxy HTTP log (option httplog)
+	FormatALB              // AWS Application Load Balancer access log
+	FormatEnvoy            // Envoy/Istio default access log, text or JSON
 )
 
-// Parser wraps format-aware line parsing
+// Parser wraps format-aware line parsing. The format may be switched at
+// runtime (SetFormat) while another goroutine parses lines.
 type Parser struct {
-	format Format
+	format   atomic.Int32 // a Format
+	template *Template    // custom Traefik field layout, see SetTemplate
+	unit     DurationUnit // duration unit override, see SetDurationUnit
 }
 
-// NewParser creates a Parser for the given format string.
-// Valid values: "auto", "traefik", "combined".
+// NewParser creates a Parser for the given format string: "auto",
+// "multi" or a registered format's name ("traefik", "combined", "caddy",
+// "haproxy", "alb", "envoy" or one added with Register); anything else is
+// auto.
 func NewParser(format string) *Parser {
-	switch strings.ToLower(format) {
-	case "traefik":
-		return &Parser{format: FormatTraefik}
-	case "combined":
-		return &Parser{format: FormatCombined}
-	default:
-		return &Parser{format: FormatAuto}
+	p := &Parser{}
+	if f, ok := LookupFormat(format); ok {
+		p.SetFormat(f)
 	}
+	return p
+}
+
+// SetTemplate makes p parse every line with t, a custom Traefik field
+// layout (TRAIL_TRAEFIK_TEMPLATE), and locks the format to Traefik.
+// Call it before lines are parsed.
+func (p *Parser) SetTemplate(t *Template) {
+	p.template = t
+	p.SetFormat(FormatTraefik)
+}
+
+// SetDurationUnit overrides the unit of Combined's trailing request_time
+// and of a template's {duration} field. Traefik's stock CLF writes its
+// unit ("123ms") and is unaffected. Call it before lines are parsed.
+func (p *Parser) SetDurationUnit(u DurationUnit) {
+	p.unit = u
+}
+
+// SetFormat overrides the format, e.g. when auto-detection guessed wrong.
+// Safe to call while lines are being parsed; FormatAuto re-enables Detect.
+func (p *Parser) SetFormat(f Format) {
+	p.format.Store(int32(f))
 }
 
 // Format returns the current parser format
 func (p *Parser) Format() Format {
-	return p.format
+	return Format(p.format.Load())
 }
 
 // Detect examines sample lines to determine the log format.
 // Only meaningful when format is FormatAuto; locks format for future calls.
+// FormatMulti is returned unchanged since it detects per line.
 func (p *Parser) Detect(lines []string) Format {
-	if p.format != FormatAuto {
-		return p.format
+	if f := p.Format(); f != FormatAuto {
+		return f
 	}
 
 	detected := DetectFormat(lines)
-	p.format = detected
+	p.SetFormat(detected)
 	return detected
 }
 
 // ParseLine parses a single log line using the configured format.
-// For FormatAuto, tries Traefik first (more specific), then Combined.
+// For FormatAuto (before Detect) and FormatMulti, tries every registered
+// format in order: Traefik (more specific), Combined, Caddy, HAProxy, ALB,
+// Envoy, then those added with Register.
 func (p *Parser) ParseLine(line string) (*LogEntry, error) {
-	switch p.format {
-	case FormatTraefik:
-		return ParseTraefik(line)
-	case FormatCombined:
-		return ParseCombined(line)
-	default:
-		// Auto: try Traefik first (more specific regex), fall back to Combined
-		if entry, err := ParseTraefik(line); err == nil {
-			return entry, nil
-		}
-		if entry, err := ParseCombined(line); err == nil {
-			return entry, nil
+	f := p.Format()
+	if f == FormatTraefik && p.template != nil {
+		return p.template.parse(line, p.unit.or(UnitMillis))
+	}
+	if lp := lineParser(f); lp != nil {
+		return lp.ParseLine(line, p.unit)
+	}
+	entry, _, err := parseAnyFormat(line, p.unit)
+	return entry, err
+}
+
+// parseAnyFormat tries each registered format in order and returns the
+// first match and its format
+func parseAnyFormat(line string, unit DurationUnit) (*LogEntry, Format, error) {
+	for _, r := range registered() {
+		if entry, err := r.parser.ParseLine(line, unit); err == nil {
+			return entry, r.format, nil
 		}
-		return nil, fmt.Errorf("line does not match any known log format")
 	}
+	return nil, FormatAuto, fmt.Errorf("line does not match any known log format")
 }
 
 // ParseLine is a backward-compatible standalone function that calls ParseTraefik.
@@ -98,3 +284,10 @@ func ParseLine(line string) (*LogEntry, error) {
 func HourBucket(t time.Time) string {
 	return t.UTC().Truncate(time.Hour).Format("2006-01-02T15:00:00Z")
 }
+
+// MinuteBucket truncates a time to a multiple of d (a whole number of
+// minutes dividing the hour) and returns it in the same format as HourBucket,
+// so fine and hourly buckets compare as strings
+func MinuteBucket(t time.Time, d time.Duration) string {
+	return t.UTC().Truncate(d).Format("2006-01-02T15:04:00Z")
+}
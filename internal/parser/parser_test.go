@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -192,3 +193,218 @@ func TestHourBucket(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "epoch seconds",
+			input: "1770566400",
+			want:  time.Date(2026, 2, 8, 16, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "epoch milliseconds",
+			input: "1770566400123",
+			want:  time.Date(2026, 2, 8, 16, 0, 0, 123000000, time.UTC),
+		},
+		{
+			name:  "fractional epoch seconds",
+			input: "1770566400.5",
+			want:  time.Date(2026, 2, 8, 16, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:    "not a number",
+			input:   "yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			input:   "-5",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEpoch(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEpoch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseEpoch() = %v, want %v", got, tt.want)
+			}
+			if HourBucket(got) != "2026-02-08T16:00:00Z" {
+				t.Errorf("HourBucket() = %v, want 2026-02-08T16:00:00Z", HourBucket(got))
+			}
+		})
+	}
+}
+
+func TestParseTraefikEpochTimestamp(t *testing.T) {
+	line := `10.0.0.1 - - [1770566400] "GET / HTTP/1.1" 200 10 "-" "curl/8.0" 1 "web@docker" "http://10.0.0.2:80" 3ms`
+	entry, err := ParseTraefik(line)
+	if err != nil {
+		t.Fatalf("ParseTraefik() error = %v", err)
+	}
+	if !entry.Timestamp.Equal(time.Date(2026, 2, 8, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("Timestamp = %v, want 2026-02-08 16:00:00 UTC", entry.Timestamp)
+	}
+}
+
+func TestParseRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "combined with request_time and $request_id",
+			line: `1.2.3.4 - - [10/Jan/2026:15:00:00 +0000] "GET / HTTP/1.1" 502 0 "-" "curl/8.0" 0.120 5f2b8c9e0a1d4e6fb7c3a9d2e1f0b4c8`,
+			want: "5f2b8c9e0a1d4e6fb7c3a9d2e1f0b4c8",
+		},
+		{
+			name: "combined with a quoted request ID only",
+			line: `1.2.3.4 - - [10/Jan/2026:15:00:00 +0000] "GET / HTTP/1.1" 502 0 "-" "curl/8.0" "0b1e7f3c-7a8d-4c5e-9f10-2a3b4c5d6e7f"`,
+			want: "0b1e7f3c-7a8d-4c5e-9f10-2a3b4c5d6e7f",
+		},
+		{
+			name: "combined with an appended forwarded-for IP",
+			line: `1.2.3.4 - - [10/Jan/2026:15:00:00 +0000] "GET / HTTP/1.1" 502 0 "-" "curl/8.0" 0.120 "10.20.30.40"`,
+			want: "",
+		},
+		{
+			name: "combined without trailing fields",
+			line: `1.2.3.4 - - [10/Jan/2026:15:00:00 +0000] "GET / HTTP/1.1" 502 0 "-" "curl/8.0"`,
+			want: "",
+		},
+		{
+			name: "traefik with a trailing request ID",
+			line: `10.0.0.1 - - [10/Jan/2026:15:00:00 +0000] "GET / HTTP/1.1" 500 10 "-" "curl/8.0" 1 "web@docker" "http://10.0.0.2:80" 3ms "req-4f1c2d"`,
+			want: "req-4f1c2d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := NewParser("auto").ParseLine(tt.line)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			if entry.RequestID != tt.want {
+				t.Errorf("RequestID = %q, want %q", entry.RequestID, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	for _, f := range []Format{FormatAuto, FormatTraefik, FormatCombined, FormatMulti} {
+		got, ok := LookupFormat(strings.ToUpper(f.String()))
+		if !ok || got != f {
+			t.Errorf("LookupFormat(%q) = %v, %v; want %v", f.String(), got, ok, f)
+		}
+	}
+	if _, ok := LookupFormat("json"); ok {
+		t.Error("LookupFormat(json) should fail")
+	}
+
+	// A runtime override replaces the detected format
+	p := NewParser("auto")
+	p.Detect([]string{`10.0.0.1 - - [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`})
+	p.SetFormat(FormatTraefik)
+	if p.Format() != FormatTraefik {
+		t.Errorf("Format() after SetFormat = %v, want traefik", p.Format())
+	}
+}
+
+func TestDurationUnit(t *testing.T) {
+	const combined = `10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0" `
+	tests := []struct {
+		unit  DurationUnit
+		value string
+		want  int
+	}{
+		{UnitDefault, "0.250", 250}, // Combined defaults to seconds
+		{UnitSeconds, "1.5", 1500},
+		{UnitMillis, "42", 42},
+		{UnitMicros, "2500", 3},
+		{UnitNanos, "1200000", 1},
+		{UnitNanos, "400000", 0},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"combined", "auto", "multi"} {
+			p := NewParser(format)
+			p.SetDurationUnit(tt.unit)
+			entry, err := p.ParseLine(combined + tt.value)
+			if err != nil {
+				t.Fatalf("%s/%q: %v", format, tt.unit, err)
+			}
+			if entry.DurationMs != tt.want || !entry.HasDuration {
+				t.Errorf("%s/%q: %s parsed as %d ms (has %v), want %d", format, tt.unit, tt.value, entry.DurationMs, entry.HasDuration, tt.want)
+			}
+		}
+	}
+
+	// Templates default to milliseconds and take the override too
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {duration}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `10.0.0.1 [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" 200 `
+	p := NewParser("traefik")
+	p.SetTemplate(tmpl)
+	if entry, err := p.ParseLine(line + "7"); err != nil || entry.DurationMs != 7 {
+		t.Errorf("template default unit: %+v, %v; want 7 ms", entry, err)
+	}
+	p.SetDurationUnit(UnitSeconds)
+	if entry, err := p.ParseLine(line + "0.007"); err != nil || entry.DurationMs != 7 {
+		t.Errorf("template in seconds: %+v, %v; want 7 ms", entry, err)
+	}
+
+	// Traefik's stock CLF says "ms" itself and ignores the override
+	p = NewParser("traefik")
+	p.SetDurationUnit(UnitMicros)
+	entry, err := p.ParseLine(`10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0" 1 "web@docker" "http://10.0.0.2:80" 42ms`)
+	if err != nil || entry.DurationMs != 42 {
+		t.Errorf("traefik with unit override: %+v, %v; want 42 ms", entry, err)
+	}
+}
+
+func TestMissingNumericFields(t *testing.T) {
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {bytes} {duration}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := NewParser("traefik")
+	tp.SetTemplate(tmpl)
+
+	tests := []struct {
+		name  string
+		parse func(string) (*LogEntry, error)
+		line  string
+	}{
+		{"combined", ParseCombined, `10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" - - "-" "curl/8.0" -`},
+		{"traefik", ParseTraefik, `10.0.0.1 - - [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" - - "-" "curl/8.0" 1 "web@docker" "-" -`},
+		{"template", tp.ParseLine, `10.0.0.1 [10/Jan/2026:14:00:00 +0000] "GET / HTTP/1.1" - - -`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := tt.parse(tt.line)
+			if err != nil {
+				t.Fatalf("line with dashes dropped: %v", err)
+			}
+			if entry.Status != 0 || entry.Bytes != 0 || entry.DurationMs != 0 || entry.HasDuration {
+				t.Errorf("entry = %+v, want status, bytes and duration 0 without a timing", entry)
+			}
+			if entry.Path != "/" {
+				t.Errorf("Path = %q, want /", entry.Path)
+			}
+		})
+	}
+}
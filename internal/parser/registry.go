@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// LineParser parses the lines of one log format. unit is the
+// TRAIL_DURATION_UNIT override, UnitDefault when unset: a format whose
+// duration field carries no unit of its own reads it in unit.or(its
+// default). A line not in the format returns an error.
+type LineParser interface {
+	ParseLine(line string, unit DurationUnit) (*LogEntry, error)
+}
+
+// LineParserFunc adapts a function to a LineParser
+type LineParserFunc func(line string, unit DurationUnit) (*LogEntry, error)
+
+// ParseLine calls f(line, unit)
+func (f LineParserFunc) ParseLine(line string, unit DurationUnit) (*LogEntry, error) {
+	return f(line, unit)
+}
+
+// registeredFormat is a log format selectable by name
+type registeredFormat struct {
+	format Format
+	name   string
+	parser LineParser
+}
+
+var (
+	registryMu sync.RWMutex
+
+	// registry holds the parsing formats in the order auto-detection and
+	// FormatMulti try them: the more specific built-in ones first, then
+	// those added with Register
+	registry = []registeredFormat{
+		{FormatTraefik, "traefik", ignoreUnit(ParseTraefik)},
+		{FormatCombined, "combined", LineParserFunc(func(line string, unit DurationUnit) (*LogEntry, error) {
+			return parseCombined(line, unit.or(UnitSeconds))
+		})},
+		{FormatCaddyJSON, "caddy", ignoreUnit(ParseCaddyJSON)},
+		{FormatHAProxy, "haproxy", ignoreUnit(ParseHAProxy)},
+		{FormatALB, "alb", ignoreUnit(ParseALB)},
+		{FormatEnvoy, "envoy", ignoreUnit(ParseEnvoy)},
+	}
+
+	// nextFormat is the Format the next Register call assigns
+	nextFormat = FormatEnvoy + 1
+)
+
+// ignoreUnit adapts a parser for a format that records its own duration
+// unit, or none
+func ignoreUnit(parse func(line string) (*LogEntry, error)) LineParser {
+	return LineParserFunc(func(line string, _ DurationUnit) (*LogEntry, error) {
+		return parse(line)
+	})
+}
+
+// Register adds a log format under name, selectable with TRAIL_LOG_FORMAT
+// and the admin format switch, and tried after the built-in formats by
+// auto-detection and FormatMulti. Call it from an init function, before
+// any Parser is created. It panics if lp is nil or name (compared
+// case-insensitively) is taken, like database/sql.Register.
+func Register(name string, lp LineParser) Format {
+	if lp == nil {
+		panic("parser: Register parser is nil")
+	}
+	if name == "" || strings.EqualFold(name, "auto") || strings.EqualFold(name, "multi") {
+		panic(fmt.Sprintf("parser: Register with reserved format name %q", name))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, r := range registry {
+		if strings.EqualFold(name, r.name) {
+			panic(fmt.Sprintf("parser: Register called twice for format %q", name))
+		}
+	}
+	f := nextFormat
+	nextFormat++
+	registry = append(registry, registeredFormat{f, strings.ToLower(name), lp})
+	return f
+}
+
+// registered returns a snapshot of the registry
+func registered() []registeredFormat {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry
+}
+
+// lineParser returns the LineParser of f, or nil for FormatAuto,
+// FormatMulti and unknown formats
+func lineParser(f Format) LineParser {
+	for _, r := range registered() {
+		if r.format == f {
+			return r.parser
+		}
+	}
+	return nil
+}
+
+// Formats returns the formats a parser can be switched to, in detection
+// order, followed by FormatMulti
+func Formats() []Format {
+	var out []Format
+	for _, r := range registered() {
+		out = append(out, r.format)
+	}
+	return append(out, FormatMulti)
+}
+
+// String returns the format's TRAIL_LOG_FORMAT name
+func (f Format) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatMulti:
+		return "multi"
+	}
+	for _, r := range registered() {
+		if r.format == f {
+			return r.name
+		}
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// LookupFormat returns the Format named name (case-insensitive)
+func LookupFormat(name string) (Format, bool) {
+	switch {
+	case strings.EqualFold(name, "auto"):
+		return FormatAuto, true
+	case strings.EqualFold(name, "multi"):
+		return FormatMulti, true
+	}
+	for _, r := range registered() {
+		if strings.EqualFold(name, r.name) {
+			return r.format, true
+		}
+	}
+	return FormatAuto, false
+}
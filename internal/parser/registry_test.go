@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	// "pipe|ip|METHOD|path|status", with a duration in the configured unit
+	f := Register("PipeTest", LineParserFunc(func(line string, unit DurationUnit) (*LogEntry, error) {
+		fields := strings.Split(line, "|")
+		if len(fields) != 6 || fields[0] != "pipe" {
+			return nil, fmt.Errorf("not a pipe line")
+		}
+		ms, err := parseDurationMs(fields[5], unit.or(UnitMillis))
+		if err != nil {
+			return nil, err
+		}
+		return &LogEntry{IP: fields[1], Method: fields[2], Path: fields[3], Router: "pipe", DurationMs: ms, HasDuration: true}, nil
+	}))
+	line := "pipe|10.0.0.1|GET|/x|200|1.5"
+	traefikLine := `91.34.143.167 - admin [07/Jan/2026:16:17:08 +0000] "GET /ws HTTP/1.1" 404 555 "-" "Mozilla/5.0" 1 "web@docker" "http://172.19.0.4:80" 1ms`
+
+	if got, ok := LookupFormat("pipetest"); !ok || got != f {
+		t.Fatalf("LookupFormat(pipetest) = %v, %v, want %v", got, ok, f)
+	}
+	if f.String() != "pipetest" {
+		t.Errorf("String() = %q, want pipetest", f.String())
+	}
+	if formats := Formats(); !slices.Contains(formats, f) || formats[len(formats)-1] != FormatMulti {
+		t.Errorf("Formats() = %v, want pipetest listed before multi", formats)
+	}
+
+	p := NewParser("pipetest")
+	p.SetDurationUnit(UnitSeconds)
+	if entry, err := p.ParseLine(line); err != nil || entry.DurationMs != 1500 {
+		t.Errorf("ParseLine() = %+v, %v, want 1500ms in the configured unit", entry, err)
+	}
+
+	auto := NewParser("auto")
+	if got := auto.Detect([]string{line, line, traefikLine}); got != f {
+		t.Errorf("Detect() = %v, want pipetest", got)
+	}
+	m := NewParser("multi")
+	for _, l := range []string{line, traefikLine} {
+		if _, err := m.ParseLine(l); err != nil {
+			t.Errorf("multi ParseLine(%.20s...) error = %v", l, err)
+		}
+	}
+
+	for _, name := range []string{"pipetest", "Traefik", "multi", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", name)
+				}
+			}()
+			Register(name, LineParserFunc(func(string, DurationUnit) (*LogEntry, error) { return nil, nil }))
+		}()
+	}
+}
@@ -0,0 +1,242 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultTraefikTemplate describes Traefik's stock CLF in template tokens
+const DefaultTraefikTemplate = `{ip} - {user} [{time}] "{request}" {status} {bytes} "{referer}" "{user_agent}" {-} "{router}" "{backend}" {duration}ms`
+
+// templateTokens lists the tokens a field template may use. {-} matches a
+// field that is skipped (e.g. Traefik's request count).
+var templateTokens = []string{
+	"ip", "user", "time", "request", "method", "path", "protocol", "status", "bytes", "body_bytes",
+	"referer", "user_agent", "router", "backend", "host", "cache_status", "duration", "upstream_duration", "request_id", "-",
+}
+
+// whitespaceRegex splits template literals at runs of spaces
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// templateTokenRegex finds {token} placeholders in a field template
+var templateTokenRegex = regexp.MustCompile(`\{([a-z_-]+)\}`)
+
+// Template parses lines laid out by a custom field template, for Traefik
+// setups whose accesslog.fields differ from the stock CLF. Literal text
+// between tokens must match exactly; runs of spaces match any whitespace.
+type Template struct {
+	re        *regexp.Regexp
+	fields    []string // token name per capture group, "request" expanding to three
+	bytesFrom string   // "bytes" or "body_bytes", whichever fills LogEntry.Bytes
+}
+
+// CompileTemplate builds a Template from a string naming the fields in
+// order, e.g. `{ip} [{time}] "{request}" {status} {duration}ms "{router}"`.
+// A time, a status, and either {request} or {path} are required.
+func CompileTemplate(tmpl string) (*Template, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	var fields []string
+
+	literal := func(s string) {
+		for i, part := range whitespaceRegex.Split(s, -1) {
+			if i > 0 {
+				pattern.WriteString(`\s+`)
+			}
+			pattern.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+
+	rest := tmpl
+	for {
+		loc := templateTokenRegex.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			literal(rest)
+			break
+		}
+		literal(rest[:loc[0]])
+		name := rest[loc[2]:loc[3]]
+		if !slices.Contains(templateTokens, name) {
+			return nil, fmt.Errorf("unknown template token {%s}", name)
+		}
+		if name != "-" && slices.Contains(fields, name) {
+			return nil, fmt.Errorf("template token {%s} used twice", name)
+		}
+		rest = rest[loc[1]:]
+
+		// A field runs up to the character the template puts after it
+		field := `\S+`
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			field = `[^"]*`
+		case strings.HasPrefix(rest, "]"):
+			field = `[^\]]+`
+		}
+
+		switch name {
+		case "-":
+			pattern.WriteString(field)
+		case "request":
+			pattern.WriteString(`(\S+) (\S+) ([^"]+)`)
+			fields = append(fields, "method", "path", "protocol")
+		case "status", "bytes", "body_bytes":
+			pattern.WriteString(`(\d+|-)`)
+			fields = append(fields, name)
+		case "duration":
+			pattern.WriteString(`(\d+(?:\.\d+)?|-)`)
+			fields = append(fields, name)
+		case "upstream_duration":
+			pattern.WriteString(`(\d+(?:\.\d+)?(?:,\s*\d+(?:\.\d+)?)*|-)`)
+			fields = append(fields, name)
+		default:
+			pattern.WriteString("(" + field + ")")
+			fields = append(fields, name)
+		}
+	}
+	pattern.WriteString(`(.*)`) // trailing fields, searched for a request ID
+	fields = append(fields, "trailing")
+
+	for _, required := range []string{"time", "status"} {
+		if !slices.Contains(fields, required) {
+			return nil, fmt.Errorf("template needs a {%s} token", required)
+		}
+	}
+	if !slices.Contains(fields, "path") {
+		return nil, fmt.Errorf("template needs a {request} or {path} token")
+	}
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("compile template: %w", err)
+	}
+	t := &Template{re: re, fields: fields, bytesFrom: "bytes"}
+	if !slices.Contains(fields, "bytes") {
+		t.bytesFrom = "body_bytes"
+	}
+	return t, nil
+}
+
+// SetBytesField picks which size field fills LogEntry.Bytes, and so the
+// bandwidth figures, when the template has both: "bytes" (sent on the
+// wire, e.g. nginx $bytes_sent) or "body_bytes" (the response body,
+// $body_bytes_sent). A template with only one of them keeps using it.
+func (t *Template) SetBytesField(name string) error {
+	if name != "bytes" && name != "body_bytes" {
+		return fmt.Errorf("unknown bytes field %q", name)
+	}
+	if slices.Contains(t.fields, name) {
+		t.bytesFrom = name
+	}
+	return nil
+}
+
+// Parse parses a single log line laid out by the template, with
+// {duration} in milliseconds
+func (t *Template) Parse(line string) (*LogEntry, error) {
+	return t.parse(line, UnitMillis)
+}
+
+// parse is Parse with {duration} written in unit
+func (t *Template) parse(line string, unit DurationUnit) (*LogEntry, error) {
+	matches := t.re.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("line does not match the configured field template")
+	}
+
+	unquote := func(s string) string {
+		if s == "-" {
+			return ""
+		}
+		return s
+	}
+
+	entry := &LogEntry{}
+	var err error
+	for i, name := range t.fields {
+		v := matches[i+1]
+		switch name {
+		case "ip":
+			entry.IP = v
+		case "time":
+			if entry.Timestamp, err = parseTimestamp(v); err != nil {
+				return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+			}
+		case "method":
+			entry.Method = v
+		case "path":
+			entry.Path = v
+		case "protocol":
+			entry.Protocol = v
+		case "status":
+			status, err := parseNumber(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse status code: %w", err)
+			}
+			entry.Status = int(status)
+		case "bytes", "body_bytes":
+			if name != t.bytesFrom {
+				continue
+			}
+			if entry.Bytes, err = parseNumber(v); err != nil {
+				return nil, fmt.Errorf("failed to parse bytes: %w", err)
+			}
+		case "referer":
+			entry.Referer = unquote(v)
+		case "user_agent":
+			entry.UserAgent = unquote(v)
+		case "router":
+			entry.Router = unquote(v)
+		case "backend":
+			entry.Backend = unquote(v)
+		case "host":
+			entry.Host = unquote(v)
+		case "cache_status":
+			entry.CacheStatus = unquote(v)
+		case "duration":
+			if v == "-" {
+				continue
+			}
+			if entry.DurationMs, err = parseDurationMs(v, unit); err != nil {
+				return nil, fmt.Errorf("failed to parse duration: %w", err)
+			}
+			entry.HasDuration = true
+		case "upstream_duration":
+			if v == "-" {
+				continue
+			}
+			if entry.UpstreamMs, err = parseUpstreamMs(v, unit); err != nil {
+				return nil, fmt.Errorf("failed to parse upstream duration: %w", err)
+			}
+			entry.HasUpstream = true
+		case "request_id":
+			entry.RequestID = unquote(v)
+		case "trailing":
+			if entry.RequestID == "" {
+				entry.RequestID = findRequestID(strings.Fields(v))
+			}
+		}
+	}
+	if entry.Method == "" {
+		entry.Method = "GET"
+	}
+	// Without a total, the upstream time is the only timing there is
+	if entry.HasUpstream && !entry.HasDuration {
+		entry.DurationMs, entry.HasDuration = entry.UpstreamMs, true
+		entry.HasUpstream = false
+	}
+	return entry, nil
+}
+
+// Matches returns how many of lines the template parses, for checking a
+// template against the head of the log at startup
+func (t *Template) Matches(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		if _, err := t.Parse(line); err == nil {
+			n++
+		}
+	}
+	return n
+}
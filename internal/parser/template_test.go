@@ -0,0 +1,222 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompileTemplateDefaultMatchesTraefik(t *testing.T) {
+	tmpl, err := CompileTemplate(DefaultTraefikTemplate)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+
+	line := `91.34.143.167 - admin [07/Jan/2026:16:17:08 +0000] "GET /ws HTTP/1.1" 404 555 "-" "Mozilla/5.0 (X11)" 1 "web@docker" "http://172.19.0.4:80" 12ms`
+	got, err := tmpl.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want, err := ParseTraefik(line)
+	if err != nil {
+		t.Fatalf("ParseTraefik() error = %v", err)
+	}
+	if *got != *want {
+		t.Errorf("Parse() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTemplateCustomLayout(t *testing.T) {
+	// Router moved to the front, no referer/user agent, request ID field
+	tmpl, err := CompileTemplate(`"{router}" {ip} [{time}] "{request}" {status} {bytes} {duration}ms {request_id}`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+
+	got, err := tmpl.Parse(`"api@docker" 10.0.0.1 [08/Feb/2026:10:00:00 +0000] "POST /v1/items HTTP/2.0" 502 -  87ms 3f2a9c1d-7b4e`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := LogEntry{
+		IP:          "10.0.0.1",
+		Timestamp:   time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC),
+		Method:      "POST",
+		Path:        "/v1/items",
+		Protocol:    "HTTP/2.0",
+		Status:      502,
+		Router:      "api@docker",
+		DurationMs:  87,
+		HasDuration: true,
+		RequestID:   "3f2a9c1d-7b4e",
+	}
+	if !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("Timestamp = %v, want %v", got.Timestamp, want.Timestamp)
+	}
+	got.Timestamp = want.Timestamp
+	if *got != want {
+		t.Errorf("Parse() = %+v\nwant %+v", *got, want)
+	}
+
+	if _, err := tmpl.Parse(DefaultTraefikTemplate); err == nil {
+		t.Error("Parse() should reject a line in another layout")
+	}
+	if n := tmpl.Matches([]string{"garbage", `"w" 1.2.3.4 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 5 1ms x`}); n != 1 {
+		t.Errorf("Matches() = %d, want 1", n)
+	}
+}
+
+func TestCompileTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{
+		`{ip} [{time}] "{request}" {status} {colour}`, // unknown token
+		`{ip} [{time}] "{request}"`,                   // no status
+		`{ip} "{request}" {status}`,                   // no time
+		`{ip} [{time}] {status}`,                      // no path
+		`[{time}] "{request}" {path} {status}`,        // path twice
+	} {
+		if _, err := CompileTemplate(tmpl); err == nil {
+			t.Errorf("CompileTemplate(%q) should fail", tmpl)
+		}
+	}
+}
+
+func TestParserSetTemplate(t *testing.T) {
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status}`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	p := NewParser("auto")
+	p.SetTemplate(tmpl)
+	if p.Format() != FormatTraefik {
+		t.Errorf("Format() = %v, want FormatTraefik", p.Format())
+	}
+	entry, err := p.ParseLine(`1.2.3.4 [08/Feb/2026:10:00:00 +0000] "GET /x HTTP/1.1" 200`)
+	if err != nil {
+		t.Fatalf("ParseLine() error = %v", err)
+	}
+	if entry.Path != "/x" || entry.HasDuration {
+		t.Errorf("ParseLine() = %+v, want /x without a duration", entry)
+	}
+}
+
+func TestTemplateHost(t *testing.T) {
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} "{host}" "{router}"`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	got, err := tmpl.Parse(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 "shop.example.com" "web@docker"`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.Host != "shop.example.com" || got.Router != "web@docker" {
+		t.Errorf("Parse() Host = %q, Router = %q", got.Host, got.Router)
+	}
+
+	// The stock layout has no host
+	stock, err := ParseTraefik(`91.34.143.167 - - [07/Jan/2026:16:17:08 +0000] "GET / HTTP/1.1" 200 5 "-" "-" 1 "web@docker" "-" 1ms`)
+	if err != nil {
+		t.Fatalf("ParseTraefik() error = %v", err)
+	}
+	if stock.Host != "" {
+		t.Errorf("ParseTraefik() Host = %q, want empty", stock.Host)
+	}
+}
+
+func TestTemplateCacheStatus(t *testing.T) {
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} "{cache_status}"`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	got, err := tmpl.Parse(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET /logo.png HTTP/1.1" 200 "Hit from cloudfront"`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.CacheStatus != "Hit from cloudfront" {
+		t.Errorf("Parse() CacheStatus = %q", got.CacheStatus)
+	}
+
+	got, err = tmpl.Parse(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 "-"`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.CacheStatus != "" {
+		t.Errorf("Parse() CacheStatus = %q, want empty for -", got.CacheStatus)
+	}
+}
+
+func TestTemplateUpstreamDuration(t *testing.T) {
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {duration}ms "{upstream_duration}"`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	const prefix = `10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 40ms `
+	for value, want := range map[string]int{`"25"`: 25, `"10, 12"`: 22, `"3.6"`: 4} {
+		got, err := tmpl.Parse(prefix + value)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", value, err)
+		}
+		if !got.HasUpstream || got.UpstreamMs != want || got.DurationMs != 40 {
+			t.Errorf("Parse(%s) = upstream %d (has %v), total %d; want %d of 40", value, got.UpstreamMs, got.HasUpstream, got.DurationMs, want)
+		}
+	}
+
+	got, err := tmpl.Parse(prefix + `"-"`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.HasUpstream || !got.HasDuration {
+		t.Errorf("Parse() with upstream - = %+v, want the total duration only", got)
+	}
+
+	// The duration unit applies to both fields
+	nginx, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {duration} "{upstream_duration}"`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	p := NewParser("traefik")
+	p.SetTemplate(nginx)
+	p.SetDurationUnit(UnitSeconds)
+	if got, err := p.ParseLine(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 0.040 "0.002, 0.004"`); err != nil || got.UpstreamMs != 6 || got.DurationMs != 40 {
+		t.Errorf("ParseLine() in seconds = %+v, %v; want 6 of 40 ms", got, err)
+	}
+
+	// An upstream time alone stands in for the total
+	upstreamOnly, err := CompileTemplate(`{ip} [{time}] "{request}" {status} "{upstream_duration}"`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	got, err = upstreamOnly.Parse(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 "25"`)
+	if err != nil || !got.HasDuration || got.DurationMs != 25 || got.HasUpstream {
+		t.Errorf("Parse() with only an upstream time = %+v, %v; want it as the 25 ms duration", got, err)
+	}
+}
+
+func TestTemplateBytesField(t *testing.T) {
+	const line = `10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 1200 5000`
+	tmpl, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {bytes} {body_bytes}`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	if got, err := tmpl.Parse(line); err != nil || got.Bytes != 1200 {
+		t.Errorf("Parse() = %+v, %v; want the on-wire 1200 bytes by default", got, err)
+	}
+	if err := tmpl.SetBytesField("body_bytes"); err != nil {
+		t.Fatalf("SetBytesField() error = %v", err)
+	}
+	if got, err := tmpl.Parse(line); err != nil || got.Bytes != 5000 {
+		t.Errorf("Parse() with body_bytes = %+v, %v; want 5000", got, err)
+	}
+	if err := tmpl.SetBytesField("content_length"); err == nil {
+		t.Error("SetBytesField(content_length): want error")
+	}
+
+	// With one size field, that one is used whatever was asked for
+	bodyOnly, err := CompileTemplate(`{ip} [{time}] "{request}" {status} {body_bytes}`)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	if err := bodyOnly.SetBytesField("bytes"); err != nil {
+		t.Fatalf("SetBytesField() error = %v", err)
+	}
+	if got, err := bodyOnly.Parse(`10.0.0.1 [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 5000`); err != nil || got.Bytes != 5000 {
+		t.Errorf("Parse() with only body_bytes = %+v, %v; want 5000", got, err)
+	}
+}
@@ -4,25 +4,26 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
-	"time"
+	"strings"
 )
 
 // Compiled regex for Traefik extended CLF format
-// Format: IP - USER [TIMESTAMP] "METHOD PATH PROTOCOL" STATUS BYTES "REFERER" "UA" REQ# "ROUTER" "BACKEND" DURATIONms
+// Format: IP - USER [TIMESTAMP] "METHOD PATH PROTOCOL" STATUS BYTES "REFERER" "UA" REQ# "ROUTER" "BACKEND" DURATIONms [optional: request_id]
 var traefikRegex = regexp.MustCompile(
 	`^(\S+) ` + // IP
 		`\S+ ` + // ident (always -)
 		`(\S+) ` + // auth user (- or username)
 		`\[([^\]]+)\] ` + // timestamp
 		`"(\S+) (\S+) ([^"]+)" ` + // method path protocol
-		`(\d+) ` + // status
-		`(\d+) ` + // bytes
+		`(\d+|-) ` + // status (- for none)
+		`(\d+|-) ` + // bytes
 		`"([^"]*)" ` + // referer
 		`"([^"]*)" ` + // user-agent
 		`\d+ ` + // request number (ignored)
 		`"([^"]*)" ` + // router
 		`"([^"]*)" ` + // backend
-		`(\d+)ms`, // duration
+		`(\d+ms|-)` + // duration (- for none)
+		`(.*)`, // optional trailing fields, e.g. a request ID
 )
 
 // ParseTraefik parses a single Traefik access log line into a LogEntry
@@ -32,24 +33,27 @@ func ParseTraefik(line string) (*LogEntry, error) {
 		return nil, fmt.Errorf("line does not match Traefik CLF format")
 	}
 
-	timestamp, err := time.Parse(clfTimeLayout, matches[3])
+	timestamp, err := parseTimestamp(matches[3])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
 	}
 
-	status, err := strconv.Atoi(matches[7])
+	status, err := parseNumber(matches[7])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse status code: %w", err)
 	}
 
-	bytes, err := strconv.ParseInt(matches[8], 10, 64)
+	bytes, err := parseNumber(matches[8])
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse bytes: %w", err)
 	}
 
-	durationMs, err := strconv.Atoi(matches[13])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse duration: %w", err)
+	var durationMs int
+	hasDuration := matches[13] != "-"
+	if hasDuration {
+		if durationMs, err = strconv.Atoi(strings.TrimSuffix(matches[13], "ms")); err != nil {
+			return nil, fmt.Errorf("failed to parse duration: %w", err)
+		}
 	}
 
 	unquote := func(s string) string {
@@ -60,17 +64,19 @@ func ParseTraefik(line string) (*LogEntry, error) {
 	}
 
 	return &LogEntry{
-		IP:         matches[1],
-		Timestamp:  timestamp,
-		Method:     matches[4],
-		Path:       matches[5],
-		Protocol:   matches[6],
-		Status:     status,
-		Bytes:      bytes,
-		Referer:    unquote(matches[9]),
-		UserAgent:  unquote(matches[10]),
-		Router:     unquote(matches[11]),
-		Backend:    unquote(matches[12]),
-		DurationMs: durationMs,
+		IP:          matches[1],
+		Timestamp:   timestamp,
+		Method:      matches[4],
+		Path:        matches[5],
+		Protocol:    matches[6],
+		Status:      int(status),
+		Bytes:       bytes,
+		Referer:     unquote(matches[9]),
+		UserAgent:   unquote(matches[10]),
+		Router:      unquote(matches[11]),
+		Backend:     unquote(matches[12]),
+		DurationMs:  durationMs,
+		HasDuration: hasDuration,
+		RequestID:   findRequestID(strings.Fields(matches[14])),
 	}, nil
 }
@@ -5,13 +5,47 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/open-wander/trail/internal/aggregator"
 )
 
 type Cleaner struct {
 	db            *sql.DB
 	retentionDays int
 	interval      time.Duration
+
+	// Distinct keys kept per hour and router; 0 disables the rollup for that table
+	maxPathsPerHour     int
+	maxReferrersPerHour int
+
+	// Per-router retention overrides (router -> days)
+	routerDays map[string]int
+
+	// How long requests_fine rows are kept; 0 clears the table
+	fineRetention time.Duration
+
+	// Large-delete guard, see SetDeleteGuard; maxDeletePct 0 disables it
+	maxDeletePct int
+	largeDelete  string
+}
+
+// Large-delete guard modes
+const (
+	LargeDeleteWarn  = "warn"  // log a warning and delete anyway
+	LargeDeleteBlock = "block" // log a warning and skip the pass
+	LargeDeleteAllow = "allow" // delete without warning, confirming an intended large cut
+)
+
+// hourlyTables lists every table keyed by (hour, router, ...)
+var hourlyTables = []string{
+	"requests", "visitors", "referrers", "user_agents",
+	"countries", "browsers", "os_stats", "duration_hist", "size_hist", "query_params",
+	"error_requests", "hosts", "raw_user_agents",
+	"cache_status", "threat_requests", "path_categories", "upstream_times",
+	"rate_limited", "duration_samples", "scanner_paths", "visitor_entries",
+	"auth_failures", "requests_raw",
 }
 
 // New creates a new retention cleaner with a default interval of 1 hour.
@@ -23,6 +57,61 @@ func New(db *sql.DB, retentionDays int) *Cleaner {
 	}
 }
 
+// SetHourlyCaps enables folding of low-count rows into aggregator.OtherKey
+// once an hour and router holds more than maxPaths distinct paths or
+// maxReferrers distinct referrers or requested hosts. This bounds table growth even when many flushes each stay under the
+// aggregator's per-flush caps. Zero disables the cap for that table.
+func (c *Cleaner) SetHourlyCaps(maxPaths, maxReferrers int) {
+	c.maxPathsPerHour = maxPaths
+	c.maxReferrersPerHour = maxReferrers
+}
+
+// SetRouterRetention overrides the retention period for specific routers.
+// Unlisted routers keep the global retention. An override longer than the
+// global period has no effect since the global pass runs first.
+func (c *Cleaner) SetRouterRetention(days map[string]int) {
+	c.routerDays = days
+}
+
+// SetFineRetention sets how long sub-hour requests_fine rows are kept.
+// Without it (fine buckets disabled) the table is emptied on every run, so
+// turning the feature off frees its space.
+func (c *Cleaner) SetFineRetention(d time.Duration) {
+	c.fineRetention = d
+}
+
+// SetDeleteGuard checks each pass against a misconfigured retention period:
+// when it would delete more than maxPct percent of the requests rows, mode
+// decides whether to warn and go ahead (LargeDeleteWarn), skip the pass
+// until the operator confirms with LargeDeleteAllow (LargeDeleteBlock), or
+// proceed quietly (LargeDeleteAllow). maxPct 0 disables the check.
+func (c *Cleaner) SetDeleteGuard(maxPct int, mode string) {
+	c.maxDeletePct = maxPct
+	c.largeDelete = mode
+}
+
+// checkDeleteFraction applies the SetDeleteGuard check to a pass deleting
+// rows older than cutoff. It returns an error when the pass must not run.
+func (c *Cleaner) checkDeleteFraction(tx *sql.Tx, cutoff string) error {
+	if c.maxDeletePct <= 0 || c.largeDelete == LargeDeleteAllow {
+		return nil
+	}
+	var total, old int64
+	if err := tx.QueryRow("SELECT COUNT(*), COALESCE(SUM(hour < ?), 0) FROM requests", cutoff).Scan(&total, &old); err != nil {
+		return fmt.Errorf("count requests: %w", err)
+	}
+	if total == 0 || old*100 <= total*int64(c.maxDeletePct) {
+		return nil
+	}
+
+	log.Printf("retention: WARNING: this pass deletes %d of %d requests rows (%.0f%%) older than %s, over the %d%% limit; check TRAIL_RETENTION_DAYS=%d",
+		old, total, float64(old)*100/float64(total), cutoff[:10], c.maxDeletePct, c.retentionDays)
+	if c.largeDelete == LargeDeleteBlock {
+		return fmt.Errorf("skipped a pass deleting %d%% of requests rows; set TRAIL_RETENTION_LARGE_DELETE=allow to confirm", old*100/total)
+	}
+	return nil
+}
+
 // Run starts the retention cleanup job. It runs cleanup immediately on start,
 // then repeats every interval. It respects context cancellation.
 func (c *Cleaner) Run(ctx context.Context) error {
@@ -56,71 +145,258 @@ func (c *Cleaner) cleanup() error {
 	}
 	defer tx.Rollback()
 
-	// Delete from requests
-	reqResult, err := tx.Exec("DELETE FROM requests WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete requests: %w", err)
+	if err := c.checkDeleteFraction(tx, cutoff); err != nil {
+		return err
 	}
-	reqCount, _ := reqResult.RowsAffected()
 
-	// Delete from visitors
-	visResult, err := tx.Exec("DELETE FROM visitors WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete visitors: %w", err)
+	// Delete from every hourly table, noting the counts for one log line
+	deleted := make([]string, 0, len(hourlyTables))
+	for _, table := range hourlyTables {
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE hour < ?", table), cutoff)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+		n, _ := res.RowsAffected()
+		deleted = append(deleted, fmt.Sprintf("%d %s", n, table))
 	}
-	visCount, _ := visResult.RowsAffected()
 
-	// Delete from referrers
-	refResult, err := tx.Exec("DELETE FROM referrers WHERE hour < ?", cutoff)
+	// Delete from requests_fine, on its own much shorter clock
+	fineCutoff := time.Now().UTC().Add(-c.fineRetention).Format(time.RFC3339)
+	fineResult, err := tx.Exec("DELETE FROM requests_fine WHERE bucket < ?", fineCutoff)
 	if err != nil {
-		return fmt.Errorf("delete referrers: %w", err)
+		return fmt.Errorf("delete requests_fine: %w", err)
 	}
-	refCount, _ := refResult.RowsAffected()
+	fineCount, _ := fineResult.RowsAffected()
 
-	// Delete from user_agents
-	uaResult, err := tx.Exec("DELETE FROM user_agents WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete user_agents: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
 	}
-	uaCount, _ := uaResult.RowsAffected()
 
-	// Delete from countries
-	countryResult, err := tx.Exec("DELETE FROM countries WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete countries: %w", err)
+	if err := c.cleanupRouters(); err != nil {
+		return fmt.Errorf("router retention: %w", err)
 	}
-	countryCount, _ := countryResult.RowsAffected()
 
-	// Delete from browsers
-	browserResult, err := tx.Exec("DELETE FROM browsers WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete browsers: %w", err)
+	if err := c.rollupOverflow(); err != nil {
+		return fmt.Errorf("rollup overflow: %w", err)
 	}
-	browserCount, _ := browserResult.RowsAffected()
 
-	// Delete from os_stats
-	osResult, err := tx.Exec("DELETE FROM os_stats WHERE hour < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("delete os_stats: %w", err)
+	// Parse cutoff for friendly logging
+	cutoffDate := cutoff[:10] // Extract YYYY-MM-DD from RFC3339
+
+	log.Printf("retention: deleted %s older than %s", strings.Join(deleted, ", "), cutoffDate)
+	if fineCount > 0 {
+		log.Printf("retention: deleted %d requests_fine rows older than %s", fineCount, c.fineRetention)
 	}
-	osCount, _ := osResult.RowsAffected()
 
-	// Delete from duration_hist
-	dhResult, err := tx.Exec("DELETE FROM duration_hist WHERE hour < ?", cutoff)
+	return nil
+}
+
+// cleanupRouters deletes rows of routers with a retention override that are
+// older than that router's own cutoff.
+func (c *Cleaner) cleanupRouters() error {
+	if len(c.routerDays) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.Begin()
 	if err != nil {
-		return fmt.Errorf("delete duration_hist: %w", err)
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for router, days := range c.routerDays {
+		cutoff := now.AddDate(0, 0, -days).Truncate(time.Hour).Format(time.RFC3339)
+		var deleted int64
+		for _, table := range hourlyTables {
+			res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE router = ? AND hour < ?", table), router, cutoff)
+			if err != nil {
+				return fmt.Errorf("delete %s for router %s: %w", table, router, err)
+			}
+			n, _ := res.RowsAffected()
+			deleted += n
+		}
+		if deleted > 0 {
+			log.Printf("retention: deleted %d rows for router %s older than %s (%d days)", deleted, router, cutoff[:10], days)
+		}
 	}
-	dhCount, _ := dhResult.RowsAffected()
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("commit transaction: %w", err)
 	}
+	return nil
+}
 
-	// Parse cutoff for friendly logging
-	cutoffDate := cutoff[:10] // Extract YYYY-MM-DD from RFC3339
+// rollupSpec describes how to fold overflow rows of one table into OtherKey
+type rollupSpec struct {
+	table     string
+	keyCol    string // column replaced with OtherKey
+	rankTable string // table whose counts rank the keys; "" for table itself
+	limit     int
+	fold      string // INSERT ... SELECT merging rows listed in temp.overflow
+}
 
-	log.Printf("retention: deleted %d requests, %d visitors, %d referrers, %d user_agents, %d countries, %d browsers, %d os_stats, %d duration_hist older than %s",
-		reqCount, visCount, refCount, uaCount, countryCount, browserCount, osCount, dhCount, cutoffDate)
+// rollupOverflow keeps the top keys (by total count) of every hour and
+// router that holds more distinct keys than its cap, and merges every row of
+// the rest into a single OtherKey row per remaining key. Requests are capped
+// by host and then by path; a path's rows for each host, method and status
+// are kept or folded together, and path_categories is ranked by the requests
+// totals so both tables keep the same paths.
+func (c *Cleaner) rollupOverflow() error {
+	specs := []rollupSpec{
+		{
+			// Hosts first, sharing the referrer cap like the hosts table, so
+			// the path fold below leaves at most one (other) row per host
+			table:  "requests",
+			keyCol: "host",
+			limit:  c.maxReferrersPerHour,
+			fold: `
+				INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+				SELECT hour, router, ?, path, method, status, SUM(count), SUM(bytes), SUM(duration)
+				FROM requests
+				WHERE rowid IN (SELECT rid FROM temp.overflow)
+				GROUP BY hour, router, path, method, status
+				ON CONFLICT(hour, router, host, path, method, status) DO UPDATE SET
+					count = count + excluded.count,
+					bytes = bytes + excluded.bytes,
+					duration = duration + excluded.duration`,
+		},
+		{
+			table:  "requests",
+			keyCol: "path",
+			limit:  c.maxPathsPerHour,
+			fold: `
+				INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+				SELECT hour, router, host, ?, method, status, SUM(count), SUM(bytes), SUM(duration)
+				FROM requests
+				WHERE rowid IN (SELECT rid FROM temp.overflow)
+				GROUP BY hour, router, host, method, status
+				ON CONFLICT(hour, router, host, path, method, status) DO UPDATE SET
+					count = count + excluded.count,
+					bytes = bytes + excluded.bytes,
+					duration = duration + excluded.duration`,
+		},
+		{
+			table:     "path_categories",
+			keyCol:    "path",
+			rankTable: "requests",
+			limit:     c.maxPathsPerHour,
+			fold: `
+				INSERT INTO path_categories (hour, router, path, category, count)
+				SELECT hour, router, ?, category, SUM(count)
+				FROM path_categories
+				WHERE rowid IN (SELECT rid FROM temp.overflow)
+				GROUP BY hour, router, category
+				ON CONFLICT(hour, router, path, category) DO UPDATE SET
+					count = count + excluded.count`,
+		},
+		{
+			table:  "referrers",
+			keyCol: "referrer",
+			limit:  c.maxReferrersPerHour,
+			fold: `
+				INSERT INTO referrers (hour, router, referrer, count)
+				SELECT hour, router, ?, SUM(count)
+				FROM referrers
+				WHERE rowid IN (SELECT rid FROM temp.overflow)
+				GROUP BY hour, router
+				ON CONFLICT(hour, router, referrer) DO UPDATE SET
+					count = count + excluded.count`,
+		},
+		{
+			table:  "raw_user_agents",
+			keyCol: "user_agent",
+			limit:  c.maxReferrersPerHour,
+			fold: `
+				INSERT INTO raw_user_agents (hour, router, user_agent, count)
+				SELECT hour, router, ?, SUM(count)
+				FROM raw_user_agents
+				WHERE rowid IN (SELECT rid FROM temp.overflow)
+				GROUP BY hour, router
+				ON CONFLICT(hour, router, user_agent) DO UPDATE SET
+					count = count + excluded.count`,
+		},
+	}
 
+	for _, spec := range specs {
+		if spec.limit <= 0 {
+			continue
+		}
+		folded, err := c.rollupTable(spec)
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.table, err)
+		}
+		if folded > 0 {
+			log.Printf("retention: folded %d %s rows into %q (cap %d per hour)", folded, spec.table, aggregator.OtherKey, spec.limit)
+		}
+	}
 	return nil
 }
+
+// rollupTable applies one rollupSpec in a single transaction and returns the
+// number of rows folded away.
+func (c *Cleaner) rollupTable(spec rollupSpec) (int64, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rankTable := spec.rankTable
+	if rankTable == "" {
+		rankTable = spec.table
+	}
+
+	// Rank the distinct keys of each over-cap hour and router by their total
+	// count; every row of a key past the cap overflows. A key missing from
+	// rankTable (already folded there) ranks last. The OtherKey rows are never
+	// ranked so they can only grow. The temp table is created inside the
+	// transaction, so a rollback discards it too.
+	_, err = tx.Exec(fmt.Sprintf(`
+		CREATE TEMP TABLE overflow AS
+		WITH keys AS (
+			SELECT hour, router, %[2]s AS k
+			FROM %[1]s
+			WHERE %[2]s != ?
+			GROUP BY hour, router, %[2]s
+		),
+		over AS (
+			SELECT hour, router FROM keys GROUP BY hour, router HAVING COUNT(*) > ?
+		),
+		totals AS (
+			SELECT hour, router, %[2]s AS k, SUM(count) AS total
+			FROM %[3]s JOIN over USING (hour, router)
+			GROUP BY hour, router, %[2]s
+		),
+		ranked AS (
+			SELECT hour, router, k,
+				ROW_NUMBER() OVER (PARTITION BY hour, router ORDER BY COALESCE(total, 0) DESC, k) AS rn
+			FROM keys JOIN over USING (hour, router) LEFT JOIN totals USING (hour, router, k)
+		)
+		SELECT t.rowid AS rid
+		FROM %[1]s t
+		JOIN ranked r ON r.hour = t.hour AND r.router = t.router AND r.k = t.%[2]s
+		WHERE r.rn > ?`, spec.table, spec.keyCol, rankTable), aggregator.OtherKey, spec.limit, spec.limit)
+	if err != nil {
+		return 0, fmt.Errorf("rank rows: %w", err)
+	}
+
+	if _, err := tx.Exec(spec.fold, aggregator.OtherKey); err != nil {
+		return 0, fmt.Errorf("fold rows: %w", err)
+	}
+
+	res, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE rowid IN (SELECT rid FROM temp.overflow)`, spec.table))
+	if err != nil {
+		return 0, fmt.Errorf("delete rows: %w", err)
+	}
+	folded, _ := res.RowsAffected()
+
+	if _, err := tx.Exec("DROP TABLE temp.overflow"); err != nil {
+		return 0, fmt.Errorf("drop temp table: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return folded, nil
+}
@@ -0,0 +1,403 @@
+package retention
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	traildb "github.com/open-wander/trail/internal/db"
+	_ "modernc.org/sqlite"
+)
+
+// testDB creates an in-memory SQLite database for testing
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := traildb.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestRollupOverflowRequests(t *testing.T) {
+	db := testDB(t)
+	hour := "2026-02-08T10:00:00Z"
+
+	// 5 paths in one hour with counts 50, 40, 30, 20, 10
+	for i := 0; i < 5; i++ {
+		count := 50 - i*10
+		_, err := db.Exec(`INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
+			VALUES (?, 'web', ?, 'GET', 200, ?, ?, ?)`, hour, fmt.Sprintf("/p%d", i), count, count*100, count*10)
+		if err != nil {
+			t.Fatalf("seed requests: %v", err)
+		}
+	}
+	// A second hour under the cap must be left alone
+	if _, err := db.Exec(`INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
+		VALUES ('2026-02-08T11:00:00Z', 'web', '/solo', 'GET', 200, 1, 1, 1)`); err != nil {
+		t.Fatalf("seed requests: %v", err)
+	}
+
+	c := New(db, 90)
+	c.SetHourlyCaps(3, 0)
+	if err := c.rollupOverflow(); err != nil {
+		t.Fatalf("rollupOverflow() error = %v", err)
+	}
+
+	rows, err := db.Query(`SELECT path, count, bytes FROM requests WHERE hour = ?`, hour)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	got := make(map[string][2]int64)
+	for rows.Next() {
+		var path string
+		var count, bytes int64
+		if err := rows.Scan(&path, &count, &bytes); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got[path] = [2]int64{count, bytes}
+	}
+	rows.Close()
+
+	// Top 3 kept; /p3 (20) and /p4 (10) folded into (other)
+	want := map[string][2]int64{
+		"/p0":     {50, 5000},
+		"/p1":     {40, 4000},
+		"/p2":     {30, 3000},
+		"(other)": {30, 3000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got rows %v, want %v", got, want)
+	}
+	for path, w := range want {
+		if got[path] != w {
+			t.Errorf("%s = %v, want %v", path, got[path], w)
+		}
+	}
+
+	var solo int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM requests WHERE path = '/solo'`).Scan(&solo); err != nil {
+		t.Fatalf("query solo: %v", err)
+	}
+	if solo != 1 {
+		t.Errorf("under-cap hour was modified")
+	}
+
+	// Running again is a no-op: the hour is now at the cap plus the (other) row
+	if err := c.rollupOverflow(); err != nil {
+		t.Fatalf("second rollupOverflow() error = %v", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM requests WHERE hour = ?`, hour).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("rows after second rollup = %d, want 4", n)
+	}
+}
+
+func TestRollupOverflowByPath(t *testing.T) {
+	db := testDB(t)
+	hour := "2026-02-08T10:00:00Z"
+
+	// web has 3 paths: /a (200 x5, 404 x4), /b (200 x6), /c (404 x1). api has
+	// 2 paths, under the cap of 2 even though the hour holds 5 paths.
+	seed := []struct {
+		router, path string
+		status, n    int
+	}{
+		{"web", "/a", 200, 5}, {"web", "/a", 404, 4}, {"web", "/b", 200, 6}, {"web", "/c", 404, 1},
+		{"api", "/x", 200, 1}, {"api", "/y", 200, 1},
+	}
+	for _, s := range seed {
+		if _, err := db.Exec(`INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
+			VALUES (?, ?, ?, 'GET', ?, ?, 0, 0)`, hour, s.router, s.path, s.status, s.n); err != nil {
+			t.Fatalf("seed requests: %v", err)
+		}
+	}
+	// path_categories counts differ from requests; the kept paths must match
+	for _, p := range []struct {
+		path string
+		n    int
+	}{{"/a", 1}, {"/b", 1}, {"/c", 50}} {
+		if _, err := db.Exec(`INSERT INTO path_categories (hour, router, path, category, count)
+			VALUES (?, 'web', ?, 'page', ?)`, hour, p.path, p.n); err != nil {
+			t.Fatalf("seed path_categories: %v", err)
+		}
+	}
+
+	c := New(db, 90)
+	c.SetHourlyCaps(2, 0)
+	if err := c.rollupOverflow(); err != nil {
+		t.Fatalf("rollupOverflow() error = %v", err)
+	}
+
+	rowsOf := func(query string) map[string]int {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		defer rows.Close()
+		got := make(map[string]int)
+		for rows.Next() {
+			var key string
+			var n int
+			if err := rows.Scan(&key, &n); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			got[key] = n
+		}
+		return got
+	}
+
+	// /a (9 in total) outranks /b (6) although its 200 row alone doesn't, and
+	// keeps its 404 row; only /c is folded
+	got := rowsOf(`SELECT router || ' ' || path || ' ' || status, count FROM requests`)
+	want := map[string]int{
+		"web /a 200": 5, "web /a 404": 4, "web /b 200": 6, "web (other) 404": 1,
+		"api /x 200": 1, "api /y 200": 1,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("requests %q = %d, want %d", k, got[k], w)
+		}
+	}
+
+	got = rowsOf(`SELECT path, count FROM path_categories`)
+	wantCats := map[string]int{"/a": 1, "/b": 1, "(other)": 50}
+	if len(got) != len(wantCats) {
+		t.Fatalf("path_categories = %v, want %v", got, wantCats)
+	}
+	for k, w := range wantCats {
+		if got[k] != w {
+			t.Errorf("path_categories %q = %d, want %d", k, got[k], w)
+		}
+	}
+}
+
+func TestRollupOverflowHosts(t *testing.T) {
+	db := testDB(t)
+	hour := "2026-02-08T10:00:00Z"
+
+	// Each flush stayed under its cap, but the hour collected 20 spoofed hosts
+	// on one path plus a real host with more traffic
+	for i := 0; i < 20; i++ {
+		if _, err := db.Exec(`INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+			VALUES (?, 'web', ?, '/', 'GET', 404, 1, 0, 0)`, hour, fmt.Sprintf("h%d.example", i)); err != nil {
+			t.Fatalf("seed requests: %v", err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration)
+		VALUES (?, 'web', 'example.com', '/', 'GET', 200, 100, 0, 0)`, hour); err != nil {
+		t.Fatalf("seed requests: %v", err)
+	}
+
+	c := New(db, 90)
+	c.SetHourlyCaps(10, 2)
+	if err := c.rollupOverflow(); err != nil {
+		t.Fatalf("rollupOverflow() error = %v", err)
+	}
+
+	got := map[string]int{}
+	rows, err := db.Query(`SELECT host || ' ' || status, count FROM requests`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got[key] = n
+	}
+	rows.Close()
+
+	// example.com and the alphabetically first tied host survive
+	want := map[string]int{"example.com 200": 100, "h0.example 404": 1, "(other) 404": 19}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("requests %q = %d, want %d", k, got[k], w)
+		}
+	}
+}
+
+func TestRollupOverflowReferrers(t *testing.T) {
+	db := testDB(t)
+	hour := "2026-02-08T10:00:00Z"
+
+	for i := 0; i < 4; i++ {
+		_, err := db.Exec(`INSERT INTO referrers (hour, router, referrer, count) VALUES (?, 'web', ?, ?)`,
+			hour, fmt.Sprintf("spam%d.example", i), 4-i)
+		if err != nil {
+			t.Fatalf("seed referrers: %v", err)
+		}
+	}
+
+	c := New(db, 90)
+	c.SetHourlyCaps(0, 2)
+	if err := c.rollupOverflow(); err != nil {
+		t.Fatalf("rollupOverflow() error = %v", err)
+	}
+
+	var other int
+	if err := db.QueryRow(`SELECT count FROM referrers WHERE referrer = '(other)'`).Scan(&other); err != nil {
+		t.Fatalf("query other: %v", err)
+	}
+	if other != 3 { // 2 + 1
+		t.Errorf("(other) count = %d, want 3", other)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM referrers`).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("referrer rows = %d, want 3", n)
+	}
+}
+
+func TestRouterRetentionOverrides(t *testing.T) {
+	db := testDB(t)
+	now := time.Now().UTC().Truncate(time.Hour)
+
+	// Rows for two routers at 2, 10 and 40 days old
+	ages := []int{2, 10, 40}
+	for _, router := range []string{"health@docker", "web@docker"} {
+		for _, days := range ages {
+			hour := now.AddDate(0, 0, -days).Format(time.RFC3339)
+			if _, err := db.Exec(`INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
+				VALUES (?, ?, '/', 'GET', 200, 1, 1, 1)`, hour, router); err != nil {
+				t.Fatalf("seed requests: %v", err)
+			}
+			if _, err := db.Exec(`INSERT INTO visitors (hour, router, ip_hash) VALUES (?, ?, 'abc')`, hour, router); err != nil {
+				t.Fatalf("seed visitors: %v", err)
+			}
+		}
+	}
+
+	// Global 30 days; health checks kept 7 days, web overridden to 20
+	c := New(db, 30)
+	c.SetRouterRetention(map[string]int{"health@docker": 7, "web@docker": 20})
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+
+	tests := []struct {
+		router string
+		want   int
+	}{
+		{"health@docker", 1}, // only the 2-day-old row survives
+		{"web@docker", 2},    // 2 and 10 days survive, 40 is past both cutoffs
+	}
+	for _, tt := range tests {
+		for _, table := range []string{"requests", "visitors"} {
+			var n int
+			if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE router = ?`, table), tt.router).Scan(&n); err != nil {
+				t.Fatalf("count %s: %v", table, err)
+			}
+			if n != tt.want {
+				t.Errorf("%s rows for %s = %d, want %d", table, tt.router, n, tt.want)
+			}
+		}
+	}
+}
+
+func TestFineRetention(t *testing.T) {
+	db := testDB(t)
+	now := time.Now().UTC().Truncate(10 * time.Minute)
+
+	for _, age := range []time.Duration{10 * time.Minute, 5 * time.Hour, 30 * time.Hour} {
+		bucket := now.Add(-age).Format(time.RFC3339)
+		if _, err := db.Exec(`INSERT INTO requests_fine (bucket, router, path, method, status, count, bytes, duration)
+			VALUES (?, 'web', '/', 'GET', 200, 1, 1, 1)`, bucket); err != nil {
+			t.Fatalf("seed requests_fine: %v", err)
+		}
+	}
+
+	c := New(db, 30)
+	c.SetFineRetention(24 * time.Hour)
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM requests_fine`).Scan(&n); err != nil {
+		t.Fatalf("count requests_fine: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("requests_fine rows = %d, want 2 (the 30h-old bucket is past the 24h cutoff)", n)
+	}
+
+	// With fine buckets disabled the table is cleared
+	c.SetFineRetention(0)
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM requests_fine`).Scan(&n); err != nil {
+		t.Fatalf("count requests_fine: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("requests_fine rows with fine retention off = %d, want 0", n)
+	}
+}
+
+func TestDeleteGuard(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Hour)
+	seed := func(t *testing.T, oldRows, newRows int) *sql.DB {
+		t.Helper()
+		db := testDB(t)
+		for i := 0; i < oldRows+newRows; i++ {
+			hour := now.Add(-time.Duration(i) * time.Hour)
+			if i < oldRows {
+				hour = now.AddDate(0, 0, -60).Add(-time.Duration(i) * time.Hour)
+			}
+			if _, err := db.Exec(`INSERT INTO requests (hour, router, path, method, status, count, bytes, duration)
+				VALUES (?, 'web', '/', 'GET', 200, 1, 1, 1)`, hour.Format(time.RFC3339)); err != nil {
+				t.Fatalf("seed requests: %v", err)
+			}
+		}
+		return db
+	}
+	count := func(t *testing.T, db *sql.DB) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM requests`).Scan(&n); err != nil {
+			t.Fatalf("count requests: %v", err)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name             string
+		oldRows, newRows int
+		mode             string
+		wantErr          bool
+		wantRows         int
+	}{
+		{"block keeps rows", 8, 2, LargeDeleteBlock, true, 10},
+		{"warn deletes", 8, 2, LargeDeleteWarn, false, 2},
+		{"allow deletes", 8, 2, LargeDeleteAllow, false, 2},
+		{"block under limit", 2, 8, LargeDeleteBlock, false, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := seed(t, tt.oldRows, tt.newRows)
+			c := New(db, 30)
+			c.SetDeleteGuard(50, tt.mode)
+			if err := c.cleanup(); (err != nil) != tt.wantErr {
+				t.Fatalf("cleanup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := count(t, db); n != tt.wantRows {
+				t.Errorf("requests rows = %d, want %d", n, tt.wantRows)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-wander/trail/internal/config"
+	"github.com/open-wander/trail/internal/export"
+	"github.com/open-wander/trail/internal/parser"
+)
+
+// handleAdminExport streams every aggregate table as JSON Lines for backup or
+// migration. Load it elsewhere with `trail import <file>`.
+func (s *Server) handleAdminExport(c *fiber.Ctx) error {
+	filename := fmt.Sprintf("trail-%s.jsonl", time.Now().UTC().Format("20060102-150405"))
+	c.Set("Content-Type", "application/x-ndjson")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := export.Dump(context.Background(), s.db, w); err != nil {
+			log.Printf("Error exporting data: %v", err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// handleAdminFlush writes the aggregator's buffered entries to the database
+// immediately instead of waiting for the next flush interval
+func (s *Server) handleAdminFlush(c *fiber.Ctx) error {
+	if s.flusher == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no aggregator attached"})
+	}
+	n, err := s.flusher.Flush(c.UserContext())
+	if err != nil {
+		log.Printf("Error flushing on demand: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "flush failed"})
+	}
+	return c.JSON(fiber.Map{"flushed": n})
+}
+
+// handleAdminPause stops ingestion for maintenance: the inputs stop
+// reading and what the aggregator buffered is flushed. Lines already
+// queued for the aggregator are still written by later flushes and
+// retention keeps running, so the database isn't idle. The log position
+// is kept.
+func (s *Server) handleAdminPause(c *fiber.Ctx) error {
+	if s.ingest == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no tailer attached"})
+	}
+	s.ingest.Pause()
+	log.Printf("Ingestion paused")
+
+	flushed := 0
+	if s.flusher != nil {
+		n, err := s.flusher.Flush(c.UserContext())
+		if err != nil {
+			log.Printf("Error flushing on pause: %v", err)
+			return c.Status(500).JSON(fiber.Map{"paused": true, "error": "flush failed"})
+		}
+		flushed = n
+	}
+	return c.JSON(fiber.Map{"paused": true, "flushed": flushed})
+}
+
+// handleAdminResume restarts ingestion from the saved log position
+func (s *Server) handleAdminResume(c *fiber.Ctx) error {
+	if s.ingest == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no tailer attached"})
+	}
+	s.ingest.Resume()
+	log.Printf("Ingestion resumed")
+	return c.JSON(fiber.Map{"paused": false})
+}
+
+// handleDebugConfig returns the effective configuration with secrets
+// redacted, to check which log file, format and retention a deployment
+// actually picked up
+func (s *Server) handleDebugConfig(c *fiber.Ctx) error {
+	return c.JSON(s.config.Redacted())
+}
+
+// formatSampleLines is how many lines from the head of the log format
+// detection looks at, matching startup detection
+const formatSampleLines = 10
+
+// handleAdminFormat reports the live parser's format alongside what
+// detection makes of the head of the log file right now
+func (s *Server) handleAdminFormat(c *fiber.Ctx) error {
+	if s.parser == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no parser attached"})
+	}
+	// Logs that only arrive over syslog or stdin leave no file to sample
+	var lines []string
+	if s.config.LogFile != "" && s.config.LogFile != config.Stdin {
+		var err error
+		if lines, err = readHeadLines(s.config.LogFile, formatSampleLines); err != nil {
+			log.Printf("Error reading log head for format detection: %v", err)
+			return c.Status(500).JSON(fiber.Map{"error": "cannot read log file"})
+		}
+	}
+	detected := ""
+	if len(lines) > 0 {
+		detected = parser.DetectFormat(lines).String()
+	}
+	return c.JSON(fiber.Map{
+		"current":      s.parser.Format().String(),
+		"detected":     detected,
+		"sample_lines": len(lines),
+		"formats":      formatNames(),
+	})
+}
+
+// formatNames lists the formats the live parser can be switched to
+func formatNames() []string {
+	var names []string
+	for _, f := range parser.Formats() {
+		names = append(names, f.String())
+	}
+	return names
+}
+
+// handleAdminSetFormat switches the live parser to the format named in the
+// "format" form value. Lines already aggregated are not re-parsed.
+func (s *Server) handleAdminSetFormat(c *fiber.Ctx) error {
+	if s.parser == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no parser attached"})
+	}
+	f, ok := parser.LookupFormat(c.FormValue("format"))
+	if !ok || f == parser.FormatAuto {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be one of " + strings.Join(formatNames(), ", ")})
+	}
+	previous := s.parser.Format()
+	s.parser.SetFormat(f)
+	log.Printf("Log format switched from %s to %s from the dashboard", previous, f)
+	return c.JSON(fiber.Map{"format": f.String()})
+}
+
+// readHeadLines returns up to n non-empty lines from the start of path
+func readHeadLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for len(lines) < n && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// handleAdminBackup streams a point-in-time copy of the SQLite database.
+// The copy is made with VACUUM INTO a temporary file, which is consistent
+// even while the aggregator is writing (unlike copying the live file under
+// WAL), and removed once the response has been sent.
+func (s *Server) handleAdminBackup(c *fiber.Ctx) error {
+	// Next to the database so the copy lands on the same (large enough) volume
+	dir, err := os.MkdirTemp(filepath.Dir(s.config.DBPath), ".trail-backup-")
+	if err != nil {
+		log.Printf("Error creating backup directory: %v", err)
+		return c.Status(500).SendString("Error creating backup")
+	}
+	path := filepath.Join(dir, "trail.db")
+
+	if _, err := s.db.ExecContext(c.UserContext(), "VACUUM INTO ?", path); err != nil {
+		os.RemoveAll(dir)
+		log.Printf("Error writing backup: %v", err)
+		return c.Status(500).SendString("Error creating backup")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Printf("Error opening backup: %v", err)
+		return c.Status(500).SendString("Error creating backup")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		os.RemoveAll(dir)
+		log.Printf("Error opening backup: %v", err)
+		return c.Status(500).SendString("Error creating backup")
+	}
+
+	filename := fmt.Sprintf("trail-%s.db", time.Now().UTC().Format("20060102-150405"))
+	c.Set("Content-Type", "application/vnd.sqlite3")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	// fasthttp closes the stream after sending, which removes the temp copy
+	return c.SendStream(&tempFile{File: f, dir: dir}, int(info.Size()))
+}
+
+// tempFile is an open file whose directory is removed when it is closed
+type tempFile struct {
+	*os.File
+	dir string
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	if rmErr := os.RemoveAll(t.dir); rmErr != nil {
+		log.Printf("Error removing backup copy %s: %v", t.dir, rmErr)
+	}
+	return err
+}
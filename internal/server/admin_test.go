@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+	traildb "github.com/open-wander/trail/internal/db"
+	"github.com/open-wander/trail/internal/parser"
+)
+
+func TestAdminBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "trail.db")
+	db, err := traildb.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	seedRequests(t, db,
+		requestRow{"2026-02-08T10:00:00Z", "api", "/users", "GET", 200, 42, 1000, 500},
+	)
+
+	srv := newTestServer(t, &config.Config{DBPath: dbPath, AuthUser: "admin", AuthPass: "secret"}, db)
+	resp, err := srv.app.Test(adminRequest("GET", "/api/admin/backup.db", nil), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	// The download is a standalone database with the same data
+	copyPath := filepath.Join(t.TempDir(), "copy.db")
+	if err := os.WriteFile(copyPath, body, 0o600); err != nil {
+		t.Fatalf("write copy: %v", err)
+	}
+	restored, err := traildb.Open(copyPath)
+	if err != nil {
+		t.Fatalf("open copy: %v", err)
+	}
+	defer restored.Close()
+	var count int
+	if err := restored.QueryRow(`SELECT SUM(count) FROM requests`).Scan(&count); err != nil {
+		t.Fatalf("query copy: %v", err)
+	}
+	if count != 42 {
+		t.Errorf("backup count = %d, want 42", count)
+	}
+
+	// The temporary copy is cleaned up
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("leftover backup directory %s", e.Name())
+		}
+	}
+}
+
+// adminRequest builds a request to an admin endpoint with the credentials
+// the admin tests configure
+func adminRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.SetBasicAuth("admin", "secret")
+	return req
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	// Without configured credentials the dashboard is open, but admin and
+	// debug endpoints are refused rather than served to anyone
+	srv := newTestServer(t, &config.Config{}, testDB(t))
+	for _, route := range []struct{ method, target string }{
+		{"GET", "/api/admin/export"},
+		{"GET", "/api/admin/backup.db"},
+		{"POST", "/api/admin/flush"},
+		{"POST", "/api/admin/pause"},
+		{"POST", "/api/admin/resume"},
+		{"GET", "/api/admin/format"},
+		{"POST", "/api/admin/format"},
+		{"GET", "/api/debug/config"},
+	} {
+		resp, err := srv.app.Test(httptest.NewRequest(route.method, route.target, nil), -1)
+		if err != nil {
+			t.Fatalf("%s %s: %v", route.method, route.target, err)
+		}
+		if resp.StatusCode != 403 {
+			t.Errorf("%s %s without credentials configured = %d, want 403", route.method, route.target, resp.StatusCode)
+		}
+	}
+
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/api/bounds", nil), -1)
+	if err != nil {
+		t.Fatalf("GET /api/bounds: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("GET /api/bounds without credentials configured = %d, want 200", resp.StatusCode)
+	}
+}
+
+// fakeFlusher reports a fixed last flush time
+type fakeFlusher struct{ last time.Time }
+
+func (f fakeFlusher) Flush(context.Context) (int, error) { return 0, nil }
+func (f fakeFlusher) LastFlush() time.Time               { return f.last }
+
+// fakePauser records Pause and Resume calls
+type fakePauser struct{ paused bool }
+
+func (p *fakePauser) Pause()       { p.paused = true }
+func (p *fakePauser) Resume()      { p.paused = false }
+func (p *fakePauser) Paused() bool { return p.paused }
+
+func TestAdminPause(t *testing.T) {
+	srv := newTestServer(t, &config.Config{AuthUser: "admin", AuthPass: "secret"}, testDB(t))
+	post := func(target string) (int, map[string]any) {
+		t.Helper()
+		resp, err := srv.app.Test(adminRequest("POST", target, nil), -1)
+		if err != nil {
+			t.Fatalf("POST %s: %v", target, err)
+		}
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if code, _ := post("/api/admin/pause"); code != 503 {
+		t.Errorf("POST /api/admin/pause without a tailer = %d, want 503", code)
+	}
+
+	ingest := &fakePauser{}
+	srv.SetPauser(ingest)
+	srv.SetFlusher(fakeFlusher{last: time.Now()})
+
+	if code, body := post("/api/admin/pause"); code != 200 || body["paused"] != true || !ingest.paused {
+		t.Errorf("POST /api/admin/pause = %d %v, want paused", code, body)
+	}
+	if h := srv.health(context.Background()); h.Status != "paused" || !h.Paused {
+		t.Errorf("health() while paused = %+v, want status paused", h)
+	}
+	if !srv.freshness(context.Background()).Paused {
+		t.Error("freshness() while paused doesn't report it")
+	}
+
+	if code, body := post("/api/admin/resume"); code != 200 || body["paused"] != false || ingest.paused {
+		t.Errorf("POST /api/admin/resume = %d %v, want resumed", code, body)
+	}
+	if h := srv.health(context.Background()); h.Status != "ok" || h.Paused {
+		t.Errorf("health() after resume = %+v, want ok", h)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	db := testDB(t)
+	srv := newTestServer(t, &config.Config{}, db)
+
+	if got := srv.freshness(context.Background()); !got.Stale || !got.AsOf.IsZero() {
+		t.Errorf("empty database: freshness = %+v, want stale with zero AsOf", got)
+	}
+
+	// An old hour bucket is as current as its end
+	old := time.Now().UTC().Truncate(time.Hour).Add(-48 * time.Hour)
+	seedRequests(t, db, requestRow{old.Format(time.RFC3339), "api", "/", "GET", 200, 1, 0, 0})
+	got := srv.freshness(context.Background())
+	if !got.Stale || !got.AsOf.Equal(old.Add(time.Hour)) {
+		t.Errorf("old data: freshness = %+v, want stale as of %v", got, old.Add(time.Hour))
+	}
+
+	// A recent flush wins over the hour bucket
+	flushed := time.Now().UTC().Add(-time.Minute)
+	srv.SetFlusher(fakeFlusher{last: flushed})
+	got = srv.freshness(context.Background())
+	if got.Stale || !got.AsOf.Equal(flushed) {
+		t.Errorf("recent flush: freshness = %+v, want fresh as of %v", got, flushed)
+	}
+
+	// Data in the current hour counts as current even before a flush is seen
+	srv.SetFlusher(fakeFlusher{})
+	seedRequests(t, db, requestRow{time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339), "api", "/", "GET", 200, 1, 0, 0})
+	if got := srv.freshness(context.Background()); got.Stale {
+		t.Errorf("current hour: freshness = %+v, want fresh", got)
+	}
+}
+
+func TestAdminFormat(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	combined := `10.0.0.1 - - [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	if err := os.WriteFile(logPath, []byte(strings.Repeat(combined, 3)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, &config.Config{LogFile: logPath, AuthUser: "admin", AuthPass: "secret"}, testDB(t))
+	resp, err := srv.app.Test(adminRequest("GET", "/api/admin/format", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 {
+		t.Errorf("without a parser: status %d, want 503", resp.StatusCode)
+	}
+
+	p := parser.NewParser("traefik")
+	srv.SetParser(p)
+
+	resp, err = srv.app.Test(adminRequest("GET", "/api/admin/format", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Current     string   `json:"current"`
+		Detected    string   `json:"detected"`
+		SampleLines int      `json:"sample_lines"`
+		Formats     []string `json:"formats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Current != "traefik" || got.Detected != "combined" || got.SampleLines != 3 {
+		t.Errorf("GET /api/admin/format = %+v, want traefik active, combined detected in 3 lines", got)
+	}
+	if len(got.Formats) == 0 || got.Formats[0] != "traefik" || got.Formats[len(got.Formats)-1] != "multi" {
+		t.Errorf("formats = %v, want the registered formats then multi", got.Formats)
+	}
+
+	switchTo := func(format string) int {
+		req := adminRequest("POST", "/api/admin/format", strings.NewReader("format="+format))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	if code := switchTo("combined"); code != 200 {
+		t.Fatalf("switch to combined: status %d", code)
+	}
+	if p.Format() != parser.FormatCombined {
+		t.Errorf("parser format = %v, want combined", p.Format())
+	}
+	if _, err := p.ParseLine(strings.TrimSpace(combined)); err != nil {
+		t.Errorf("switched parser rejects a combined line: %v", err)
+	}
+	for _, bad := range []string{"auto", "json", ""} {
+		if code := switchTo(bad); code != 400 {
+			t.Errorf("switch to %q: status %d, want 400", bad, code)
+		}
+	}
+}
+
+func TestDebugConfig(t *testing.T) {
+	srv := newTestServer(t, &config.Config{
+		LogFile:       "/logs/access.log",
+		RetentionDays: 30,
+		AuthUser:      "admin",
+		AuthPass:      "secret",
+		SessionSecret: "signing-key",
+	}, testDB(t))
+
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/api/debug/config", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 401 {
+		t.Errorf("without credentials: status %d, want 401", resp.StatusCode)
+	}
+
+	req := httptest.NewRequest("GET", "/api/debug/config", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, err = srv.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /api/debug/config = %d: %s", resp.StatusCode, body)
+	}
+	if strings.Contains(string(body), "secret") || strings.Contains(string(body), "signing-key") {
+		t.Errorf("GET /api/debug/config leaks a secret: %s", body)
+	}
+	var got config.Config
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.LogFile != "/logs/access.log" || got.RetentionDays != 30 || got.AuthUser != "admin" {
+		t.Errorf("GET /api/debug/config = %+v, want the loaded settings", got)
+	}
+}
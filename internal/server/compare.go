@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// compareTopPaths is how many top paths are taken from each period; the
+// union is then counted in both
+const compareTopPaths = 20
+
+// ComparePeriod describes one side of an arbitrary period comparison
+type ComparePeriod struct {
+	From   string // YYYY-MM-DD, inclusive
+	To     string // YYYY-MM-DD, inclusive
+	Stats  *TotalStat
+	Filter Filter
+}
+
+// CountDelta pairs a label's count in period A and period B with the change from B to A
+type CountDelta struct {
+	Label string
+	A     int64
+	B     int64
+	Delta float64
+}
+
+// CompareData represents the data for the compare template
+type CompareData struct {
+	A           ComparePeriod
+	B           ComparePeriod
+	Comparison  *ComparisonStat // A relative to B
+	Paths       []CountDelta
+	Statuses    []CountDelta
+	Router      string
+	IncludeBots bool
+	Routers     []string
+	Error       string
+	Page        string
+	Freshness   Freshness
+}
+
+// dayRangeFilter builds a Filter covering whole days from..to inclusive
+func dayRangeFilter(from, to time.Time, router string, includeBots bool) Filter {
+	return Filter{
+		From:        from.Format(time.RFC3339),
+		To:          to.Add(23*time.Hour + 59*time.Minute).Format(time.RFC3339),
+		Router:      router,
+		IncludeBots: includeBots,
+	}
+}
+
+// parsePeriod validates a YYYY-MM-DD from/to pair and returns its filter.
+// Unlike the dashboard's custom range, from may equal to (a single day).
+func parsePeriod(from, to, router string, includeBots bool) (Filter, error) {
+	fromTime, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid start date %q", from)
+	}
+	toTime, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return Filter{}, fmt.Errorf("invalid end date %q", to)
+	}
+	if toTime.Before(fromTime) {
+		return Filter{}, fmt.Errorf("end date %s is before start date %s", to, from)
+	}
+	if toTime.Sub(fromTime) > 365*24*time.Hour {
+		return Filter{}, fmt.Errorf("period %s to %s is longer than 365 days", from, to)
+	}
+	return dayRangeFilter(fromTime, toTime, router, includeBots), nil
+}
+
+// mergeCountDeltas joins two label/count lists into one row per label,
+// ordered by the larger of the two counts so top entries of either side lead.
+func mergeCountDeltas(a, b map[string]int64) []CountDelta {
+	seen := make(map[string]bool, len(a)+len(b))
+	var rows []CountDelta
+	for _, m := range []map[string]int64{a, b} {
+		for label := range m {
+			if seen[label] {
+				continue
+			}
+			seen[label] = true
+			rows = append(rows, CountDelta{
+				Label: label,
+				A:     a[label],
+				B:     b[label],
+				Delta: pctChange(a[label], b[label]),
+			})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		mi, mj := max(rows[i].A, rows[i].B), max(rows[j].A, rows[j].B)
+		if mi != mj {
+			return mi > mj
+		}
+		return rows[i].Label < rows[j].Label
+	})
+	return rows
+}
+
+// comparePaths takes the top limit paths of each period and counts every
+// one of them in both, so a path just outside one period's top list still
+// shows its real count there instead of 0
+func (s *Server) comparePaths(ctx context.Context, a, b Filter, limit int) ([]CountDelta, error) {
+	var paths []string
+	for _, f := range []Filter{a, b} {
+		top, err := s.queries.TopPaths(ctx, f, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch top paths: %w", err)
+		}
+		for _, ps := range top {
+			if !slices.Contains(paths, ps.Path) {
+				paths = append(paths, ps.Path)
+			}
+		}
+	}
+
+	countsA, countsB, err := s.queries.PathCountsInPeriods(ctx, a, b, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count top paths: %w", err)
+	}
+	return mergeCountDeltas(countsA, countsB), nil
+}
+
+// handleCompare serves the side-by-side comparison of two arbitrary periods.
+// Defaults to the last 7 days (A) against the 7 days before that (B).
+func (s *Server) handleCompare(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	data, err := s.getCompareData(c)
+	if err != nil {
+		log.Printf("Error loading compare data: %v", err)
+		return c.Status(500).SendString("Error loading comparison data")
+	}
+
+	data.Freshness = s.freshness(ctx)
+
+	var buf bytes.Buffer
+	if err := s.compareTmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// getCompareData fetches the core stats for both periods of a comparison
+func (s *Server) getCompareData(c *fiber.Ctx) (*CompareData, error) {
+	ctx := c.UserContext()
+	router := c.Query("router", "")
+	includeBots := c.Query("bots", "false") == "true"
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	data := &CompareData{
+		A: ComparePeriod{
+			From: c.Query("a_from", today.AddDate(0, 0, -6).Format("2006-01-02")),
+			To:   c.Query("a_to", today.Format("2006-01-02")),
+		},
+		B: ComparePeriod{
+			From: c.Query("b_from", today.AddDate(0, 0, -13).Format("2006-01-02")),
+			To:   c.Query("b_to", today.AddDate(0, 0, -7).Format("2006-01-02")),
+		},
+		Router:      router,
+		IncludeBots: includeBots,
+		Page:        "compare",
+	}
+
+	routers, err := s.routerOptions(ctx, router)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch routers: %w", err)
+	}
+	data.Routers = routers
+
+	for _, p := range []*ComparePeriod{&data.A, &data.B} {
+		f, err := parsePeriod(p.From, p.To, router, includeBots)
+		if err != nil {
+			// Bad input is shown on the page rather than failing the request
+			data.Error = err.Error()
+			return data, nil
+		}
+		p.Filter = s.scopeFilter(ctx, f)
+	}
+
+	statusCounts := make([]map[string]int64, 2)
+	for i, p := range []*ComparePeriod{&data.A, &data.B} {
+		stats, err := s.queries.TotalStats(ctx, p.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch total stats: %w", err)
+		}
+		p.Stats = stats
+
+		statuses, err := s.queries.StatusBreakdown(ctx, p.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch status breakdown: %w", err)
+		}
+		statusCounts[i] = make(map[string]int64, len(statuses))
+		for _, st := range statuses {
+			statusCounts[i][st.Class] = st.Count
+		}
+	}
+
+	data.Comparison = computeComparison(data.A.Stats, data.B.Stats)
+	if data.Paths, err = s.comparePaths(ctx, data.A.Filter, data.B.Filter, compareTopPaths); err != nil {
+		return nil, err
+	}
+	data.Statuses = mergeCountDeltas(statusCounts[0], statusCounts[1])
+	sort.Slice(data.Statuses, func(i, j int) bool { return data.Statuses[i].Label < data.Statuses[j].Label })
+
+	return data, nil
+}
+
+// RouterSide is one router's key metrics in a router comparison
+type RouterSide struct {
+	Router      string
+	Stats       *TotalStat
+	ClientPct   float64 // 4xx share of requests
+	ErrorPct    float64 // 5xx share of requests
+	Percentiles *PercentileResult
+	NoDuration  bool // traffic but no recorded durations, see Queries.HasDurations
+}
+
+// RouterCompareData represents the data for the compare_routers template
+type RouterCompareData struct {
+	A           RouterSide
+	B           RouterSide
+	Range       string
+	IncludeBots bool
+	Routers     []string // every router, for both pickers
+	Error       string
+	Page        string
+	Freshness   Freshness
+}
+
+// statusClassPct returns the share (%) of class in a StatusBreakdown result
+func statusClassPct(statuses []StatusStat, class string) float64 {
+	for _, st := range statuses {
+		if st.Class == class {
+			return st.Pct
+		}
+	}
+	return 0
+}
+
+// handleCompareRouters serves two routers' key metrics side by side over
+// the same dashboard range
+func (s *Server) handleCompareRouters(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	data, err := s.getRouterCompareData(c)
+	if err != nil {
+		log.Printf("Error loading router compare data: %v", err)
+		return c.Status(500).SendString("Error loading comparison data")
+	}
+
+	data.Freshness = s.freshness(ctx)
+
+	var buf bytes.Buffer
+	if err := s.routerCompareTmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// getRouterCompareData fetches the stats for both routers of a comparison.
+// Both must be known routers; until two are picked only the form is shown.
+func (s *Server) getRouterCompareData(c *fiber.Ctx) (*RouterCompareData, error) {
+	ctx := c.UserContext()
+	includeBots := c.Query("bots", "false") == "true"
+	data := &RouterCompareData{
+		A:           RouterSide{Router: c.Query("a", "")},
+		B:           RouterSide{Router: c.Query("b", "")},
+		IncludeBots: includeBots,
+		Page:        "compare",
+	}
+
+	routers, err := s.queries.Routers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch routers: %w", err)
+	}
+	data.Routers = routers
+
+	if data.A.Router == "" || data.B.Router == "" {
+		_, data.Range = s.buildFilterWithCustom(c, "", includeBots)
+		return data, nil
+	}
+	for _, r := range []string{data.A.Router, data.B.Router} {
+		if !slices.Contains(routers, r) {
+			// Bad input is shown on the page rather than failing the request
+			data.Error = fmt.Sprintf("unknown service %q", r)
+			_, data.Range = s.buildFilterWithCustom(c, "", includeBots)
+			return data, nil
+		}
+	}
+
+	for _, side := range []*RouterSide{&data.A, &data.B} {
+		var f Filter
+		f, data.Range = s.buildFilterWithCustom(c, side.Router, includeBots)
+
+		stats, err := s.queries.TotalStats(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch total stats: %w", err)
+		}
+		side.Stats = stats
+
+		statuses, err := s.queries.StatusBreakdown(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch status breakdown: %w", err)
+		}
+		side.ClientPct = statusClassPct(statuses, "4xx")
+		side.ErrorPct = statusClassPct(statuses, "5xx")
+
+		side.Percentiles, err = s.queries.DurationPercentiles(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch duration percentiles: %w", err)
+		}
+		hasDurations, err := s.queries.HasDurations(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check durations: %w", err)
+		}
+		side.NoDuration = !hasDurations && stats.Requests > 0
+	}
+
+	return data, nil
+}
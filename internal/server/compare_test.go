@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{
+			name:     "single day",
+			from:     "2026-02-09",
+			to:       "2026-02-09",
+			wantFrom: "2026-02-09T00:00:00Z",
+			wantTo:   "2026-02-09T23:59:00Z",
+		},
+		{
+			name:     "launch week",
+			from:     "2026-02-02",
+			to:       "2026-02-08",
+			wantFrom: "2026-02-02T00:00:00Z",
+			wantTo:   "2026-02-08T23:59:00Z",
+		},
+		{name: "end before start", from: "2026-02-08", to: "2026-02-01", wantErr: true},
+		{name: "bad start", from: "yesterday", to: "2026-02-01", wantErr: true},
+		{name: "bad end", from: "2026-02-01", to: "", wantErr: true},
+		{name: "longer than a year", from: "2024-01-01", to: "2026-01-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePeriod(tt.from, tt.to, "web", true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePeriod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.From != tt.wantFrom || got.To != tt.wantTo {
+				t.Errorf("parsePeriod() = %s..%s, want %s..%s", got.From, got.To, tt.wantFrom, tt.wantTo)
+			}
+			if got.Router != "web" || !got.IncludeBots {
+				t.Errorf("parsePeriod() dropped router/bots: %+v", got)
+			}
+		})
+	}
+}
+
+func TestMergeCountDeltas(t *testing.T) {
+	a := map[string]int64{"/": 100, "/new": 40, "/shared": 10}
+	b := map[string]int64{"/": 50, "/gone": 70, "/shared": 10}
+
+	got := mergeCountDeltas(a, b)
+
+	want := []CountDelta{
+		{Label: "/", A: 100, B: 50, Delta: 100},
+		{Label: "/gone", A: 0, B: 70, Delta: -100},
+		{Label: "/new", A: 40, B: 0, Delta: 100},
+		{Label: "/shared", A: 10, B: 10, Delta: 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("mergeCountDeltas() returned %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMergeCountDeltasEmpty(t *testing.T) {
+	if got := mergeCountDeltas(nil, nil); len(got) != 0 {
+		t.Errorf("mergeCountDeltas(nil, nil) = %+v, want empty", got)
+	}
+}
+
+func TestComparePaths(t *testing.T) {
+	db := testDB(t)
+	seedRequests(t, db,
+		requestRow{"2026-02-02T10:00:00Z", "web", "/x", "GET", 200, 10, 0, 0},
+		requestRow{"2026-02-02T10:00:00Z", "web", "/y", "GET", 200, 5, 0, 0},
+		requestRow{"2026-02-09T10:00:00Z", "web", "/x", "GET", 200, 6, 0, 0},
+		requestRow{"2026-02-09T10:00:00Z", "web", "/y", "GET", 200, 8, 0, 0},
+		requestRow{"2026-02-09T10:00:00Z", "web", "/z", "GET", 200, 1, 0, 0},
+	)
+	srv := newTestServer(t, &config.Config{}, db)
+
+	a, _ := parsePeriod("2026-02-09", "2026-02-09", "", false)
+	b, _ := parsePeriod("2026-02-02", "2026-02-02", "", false)
+
+	// Each period's top 1 is only in the other's second place, yet both
+	// sides get real counts; /z is in neither top list
+	got, err := srv.comparePaths(context.Background(), a, b, 1)
+	if err != nil {
+		t.Fatalf("comparePaths() error = %v", err)
+	}
+	want := []CountDelta{
+		{Label: "/x", A: 6, B: 10, Delta: -40},
+		{Label: "/y", A: 8, B: 5, Delta: 60},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("comparePaths() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompareRouters(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().UTC().Truncate(time.Hour).Format("2006-01-02T15:00:00Z")
+	seedRequests(t, db,
+		requestRow{hour, "web", "/", "GET", 200, 95, 0, 0},
+		requestRow{hour, "web", "/boom", "GET", 500, 5, 0, 0},
+		requestRow{hour, "api", "/v1", "GET", 200, 40, 0, 0},
+	)
+	srv := newTestServer(t, &config.Config{}, db)
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := srv.app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s: status %d: %s", url, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	body := get("/compare/routers?a=web&b=api&range=today")
+	for _, want := range []string{"web vs api", "5.0%", "100", "40"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("comparison page missing %q", want)
+		}
+	}
+
+	body = get("/compare/routers?a=web&b=nope&range=today")
+	if !strings.Contains(body, "unknown service") {
+		t.Error("unknown router should be reported on the page")
+	}
+
+	if body = get("/compare/routers"); !strings.Contains(body, "Pick two services") {
+		t.Error("page without routers should prompt for a choice")
+	}
+}
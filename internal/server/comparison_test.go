@@ -185,6 +185,32 @@ func TestComputeComparison(t *testing.T) {
 	})
 }
 
+func TestComputeEngagement(t *testing.T) {
+	current := &TotalStat{Requests: 300, Visitors: 50}
+	previous := &TotalStat{Requests: 200, Visitors: 40}
+	e := computeEngagement(current, previous, 60)
+
+	if math.Abs(e.RequestsPerVisitor-6.0) > 0.01 {
+		t.Errorf("RequestsPerVisitor = %.2f, want 6.0", e.RequestsPerVisitor)
+	}
+	if math.Abs(e.RequestsPerVisit-5.0) > 0.01 {
+		t.Errorf("RequestsPerVisit = %.2f, want 5.0", e.RequestsPerVisit)
+	}
+	// 5.0 per visitor before, 6.0 now
+	if !e.HasDelta || math.Abs(e.PerVisitorDelta-20.0) > 0.01 {
+		t.Errorf("PerVisitorDelta = %.2f (has %v), want 20.0", e.PerVisitorDelta, e.HasDelta)
+	}
+
+	// Zero denominators leave the ratios at 0 instead of dividing by zero
+	e = computeEngagement(&TotalStat{Requests: 10}, &TotalStat{Requests: 5}, 0)
+	if e.RequestsPerVisitor != 0 || e.RequestsPerVisit != 0 || e.HasDelta {
+		t.Errorf("no visitors = %+v, want zero ratios and no delta", e)
+	}
+	if computeEngagement(nil, previous, 1) != nil {
+		t.Error("computeEngagement(nil) should be nil")
+	}
+}
+
 func TestFormatDelta(t *testing.T) {
 	tests := []struct {
 		name     string
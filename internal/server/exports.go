@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxExportRows caps the rows of a CSV/JSON download
+const maxExportRows = 1000
+
+// pathExportRow is one path in a paths export
+type pathExportRow struct {
+	Path     string  `json:"path"`
+	Requests int64   `json:"requests"`
+	Pct      float64 `json:"pct"`
+	Bytes    int64   `json:"bytes"`
+	AvgMs    int64   `json:"avg_ms"`
+}
+
+// handleExportPaths downloads the top paths as CSV (default) or JSON with
+// ?format=json. It honors the same range, router, bots and custom_* params
+// as the dashboard via requestFilter, so the file matches the page.
+func (s *Server) handleExportPaths(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "json" {
+		return c.Status(400).SendString("format must be csv or json")
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > maxExportRows {
+		limit = maxExportRows
+	}
+
+	filter, rangeParam := s.requestFilter(c)
+	paths, err := s.queries.TopPaths(ctx, filter, limit)
+	if err != nil {
+		log.Printf("Error exporting paths: %v", err)
+		return c.Status(500).SendString("Error loading paths")
+	}
+
+	rows := make([]pathExportRow, 0, len(paths))
+	for _, p := range paths {
+		rows = append(rows, pathExportRow{Path: p.Path, Requests: p.Count, Pct: p.Pct, Bytes: p.Bytes, AvgMs: p.AvgMs})
+	}
+
+	filename := fmt.Sprintf("trail-paths-%s.%s", rangeParam, format)
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "json" {
+		return c.JSON(rows)
+	}
+
+	c.Set("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c)
+	w.Write([]string{"path", "requests", "pct", "bytes", "avg_ms"})
+	for _, r := range rows {
+		w.Write([]string{
+			r.Path,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatFloat(r.Pct, 'f', 2, 64),
+			strconv.FormatInt(r.Bytes, 10),
+			strconv.FormatInt(r.AvgMs, 10),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestExportPathsMatchesPage(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339)
+	seedRequests(t, db,
+		requestRow{hour, "web", "/home", "GET", 200, 10, 1000, 100},
+		requestRow{hour, "api", "/api-only", "GET", 200, 5, 500, 50},
+		requestRow{hour, "unrouted", "/wp-login.php", "GET", 404, 7, 0, 5},
+	)
+	srv := newTestServer(t, &config.Config{Listen: ":0"}, db)
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := srv.app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s: status %d: %s", url, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	for _, qs := range []string{"", "bots=true", "router=api", "router=web&bots=true", "range=7d&bots=true"} {
+		t.Run(qs, func(t *testing.T) {
+			page := get("/api/overview?tab=traffic&" + qs)
+
+			var rows []pathExportRow
+			if err := json.Unmarshal([]byte(get("/api/export/paths?format=json&"+qs)), &rows); err != nil {
+				t.Fatalf("decode JSON export: %v", err)
+			}
+			exported := map[string]bool{}
+			for _, r := range rows {
+				exported[r.Path] = true
+			}
+
+			records, err := csv.NewReader(strings.NewReader(get("/api/export/paths?" + qs))).ReadAll()
+			if err != nil {
+				t.Fatalf("read CSV export: %v", err)
+			}
+			if len(records) != len(rows)+1 {
+				t.Errorf("CSV has %d rows, JSON %d", len(records)-1, len(rows))
+			}
+
+			if qs == "" && (!exported["/home"] || exported["/wp-login.php"]) {
+				t.Errorf("default export = %v, want human paths without unrouted", exported)
+			}
+			for _, path := range []string{"/home", "/api-only", "/wp-login.php"} {
+				onPage := strings.Contains(page, "<td>"+path+"</td>")
+				if onPage != exported[path] {
+					t.Errorf("%s: on page = %v, in export = %v", path, onPage, exported[path])
+				}
+			}
+		})
+	}
+
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/api/export/paths?format=xml", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Errorf("format=xml status = %d, want 400", resp.StatusCode)
+	}
+}
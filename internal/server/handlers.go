@@ -2,11 +2,15 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/open-wander/trail/internal/aggregator"
 )
 
 // DonutSegment represents one segment of a donut chart
@@ -40,6 +44,64 @@ func computeDonutPositions(segments []DonutSegment) {
 	}
 }
 
+// rotateHours reorders an hour-of-day distribution (sorted 0-23, possibly
+// with gaps) so it starts at hour start and wraps around midnight
+func rotateHours(stats []HourOfDayStat, start int) {
+	if start == 0 {
+		return
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return (stats[i].Hour-start+24)%24 < (stats[j].Hour-start+24)%24
+	})
+}
+
+// maxGapAnnotations caps the possible outages listed under the requests chart
+const maxGapAnnotations = 5
+
+// SlashRedirectSummary counts the resolved trailing-slash redirects folded
+// out of the redirects panel
+type SlashRedirectSummary struct {
+	Paths    int   // redirecting paths folded
+	Requests int64 // their 3xx responses
+}
+
+// mergeSlashRedirects drops the chains that only add or remove a trailing
+// slash and land on a 2xx page, counting them instead, so the panel keeps
+// the redirects worth a look: unresolved ones and loops
+func mergeSlashRedirects(chains []RedirectChain) ([]RedirectChain, SlashRedirectSummary) {
+	var kept []RedirectChain
+	var merged SlashRedirectSummary
+	for _, rc := range chains {
+		if rc.Resolved() {
+			merged.Paths++
+			merged.Requests += rc.Redirects
+			continue
+		}
+		kept = append(kept, rc)
+	}
+	return kept, merged
+}
+
+// markPartial flags the newest point when its hour or day is still in
+// progress at now and less than minPct percent of it has passed, so charts
+// draw it faded instead of as a drop in traffic. minPct 0 disables it.
+func markPartial(points []TimeSeriesPoint, now time.Time, minPct int) {
+	if len(points) == 0 || minPct <= 0 {
+		return
+	}
+	last := &points[len(points)-1]
+	start, err := time.Parse(time.RFC3339, last.Label)
+	width := time.Hour
+	if err != nil {
+		if start, err = time.Parse("2006-01-02", last.Label); err != nil {
+			return
+		}
+		width = 24 * time.Hour
+	}
+	elapsed := now.Sub(start)
+	last.Partial = elapsed >= 0 && elapsed < width && elapsed*100 < width*time.Duration(minPct)
+}
+
 // ComparisonStat holds current vs previous period stats with precomputed deltas
 type ComparisonStat struct {
 	Current       *TotalStat
@@ -50,6 +112,25 @@ type ComparisonStat struct {
 	AvgMsDelta    float64
 }
 
+// successRates returns the success rate of filter and its change in
+// percentage points from prevFilter; ok is false without previous traffic.
+// Failures are logged and leave the rates at zero.
+func (s *Server) successRates(ctx context.Context, filter, prevFilter Filter, prevStats *TotalStat) (rate, delta float64, ok bool) {
+	rate, err := s.queries.SuccessRate(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch success rate: %v", err)
+	}
+	if prevStats == nil || prevStats.Requests == 0 {
+		return rate, 0, false
+	}
+	prevRate, err := s.queries.SuccessRate(ctx, prevFilter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch previous success rate: %v", err)
+		return rate, 0, false
+	}
+	return rate, rate - prevRate, true
+}
+
 // computeComparison calculates percentage change between current and previous stats
 func computeComparison(current, previous *TotalStat) *ComparisonStat {
 	c := &ComparisonStat{
@@ -66,6 +147,36 @@ func computeComparison(current, previous *TotalStat) *ComparisonStat {
 	return c
 }
 
+// EngagementStat holds the summary's requests per visitor and per visit,
+// both from human traffic only
+type EngagementStat struct {
+	RequestsPerVisitor float64
+	RequestsPerVisit   float64
+	PerVisitorDelta    float64 // % change of RequestsPerVisitor from the previous period
+	HasDelta           bool    // previous period had visitors to compare against
+}
+
+// computeEngagement derives the engagement ratios from human totals and
+// visits; a ratio whose denominator is zero stays 0
+func computeEngagement(current, previous *TotalStat, visits int64) *EngagementStat {
+	if current == nil {
+		return nil
+	}
+	e := &EngagementStat{}
+	if current.Visitors > 0 {
+		e.RequestsPerVisitor = float64(current.Requests) / float64(current.Visitors)
+	}
+	if visits > 0 {
+		e.RequestsPerVisit = float64(current.Requests) / float64(visits)
+	}
+	if previous != nil && previous.Visitors > 0 && previous.Requests > 0 {
+		prevRatio := float64(previous.Requests) / float64(previous.Visitors)
+		e.PerVisitorDelta = (e.RequestsPerVisitor - prevRatio) / prevRatio * 100
+		e.HasDelta = true
+	}
+	return e
+}
+
 // pctChange returns the percentage change from old to new value.
 // Returns 0 when old is 0 to avoid division by zero.
 func pctChange(newVal, oldVal int64) float64 {
@@ -93,42 +204,60 @@ func previousPeriodFilter(f Filter, rangeParam string) Filter {
 	prevFrom := prevTo.Add(-duration)
 
 	return Filter{
-		From:        prevFrom.Format(time.RFC3339),
-		To:          prevTo.Format(time.RFC3339),
-		Router:      f.Router,
-		IncludeBots: f.IncludeBots,
+		From:            prevFrom.Format(time.RFC3339),
+		To:              prevTo.Format(time.RFC3339),
+		Router:          f.Router,
+		Routers:         f.Routers,
+		Host:            f.Host,
+		IncludeBots:     f.IncludeBots,
+		IncludeUnrouted: f.IncludeUnrouted,
 	}
 }
 
 // OverviewData represents the data for the overview template
 type OverviewData struct {
-	Stats         *TotalStat
-	RequestsChart []TimeSeriesPoint
-	VisitorsChart []TimeSeriesPoint
-	TopPaths      []PathStat
-	StatusCodes   []StatusStat
-	TopReferrers  []ReferrerStat
-	NotFoundPaths []PathStat
-	UserAgents    []UserAgentStat
-	Methods       []MethodStat
-	StatusDetails []SpecificStatusStat
-	HourOfDay     []HourOfDayStat
-	MaxRequests   int64
-	MaxVisitors   int64
-	MaxStatus     int64
-	MaxNotFound   int64
-	MaxUserAgent  int64
-	MaxMethod     int64
-	MaxStatusDet  int64
-	MaxHourOfDay  int64
-	MaxReferrer   int64
-	Range         string
-	CustomFrom    string
-	CustomTo      string
-	Router        string
-	IncludeBots   bool
-	Routers       []string
-	Page          string
+	Stats          *TotalStat
+	RequestsChart  []TimeSeriesPoint
+	VisitorsChart  []TimeSeriesPoint
+	TrafficGaps    []Gap // possible outages noted under the requests chart, longest first
+	TopPaths       []PathStat
+	StatusCodes    []StatusStat
+	TopReferrers   []ReferrerStat
+	Goal           *GoalAttributionStat // nil unless TRAIL_GOAL_PATH is set
+	Hosts          []HostStat           // empty when the log format has no host field
+	CacheStatus    []CacheStatusStat    // empty when the log format has no cache status field
+	NotFoundPaths  []PathStat
+	BrokenLinks    []BrokenLinkCandidate // 404s with a working variant
+	Redirects      []RedirectChain       // busiest 3xx paths, minus SlashRedirects when merged
+	SlashRedirects SlashRedirectSummary
+	UserAgents     []UserAgentStat
+	RawUserAgents  []RawUserAgentStat // empty unless TRAIL_RAW_USER_AGENTS is on
+	Methods        []MethodStat
+	StatusDetails  []SpecificStatusStat
+	HourOfDay      []HourOfDayStat
+	MaxRequests    int64
+	MaxVisitors    int64
+	MaxStatus      int64
+	MaxNotFound    int64
+	MaxUserAgent   int64
+	MaxMethod      int64
+	MaxStatusDet   int64
+	MaxHourOfDay   int64
+	MaxReferrer    int64
+	MaxHost        int64
+	MaxCache       int64
+	Range          string
+	CustomFrom     string
+	CustomTo       string
+	MinDate        string // earliest day with data (YYYY-MM-DD), bounds the custom date inputs
+	MaxDate        string // latest day with data (YYYY-MM-DD)
+	Router         string
+	Host           string // requested host filter, "" for all
+	IncludeBots    bool
+	Routers        []string
+	HostOptions    []string // host selector entries; empty hides it
+	Page           string
+	Freshness      Freshness // set for full page loads only
 	// Donut chart data
 	StatusDonut    []DonutSegment
 	MethodDonut    []DonutSegment
@@ -145,7 +274,11 @@ type OverviewData struct {
 	DurationHist      []DurationBucketStat
 	Percentiles       *PercentileResult
 	BandwidthChart    []TimeSeriesPoint
+	SizeHistChart     []SizeHistPoint
+	SizeBuckets       []string
 	ResponseTimeChart []TimeSeriesPoint
+	UpstreamTimes     []UpstreamStat // only routers whose log lines carry an upstream time
+	NoDuration        bool           // traffic but no recorded durations; latency panels show "not available"
 	MobilePct         float64
 	DesktopPct        float64
 	GeoIPEnabled      bool
@@ -157,6 +290,25 @@ type OverviewData struct {
 	MaxResponseTime   int64
 	ActiveTab         string
 	Comparison        *ComparisonStat
+	SuccessRate       float64          // % of requests below the success cutoff, see Queries.SuccessRate
+	SuccessDelta      float64          // change from the previous period, in percentage points
+	HasSuccessDelta   bool             // previous period had traffic to compare against
+	Visits            int64            // approximate visits, see Queries.Visits
+	Engagement        *EngagementStat  // requests per visitor and per visit
+	TopDecileShare    float64          // % of requests to the busiest 10% of paths, see Queries.PathConcentration
+	PathGini          float64          // Gini coefficient of per-path requests
+	ParamValues       []ParamBreakdown // one per TRAIL_CAPTURE_PARAMS entry
+	CapturesParams    bool             // TRAIL_CAPTURE_PARAMS is set
+	StoresRaw         bool             // TRAIL_STORE_RAW is set: show the recent requests panel
+	TopParams         []QueryParamStat // most frequent captured params
+	MaxParamCount     int64
+}
+
+// ParamBreakdown holds the top values of one captured query-string param
+type ParamBreakdown struct {
+	Param  string
+	Values []ParamValueStat
+	Max    int64
 }
 
 // SecurityData represents the data for the security template
@@ -167,6 +319,8 @@ type SecurityData struct {
 	Total5xx       int64
 	SlowestAvgMs   int64
 	ThreatPatterns []ThreatPatternStat
+	UnusualMethods []MethodStat // methods outside the known set, often scanners
+	MaxUnusual     int64
 	BotBreakdown   []UserAgentStat
 	HumanCount     int64
 	BotCount       int64
@@ -175,22 +329,60 @@ type SecurityData struct {
 	ErrorTrends    []TimeSeriesPoint
 	MaxErrorCount  int64
 	ErrorPaths     []PathStat
+	ErrorRatePaths []ErrorRatePathStat
+	ErrorRequests  []ErrorRequestID // recent 5xx request IDs, see TRAIL_REQUEST_IDS
 	SlowestPaths   []PathStat
+	KnownThreats   *KnownThreatStat           // nil unless TRAIL_THREAT_IPS_FILE is set
+	RateLimits     *RateLimitStat             // nil without 429 responses
+	Scanners       []ScannerBreadthStat       // empty unless TRAIL_SCANNER_PATHS is set
+	Stuffing       []CredentialStuffingSignal // empty unless TRAIL_AUTH_PATHS is set
+	BotOnlyPaths   []BotOnlyPathStat
+	MaxBotOnly     int64
+	FakeCrawlers   int64 // unrouted requests with a search engine crawler's User-Agent
+	NoDuration     bool  // traffic but no recorded durations, see Queries.HasDurations
 	Range          string
 	CustomFrom     string
 	CustomTo       string
+	MinDate        string
+	MaxDate        string
 	Page           string
+	Freshness      Freshness // set for full page loads only
 	ActiveTab      string
+	Score          int      // 0-100, see SecurityScore
+	ScoreLevel     string   // "good", "warn" or "bad"
+	ScoreFactors   []string // what lowered the score
+}
+
+// RateLimitStat summarizes 429 (Too Many Requests) responses for the
+// security page
+type RateLimitStat struct {
+	Total    int64
+	OverTime []TimeSeriesPoint
+	MaxCount int64
+	Paths    []StatusCodePathStat
+	IPs      []RateLimitedIPStat // empty unless TRAIL_RATE_LIMIT_IPS is set
 }
 
-// handleOverview serves the main dashboard overview page
+// handleOverview serves the main dashboard overview page. Clients that
+// prefer JSON get the /healthz status instead (see TRAIL_ROOT_JSON), sparing
+// probes the dashboard queries.
 func (s *Server) handleOverview(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	if s.config.RootJSON != "html" && wantsJSON(c) {
+		if s.config.RootJSON == "redirect" {
+			return c.Redirect("/healthz")
+		}
+		return c.JSON(s.health(ctx))
+	}
+
 	data, err := s.getOverviewData(c)
 	if err != nil {
 		log.Printf("Error loading overview data: %v", err)
 		return c.Status(500).SendString("Error loading dashboard data")
 	}
 
+	data.Freshness = s.freshness(ctx)
+
 	var buf bytes.Buffer
 	if err := s.overviewTmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
 		log.Printf("Error rendering template: %v", err)
@@ -203,12 +395,15 @@ func (s *Server) handleOverview(c *fiber.Ctx) error {
 
 // handleSecurity serves the security dashboard page
 func (s *Server) handleSecurity(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	data, err := s.getSecurityData(c)
 	if err != nil {
 		log.Printf("Error loading security data: %v", err)
 		return c.Status(500).SendString("Error loading security data")
 	}
 
+	data.Freshness = s.freshness(ctx)
+
 	var buf bytes.Buffer
 	if err := s.securityTmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
 		log.Printf("Error rendering template: %v", err)
@@ -260,6 +455,8 @@ func (s *Server) handleAPIFilters(c *fiber.Ctx) error {
 
 // getOverviewData fetches and prepares data for the overview page
 func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
+	ctx := c.UserContext()
+
 	// Parse query parameters
 	router := c.Query("router", "")
 	includeBots := c.Query("bots", "false") == "true"
@@ -269,14 +466,15 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 	}
 
 	// Calculate time filter based on range (supports custom dates)
-	filter, rangeParam := s.buildFilterWithCustom(c, router, includeBots)
+	filter, rangeParam := s.requestFilter(c)
 	customFrom := c.Query("custom_from", "")
 	customTo := c.Query("custom_to", "")
+	minDate, maxDate := s.dateBounds(ctx)
 	log.Printf("Overview query: range=%s router=%q bots=%v from=%s to=%s",
 		rangeParam, router, includeBots, filter.From, filter.To)
 
 	// Fetch all required data
-	stats, err := s.queries.TotalStats(filter)
+	stats, err := s.queries.TotalStats(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch total stats: %w", err)
 	}
@@ -284,77 +482,157 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 
 	// Compute previous period comparison
 	prevFilter := previousPeriodFilter(filter, rangeParam)
-	prevStats, err := s.queries.TotalStats(prevFilter)
+	prevStats, err := s.queries.TotalStats(ctx, prevFilter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch previous period stats: %v", err)
 		prevStats = nil
 	}
 	comparison := computeComparison(stats, prevStats)
 
+	successRate, successDelta, hasSuccessDelta := s.successRates(ctx, filter, prevFilter, prevStats)
+
+	visits, err := s.queries.Visits(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch visits: %v", err)
+	}
+
+	// Engagement ratios leave bots out even when they're shown
+	humanStats, prevHumanStats, humanVisits := stats, prevStats, visits
+	if filter.IncludeBots {
+		humanFilter, prevHumanFilter := filter, prevFilter
+		humanFilter.IncludeBots, prevHumanFilter.IncludeBots = false, false
+		if humanStats, err = s.queries.TotalStats(ctx, humanFilter); err != nil {
+			log.Printf("Warning: failed to fetch human total stats: %v", err)
+		}
+		if prevHumanStats, err = s.queries.TotalStats(ctx, prevHumanFilter); err != nil {
+			log.Printf("Warning: failed to fetch previous human total stats: %v", err)
+		}
+		if humanVisits, err = s.queries.Visits(ctx, humanFilter); err != nil {
+			log.Printf("Warning: failed to fetch human visits: %v", err)
+		}
+	}
+	engagement := computeEngagement(humanStats, prevHumanStats, humanVisits)
+
+	topDecileShare, pathGini, err := s.queries.PathConcentration(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch path concentration: %v", err)
+	}
+
 	// Use daily rollup for multi-day ranges, hourly for today
 	useDaily := rangeParam == "7d" || rangeParam == "30d" || rangeParam == "custom"
 	var requestsChart, visitorsChart []TimeSeriesPoint
 	if useDaily {
-		requestsChart, err = s.queries.DailyRequestsOverTime(filter)
+		requestsChart, err = s.queries.DailyRequestsOverTime(ctx, filter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch daily requests: %w", err)
 		}
-		visitorsChart, err = s.queries.DailyVisitors(filter)
+		visitorsChart, err = s.queries.DailyVisitors(ctx, filter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch daily visitors: %w", err)
 		}
 	} else {
-		requestsChart, err = s.queries.RequestsOverTime(filter)
+		requestsChart, err = s.queries.RequestsOverTime(ctx, filter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch requests over time: %w", err)
 		}
-		visitorsChart, err = s.queries.UniqueVisitors(filter)
+		visitorsChart, err = s.queries.UniqueVisitors(ctx, filter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch visitors over time: %w", err)
 		}
 	}
 
-	topPaths, err := s.queries.TopPaths(filter, 10)
+	now := time.Now()
+	markPartial(requestsChart, now, s.config.MinBucketCompletePct)
+	markPartial(visitorsChart, now, s.config.MinBucketCompletePct)
+
+	var trafficGaps []Gap
+	if s.config.OutageMinHours > 0 {
+		if trafficGaps, err = s.queries.TrafficGaps(ctx, filter, s.config.OutageMinHours); err != nil {
+			log.Printf("Warning: failed to fetch traffic gaps: %v", err)
+		}
+		trafficGaps = trafficGaps[:min(len(trafficGaps), maxGapAnnotations)]
+	}
+
+	topPaths, err := s.queries.TopPaths(ctx, filter, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch top paths: %w", err)
 	}
 
-	statusCodes, err := s.queries.StatusBreakdown(filter)
+	statusCodes, err := s.queries.StatusBreakdown(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch status breakdown: %w", err)
 	}
 
-	referrers, err := s.queries.TopReferrers(filter, 10)
+	referrers, err := s.queries.TopReferrers(ctx, filter, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch top referrers: %w", err)
 	}
 
-	notFoundPaths, err := s.queries.TopNotFound(filter, 10)
+	var goal *GoalAttributionStat
+	if s.config.GoalPath != "" {
+		if goal, err = s.queries.GoalAttribution(ctx, filter, s.config.GoalPath); err != nil {
+			log.Printf("Warning: failed to fetch goal attribution: %v", err)
+		}
+	}
+
+	hosts, err := s.queries.HostBreakdown(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch host breakdown: %v", err)
+	}
+
+	cacheStatus, err := s.queries.CacheStatusBreakdown(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch cache status breakdown: %v", err)
+	}
+
+	notFoundPaths, err := s.queries.TopNotFound(ctx, filter, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch 404 paths: %w", err)
 	}
 	// enrich 404 results with any redirect suggestions we can offer
 	applyRedirectSuggestions(notFoundPaths)
 
-	userAgents, err := s.queries.UserAgentBreakdown(filter)
+	brokenLinks, err := s.queries.BrokenLinkCandidates(ctx, filter, 10)
+	if err != nil {
+		log.Printf("Warning: failed to fetch broken link candidates: %v", err)
+		brokenLinks = nil
+	}
+
+	redirects, err := s.queries.RedirectChains(ctx, filter, 10)
+	if err != nil {
+		log.Printf("Warning: failed to fetch redirect chains: %v", err)
+		redirects = nil
+	}
+	var slashRedirects SlashRedirectSummary
+	if s.config.MergeSlashRedirects {
+		redirects, slashRedirects = mergeSlashRedirects(redirects)
+	}
+
+	rawUserAgents, err := s.queries.TopUserAgents(ctx, filter, 15)
+	if err != nil {
+		log.Printf("Warning: failed to fetch raw user agents: %v", err)
+	}
+
+	userAgents, err := s.queries.UserAgentBreakdown(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user agents: %w", err)
 	}
 
-	methods, err := s.queries.MethodBreakdown(filter)
+	methods, err := s.queries.MethodBreakdown(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch method breakdown: %w", err)
 	}
 
-	statusDetails, err := s.queries.SpecificStatusCodes(filter)
+	statusDetails, err := s.queries.SpecificStatusCodes(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch specific status codes: %w", err)
 	}
 
-	hourOfDay, err := s.queries.HourOfDayDistribution(filter)
+	hourOfDay, err := s.queries.HourOfDayDistribution(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch hour of day: %w", err)
 	}
+	rotateHours(hourOfDay, s.config.HourOfDayStart)
 
 	log.Printf("Overview: all queries complete (paths=%d referrers=%d agents=%d methods=%d statuses=%d hours=%d 404s=%d)",
 		len(topPaths), len(referrers), len(userAgents), len(methods), len(statusDetails), len(hourOfDay), len(notFoundPaths))
@@ -416,6 +694,20 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 		}
 	}
 
+	maxHost := int64(1)
+	for _, h := range hosts {
+		if h.Count > maxHost {
+			maxHost = h.Count
+		}
+	}
+
+	maxCache := int64(1)
+	for _, cs := range cacheStatus {
+		if cs.Count > maxCache {
+			maxCache = cs.Count
+		}
+	}
+
 	maxReferrer := int64(1)
 	for _, r := range referrers {
 		if r.Count > maxReferrer {
@@ -483,7 +775,7 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 	computeDonutPositions(userAgentDonut)
 
 	// Fetch hour-of-day visitors
-	hourVisitors, err := s.queries.HourOfDayVisitors(filter)
+	hourVisitors, err := s.queries.HourOfDayVisitors(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch hour visitors: %v", err)
 		hourVisitors = nil
@@ -500,7 +792,7 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 	for i, p := range topPaths {
 		pathNames[i] = p.Path
 	}
-	trends, err := s.queries.PathDailyTrends(filter, pathNames)
+	trends, err := s.queries.PathDailyTrends(ctx, filter, pathNames)
 	if err != nil {
 		log.Printf("Warning: failed to fetch path trends: %v", err)
 	} else {
@@ -511,57 +803,96 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 		}
 	}
 
-	// Compute path percentages based on total requests
-	if stats != nil && stats.Requests > 0 {
-		for i := range topPaths {
-			topPaths[i].Pct = float64(topPaths[i].Count) / float64(stats.Requests) * 100
-		}
-		for i := range notFoundPaths {
-			notFoundPaths[i].Pct = float64(notFoundPaths[i].Count) / float64(stats.Requests) * 100
-		}
-	}
-
 	// Fetch new analytics data
-	browsers, err := s.queries.BrowserBreakdown(filter)
+	browsers, err := s.queries.BrowserBreakdown(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch browser breakdown: %v", err)
 	}
 
-	osStats, err := s.queries.OSBreakdown(filter)
+	osStats, err := s.queries.OSBreakdown(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch OS breakdown: %v", err)
 	}
 
-	durationHist, err := s.queries.DurationHistogram(filter)
+	durationHist, err := s.queries.DurationHistogram(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch duration histogram: %v", err)
 	}
 
-	percentiles, err := s.queries.DurationPercentiles(filter)
+	percentiles, err := s.queries.DurationPercentiles(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch duration percentiles: %v", err)
 	}
 
-	bandwidthChart, err := s.queries.BandwidthTimeSeries(filter, useDaily)
+	bandwidthChart, err := s.queries.BandwidthTimeSeries(ctx, filter, useDaily)
 	if err != nil {
 		log.Printf("Warning: failed to fetch bandwidth time series: %v", err)
 	}
 
-	responseTimeChart, err := s.queries.ResponseTimeTimeSeries(filter, useDaily)
+	sizeHistChart, err := s.queries.SizeHistogramOverTime(ctx, filter, useDaily)
+	if err != nil {
+		log.Printf("Warning: failed to fetch size histogram: %v", err)
+	}
+
+	responseTimeChart, err := s.queries.ResponseTimeTimeSeries(ctx, filter, useDaily)
 	if err != nil {
 		log.Printf("Warning: failed to fetch response time series: %v", err)
 	}
 
+	upstreamTimes, err := s.queries.UpstreamTimes(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch upstream times: %v", err)
+	}
+
+	markPartial(bandwidthChart, now, s.config.MinBucketCompletePct)
+	markPartial(responseTimeChart, now, s.config.MinBucketCompletePct)
+
+	// Formats without a duration field leave the histogram empty; show the
+	// latency panels as unavailable instead of all-zero timings
+	noDuration := stats != nil && stats.Requests > 0 && len(durationHist) == 0
+	if noDuration {
+		percentiles = nil
+		responseTimeChart = nil
+	}
+
 	// Country breakdown (only if GeoIP is configured)
 	geoIPEnabled := s.config.GeoIPPath != ""
 	var countries []CountryStat
 	if geoIPEnabled {
-		countries, err = s.queries.CountryBreakdown(filter, 20)
+		countries, err = s.queries.CountryBreakdown(ctx, filter, 20)
 		if err != nil {
 			log.Printf("Warning: failed to fetch country breakdown: %v", err)
 		}
 	}
 
+	// Captured query-string params (only if TRAIL_CAPTURE_PARAMS is set)
+	var paramValues []ParamBreakdown
+	var topParams []QueryParamStat
+	maxParamCount := int64(1)
+	if len(s.config.CaptureParams) > 0 {
+		if topParams, err = s.queries.TopQueryParams(ctx, filter, 10); err != nil {
+			log.Printf("Warning: failed to fetch top query params: %v", err)
+		}
+		for _, p := range topParams {
+			maxParamCount = max(maxParamCount, p.Count)
+		}
+	}
+	for _, param := range s.config.CaptureParams {
+		if param == aggregator.AllParams {
+			continue
+		}
+		values, err := s.queries.TopParamValues(ctx, filter, param, 10)
+		if err != nil {
+			log.Printf("Warning: failed to fetch values for param %q: %v", param, err)
+			continue
+		}
+		pb := ParamBreakdown{Param: param, Values: values, Max: 1}
+		for _, v := range values {
+			pb.Max = max(pb.Max, v.Count)
+		}
+		paramValues = append(paramValues, pb)
+	}
+
 	// Build browser donut
 	browserDonutPalette := []string{"#58a6ff", "#3fb950", "#d29922", "#f85149", "#8b5cf6", "#06b6d4", "#ec4899", "#64748b"}
 	var browserDonut []DonutSegment
@@ -648,21 +979,38 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 	}
 
 	// Fetch available routers for filter dropdown
-	routers, err := s.queries.Routers()
+	routers, err := s.routerOptions(ctx, router)
 	if err != nil {
 		log.Printf("Warning: failed to fetch routers: %v", err)
 		routers = []string{}
 	}
 
+	// And hosts, keeping a selected one listed
+	hostOptions, err := s.queries.Hosts(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to fetch hosts: %v", err)
+	}
+	if filter.Host != "" && !slices.Contains(hostOptions, filter.Host) {
+		hostOptions = append(hostOptions, filter.Host)
+	}
+
 	return &OverviewData{
 		Stats:             stats,
 		RequestsChart:     requestsChart,
 		VisitorsChart:     visitorsChart,
+		TrafficGaps:       trafficGaps,
 		TopPaths:          topPaths,
 		StatusCodes:       statusCodes,
 		TopReferrers:      referrers,
+		Goal:              goal,
+		Hosts:             hosts,
+		CacheStatus:       cacheStatus,
 		NotFoundPaths:     notFoundPaths,
+		BrokenLinks:       brokenLinks,
+		Redirects:         redirects,
+		SlashRedirects:    slashRedirects,
 		UserAgents:        userAgents,
+		RawUserAgents:     rawUserAgents,
 		Methods:           methods,
 		StatusDetails:     statusDetails,
 		HourOfDay:         hourOfDay,
@@ -675,12 +1023,18 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 		MaxStatusDet:      maxStatusDet,
 		MaxHourOfDay:      maxHourOfDay,
 		MaxReferrer:       maxReferrer,
+		MaxHost:           maxHost,
+		MaxCache:          maxCache,
 		Range:             rangeParam,
 		CustomFrom:        customFrom,
 		CustomTo:          customTo,
+		MinDate:           minDate,
+		MaxDate:           maxDate,
 		Router:            router,
+		Host:              filter.Host,
 		IncludeBots:       includeBots,
 		Routers:           routers,
+		HostOptions:       hostOptions,
 		Page:              "overview",
 		ActiveTab:         activeTab,
 		StatusDonut:       statusDonut,
@@ -696,7 +1050,11 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 		DurationHist:      durationHist,
 		Percentiles:       percentiles,
 		BandwidthChart:    bandwidthChart,
+		SizeHistChart:     sizeHistChart,
+		SizeBuckets:       sizeBuckets,
 		ResponseTimeChart: responseTimeChart,
+		UpstreamTimes:     upstreamTimes,
+		NoDuration:        noDuration,
 		MobilePct:         mobilePct,
 		DesktopPct:        desktopPct,
 		GeoIPEnabled:      geoIPEnabled,
@@ -707,11 +1065,29 @@ func (s *Server) getOverviewData(c *fiber.Ctx) (*OverviewData, error) {
 		MaxBandwidth:      maxBandwidth,
 		MaxResponseTime:   maxResponseTime,
 		Comparison:        comparison,
+		SuccessRate:       successRate,
+		Visits:            visits,
+		Engagement:        engagement,
+		TopDecileShare:    topDecileShare,
+		PathGini:          pathGini,
+		SuccessDelta:      successDelta,
+		HasSuccessDelta:   hasSuccessDelta,
+		ParamValues:       paramValues,
+		CapturesParams:    len(s.config.CaptureParams) > 0,
+		StoresRaw:         s.config.StoreRaw,
+		TopParams:         topParams,
+		MaxParamCount:     maxParamCount,
 	}, nil
 }
 
-// handleLogout responds with 401 to clear basic auth credentials from the browser
+// handleLogout expires the login cookie and returns to the login form, or
+// without session login responds with 401 to clear basic auth credentials
+// from the browser
 func (s *Server) handleLogout(c *fiber.Ctx) error {
+	if s.sessionKey != nil && s.checkCredentials != nil {
+		c.Cookie(&fiber.Cookie{Name: sessionCookie, Path: "/", Expires: time.Unix(0, 0), HTTPOnly: true})
+		return c.Redirect("/login")
+	}
 	c.Set("WWW-Authenticate", `Basic realm="Trail"`)
 	return c.SendStatus(fiber.StatusUnauthorized)
 }
@@ -722,6 +1098,7 @@ type DrilldownPathData struct {
 	Details           []PathDetail
 	Suggestion        string // optional Apache redirect hint
 	TraefikSuggestion string // optional Traefik redirect snippet
+	StoresRaw         bool   // TRAIL_STORE_RAW is set: rows drill down to single requests
 }
 
 // DrilldownStatusData represents data for the status drilldown partial
@@ -733,16 +1110,15 @@ type DrilldownStatusData struct {
 
 // handlePathDrilldown serves the inline drilldown detail for a path
 func (s *Server) handlePathDrilldown(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	path := c.Query("path")
 	if path == "" {
 		return c.Status(400).SendString("path parameter required")
 	}
 
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, _ := s.buildFilterWithCustom(c, router, includeBots)
+	filter, _ := s.requestFilter(c)
 
-	details, err := s.queries.PathDrilldown(filter, path)
+	details, err := s.queries.PathDrilldown(ctx, filter, path)
 	if err != nil {
 		log.Printf("Error fetching path drilldown: %v", err)
 		return c.Status(500).SendString("Error loading drilldown")
@@ -754,6 +1130,7 @@ func (s *Server) handlePathDrilldown(c *fiber.Ctx) error {
 		Details:           details,
 		Suggestion:        suggestion,
 		TraefikSuggestion: generateTraefikSnippet(path),
+		StoresRaw:         s.config.StoreRaw,
 	}
 
 	var buf bytes.Buffer
@@ -766,18 +1143,62 @@ func (s *Server) handlePathDrilldown(c *fiber.Ctx) error {
 	return c.Send(buf.Bytes())
 }
 
+// DrilldownRawData represents data for the single-request samples of a
+// path drilldown
+type DrilldownRawData struct {
+	Path     string
+	Method   string
+	Status   int // -1 for any
+	Requests []RawRequest
+}
+
+// rawSampleLimit is how many single requests a drilldown shows
+const rawSampleLimit = 20
+
+// handleRawDrilldown serves the newest single requests to a path, optionally
+// of one method and status, from requests_raw (TRAIL_STORE_RAW)
+func (s *Server) handleRawDrilldown(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	path := c.Query("path")
+	if path == "" {
+		return c.Status(400).SendString("path parameter required")
+	}
+
+	filter, _ := s.requestFilter(c)
+	data := DrilldownRawData{
+		Path:   path,
+		Method: c.Query("method"),
+		Status: c.QueryInt("status", -1),
+	}
+
+	var err error
+	data.Requests, err = s.queries.RecentRequests(ctx, filter, data.Path, data.Method, data.Status, rawSampleLimit)
+	if err != nil {
+		log.Printf("Error fetching raw requests: %v", err)
+		return c.Status(500).SendString("Error loading drilldown")
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "drilldown_raw.html", data); err != nil {
+		log.Printf("Error rendering raw drilldown template: %v", err)
+		return c.Status(500).SendString("Error rendering drilldown")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
 // handleStatusDrilldown serves the inline drilldown detail for a status class
 func (s *Server) handleStatusDrilldown(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	class := c.Query("class")
 	if class == "" {
 		return c.Status(400).SendString("class parameter required")
 	}
 
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, _ := s.buildFilterWithCustom(c, router, includeBots)
+	filter, _ := s.requestFilter(c)
 
-	statuses, err := s.queries.StatusClassDrilldown(filter, class)
+	statuses, err := s.queries.StatusClassDrilldown(ctx, filter, class)
 	if err != nil {
 		log.Printf("Error fetching status drilldown: %v", err)
 		return c.Status(500).SendString("Error loading drilldown")
@@ -817,16 +1238,16 @@ type DrilldownStatusCodeData struct {
 
 // handleStatusCodeDrilldown serves the inline drilldown detail for a specific status code
 func (s *Server) handleStatusCodeDrilldown(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	code := c.QueryInt("code", 0)
-	if code < 100 || code > 599 {
+	// Labelled non-standard codes (e.g. 0 for a dropped connection) drill down too
+	if (code < 100 || code > 599) && statusLabel(code) == "" {
 		return c.Status(400).SendString("invalid status code (must be 100-599)")
 	}
 
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, _ := s.buildFilterWithCustom(c, router, includeBots)
+	filter, _ := s.requestFilter(c)
 
-	paths, err := s.queries.StatusCodePaths(filter, code, 10)
+	paths, err := s.queries.StatusCodePaths(ctx, filter, code, 10)
 	if err != nil {
 		log.Printf("Error fetching status code paths: %v", err)
 		return c.Status(500).SendString("Error loading drilldown")
@@ -834,7 +1255,7 @@ func (s *Server) handleStatusCodeDrilldown(c *fiber.Ctx) error {
 
 	// Fetch alternate statuses for each path (controlled N+1, max 10 queries)
 	for i := range paths {
-		alts, err := s.queries.PathAlternateStatuses(filter, paths[i].Path, code)
+		alts, err := s.queries.PathAlternateStatuses(ctx, filter, paths[i].Path, code)
 		if err != nil {
 			log.Printf("Warning: failed to fetch alt statuses for %s: %v", paths[i].Path, err)
 			continue
@@ -842,7 +1263,7 @@ func (s *Server) handleStatusCodeDrilldown(c *fiber.Ctx) error {
 		paths[i].AltStatuses = alts
 	}
 
-	methods, err := s.queries.StatusCodeMethods(filter, code)
+	methods, err := s.queries.StatusCodeMethods(ctx, filter, code)
 	if err != nil {
 		log.Printf("Error fetching status code methods: %v", err)
 		return c.Status(500).SendString("Error loading drilldown")
@@ -888,6 +1309,53 @@ func (s *Server) handleStatusCodeDrilldown(c *fiber.Ctx) error {
 	return c.Send(buf.Bytes())
 }
 
+// DrilldownCountryData represents data for the country drilldown
+type DrilldownCountryData struct {
+	Country   string
+	Routers   []RouterStat
+	MaxRouter int64
+}
+
+// handleCountryDrilldown serves the inline drilldown detail for a country:
+// which routers its traffic went to
+func (s *Server) handleCountryDrilldown(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	country := c.Query("country")
+	if country == "" {
+		return c.Status(400).SendString("country is required")
+	}
+
+	filter, _ := s.requestFilter(c)
+
+	routers, err := s.queries.CountryRouterBreakdown(ctx, filter, country)
+	if err != nil {
+		log.Printf("Error fetching country routers: %v", err)
+		return c.Status(500).SendString("Error loading drilldown")
+	}
+
+	maxRouter := int64(1)
+	for _, r := range routers {
+		if r.Count > maxRouter {
+			maxRouter = r.Count
+		}
+	}
+
+	data := DrilldownCountryData{
+		Country:   country,
+		Routers:   routers,
+		MaxRouter: maxRouter,
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "drilldown_country.html", data); err != nil {
+		log.Printf("Error rendering country drilldown template: %v", err)
+		return c.Status(500).SendString("Error rendering drilldown")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
 // PanelPathsData represents data for the paginated paths panel
 type PanelPathsData struct {
 	Paths       []PathStat
@@ -904,6 +1372,16 @@ type PanelPathsData struct {
 	Summary     *PathsSummaryResult
 }
 
+// PanelSectionsData represents data for the sections panel
+type PanelSectionsData struct {
+	Sections []SectionStat
+	Depth    int
+	Depths   []int // depth choices offered
+	Sort     string
+	Order    string
+	MaxCount int64 // busiest section, for the bars
+}
+
 // PanelReferrersData represents data for the paginated referrers panel
 type PanelReferrersData struct {
 	Referrers   []ReferrerStat
@@ -919,6 +1397,27 @@ type PanelReferrersData struct {
 	MaxReferrer int64
 }
 
+// PanelNowData represents data for the "right now" top paths panel
+type PanelNowData struct {
+	Hour    string // hour bucket shown, e.g. "2026-02-08T10:00:00Z"; empty if no data
+	Current bool   // whether Hour is the current UTC hour
+	Paths   []PathStat
+	MaxPath int64
+
+	// Set instead of Hour when the panel shows the rolling last hour from
+	// requests_fine (TRAIL_FINE_BUCKET_MINUTES)
+	BucketMinutes int
+	Trend         []int64 // requests per fine bucket, oldest first
+}
+
+// PanelRecentData represents data for the recent requests panel
+type PanelRecentData struct {
+	Requests []RawRequest
+}
+
+// recentRequestsLimit is how many requests the recent requests panel shows
+const recentRequestsLimit = 25
+
 // PanelNotFoundData represents data for the paginated 404 panel
 type PanelNotFoundData struct {
 	Paths       []PathStat
@@ -935,38 +1434,31 @@ type PanelNotFoundData struct {
 
 // handlePanelPaths serves the paginated paths panel
 func (s *Server) handlePanelPaths(c *fiber.Ctx) error {
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, rangeParam := s.buildFilterWithCustom(c, router, includeBots)
+	ctx := c.UserContext()
+	filter, rangeParam := s.requestFilter(c)
 
 	page := c.QueryInt("page", 1)
 	limit := c.QueryInt("limit", 10)
 	sort := c.Query("sort", "count")
 	order := c.Query("order", "desc")
 
-	result, err := s.queries.TopPathsPaginated(filter, page, limit, sort, order)
+	result, err := s.queries.TopPathsPaginated(ctx, filter, page, limit, sort, order)
 	if err != nil {
 		log.Printf("Error fetching paginated paths: %v", err)
 		return c.Status(500).SendString("Error loading paths")
 	}
 
-	summary, err := s.queries.PathsSummary(filter)
+	summary, err := s.queries.PathsSummary(ctx, filter)
 	if err != nil {
 		log.Printf("Warning: failed to fetch paths summary: %v", err)
 	}
 
-	stats, _ := s.queries.TotalStats(filter)
 	totalReqs := int64(0)
-	if stats != nil {
-		totalReqs = stats.Requests
+	if summary != nil {
+		totalReqs = summary.TotalHits
 	}
 
 	items := result.Items.([]PathStat)
-	if totalReqs > 0 {
-		for i := range items {
-			items[i].Pct = float64(items[i].Count) / float64(totalReqs) * 100
-		}
-	}
 
 	data := PanelPathsData{
 		Paths:       items,
@@ -977,8 +1469,8 @@ func (s *Server) handlePanelPaths(c *fiber.Ctx) error {
 		Sort:        sort,
 		Order:       order,
 		Range:       rangeParam,
-		Router:      router,
-		IncludeBots: includeBots,
+		Router:      c.Query("router", ""),
+		IncludeBots: filter.IncludeBots,
 		TotalReqs:   totalReqs,
 		Summary:     summary,
 	}
@@ -993,15 +1485,83 @@ func (s *Server) handlePanelPaths(c *fiber.Ctx) error {
 	return c.Send(buf.Bytes())
 }
 
+// handlePanelSections serves the sections panel: traffic grouped by the
+// first ?depth= path segments (default TRAIL_SECTION_DEPTH), sortable like
+// the paths panel
+func (s *Server) handlePanelSections(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	filter, _ := s.requestFilter(c)
+
+	depth := max(1, min(c.QueryInt("depth", s.config.SectionDepth), MaxSectionDepth))
+	sortBy := c.Query("sort", "count")
+	order := c.Query("order", "desc")
+
+	sections, err := s.queries.SectionBreakdown(ctx, filter, depth)
+	if err != nil {
+		log.Printf("Error fetching sections: %v", err)
+		return c.Status(500).SendString("Error loading sections")
+	}
+	sortSections(sections, sortBy, order == "asc")
+
+	data := PanelSectionsData{
+		Sections: sections,
+		Depth:    depth,
+		Sort:     sortBy,
+		Order:    order,
+	}
+	for d := 1; d <= 3; d++ {
+		data.Depths = append(data.Depths, d)
+	}
+	for _, sec := range sections {
+		data.MaxCount = max(data.MaxCount, sec.Count)
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "panel_sections.html", data); err != nil {
+		log.Printf("Error rendering sections panel: %v", err)
+		return c.Status(500).SendString("Error rendering panel")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// sortSections orders sections by the paths panel's sort keys (section,
+// count, bytes, avg_bytes, avg_ms); unknown keys sort by count
+func sortSections(sections []SectionStat, by string, asc bool) {
+	key := func(s SectionStat) int64 {
+		switch by {
+		case "bytes":
+			return s.Bytes
+		case "avg_bytes":
+			return s.AvgBytes
+		case "avg_ms":
+			return s.AvgMs
+		}
+		return s.Count
+	}
+	sort.SliceStable(sections, func(i, j int) bool {
+		if by == "section" {
+			if asc {
+				return sections[i].Section < sections[j].Section
+			}
+			return sections[i].Section > sections[j].Section
+		}
+		if asc {
+			return key(sections[i]) < key(sections[j])
+		}
+		return key(sections[i]) > key(sections[j])
+	})
+}
+
 // handlePanelReferrers serves the paginated referrers panel
 func (s *Server) handlePanelReferrers(c *fiber.Ctx) error {
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, rangeParam := s.buildFilterWithCustom(c, router, includeBots)
+	ctx := c.UserContext()
+	filter, rangeParam := s.requestFilter(c)
 
 	limit := c.QueryInt("limit", 10)
 
-	referrers, err := s.queries.TopReferrers(filter, limit)
+	referrers, err := s.queries.TopReferrers(ctx, filter, limit)
 	if err != nil {
 		log.Printf("Error fetching referrers: %v", err)
 		return c.Status(500).SendString("Error loading referrers")
@@ -1017,8 +1577,8 @@ func (s *Server) handlePanelReferrers(c *fiber.Ctx) error {
 	data := PanelReferrersData{
 		Referrers:   referrers,
 		Range:       rangeParam,
-		Router:      router,
-		IncludeBots: includeBots,
+		Router:      c.Query("router", ""),
+		IncludeBots: filter.IncludeBots,
 		MaxReferrer: maxRef,
 	}
 
@@ -1034,13 +1594,12 @@ func (s *Server) handlePanelReferrers(c *fiber.Ctx) error {
 
 // handlePanelNotFound serves the paginated 404 panel
 func (s *Server) handlePanelNotFound(c *fiber.Ctx) error {
-	router := c.Query("router", "")
-	includeBots := c.Query("bots", "false") == "true"
-	filter, rangeParam := s.buildFilterWithCustom(c, router, includeBots)
+	ctx := c.UserContext()
+	filter, rangeParam := s.requestFilter(c)
 
 	limit := c.QueryInt("limit", 10)
 
-	notFound, err := s.queries.TopNotFound(filter, limit)
+	notFound, err := s.queries.TopNotFound(ctx, filter, limit)
 	if err != nil {
 		log.Printf("Error fetching 404 paths: %v", err)
 		return c.Status(500).SendString("Error loading 404 paths")
@@ -1050,8 +1609,8 @@ func (s *Server) handlePanelNotFound(c *fiber.Ctx) error {
 	data := PanelNotFoundData{
 		Paths:       notFound,
 		Range:       rangeParam,
-		Router:      router,
-		IncludeBots: includeBots,
+		Router:      c.Query("router", ""),
+		IncludeBots: filter.IncludeBots,
 	}
 
 	var buf bytes.Buffer
@@ -1064,6 +1623,115 @@ func (s *Server) handlePanelNotFound(c *fiber.Ctx) error {
 	return c.Send(buf.Bytes())
 }
 
+// handlePanelNow serves the busiest paths in the most recent hour with data,
+// independent of the selected range.
+func (s *Server) handlePanelNow(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	filter := s.scopeFilter(ctx, Filter{
+		Router:      c.Query("router", ""),
+		IncludeBots: c.Query("bots", "false") == "true",
+	})
+
+	var data PanelNowData
+	if s.config.FineBucketMinutes > 0 {
+		if err := s.fillPanelNowFine(ctx, &data, filter, s.config.FineBucketMinutes); err != nil {
+			log.Printf("Error fetching fine-grained current paths: %v", err)
+			return c.Status(500).SendString("Error loading current paths")
+		}
+	}
+
+	// Without recent fine data, show the latest hour with any data
+	var maxHour string
+	var err error
+	if data.Paths == nil {
+		if _, maxHour, err = s.queries.DataBounds(ctx); err != nil {
+			log.Printf("Error loading data bounds: %v", err)
+			return c.Status(500).SendString("Error loading current paths")
+		}
+	}
+	if maxHour != "" {
+		data.Hour = maxHour
+		data.Current = maxHour == time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339)
+		data.Paths, err = s.queries.TopPathsForHour(ctx, filter, maxHour, 5)
+		if err != nil {
+			log.Printf("Error fetching top paths for hour: %v", err)
+			return c.Status(500).SendString("Error loading current paths")
+		}
+		for _, p := range data.Paths {
+			data.MaxPath = max(data.MaxPath, p.Count)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "panel_now.html", data); err != nil {
+		log.Printf("Error rendering now panel: %v", err)
+		return c.Status(500).SendString("Error rendering panel")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// handlePanelRecent serves the newest single requests in the selected range
+// from requests_raw (TRAIL_STORE_RAW); the panel polls it for a live view.
+func (s *Server) handlePanelRecent(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	filter, _ := s.requestFilter(c)
+
+	var data PanelRecentData
+	var err error
+	data.Requests, err = s.queries.RecentRequests(ctx, filter, "", "", -1, recentRequestsLimit)
+	if err != nil {
+		log.Printf("Error fetching recent requests: %v", err)
+		return c.Status(500).SendString("Error loading recent requests")
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "panel_recent.html", data); err != nil {
+		log.Printf("Error rendering recent requests panel: %v", err)
+		return c.Status(500).SendString("Error rendering panel")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// panelNowWindow is how far back the fine-grained Right Now panel looks
+const panelNowWindow = time.Hour
+
+// fillPanelNowFine fills the Right Now panel from requests_fine: busiest paths
+// over the rolling last hour and requests per bucket. Leaves data untouched
+// when that window has no traffic.
+func (s *Server) fillPanelNowFine(ctx context.Context, data *PanelNowData, f Filter, minutes int) error {
+	width := time.Duration(minutes) * time.Minute
+	now := time.Now().UTC()
+	start := now.Truncate(width).Add(width - panelNowWindow)
+	since := start.Format(time.RFC3339)
+
+	paths, err := s.queries.TopPathsSince(ctx, f, since, 5)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	points, err := s.queries.FineRequestsSince(ctx, f, since)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int64, len(points))
+	for _, p := range points {
+		counts[p.Label] = p.Count
+	}
+
+	data.Paths = paths
+	data.BucketMinutes = minutes
+	for _, p := range paths {
+		data.MaxPath = max(data.MaxPath, p.Count)
+	}
+	for t := start; !t.After(now); t = t.Add(width) {
+		data.Trend = append(data.Trend, counts[t.Format(time.RFC3339)])
+	}
+	return nil
+}
+
 // buildFilter constructs a Filter based on the range parameter
 func (s *Server) buildFilter(rangeParam, router string, includeBots bool) Filter {
 	now := time.Now().UTC()
@@ -1089,9 +1757,41 @@ func (s *Server) buildFilter(rangeParam, router string, includeBots bool) Filter
 	}
 }
 
+// validRanges is the set of preset range names accepted in the range query param
+var validRanges = map[string]bool{
+	"today":  true,
+	"7d":     true,
+	"30d":    true,
+	"custom": true,
+}
+
+// defaultRange returns the range used when the request does not specify one.
+// An explicit ?range= always wins over TRAIL_DEFAULT_RANGE.
+func (s *Server) defaultRange() string {
+	if s.config != nil && s.config.DefaultRange != "" {
+		return s.config.DefaultRange
+	}
+	return "today"
+}
+
+// requestFilter builds the Filter for a request's range, router, host, bots
+// and custom_* params. Every page, panel and export goes through it so a CSV
+// download covers exactly the traffic shown on screen.
+func (s *Server) requestFilter(c *fiber.Ctx) (Filter, string) {
+	router := c.Query("router", "")
+	includeBots := c.Query("bots", "false") == "true"
+	f, rangeParam := s.buildFilterWithCustom(c, router, includeBots)
+	f.Host = c.Query("host", "")
+	return f, rangeParam
+}
+
 // buildFilterWithCustom extends buildFilter with custom date range support
 func (s *Server) buildFilterWithCustom(c *fiber.Ctx, router string, includeBots bool) (Filter, string) {
-	rangeParam := c.Query("range", "today")
+	ctx := c.UserContext()
+	rangeParam := c.Query("range", s.defaultRange())
+	if !validRanges[rangeParam] {
+		rangeParam = s.defaultRange()
+	}
 	customFrom := c.Query("custom_from", "")
 	customTo := c.Query("custom_to", "")
 
@@ -1099,22 +1799,177 @@ func (s *Server) buildFilterWithCustom(c *fiber.Ctx, router string, includeBots
 		fromTime, errFrom := time.Parse("2006-01-02", customFrom)
 		toTime, errTo := time.Parse("2006-01-02", customTo)
 		if errFrom == nil && errTo == nil && fromTime.Before(toTime) {
+			fromTime, toTime = s.clampToBounds(ctx, fromTime, toTime)
 			// Cap at 365 days
 			if toTime.Sub(fromTime) > 365*24*time.Hour {
 				fromTime = toTime.AddDate(0, 0, -365)
 			}
-			return Filter{
-				From:        fromTime.Format(time.RFC3339),
-				To:          toTime.Add(23*time.Hour + 59*time.Minute).Format(time.RFC3339),
-				Router:      router,
-				IncludeBots: includeBots,
-			}, rangeParam
+			return s.scopeFilter(ctx, dayRangeFilter(fromTime, toTime, router, includeBots)), rangeParam
 		}
 	}
 
-	return s.buildFilter(rangeParam, router, includeBots), rangeParam
+	return s.scopeFilter(ctx, s.buildFilter(rangeParam, router, includeBots)), rangeParam
+}
+
+// OtherRoutersKey is the router selector entry standing for every router
+// below TRAIL_ROUTER_MIN_PCT
+const OtherRoutersKey = "(other routers)"
+
+// routerGroups splits routers into those listed individually in the selector
+// and the small ones grouped under OtherRoutersKey: those below
+// TRAIL_ROUTER_MIN_PCT, and any past the busiest TRAIL_MAX_BREAKDOWN_ROWS.
+// "unrouted" is never grouped.
+func (s *Server) routerGroups(ctx context.Context) (major, minor []string, err error) {
+	totals, err := s.queries.RouterTotals(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, t := range totals {
+		if t.Router == "unrouted" || (i < s.queries.breakdownLimit && t.Pct >= s.config.RouterMinPct) {
+			major = append(major, t.Router)
+		} else {
+			minor = append(minor, t.Router)
+		}
+	}
+	sort.Strings(major)
+	sort.Strings(minor)
+	return major, minor, nil
+}
+
+// routerOptions returns the router selector entries: major routers, then
+// OtherRoutersKey if any were grouped. A grouped router picked explicitly
+// (e.g. via ?router=name) is listed too so it stays selected.
+func (s *Server) routerOptions(ctx context.Context, selected string) ([]string, error) {
+	major, minor, err := s.routerGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(minor) == 0 {
+		return major, nil
+	}
+	options := major
+	if selected != "" && selected != OtherRoutersKey && slices.Contains(minor, selected) {
+		options = append(options, selected)
+	}
+	return append(options, OtherRoutersKey), nil
 }
 
+// scopeFilter applies the server-wide parts of a filter: the router group
+// behind OtherRoutersKey and whether unrouted traffic counts as real
+func (s *Server) scopeFilter(ctx context.Context, f Filter) Filter {
+	f.IncludeUnrouted = s.config.UnroutedIsReal
+	return s.expandRouterGroup(ctx, f)
+}
+
+// expandRouterGroup resolves a filter on OtherRoutersKey to the grouped routers
+func (s *Server) expandRouterGroup(ctx context.Context, f Filter) Filter {
+	if f.Router != OtherRoutersKey {
+		return f
+	}
+	_, minor, err := s.routerGroups(ctx)
+	if err != nil {
+		log.Printf("Error loading router groups: %v", err)
+	}
+	if len(minor) == 0 {
+		// Nothing is grouped; match no router rather than all of them
+		minor = []string{OtherRoutersKey}
+	}
+	f.Router = ""
+	f.Routers = minor
+	return f
+}
+
+// dateBounds returns the first and last days with data as YYYY-MM-DD strings,
+// or empty strings if the database is empty or the lookup fails.
+func (s *Server) dateBounds(ctx context.Context) (string, string) {
+	minHour, maxHour, err := s.queries.DataBounds(ctx)
+	if err != nil {
+		log.Printf("Error loading data bounds: %v", err)
+		return "", ""
+	}
+	if len(minHour) < 10 || len(maxHour) < 10 {
+		return "", ""
+	}
+	return minHour[:10], maxHour[:10]
+}
+
+// clampToBounds narrows a custom from/to day range to the days that actually
+// hold data. If the range lies entirely outside the data it is left unchanged
+// so the dashboard renders an honest empty view instead of a different period.
+func (s *Server) clampToBounds(ctx context.Context, from, to time.Time) (time.Time, time.Time) {
+	minDate, maxDate := s.dateBounds(ctx)
+	if minDate == "" {
+		return from, to
+	}
+	lo, errLo := time.Parse("2006-01-02", minDate)
+	hi, errHi := time.Parse("2006-01-02", maxDate)
+	if errLo != nil || errHi != nil || to.Before(lo) || from.After(hi) {
+		return from, to
+	}
+	if from.Before(lo) {
+		from = lo
+	}
+	if to.After(hi) {
+		to = hi
+	}
+	return from, to
+}
+
+// handleAPIBounds returns the earliest and latest hour buckets with data.
+// Both fields are empty strings when nothing has been ingested yet.
+func (s *Server) handleAPIBounds(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	minHour, maxHour, err := s.queries.DataBounds(ctx)
+	if err != nil {
+		log.Printf("Error loading data bounds: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "failed to load data bounds"})
+	}
+	return c.JSON(fiber.Map{"min": minHour, "max": maxHour})
+}
+
+// staleAfter is how long without new data before the freshness indicator warns
+const staleAfter = 30 * time.Minute
+
+// Freshness describes how current the dashboard's data is
+type Freshness struct {
+	AsOf   time.Time // when data was last ingested; zero if never
+	Stale  bool      // nothing ingested within staleAfter
+	Paused bool      // ingestion paused via /api/admin/pause
+}
+
+// freshness reports when data was last ingested: the aggregator's last flush,
+// or for data written before this process started, the end of the newest hour
+// bucket. A stalled tailer or aggregator shows up here as Stale long before a
+// flatlining chart gets noticed.
+func (s *Server) freshness(ctx context.Context) Freshness {
+	now := time.Now().UTC()
+	var asOf time.Time
+	if s.flusher != nil {
+		asOf = s.flusher.LastFlush().UTC()
+	}
+	if _, maxHour, err := s.queries.DataBounds(ctx); err != nil {
+		log.Printf("Error loading data bounds: %v", err)
+	} else if t, err := time.Parse(time.RFC3339, maxHour); err == nil {
+		// The newest bucket may still be filling; its end is as current as it gets
+		end := t.Add(time.Hour)
+		if end.After(now) {
+			end = now
+		}
+		if end.After(asOf) {
+			asOf = end
+		}
+	}
+	return Freshness{
+		AsOf:   asOf,
+		Stale:  now.Sub(asOf) > staleAfter,
+		Paused: s.ingest != nil && s.ingest.Paused(),
+	}
+}
+
+// errorRateMinRequests is the request floor for the highest error rate
+// panel, keeping paths with a handful of hits out of it
+const errorRateMinRequests = 20
+
 // validSecurityTabs is the set of valid tab names for the security page
 var validSecurityTabs = map[string]bool{
 	"summary":     true,
@@ -1142,8 +1997,47 @@ func (s *Server) handleAPISecurityPartial(c *fiber.Ctx) error {
 	return c.Send(buf.Bytes())
 }
 
+// suspiciousPathMode reports whether threat patterns are found by
+// suspicious paths and statuses instead of unrouted traffic: for the
+// formats without routers (combined, caddy), and when unrouted traffic is
+// real so it isn't all counted as scanning
+func (s *Server) suspiciousPathMode() bool {
+	return s.config.LogFormat == "combined" || s.config.LogFormat == "caddy" || s.config.UnroutedIsReal
+}
+
+// rateLimits fetches the 429 panel's data, or nil when the period has no
+// 429 responses
+func (s *Server) rateLimits(ctx context.Context, filter Filter, useDaily bool) (*RateLimitStat, error) {
+	overTime, err := s.queries.SpecificStatusOverTime(ctx, filter, 429, useDaily)
+	if err != nil {
+		return nil, err
+	}
+	markPartial(overTime, time.Now(), s.config.MinBucketCompletePct)
+
+	stat := &RateLimitStat{OverTime: overTime, MaxCount: 1}
+	for _, p := range overTime {
+		stat.Total += p.Count
+		stat.MaxCount = max(stat.MaxCount, p.Count)
+	}
+	if stat.Total == 0 {
+		return nil, nil
+	}
+
+	if stat.Paths, err = s.queries.StatusCodePaths(ctx, filter, 429, 10); err != nil {
+		return nil, err
+	}
+	if s.config.RateLimitIPs {
+		if stat.IPs, err = s.queries.RateLimitedIPs(ctx, filter, 10); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
+
 // getSecurityData fetches and prepares data for the security page
 func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
+	ctx := c.UserContext()
+
 	// Parse active tab
 	activeTab := c.Query("tab", "summary")
 	if !validSecurityTabs[activeTab] {
@@ -1152,20 +2046,11 @@ func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
 
 	// Build filter with IncludeBots=true (security view shows all traffic)
 	filter, rangeParam := s.buildFilterWithCustom(c, "", true)
-	if rangeParam == "today" {
-		// Default security to 30d if no explicit range
-		defaultRange := c.Query("range", "30d")
-		if defaultRange == "30d" {
-			filter = s.buildFilter("30d", "", true)
-			rangeParam = "30d"
-		}
-	}
 	customFrom := c.Query("custom_from", "")
 	customTo := c.Query("custom_to", "")
+	minDate, maxDate := s.dateBounds(ctx)
 
-	// Threat patterns - use suspicious path mode for combined format
-	suspiciousPathMode := s.config.LogFormat == "combined"
-	threatPatterns, err := s.queries.ThreatPatterns(filter, suspiciousPathMode)
+	threatPatterns, err := s.queries.ThreatPatterns(ctx, filter, s.suspiciousPathMode(), s.config.SuspiciousStatuses)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch threat patterns: %w", err)
 	}
@@ -1179,8 +2064,20 @@ func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
 		}
 	}
 
+	// Non-standard methods (PROPFIND, garbage verbs) are a common scanner tell
+	unusualMethods, err := s.queries.UnusualMethods(ctx, filter, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unusual methods: %w", err)
+	}
+	maxUnusual := int64(1)
+	for _, m := range unusualMethods {
+		if m.Count > maxUnusual {
+			maxUnusual = m.Count
+		}
+	}
+
 	// Bot vs Human
-	humanCount, botCount, botBreakdown, err := s.queries.BotVsHuman(filter)
+	humanCount, botCount, botBreakdown, err := s.queries.BotVsHuman(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch bot breakdown: %w", err)
 	}
@@ -1193,18 +2090,12 @@ func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
 		humanPct = 100.0 - botPct
 	}
 
-	// Compute percentages for bot breakdown
-	for i := range botBreakdown {
-		if botCount > 0 {
-			botBreakdown[i].Pct = float64(botBreakdown[i].Count) / float64(botCount) * 100
-		}
-	}
-
 	// Error trends
-	errorTrends, err := s.queries.ErrorTrends(filter)
+	errorTrends, err := s.queries.ErrorTrends(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch error trends: %w", err)
 	}
+	markPartial(errorTrends, time.Now(), s.config.MinBucketCompletePct)
 
 	total5xx := int64(0)
 	maxErrorCount := int64(1)
@@ -1216,29 +2107,101 @@ func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
 	}
 
 	// Error paths
-	errorPaths, err := s.queries.ErrorPaths(filter, 10)
+	errorPaths, err := s.queries.ErrorPaths(ctx, filter, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch error paths: %w", err)
 	}
 
+	// Paths that fail most often relative to their traffic
+	errorRatePaths, err := s.queries.HighestErrorRatePaths(ctx, filter, errorRateMinRequests, 10)
+	if err != nil {
+		log.Printf("Warning: failed to fetch error rate paths: %v", err)
+	}
+
+	// Recent 5xx request IDs (only recorded when enabled)
+	errorRequests, err := s.queries.ErrorRequestIDs(ctx, filter, 20)
+	if err != nil {
+		log.Printf("Warning: failed to fetch error request IDs: %v", err)
+	}
+
+	// Requests from threat-listed IPs
+	var knownThreats *KnownThreatStat
+	if s.config.ThreatIPsFile != "" {
+		if knownThreats, err = s.queries.KnownThreats(ctx, filter, 10); err != nil {
+			log.Printf("Warning: failed to fetch known threats: %v", err)
+		}
+	}
+
+	// Unrouted clients by how many distinct paths they probed
+	var scanners []ScannerBreadthStat
+	if s.config.ScannerPaths {
+		if scanners, err = s.queries.ScannerBreadth(ctx, filter, 10); err != nil {
+			log.Printf("Warning: failed to fetch scanner breadth: %v", err)
+		}
+	}
+
+	// Auth paths failing for many clients at once
+	var stuffing []CredentialStuffingSignal
+	if len(s.config.AuthPaths) > 0 {
+		if stuffing, err = s.queries.CredentialStuffingSignals(ctx, filter); err != nil {
+			log.Printf("Warning: failed to fetch credential stuffing signals: %v", err)
+		}
+	}
+
+	// Rate-limited (429) responses
+	useDaily := rangeParam == "7d" || rangeParam == "30d" || rangeParam == "custom"
+	rateLimits, err := s.rateLimits(ctx, filter, useDaily)
+	if err != nil {
+		log.Printf("Warning: failed to fetch rate limits: %v", err)
+	}
+
+	// Paths only bots request
+	botOnlyPaths, err := s.queries.BotOnlyPaths(ctx, filter, 10)
+	if err != nil {
+		log.Printf("Warning: failed to fetch bot-only paths: %v", err)
+	}
+	maxBotOnly := int64(1)
+	for _, p := range botOnlyPaths {
+		if p.Bots > maxBotOnly {
+			maxBotOnly = p.Bots
+		}
+	}
+
+	// Crawler User-Agents on unrouted requests
+	fakeCrawlers, err := s.queries.FakeCrawlers(ctx, filter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch fake crawlers: %v", err)
+	}
+
 	// Slowest paths
-	slowestPaths, err := s.queries.SlowestPaths(filter, 10)
+	slowestPaths, err := s.queries.SlowestPaths(ctx, filter, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch slowest paths: %w", err)
 	}
 
+	hasDurations, err := s.queries.HasDurations(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check durations: %w", err)
+	}
+	noDuration := !hasDurations && totalTraffic > 0
+	if noDuration {
+		slowestPaths = nil
+	}
+
 	slowestAvgMs := int64(0)
 	if len(slowestPaths) > 0 {
 		slowestAvgMs = slowestPaths[0].AvgMs
 	}
 
-	return &SecurityData{
+	data := &SecurityData{
 		TotalUnrouted:  totalUnrouted,
 		BotPct:         botPct,
 		HumanPct:       humanPct,
 		Total5xx:       total5xx,
 		SlowestAvgMs:   slowestAvgMs,
 		ThreatPatterns: threatPatterns,
+		UnusualMethods: unusualMethods,
+		MaxUnusual:     maxUnusual,
 		BotBreakdown:   botBreakdown,
 		HumanCount:     humanCount,
 		BotCount:       botCount,
@@ -1247,11 +2210,27 @@ func (s *Server) getSecurityData(c *fiber.Ctx) (*SecurityData, error) {
 		ErrorTrends:    errorTrends,
 		MaxErrorCount:  maxErrorCount,
 		ErrorPaths:     errorPaths,
+		ErrorRatePaths: errorRatePaths,
+		ErrorRequests:  errorRequests,
 		SlowestPaths:   slowestPaths,
+		KnownThreats:   knownThreats,
+		RateLimits:     rateLimits,
+		Scanners:       scanners,
+		Stuffing:       stuffing,
+		BotOnlyPaths:   botOnlyPaths,
+		MaxBotOnly:     maxBotOnly,
+		FakeCrawlers:   fakeCrawlers,
+		NoDuration:     noDuration,
 		Range:          rangeParam,
 		CustomFrom:     customFrom,
 		CustomTo:       customTo,
+		MinDate:        minDate,
+		MaxDate:        maxDate,
 		Page:           "security",
 		ActiveTab:      activeTab,
-	}, nil
+	}
+	data.Score, data.ScoreFactors = SecurityScore(*data)
+	data.ScoreLevel = scoreLevel(data.Score)
+
+	return data, nil
 }
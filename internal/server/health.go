@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-wander/trail/internal/backfill"
+)
+
+// healthStatus is the JSON answer of /healthz, and of / for clients that
+// prefer JSON
+type healthStatus struct {
+	Status   string `json:"status"`               // "ok", "stale" when nothing was ingested lately, or "paused"
+	DataAsOf string `json:"data_as_of,omitempty"` // RFC 3339; omitted before any data arrived
+	Paused   bool   `json:"paused,omitempty"`     // ingestion paused via /api/admin/pause
+
+	// Startup import of rotated files; omitted when none was started
+	Backfill *backfill.ProgressState `json:"backfill,omitempty"`
+}
+
+// health summarizes data freshness for uptime checks. It costs one
+// DataBounds lookup, not the dashboard's queries.
+func (s *Server) health(ctx context.Context) healthStatus {
+	f := s.freshness(ctx)
+	h := healthStatus{Status: "ok"}
+	if f.Stale {
+		h.Status = "stale"
+	}
+	if f.Paused {
+		h.Status = "paused"
+		h.Paused = true
+	}
+	if !f.AsOf.IsZero() {
+		h.DataAsOf = f.AsOf.Format(time.RFC3339)
+	}
+	if s.backfill != nil {
+		state := s.backfill.Snapshot()
+		h.Backfill = &state
+	}
+	return h
+}
+
+// handleHealthz serves a small JSON status for uptime checks. It always
+// answers 200 while the server runs; "stale" flags a stalled ingest.
+func (s *Server) handleHealthz(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	return c.JSON(s.health(ctx))
+}
+
+// wantsJSON reports whether the client prefers JSON over HTML, e.g. a
+// probe sending Accept: application/json. Browsers and curl's */* don't.
+func wantsJSON(c *fiber.Ctx) bool {
+	return c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/backfill"
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestRootContentNegotiation(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339)
+	seedRequests(t, db, requestRow{hour, "web", "/", "GET", 200, 1, 1, 1})
+
+	get := func(srv *Server, target, accept string) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	srv := newTestServer(t, &config.Config{Listen: ":0", RootJSON: "json"}, db)
+
+	for _, accept := range []string{"", "*/*", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"} {
+		if _, ctype, _ := get(srv, "/", accept); !strings.HasPrefix(ctype, "text/html") {
+			t.Errorf("GET / with Accept %q = %s, want HTML", accept, ctype)
+		}
+	}
+
+	status, ctype, body := get(srv, "/", "application/json")
+	if status != 200 || !strings.HasPrefix(ctype, "application/json") {
+		t.Fatalf("GET / with Accept JSON = %d %s, want JSON", status, ctype)
+	}
+	var h healthStatus
+	if err := json.Unmarshal([]byte(body), &h); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	if h.Status != "ok" || h.DataAsOf == "" || h.Backfill != nil {
+		t.Errorf("GET / JSON = %+v, want ok with a data time and no backfill", h)
+	}
+
+	if _, _, healthz := get(srv, "/healthz", ""); healthz != body {
+		t.Errorf("/healthz = %s, want the same as / JSON %s", healthz, body)
+	}
+
+	redirect := newTestServer(t, &config.Config{Listen: ":0", RootJSON: "redirect"}, db)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := redirect.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/healthz" {
+		t.Errorf("redirect mode = %d to %q, want 302 to /healthz", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	html := newTestServer(t, &config.Config{Listen: ":0", RootJSON: "html"}, db)
+	if _, ctype, _ := get(html, "/", "application/json"); !strings.HasPrefix(ctype, "text/html") {
+		t.Errorf("html mode with Accept JSON = %s, want HTML", ctype)
+	}
+}
+
+func TestHealthzBackfill(t *testing.T) {
+	srv := newTestServer(t, &config.Config{Listen: ":0"}, testDB(t))
+	srv.SetBackfillProgress(&backfill.Progress{})
+
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/healthz", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := h["backfill"].(map[string]any)
+	if !ok {
+		t.Fatalf("/healthz = %v, want a backfill object", h)
+	}
+	if b["running"] != false || b["files_done"] != float64(0) {
+		t.Errorf("backfill = %v, want not running with 0 files done", b)
+	}
+}
@@ -1,6 +1,11 @@
 package server
 
-import "testing"
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestFormatBytes(t *testing.T) {
 	tests := []struct {
@@ -98,6 +103,52 @@ func TestStatusColor(t *testing.T) {
 	}
 }
 
+func TestStatusCodeColorAndLabel(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantColor string
+		wantLabel string
+	}{
+		{200, "var(--success)", ""},
+		{404, "var(--warning)", ""},
+		{499, "var(--text-secondary)", "Client closed request"},
+		{460, "var(--text-secondary)", "Client closed (ELB)"},
+		{444, "var(--text-secondary)", "Closed, no response"},
+		{0, "var(--text-secondary)", "No response"},
+		{503, "var(--error)", ""},
+		{101, "var(--text-secondary)", ""},
+	}
+
+	for _, tt := range tests {
+		if got := statusCodeColor(tt.status); got != tt.wantColor {
+			t.Errorf("statusCodeColor(%d) = %s, want %s", tt.status, got, tt.wantColor)
+		}
+		if got := statusLabel(tt.status); got != tt.wantLabel {
+			t.Errorf("statusLabel(%d) = %q, want %q", tt.status, got, tt.wantLabel)
+		}
+	}
+}
+
+func TestLatencyColor(t *testing.T) {
+	tests := []struct {
+		ms         int64
+		warn, crit int
+		want       string
+	}{
+		{120, 300, 1000, "var(--success)"},
+		{300, 300, 1000, "var(--warning)"},
+		{999, 300, 1000, "var(--warning)"},
+		{1000, 300, 1000, "var(--error)"},
+		{5000, 0, 0, "inherit"},
+	}
+
+	for _, tt := range tests {
+		if got := latencyColor(tt.ms, tt.warn, tt.crit); got != tt.want {
+			t.Errorf("latencyColor(%d, %d, %d) = %s, want %s", tt.ms, tt.warn, tt.crit, got, tt.want)
+		}
+	}
+}
+
 func TestGenerateRedirectSuggestion(t *testing.T) {
 	tests := []struct {
 		path        string
@@ -139,3 +190,76 @@ func TestApplyRedirectSuggestions(t *testing.T) {
 		t.Errorf("expected Traefik suggestion for %s", paths[1].Path)
 	}
 }
+
+func TestRotateHours(t *testing.T) {
+	stats := []HourOfDayStat{{Hour: 0}, {Hour: 3}, {Hour: 6}, {Hour: 9}, {Hour: 23}}
+
+	rotateHours(stats, 6)
+	var got []int
+	for _, s := range stats {
+		got = append(got, s.Hour)
+	}
+	want := []int{6, 9, 23, 0, 3}
+	if !slices.Equal(got, want) {
+		t.Errorf("rotateHours(6) order = %v, want %v", got, want)
+	}
+
+	rotateHours(stats, 0)
+	if stats[0].Hour != 6 {
+		t.Errorf("rotateHours(0) should leave the order alone, got first hour %d", stats[0].Hour)
+	}
+}
+
+func TestMarkPartial(t *testing.T) {
+	now := time.Date(2026, 2, 8, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		label  string
+		minPct int
+		want   bool
+	}{
+		{"2026-02-08T14:00:00Z", 100, true},  // current hour
+		{"2026-02-08T14:00:00Z", 50, false},  // half the hour has passed
+		{"2026-02-08T14:00:00Z", 0, false},   // disabled
+		{"2026-02-08T13:00:00Z", 100, false}, // finished hour
+		{"2026-02-08", 100, true},            // current day
+		{"2026-02-08", 70, true},             // 60% of the day has passed
+		{"2026-02-07", 100, false},
+		{"Feb 08", 100, false}, // not a bucket label
+	}
+	for _, tt := range tests {
+		points := []TimeSeriesPoint{{Label: "2026-02-01"}, {Label: tt.label}}
+		markPartial(points, now, tt.minPct)
+		if points[1].Partial != tt.want || points[0].Partial {
+			t.Errorf("markPartial(%s, %d%%) = %v, want %v on the last point only", tt.label, tt.minPct, points[1].Partial, tt.want)
+		}
+	}
+	markPartial(nil, now, 100)
+}
+
+func TestSortSections(t *testing.T) {
+	sections := []SectionStat{
+		{Section: "/b", Count: 10, AvgMs: 5},
+		{Section: "/a", Count: 30, AvgMs: 1},
+		{Section: "/c", Count: 20, AvgMs: 9},
+	}
+	order := func() string {
+		var names []string
+		for _, s := range sections {
+			names = append(names, s.Section)
+		}
+		return strings.Join(names, ",")
+	}
+
+	sortSections(sections, "avg_ms", false)
+	if got := order(); got != "/c,/b,/a" {
+		t.Errorf("sort by avg_ms desc = %s, want /c,/b,/a", got)
+	}
+	sortSections(sections, "section", true)
+	if got := order(); got != "/a,/b,/c" {
+		t.Errorf("sort by section asc = %s, want /a,/b,/c", got)
+	}
+	sortSections(sections, "bogus", false)
+	if got := order(); got != "/a,/c,/b" {
+		t.Errorf("sort by unknown key = %s, want by count /a,/c,/b", got)
+	}
+}
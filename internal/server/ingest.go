@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIngestBytes bounds the decompressed body of one push, so a small
+// gzip bomb can't expand without limit. The request body itself is
+// bounded by Fiber's 4 MB default.
+const maxIngestBytes = 64 << 20
+
+// ingestTimeout bounds how long a push waits for the aggregator to take
+// its lines before giving up with 503
+const ingestTimeout = 30 * time.Second
+
+// errIngestTooLarge is returned by ingestLimit past maxIngestBytes
+var errIngestTooLarge = errors.New("body over 64 MB decompressed")
+
+// SetIngestLines enables POST /api/ingest (with TRAIL_INGEST_TOKEN set),
+// which sends the pushed log lines to lines
+func (s *Server) SetIngestLines(lines chan<- string) {
+	s.ingestLines = lines
+}
+
+// handleIngest accepts newline-delimited log lines pushed by a remote
+// host, gzip-compressed with Content-Encoding: gzip or plain, and hands
+// them to the aggregator like lines read from a log file. It answers
+// {"accepted":N}; on an error part way through, the first N lines were
+// taken and the sender should resend only the rest.
+func (s *Server) handleIngest(c *fiber.Ctx) error {
+	if !validBearer(c.Get(fiber.HeaderAuthorization), s.config.IngestToken) {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="trail"`)
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or missing bearer token"})
+	}
+	if s.ingestLines == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "no aggregator attached"})
+	}
+	if s.ingest != nil && s.ingest.Paused() {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(503).JSON(fiber.Map{"error": "ingestion paused"})
+	}
+
+	var body io.Reader = bytes.NewReader(c.BodyRaw())
+	switch enc := strings.ToLower(c.Get(fiber.HeaderContentEncoding)); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid gzip body"})
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return c.Status(415).JSON(fiber.Map{"error": "unsupported Content-Encoding " + enc})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), ingestTimeout)
+	defer cancel()
+
+	accepted := 0
+	scanner := bufio.NewScanner(&ingestLimit{r: body, left: maxIngestBytes})
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		select {
+		case s.ingestLines <- line:
+			accepted++
+		case <-ctx.Done():
+			return c.Status(503).JSON(fiber.Map{"error": "aggregator busy", "accepted": accepted})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		status := 400
+		if errors.Is(err, errIngestTooLarge) {
+			status = 413
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error(), "accepted": accepted})
+	}
+	return c.JSON(fiber.Map{"accepted": accepted})
+}
+
+// validBearer reports whether header is "Bearer <token>", comparing the
+// token in constant time
+func validBearer(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// ingestLimit reads at most left bytes of r, then fails with
+// errIngestTooLarge rather than truncating silently
+type ingestLimit struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *ingestLimit) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		// One more byte tells a body of exactly the limit from a longer one
+		var one [1]byte
+		if n, _ := l.r.Read(one[:]); n > 0 {
+			return 0, errIngestTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestIngest(t *testing.T) {
+	srv := newTestServer(t, &config.Config{IngestToken: "s3cret", AuthUser: "admin", AuthPass: "pw"}, testDB(t))
+	lines := make(chan string, 10)
+	srv.SetIngestLines(lines)
+
+	push := func(token, encoding string, body io.Reader) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/ingest", body)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("POST /api/ingest: %v", err)
+		}
+		var got map[string]any
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+	drain := func() []string {
+		var got []string
+		for len(lines) > 0 {
+			got = append(got, <-lines)
+		}
+		return got
+	}
+
+	// The bearer token, not the dashboard's basic auth, admits a push
+	if code, _ := push("", "", strings.NewReader("a\n")); code != 401 {
+		t.Errorf("push without a token = %d, want 401", code)
+	}
+	if code, _ := push("wrong", "", strings.NewReader("a\n")); code != 401 {
+		t.Errorf("push with a wrong token = %d, want 401", code)
+	}
+
+	code, body := push("s3cret", "", strings.NewReader("line 1\r\n\nline 2"))
+	if code != 200 || body["accepted"] != float64(2) {
+		t.Errorf("plain push = %d %v, want 2 accepted", code, body)
+	}
+	if got := drain(); !slices.Equal(got, []string{"line 1", "line 2"}) {
+		t.Errorf("plain push sent %q", got)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("line 3\nline 4\n"))
+	zw.Close()
+	if code, body := push("s3cret", "gzip", &gz); code != 200 || body["accepted"] != float64(2) {
+		t.Errorf("gzip push = %d %v, want 2 accepted", code, body)
+	}
+	if got := drain(); !slices.Equal(got, []string{"line 3", "line 4"}) {
+		t.Errorf("gzip push sent %q", got)
+	}
+
+	if code, _ := push("s3cret", "gzip", strings.NewReader("not gzip")); code != 400 {
+		t.Errorf("push of invalid gzip = %d, want 400", code)
+	}
+	if code, _ := push("s3cret", "br", strings.NewReader("x")); code != 415 {
+		t.Errorf("push with Content-Encoding br = %d, want 415", code)
+	}
+
+	// While paused, senders are told to retry later
+	srv.SetPauser(&fakePauser{paused: true})
+	if code, _ := push("s3cret", "", strings.NewReader("line 5\n")); code != 503 || len(lines) != 0 {
+		t.Errorf("push while paused = %d with %d lines sent, want 503 and none", code, len(lines))
+	}
+}
+
+func TestIngestDisabledWithoutToken(t *testing.T) {
+	srv := newTestServer(t, &config.Config{}, testDB(t))
+	srv.SetIngestLines(make(chan string, 1))
+	resp, err := srv.app.Test(httptest.NewRequest("POST", "/api/ingest", strings.NewReader("a\n")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 && resp.StatusCode != 405 {
+		t.Errorf("POST /api/ingest without TRAIL_INGEST_TOKEN = %d, want it not routed", resp.StatusCode)
+	}
+}
+
+func TestIngestLimit(t *testing.T) {
+	r := &ingestLimit{r: strings.NewReader("12345"), left: 5}
+	if got, err := io.ReadAll(r); err != nil || string(got) != "12345" {
+		t.Errorf("body of exactly the limit = %q, %v, want it all", got, err)
+	}
+	r = &ingestLimit{r: strings.NewReader("123456"), left: 5}
+	if _, err := io.ReadAll(r); err != errIngestTooLarge {
+		t.Errorf("body over the limit: err = %v, want errIngestTooLarge", err)
+	}
+}
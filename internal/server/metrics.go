@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-wander/trail/internal/metrics"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// handleMetrics serves the current hour's traffic in the Prometheus text
+// format. trail_requests_current_hour is labelled by TRAIL_METRICS_LABELS,
+// with paths past TRAIL_METRICS_MAX_PATHS folded into "(other)" so a scan
+// can't flood Prometheus with series. It is a gauge, not a counter: it drops
+// to zero every UTC hour, and rate() over a counter reset would lose the
+// requests between the last scrape and the hour boundary. Trail's own
+// counters, such as lines dropped by the tailer, follow.
+func (s *Server) handleMetrics(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	hour := time.Now().UTC().Truncate(time.Hour).Format("2006-01-02T15:00:00Z")
+	labels := s.config.MetricsLabels
+	series, err := s.queries.HourRequestSeries(ctx, hour, labels, s.config.MetricsMaxPaths)
+	if err != nil {
+		log.Printf("Error loading metrics: %v", err)
+		return c.Status(500).SendString("Error loading metrics")
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP trail_requests_current_hour Requests in the current UTC hour.\n")
+	b.WriteString("# TYPE trail_requests_current_hour gauge\n")
+	for _, row := range series {
+		b.WriteString("trail_requests_current_hour")
+		if len(labels) > 0 {
+			pairs := make([]string, len(labels))
+			for i, label := range labels {
+				pairs[i] = fmt.Sprintf(`%s="%s"`, label, metrics.EscapeLabel(row.Values[i]))
+			}
+			b.WriteString("{" + strings.Join(pairs, ",") + "}")
+		}
+		fmt.Fprintf(&b, " %d\n", row.Count)
+	}
+
+	f := s.freshness(ctx)
+	b.WriteString("# HELP trail_data_as_of_timestamp_seconds When the newest ingested data was current.\n")
+	b.WriteString("# TYPE trail_data_as_of_timestamp_seconds gauge\n")
+	var asOf int64
+	if !f.AsOf.IsZero() {
+		asOf = f.AsOf.Unix()
+	}
+	fmt.Fprintf(&b, "trail_data_as_of_timestamp_seconds %d\n", asOf)
+	b.WriteString("# HELP trail_ingest_paused Whether ingestion is paused via /api/admin/pause.\n")
+	b.WriteString("# TYPE trail_ingest_paused gauge\n")
+	paused := 0
+	if f.Paused {
+		paused = 1
+	}
+	fmt.Fprintf(&b, "trail_ingest_paused %d\n", paused)
+	metrics.Default.WriteText(&b)
+
+	c.Set("Content-Type", metricsContentType)
+	return c.SendString(b.String())
+}
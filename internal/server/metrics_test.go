@@ -0,0 +1,78 @@
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+	"github.com/open-wander/trail/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339)
+	earlier := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour).Format(time.RFC3339)
+	seedRequests(t, db,
+		requestRow{hour, "web", "/", "GET", 200, 30, 1, 1},
+		requestRow{hour, "web", "/", "POST", 200, 5, 1, 1},
+		requestRow{hour, "web", "/api", "GET", 500, 20, 1, 1},
+		requestRow{hour, "web", "/api", "GET", 200, 2, 1, 1},
+		requestRow{hour, "web", "/say\"hi\"", "GET", 404, 3, 1, 1},
+		requestRow{hour, "web", "/rare", "GET", 404, 1, 1, 1},
+		requestRow{earlier, "web", "/old", "GET", 200, 99, 1, 1},
+	)
+
+	scrape := func(cfg *config.Config) string {
+		t.Helper()
+		resp, err := newTestServer(t, cfg, db).app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		if err != nil {
+			t.Fatalf("GET /metrics: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Fatalf("GET /metrics = %d %s, want 200 text format", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return string(body)
+	}
+
+	metrics.Default.Counter("trail_test_dropped_total", "Lines dropped in TestMetrics.", "file", "access.log").Add(7)
+
+	body := scrape(&config.Config{Listen: ":0", MetricsLabels: []string{"router"}, MetricsMaxPaths: 50})
+	for _, want := range []string{
+		"# TYPE trail_requests_current_hour gauge\n",
+		`trail_requests_current_hour{router="web"} 61` + "\n",
+		"trail_ingest_paused 0\n",
+		`trail_test_dropped_total{file="access.log"} 7` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics missing %q in:\n%s", want, body)
+		}
+	}
+
+	body = scrape(&config.Config{Listen: ":0", MetricsLabels: []string{"path", "status"}, MetricsMaxPaths: 2})
+	for _, want := range []string{
+		`trail_requests_current_hour{path="/",status="200"} 35` + "\n",
+		`trail_requests_current_hour{path="/api",status="500"} 20` + "\n",
+		`trail_requests_current_hour{path="(other)",status="404"} 4` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "/rare") || strings.Contains(body, "/old") {
+		t.Errorf("GET /metrics = %s, want paths past the cap and other hours left out", body)
+	}
+
+	body = scrape(&config.Config{Listen: ":0", MetricsLabels: []string{"path"}, MetricsMaxPaths: 3})
+	if want := `trail_requests_current_hour{path="/say\"hi\""} 3` + "\n"; !strings.Contains(body, want) {
+		t.Errorf("GET /metrics missing escaped %q in:\n%s", want, body)
+	}
+
+	body = scrape(&config.Config{Listen: ":0", MetricsMaxPaths: 50})
+	if !strings.Contains(body, "trail_requests_current_hour 61\n") {
+		t.Errorf("GET /metrics without labels = %s, want one series of 61", body)
+	}
+}
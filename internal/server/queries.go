@@ -1,33 +1,150 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/open-wander/trail/internal/aggregator"
+	"github.com/open-wander/trail/internal/bot"
 )
 
 // Queries wraps database access for dashboard metrics
 type Queries struct {
-	db *sql.DB
+	db           *sql.DB
+	knownMethods map[string]bool
+
+	// SuccessRate criteria, see SetSuccessCriteria
+	successBelow     int
+	successIgnore404 bool
+
+	// Visits: a visitor's next hour more than this many hours after their
+	// previous one starts a new visit, see SetVisitGap
+	visitGapHours int
+
+	// Rows kept by breakdowns without a limit of their own, see SetBreakdownLimit
+	breakdownLimit int
 }
 
+// standardMethods are the HTTP methods shown individually in method breakdowns
+var standardMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+
+// OtherMethod labels the bucket that non-standard methods are grouped into
+const OtherMethod = "Other"
+
+// OtherStatus stands for the statuses folded together past the breakdown
+// limit in SpecificStatusCodes
+const OtherStatus = -1
+
 // NewQueries creates a new query handler
 func NewQueries(db *sql.DB) *Queries {
-	return &Queries{db: db}
+	q := &Queries{db: db}
+	q.SetKnownMethods(nil)
+	q.SetSuccessCriteria(0, false)
+	q.SetVisitGap(0)
+	q.SetBreakdownLimit(0)
+	return q
+}
+
+// defaultSuccessBelow is the SuccessRate cutoff: 2xx and 3xx count as success
+const defaultSuccessBelow = 400
+
+// SetSuccessCriteria sets what SuccessRate counts: statuses below below are
+// successes (0 means defaultSuccessBelow), and with ignore404 404s are left
+// out of the rate entirely, so probes for missing pages don't drag it down.
+func (q *Queries) SetSuccessCriteria(below int, ignore404 bool) {
+	if below <= 0 {
+		below = defaultSuccessBelow
+	}
+	q.successBelow = below
+	q.successIgnore404 = ignore404
+}
+
+// defaultVisitGapHours makes any hour without the visitor end their visit
+const defaultVisitGapHours = 1
+
+// SetVisitGap sets how many hours apart a visitor's hits may be and still
+// count as one visit (0 means defaultVisitGapHours)
+func (q *Queries) SetVisitGap(hours int) {
+	if hours <= 0 {
+		hours = defaultVisitGapHours
+	}
+	q.visitGapHours = hours
+}
+
+// defaultBreakdownLimit is the number of rows a breakdown keeps
+const defaultBreakdownLimit = 50
+
+// SetBreakdownLimit caps the rows of the status code, method and user agent
+// breakdowns and of Routers (0 means defaultBreakdownLimit). Breakdowns
+// fold the rest into one "other" row, so a flood of fabricated values
+// can't blow up memory or rendering.
+func (q *Queries) SetBreakdownLimit(n int) {
+	if n <= 0 {
+		n = defaultBreakdownLimit
+	}
+	q.breakdownLimit = n
+}
+
+// SetKnownMethods adds extra methods (e.g. WebDAV's PROPFIND) to the standard
+// set shown individually in method breakdowns. Anything else is grouped as
+// OtherMethod there and reported by UnusualMethods.
+func (q *Queries) SetKnownMethods(extra []string) {
+	q.knownMethods = make(map[string]bool, len(standardMethods)+len(extra))
+	for _, m := range standardMethods {
+		q.knownMethods[m] = true
+	}
+	for _, m := range extra {
+		q.knownMethods[strings.ToUpper(m)] = true
+	}
 }
 
 // Filter defines common filtering parameters for queries
 type Filter struct {
-	From        string // hour start, e.g. "2026-02-08T00:00:00Z"
-	To          string // hour end, e.g. "2026-02-08T23:00:00Z"
-	Router      string // empty = all routers, or specific router name
-	IncludeBots bool   // if false, exclude router="unrouted" and bot UA categories
+	From        string   // hour start, e.g. "2026-02-08T00:00:00Z"
+	To          string   // hour end, e.g. "2026-02-08T23:00:00Z"
+	Router      string   // empty = all routers, or specific router name
+	Routers     []string // if set, restricts to these routers instead of Router
+	Host        string   // empty = all hosts, or a requested host; see allHosts
+	IncludeBots bool     // if false, exclude router="unrouted" and bot UA categories
+
+	// IncludeUnrouted keeps router="unrouted" even when IncludeBots is false
+	// (TRAIL_UNROUTED_IS_REAL)
+	IncludeUnrouted bool
+}
+
+// routerCondition returns the SQL condition and args restricting f to its
+// router(s), or "" if f covers all routers
+func routerCondition(f Filter) (string, []interface{}) {
+	if len(f.Routers) > 0 {
+		args := make([]interface{}, len(f.Routers))
+		for i, r := range f.Routers {
+			args[i] = r
+		}
+		return "router IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(f.Routers)), ", ") + ")", args
+	}
+	if f.Router != "" {
+		return "router = ?", []interface{}{f.Router}
+	}
+	return "", nil
+}
+
+// allHosts drops the host filter, for queries on tables that don't record
+// the requested host: their panels cover every host of the routers
+func (f Filter) allHosts() Filter {
+	f.Host = ""
+	return f
 }
 
 // TimeSeriesPoint represents a single time-based data point
 type TimeSeriesPoint struct {
-	Label string // hour or date
-	Count int64
+	Label   string // hour or date
+	Count   int64
+	Partial bool // bucket still in progress, see markPartial
 }
 
 // PathStat represents statistics for a single path
@@ -36,6 +153,7 @@ type PathStat struct {
 	Count             int64
 	AvgMs             int64 // average duration
 	Bytes             int64
+	AvgBytes          int64 // average response size; only set by TopPathsPaginated
 	Pct               float64
 	Trend             []int64 // daily request counts for sparkline
 	Suggestion        string  // optional redirect hint for suspicious 404 paths
@@ -49,6 +167,13 @@ type UserAgentStat struct {
 	Pct      float64
 }
 
+// RawUserAgentStat represents statistics for a full User-Agent string
+type RawUserAgentStat struct {
+	UserAgent string
+	Count     int64
+	Pct       float64
+}
+
 // MethodStat represents statistics for an HTTP method
 type MethodStat struct {
 	Method string
@@ -93,6 +218,7 @@ type PaginatedResult struct {
 type PathsSummaryResult struct {
 	TotalHits  int64
 	TotalBytes int64
+	AvgBytes   int64
 	AvgMs      int64
 	MinMs      int64
 	MaxMs      int64
@@ -102,12 +228,14 @@ type PathsSummaryResult struct {
 type ReferrerStat struct {
 	Referrer string
 	Count    int64
+	Pct      float64
 }
 
 // StatusStat represents statistics for a status code class
 type StatusStat struct {
 	Class string // "2xx", "3xx", "4xx", "5xx"
 	Count int64
+	Pct   float64
 }
 
 // TotalStat represents summary statistics
@@ -115,13 +243,14 @@ type TotalStat struct {
 	Requests int64
 	Visitors int64
 	Bytes    int64
-	AvgMs    int64
+	AvgMs    int64 // request-weighted mean: SUM(duration) / SUM(count) across all rows
 }
 
 // ScannerStat represents statistics for a scanner IP
 type ScannerStat struct {
 	IPHash string
 	Count  int64
+	Pct    float64
 }
 
 // ThreatPatternStat represents a threat category with count and example paths
@@ -132,6 +261,33 @@ type ThreatPatternStat struct {
 	Pct      float64
 }
 
+// Percentages: every list stat's Pct is filled in by the query method that
+// returns it, never by handlers or templates. Each method's doc says what it
+// is relative to, which is one of:
+//   - the breakdown total: the sum over every row of that breakdown, including
+//     rows cut off by a limit (e.g. a country's share of geolocated requests)
+//   - all requests: every request matching the filter, for lists that pick
+//     out a subset such as 404 or 5xx paths, so the share reads as "of traffic"
+// Limited queries get the breakdown total from a SUM(...) OVER () window,
+// which is computed before LIMIT applies.
+
+// pctOf returns count as a percentage of total, or 0 for an empty total
+func pctOf(count, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(count) / float64(total) * 100
+}
+
+// requestTotal returns the number of requests matching f, the denominator
+// for "of all requests" percentages on subset lists
+func (q *Queries) requestTotal(ctx context.Context, f Filter) (int64, error) {
+	where, args := buildWhere(f)
+	var total int64
+	err := q.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(SUM(count), 0) FROM requests %s", where), args...).Scan(&total)
+	return total, err
+}
+
 // buildWhere constructs WHERE clause with conditions based on filter
 func buildWhere(f Filter) (string, []interface{}) {
 	var conditions []string
@@ -140,11 +296,15 @@ func buildWhere(f Filter) (string, []interface{}) {
 	conditions = append(conditions, "hour >= ?", "hour <= ?")
 	args = append(args, f.From, f.To)
 
-	if f.Router != "" {
-		conditions = append(conditions, "router = ?")
-		args = append(args, f.Router)
+	if cond, condArgs := routerCondition(f); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+	if f.Host != "" {
+		conditions = append(conditions, "host = ?")
+		args = append(args, f.Host)
 	}
-	if !f.IncludeBots {
+	if !f.IncludeBots && !f.IncludeUnrouted {
 		conditions = append(conditions, "router != 'unrouted'")
 	}
 
@@ -152,7 +312,7 @@ func buildWhere(f Filter) (string, []interface{}) {
 }
 
 // RequestsOverTime returns hourly/daily request counts
-func (q *Queries) RequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
+func (q *Queries) RequestsOverTime(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -163,7 +323,7 @@ func (q *Queries) RequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
 		ORDER BY hour
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +342,7 @@ func (q *Queries) RequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
 }
 
 // DailyRequestsOverTime returns daily request counts (for 7d/30d views)
-func (q *Queries) DailyRequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
+func (q *Queries) DailyRequestsOverTime(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -193,7 +353,7 @@ func (q *Queries) DailyRequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
 		ORDER BY day
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -211,9 +371,11 @@ func (q *Queries) DailyRequestsOverTime(f Filter) ([]TimeSeriesPoint, error) {
 	return results, rows.Err()
 }
 
-// DailyVisitors returns daily unique visitor counts (for 7d/30d views)
-func (q *Queries) DailyVisitors(f Filter) ([]TimeSeriesPoint, error) {
-	where, args := buildWhere(f)
+// DailyVisitors returns daily unique visitor counts (for 7d/30d views).
+// The IP salt is persistent, so a visitor active across many hours of a day
+// counts once for that day.
+func (q *Queries) DailyVisitors(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
 		SELECT SUBSTR(hour, 1, 10) as day, COUNT(DISTINCT ip_hash) as total
@@ -223,7 +385,7 @@ func (q *Queries) DailyVisitors(f Filter) ([]TimeSeriesPoint, error) {
 		ORDER BY day
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -241,8 +403,8 @@ func (q *Queries) DailyVisitors(f Filter) ([]TimeSeriesPoint, error) {
 	return results, rows.Err()
 }
 
-// TopPaths returns top paths by request count
-func (q *Queries) TopPaths(f Filter, limit int) ([]PathStat, error) {
+// TopPaths returns top paths by request count. Pct is of all requests.
+func (q *Queries) TopPaths(ctx context.Context, f Filter, limit int) ([]PathStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -253,7 +415,8 @@ func (q *Queries) TopPaths(f Filter, limit int) ([]PathStat, error) {
 				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
 				ELSE 0
 			END as avg_ms,
-			SUM(bytes) as total_bytes
+			SUM(bytes) as total_bytes,
+			SUM(SUM(count)) OVER () as grand_total
 		FROM requests
 		%s
 		GROUP BY path
@@ -262,107 +425,206 @@ func (q *Queries) TopPaths(f Filter, limit int) ([]PathStat, error) {
 	`, where)
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var results []PathStat
+	var grandTotal int64
 	for rows.Next() {
 		var stat PathStat
-		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes); err != nil {
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
-// TopReferrers returns top referrers by count
-func (q *Queries) TopReferrers(f Filter, limit int) ([]ReferrerStat, error) {
-	where, args := buildWhere(f)
+// PathCountsInPeriods returns the requests to each of paths in the periods
+// of a and b, which must differ only in From and To, in one pass. Paths
+// without requests in a period are absent from its map.
+func (q *Queries) PathCountsInPeriods(ctx context.Context, a, b Filter, paths []string) (map[string]int64, map[string]int64, error) {
+	countsA := make(map[string]int64, len(paths))
+	countsB := make(map[string]int64, len(paths))
+	if len(paths) == 0 {
+		return countsA, countsB, nil
+	}
 
+	span := a
+	span.From, span.To = min(a.From, b.From), max(a.To, b.To)
+	where, args := buildWhere(span)
 	query := fmt.Sprintf(`
-		SELECT referrer, SUM(count) as total
-		FROM referrers
-		%s
-		GROUP BY referrer
-		ORDER BY total DESC
+		SELECT
+			path,
+			SUM(CASE WHEN hour >= ? AND hour <= ? THEN count ELSE 0 END),
+			SUM(CASE WHEN hour >= ? AND hour <= ? THEN count ELSE 0 END)
+		FROM requests
+		%s AND path IN (%s)
+		GROUP BY path
+	`, where, strings.TrimSuffix(strings.Repeat("?, ", len(paths)), ", "))
+
+	args = append([]interface{}{a.From, a.To, b.From, b.To}, args...)
+	for _, p := range paths {
+		args = append(args, p)
+	}
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path string
+		var inA, inB int64
+		if err := rows.Scan(&path, &inA, &inB); err != nil {
+			return nil, nil, err
+		}
+		if inA > 0 {
+			countsA[path] = inA
+		}
+		if inB > 0 {
+			countsB[path] = inB
+		}
+	}
+	return countsA, countsB, rows.Err()
+}
+
+// TopPathsForHour returns the top paths within a single hour bucket
+// (e.g. "2026-02-08T10:00:00Z"). Matching hour exactly uses the primary key
+// prefix, so this stays cheap for live views. f.From and f.To are ignored.
+// Pct is of all requests in that hour.
+func (q *Queries) TopPathsForHour(ctx context.Context, f Filter, hour string, limit int) ([]PathStat, error) {
+	conditions := []string{"hour = ?"}
+	args := []interface{}{hour}
+	if cond, condArgs := routerCondition(f); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+	if f.Host != "" {
+		conditions = append(conditions, "host = ?")
+		args = append(args, f.Host)
+	}
+	if !f.IncludeBots && !f.IncludeUnrouted {
+		conditions = append(conditions, "router != 'unrouted'")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			path,
+			SUM(count) as total_count,
+			CASE
+				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
+				ELSE 0
+			END as avg_ms,
+			SUM(bytes) as total_bytes,
+			SUM(SUM(count)) OVER () as grand_total
+		FROM requests
+		WHERE %s
+		GROUP BY path
+		ORDER BY total_count DESC
 		LIMIT ?
-	`, where)
+	`, strings.Join(conditions, " AND "))
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []ReferrerStat
+	var results []PathStat
+	var grandTotal int64
 	for rows.Next() {
-		var stat ReferrerStat
-		if err := rows.Scan(&stat.Referrer, &stat.Count); err != nil {
+		var stat PathStat
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
-// StatusBreakdown returns status code class breakdown
-func (q *Queries) StatusBreakdown(f Filter) ([]StatusStat, error) {
-	where, args := buildWhere(f)
+// fineWhere builds the WHERE clause for requests_fine buckets from since on,
+// scoped like buildWhere. f.From and f.To are ignored, and so is f.Host,
+// since requests_fine doesn't record the host.
+func fineWhere(f Filter, since string) (string, []interface{}) {
+	conditions := []string{"bucket >= ?"}
+	args := []interface{}{since}
+	if cond, condArgs := routerCondition(f); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+	if !f.IncludeBots && !f.IncludeUnrouted {
+		conditions = append(conditions, "router != 'unrouted'")
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// TopPathsSince returns the top paths in requests_fine from bucket since
+// (e.g. "2026-02-08T10:20:00Z") on, for live views finer than an hour.
+// Pct is of all requests in that window.
+func (q *Queries) TopPathsSince(ctx context.Context, f Filter, since string, limit int) ([]PathStat, error) {
+	where, args := fineWhere(f, since)
 
 	query := fmt.Sprintf(`
 		SELECT
+			path,
+			SUM(count) as total_count,
 			CASE
-				WHEN status >= 200 AND status < 300 THEN '2xx'
-				WHEN status >= 300 AND status < 400 THEN '3xx'
-				WHEN status >= 400 AND status < 500 THEN '4xx'
-				WHEN status >= 500 AND status < 600 THEN '5xx'
-				ELSE 'other'
-			END as class,
-			SUM(count) as total
-		FROM requests
+				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
+				ELSE 0
+			END as avg_ms,
+			SUM(bytes) as total_bytes,
+			SUM(SUM(count)) OVER () as grand_total
+		FROM requests_fine
 		%s
-		GROUP BY class
-		ORDER BY class
+		GROUP BY path
+		ORDER BY total_count DESC
+		LIMIT ?
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []StatusStat
+	var results []PathStat
+	var grandTotal int64
 	for rows.Next() {
-		var stat StatusStat
-		if err := rows.Scan(&stat.Class, &stat.Count); err != nil {
+		var stat PathStat
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
-// UniqueVisitors returns unique visitor counts per hour
-func (q *Queries) UniqueVisitors(f Filter) ([]TimeSeriesPoint, error) {
-	where, args := buildWhere(f)
+// FineRequestsSince returns request counts per requests_fine bucket from
+// since on, in bucket order. Buckets without traffic are absent.
+func (q *Queries) FineRequestsSince(ctx context.Context, f Filter, since string) ([]TimeSeriesPoint, error) {
+	where, args := fineWhere(f, since)
 
 	query := fmt.Sprintf(`
-		SELECT hour, COUNT(DISTINCT ip_hash) as total
-		FROM visitors
+		SELECT bucket, SUM(count) as total
+		FROM requests_fine
 		%s
-		GROUP BY hour
-		ORDER BY hour
+		GROUP BY bucket
+		ORDER BY bucket
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -380,150 +642,627 @@ func (q *Queries) UniqueVisitors(f Filter) ([]TimeSeriesPoint, error) {
 	return results, rows.Err()
 }
 
-// TotalStats returns summary statistics
-func (q *Queries) TotalStats(f Filter) (*TotalStat, error) {
-	where, args := buildWhere(f)
+// TopReferrers returns top referrers by count. Pct is of all requests
+// with a referrer, including those outside the top limit.
+func (q *Queries) TopReferrers(ctx context.Context, f Filter, limit int) ([]ReferrerStat, error) {
+	where, args := buildWhere(f.allHosts())
 
-	// Get request stats
-	requestQuery := fmt.Sprintf(`
-		SELECT
-			COALESCE(SUM(count), 0) as total_requests,
-			COALESCE(SUM(bytes), 0) as total_bytes,
-			CASE
-				WHEN COALESCE(SUM(count), 0) > 0 THEN SUM(duration) / SUM(count)
-				ELSE 0
-			END as avg_ms
-		FROM requests
+	query := fmt.Sprintf(`
+		SELECT referrer, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM referrers
 		%s
+		GROUP BY referrer
+		ORDER BY total DESC
+		LIMIT ?
 	`, where)
 
-	var stat TotalStat
-	err := q.db.QueryRow(requestQuery, args...).Scan(&stat.Requests, &stat.Bytes, &stat.AvgMs)
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Get visitor count
-	visitorQuery := fmt.Sprintf(`
-		SELECT COUNT(DISTINCT ip_hash)
-		FROM visitors
-		%s
-	`, where)
-
-	err = q.db.QueryRow(visitorQuery, args...).Scan(&stat.Visitors)
-	if err != nil {
-		return nil, err
+	var results []ReferrerStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat ReferrerStat
+		if err := rows.Scan(&stat.Referrer, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
 	}
 
-	return &stat, nil
+	return results, rows.Err()
 }
 
-// Routers returns list of all distinct routers
-func (q *Queries) Routers() ([]string, error) {
-	query := `
-		SELECT DISTINCT router
-		FROM requests
-		WHERE router != ''
-		ORDER BY router
-	`
-
-	rows, err := q.db.Query(query)
-	if err != nil {
+// goalSourceLimit is how many referrers and entry paths goal attribution lists
+const goalSourceLimit = 10
+
+// GoalSourceStat is a referrer or entry path by the visitor-hours it began
+// and how many of those reached the goal
+type GoalSourceStat struct {
+	Source      string
+	Visits      int64   // visitor-hours that began here
+	Conversions int64   // of those, how many reached the goal
+	Rate        float64 // Conversions as a percentage of Visits
+	Pct         float64 // of all conversions
+}
+
+// GoalAttributionStat attributes goal hits to where visits began
+type GoalAttributionStat struct {
+	Goal        string
+	Visits      int64 // all visitor-hours
+	Conversions int64 // visitor-hours that reached the goal
+	Rate        float64
+	Referrers   []GoalSourceStat // "" is direct, aggregator.InternalReferrer a visit continuing from an earlier hour
+	EntryPaths  []GoalSourceStat
+}
+
+// GoalAttribution returns the referrers and entry paths that most often
+// precede a hit on goalPath, from visitor_entries (TRAIL_GOAL_PATH). Without
+// sessions this is an approximation: a visit is a visitor-hour, credited to
+// the first referrer and path seen for that IP in that hour, so a visit
+// crossing the hour boundary is split and shared IPs are merged.
+func (q *Queries) GoalAttribution(ctx context.Context, f Filter, goalPath string) (*GoalAttributionStat, error) {
+	where, args := buildWhere(f.allHosts())
+	stat := &GoalAttributionStat{Goal: goalPath}
+
+	if err := q.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(goal = ?), 0) FROM visitor_entries %s
+	`, where), append([]interface{}{goalPath}, args...)...).Scan(&stat.Visits, &stat.Conversions); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if stat.Conversions == 0 {
+		return stat, nil
+	}
+	stat.Rate = pctOf(stat.Conversions, stat.Visits)
 
-	var routers []string
-	for rows.Next() {
-		var router string
-		if err := rows.Scan(&router); err != nil {
+	sources := func(column string) ([]GoalSourceStat, error) {
+		rows, err := q.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s, COUNT(*) as visits, SUM(goal = ?) as conversions
+			FROM visitor_entries
+			%s
+			GROUP BY %s
+			HAVING conversions > 0
+			ORDER BY conversions DESC, visits DESC
+			LIMIT ?
+		`, column, where, column), append(append([]interface{}{goalPath}, args...), goalSourceLimit)...)
+		if err != nil {
 			return nil, err
 		}
-		routers = append(routers, router)
+		defer rows.Close()
+
+		var results []GoalSourceStat
+		for rows.Next() {
+			var s GoalSourceStat
+			if err := rows.Scan(&s.Source, &s.Visits, &s.Conversions); err != nil {
+				return nil, err
+			}
+			s.Rate = pctOf(s.Conversions, s.Visits)
+			s.Pct = pctOf(s.Conversions, stat.Conversions)
+			results = append(results, s)
+		}
+		return results, rows.Err()
 	}
 
-	return routers, rows.Err()
+	var err error
+	if stat.Referrers, err = sources("referrer"); err != nil {
+		return nil, err
+	}
+	if stat.EntryPaths, err = sources("entry_path"); err != nil {
+		return nil, err
+	}
+	return stat, nil
 }
 
-// SecurityOverTime returns unrouted and bot traffic over time
-func (q *Queries) SecurityOverTime(f Filter) ([]TimeSeriesPoint, error) {
-	// Build custom where clause that includes unrouted traffic
-	var conditions []string
-	var args []interface{}
-
-	conditions = append(conditions, "hour >= ?", "hour <= ?")
-	args = append(args, f.From, f.To)
-
-	// For security view, we want unrouted traffic
-	conditions = append(conditions, "router = 'unrouted'")
-
-	where := "WHERE " + strings.Join(conditions, " AND ")
+// StatusBreakdown returns status code class breakdown. Pct is of all requests.
+func (q *Queries) StatusBreakdown(ctx context.Context, f Filter) ([]StatusStat, error) {
+	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
-		SELECT hour, SUM(count) as total
+		SELECT
+			CASE
+				WHEN status >= 200 AND status < 300 THEN '2xx'
+				WHEN status >= 300 AND status < 400 THEN '3xx'
+				WHEN status >= 400 AND status < 500 THEN '4xx'
+				WHEN status >= 500 AND status < 600 THEN '5xx'
+				ELSE 'other'
+			END as class,
+			SUM(count) as total
 		FROM requests
 		%s
-		GROUP BY hour
-		ORDER BY hour
+		GROUP BY class
+		ORDER BY class
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []TimeSeriesPoint
+	var results []StatusStat
+	var grandTotal int64
 	for rows.Next() {
-		var point TimeSeriesPoint
-		if err := rows.Scan(&point.Label, &point.Count); err != nil {
+		var stat StatusStat
+		if err := rows.Scan(&stat.Class, &stat.Count); err != nil {
 			return nil, err
 		}
-		results = append(results, point)
+		grandTotal += stat.Count
+		results = append(results, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return results, rows.Err()
+	for i := range results {
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
+	}
+
+	return results, nil
 }
 
-// TopProbedPaths returns most frequently probed paths from unrouted traffic
-func (q *Queries) TopProbedPaths(limit int) ([]PathStat, error) {
-	query := `
+// SuccessRate returns the percentage of requests matching f with a status
+// below the SetSuccessCriteria cutoff, or 0 without traffic. Status 0 (a
+// line logged without one) is never a success.
+func (q *Queries) SuccessRate(ctx context.Context, f Filter) (float64, error) {
+	where, args := buildWhere(f)
+	if q.successIgnore404 {
+		where += " AND status != 404"
+	}
+
+	query := fmt.Sprintf(`
 		SELECT
-			path,
-			SUM(count) as total_count,
-			CASE
-				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
+			COALESCE(SUM(CASE WHEN status > 0 AND status < ? THEN count ELSE 0 END), 0),
+			COALESCE(SUM(count), 0)
+		FROM requests
+		%s
+	`, where)
+
+	var success, total int64
+	args = append([]interface{}{q.successBelow}, args...)
+	if err := q.db.QueryRowContext(ctx, query, args...).Scan(&success, &total); err != nil {
+		return 0, err
+	}
+	return pctOf(success, total), nil
+}
+
+// Visits approximates the number of visits: a visitor hash seen in
+// consecutive hours is one visit, and a gap of more than the SetVisitGap
+// hours starts a new one. Hours are the finest grain visitors are stored at,
+// so two short visits within the gap count once. Relies on the persistent IP
+// salt keeping a visitor's hash stable across hours.
+func (q *Queries) Visits(ctx context.Context, f Filter) (int64, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM (
+			SELECT hour, LAG(hour) OVER (PARTITION BY ip_hash ORDER BY hour) as prev
+			FROM (SELECT DISTINCT ip_hash, hour FROM visitors %s)
+		)
+		-- hour gaps are whole numbers; the 0.5 absorbs julianday rounding
+		WHERE prev IS NULL OR (julianday(hour) - julianday(prev)) * 24 > ? + 0.5
+	`, where)
+
+	args = append(args, q.visitGapHours)
+	var visits int64
+	if err := q.db.QueryRowContext(ctx, query, args...).Scan(&visits); err != nil {
+		return 0, err
+	}
+	return visits, nil
+}
+
+// PathConcentration describes how concentrated requests are across paths:
+// the percentage of requests going to the busiest tenth of paths (at least
+// one), and the Gini coefficient of per-path counts, from 0 when every path
+// is requested equally to near 1 when one path takes everything. Paths
+// folded into aggregator.OtherKey are left out since they stand for many.
+func (q *Queries) PathConcentration(ctx context.Context, f Filter) (topDecileShare float64, gini float64, err error) {
+	where, args := buildWhere(f)
+
+	query := fmt.Sprintf(`
+		SELECT SUM(count) as total
+		FROM requests
+		%s
+		GROUP BY path
+		HAVING path != ?
+		ORDER BY total DESC
+	`, where)
+
+	args = append(args, aggregator.OtherKey)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var counts []int64 // descending
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			return 0, 0, err
+		}
+		counts = append(counts, n)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	topDecileShare, gini = concentration(counts)
+	return topDecileShare, gini, nil
+}
+
+// concentration computes PathConcentration's measures from counts sorted
+// in descending order
+func concentration(counts []int64) (topDecileShare float64, gini float64) {
+	n := len(counts)
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if n == 0 || total == 0 {
+		return 0, 0
+	}
+
+	var top int64
+	for _, c := range counts[:(n+9)/10] {
+		top += c
+	}
+
+	// G = 2*sum(i*x_i) / (n*sum(x)) - (n+1)/n over x ascending, i from 1
+	var weighted float64
+	for i, c := range counts {
+		weighted += float64(n-i) * float64(c)
+	}
+	gini = 2*weighted/(float64(n)*float64(total)) - float64(n+1)/float64(n)
+	return pctOf(top, total), gini
+}
+
+// UniqueVisitors returns unique visitor counts per hour
+func (q *Queries) UniqueVisitors(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT hour, COUNT(DISTINCT ip_hash) as total
+		FROM visitors
+		%s
+		GROUP BY hour
+		ORDER BY hour
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []TimeSeriesPoint
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(&point.Label, &point.Count); err != nil {
+			return nil, err
+		}
+		results = append(results, point)
+	}
+
+	return results, rows.Err()
+}
+
+// TotalStats returns summary statistics.
+// AvgMs is weighted by request count, so a busy path contributes
+// proportionally more than a rarely-hit one.
+func (q *Queries) TotalStats(ctx context.Context, f Filter) (*TotalStat, error) {
+	where, args := buildWhere(f)
+
+	// Get request stats
+	requestQuery := fmt.Sprintf(`
+		SELECT
+			COALESCE(SUM(count), 0) as total_requests,
+			COALESCE(SUM(bytes), 0) as total_bytes,
+			CASE
+				WHEN COALESCE(SUM(count), 0) > 0 THEN SUM(duration) / SUM(count)
 				ELSE 0
 			END as avg_ms
 		FROM requests
+		%s
+	`, where)
+
+	var stat TotalStat
+	err := q.db.QueryRowContext(ctx, requestQuery, args...).Scan(&stat.Requests, &stat.Bytes, &stat.AvgMs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get visitor count, across hosts since visitors doesn't record them
+	visitorWhere, visitorArgs := buildWhere(f.allHosts())
+	visitorQuery := fmt.Sprintf(`
+		SELECT COUNT(DISTINCT ip_hash)
+		FROM visitors
+		%s
+	`, visitorWhere)
+
+	err = q.db.QueryRowContext(ctx, visitorQuery, visitorArgs...).Scan(&stat.Visitors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stat, nil
+}
+
+// DataBounds returns the earliest and latest hour buckets present in requests.
+// Both are empty strings when the database holds no data yet.
+func (q *Queries) DataBounds(ctx context.Context) (minHour, maxHour string, err error) {
+	var lo, hi sql.NullString
+	err = q.db.QueryRowContext(ctx, `SELECT MIN(hour), MAX(hour) FROM requests`).Scan(&lo, &hi)
+	if err != nil {
+		return "", "", err
+	}
+	return lo.String, hi.String, nil
+}
+
+// gapQuietPct is the share (%) of the median hourly request count below
+// which an hour counts as quiet for TrafficGaps. On low-traffic sites it
+// rounds down to requiring no requests at all.
+const gapQuietPct = 1
+
+// Gap is a run of quiet hours, a candidate outage
+type Gap struct {
+	Start    string // first quiet hour, e.g. "2026-02-08T03:00:00Z"
+	End      string // last quiet hour
+	Hours    int
+	Requests int64 // requests during the gap; 0 for a flatline
+}
+
+// TrafficGaps returns runs of at least minGapHours consecutive hours with
+// no or near-zero traffic (see gapQuietPct), longest first. Only hours
+// between the first and last hour of data in the database count, so hours
+// before data began, in the future, or after ingestion stalled aren't
+// reported. Without any traffic in f there is no baseline and no gaps.
+func (q *Queries) TrafficGaps(ctx context.Context, f Filter, minGapHours int) ([]Gap, error) {
+	minHour, maxHour, err := q.DataBounds(ctx)
+	if err != nil || minHour == "" {
+		return nil, err
+	}
+	points, err := q.RequestsOverTime(ctx, f)
+	if err != nil || len(points) == 0 {
+		return nil, err
+	}
+
+	start, err := time.Parse(time.RFC3339, max(f.From, minHour))
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse(time.RFC3339, min(f.To, maxHour))
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(points))
+	sorted := make([]int64, 0, len(points))
+	for _, p := range points {
+		counts[p.Label] = p.Count
+		sorted = append(sorted, p.Count)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+
+	var gaps []Gap
+	var cur *Gap
+	for t := start; !t.After(end); t = t.Add(time.Hour) {
+		label := t.Format(time.RFC3339)
+		count := counts[label]
+		if count*100 >= median*gapQuietPct {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			gaps = append(gaps, Gap{Start: label})
+			cur = &gaps[len(gaps)-1]
+		}
+		cur.End = label
+		cur.Hours++
+		cur.Requests += count
+	}
+
+	long := gaps[:0]
+	for _, g := range gaps {
+		if g.Hours >= minGapHours {
+			long = append(long, g)
+		}
+	}
+	sort.SliceStable(long, func(i, j int) bool { return long[i].Hours > long[j].Hours })
+	return long, nil
+}
+
+// Routers returns the distinct routers by name, at most the breakdown
+// limit of them, keeping the busiest
+func (q *Queries) Routers(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT router FROM (
+			SELECT router, SUM(count) as total
+			FROM requests
+			WHERE router != ''
+			GROUP BY router
+			ORDER BY total DESC, router
+			LIMIT ?
+		)
+		ORDER BY router
+	`
+
+	rows, err := q.db.QueryContext(ctx, query, q.breakdownLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routers []string
+	for rows.Next() {
+		var router string
+		if err := rows.Scan(&router); err != nil {
+			return nil, err
+		}
+		routers = append(routers, router)
+	}
+
+	return routers, rows.Err()
+}
+
+// RouterStat represents total requests for a router
+type RouterStat struct {
+	Router string
+	Count  int64
+	Pct    float64
+}
+
+// Hosts returns the distinct requested hosts by name, at most the
+// breakdown limit of them, keeping the busiest. Empty when the log format
+// doesn't record the host.
+func (q *Queries) Hosts(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT host FROM (
+			SELECT host, SUM(count) as total
+			FROM requests
+			WHERE host != ''
+			GROUP BY host
+			ORDER BY total DESC, host
+			LIMIT ?
+		)
+		ORDER BY host
+	`
+
+	rows, err := q.db.QueryContext(ctx, query, q.breakdownLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []string
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, rows.Err()
+}
+
+// RouterTotals returns all-time request totals per router, largest first.
+// Pct is of all requests.
+func (q *Queries) RouterTotals(ctx context.Context) ([]RouterStat, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT router, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM requests
+		WHERE router != ''
+		GROUP BY router
+		ORDER BY total DESC, router
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RouterStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat RouterStat
+		if err := rows.Scan(&stat.Router, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// SecurityOverTime returns unrouted and bot traffic over time
+func (q *Queries) SecurityOverTime(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
+	// Build custom where clause that includes unrouted traffic
+	var conditions []string
+	var args []interface{}
+
+	conditions = append(conditions, "hour >= ?", "hour <= ?")
+	args = append(args, f.From, f.To)
+
+	// For security view, we want unrouted traffic
+	conditions = append(conditions, "router = 'unrouted'")
+
+	where := "WHERE " + strings.Join(conditions, " AND ")
+
+	query := fmt.Sprintf(`
+		SELECT hour, SUM(count) as total
+		FROM requests
+		%s
+		GROUP BY hour
+		ORDER BY hour
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []TimeSeriesPoint
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(&point.Label, &point.Count); err != nil {
+			return nil, err
+		}
+		results = append(results, point)
+	}
+
+	return results, rows.Err()
+}
+
+// TopProbedPaths returns most frequently probed paths from unrouted traffic.
+// Pct is of all unrouted requests.
+func (q *Queries) TopProbedPaths(ctx context.Context, limit int) ([]PathStat, error) {
+	query := `
+		SELECT
+			path,
+			SUM(count) as total_count,
+			CASE
+				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
+				ELSE 0
+			END as avg_ms,
+			SUM(SUM(count)) OVER () as grand_total
+		FROM requests
 		WHERE router = 'unrouted'
 		GROUP BY path
 		ORDER BY total_count DESC
 		LIMIT ?
 	`
 
-	rows, err := q.db.Query(query, limit)
+	rows, err := q.db.QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var results []PathStat
+	var grandTotal int64
 	for rows.Next() {
 		var stat PathStat
-		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs); err != nil {
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
-// TopScannerIPs returns top scanner IPs from unrouted traffic
-func (q *Queries) TopScannerIPs(limit int) ([]ScannerStat, error) {
+// TopScannerIPs returns top scanner IPs from unrouted traffic. Count is
+// active hours per IP and Pct is of all unrouted visitor-hours.
+func (q *Queries) TopScannerIPs(ctx context.Context, limit int) ([]ScannerStat, error) {
 	query := `
-		SELECT ip_hash, COUNT(*) as total
+		SELECT ip_hash, COUNT(*) as total, SUM(COUNT(*)) OVER () as grand_total
 		FROM visitors
 		WHERE router = 'unrouted'
 		GROUP BY ip_hash
@@ -531,26 +1270,179 @@ func (q *Queries) TopScannerIPs(limit int) ([]ScannerStat, error) {
 		LIMIT ?
 	`
 
-	rows, err := q.db.Query(query, limit)
+	rows, err := q.db.QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var results []ScannerStat
+	var grandTotal int64
 	for rows.Next() {
 		var stat ScannerStat
-		if err := rows.Scan(&stat.IPHash, &stat.Count); err != nil {
+		if err := rows.Scan(&stat.IPHash, &stat.Count, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
-// TopNotFound returns top paths with 404 status
-func (q *Queries) TopNotFound(f Filter, limit int) ([]PathStat, error) {
+// ScannerBreadthStat is an unrouted client ranked by how many distinct
+// paths it probed: one trying 500 paths once each is mapping the site, one
+// hitting a single path 500 times is not
+type ScannerBreadthStat struct {
+	IPHash   string
+	Requests int64
+	Paths    int64   // distinct paths requested
+	Breadth  float64 // Paths as a percentage of Requests; 100 means no path was repeated
+}
+
+// ScannerBreadth returns the unrouted clients that requested the most
+// distinct paths, as recorded with TRAIL_SCANNER_PATHS. Clients folded into
+// OtherKey past the aggregator's cap are left out. Empty when that's off.
+func (q *Queries) ScannerBreadth(ctx context.Context, f Filter, limit int) ([]ScannerBreadthStat, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT ip_hash, SUM(count) as total, COUNT(DISTINCT path) as paths
+		FROM scanner_paths
+		WHERE hour >= ? AND hour <= ? AND ip_hash != ?
+		GROUP BY ip_hash
+		ORDER BY paths DESC, total DESC
+		LIMIT ?
+	`, f.From, f.To, aggregator.OtherKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ScannerBreadthStat
+	for rows.Next() {
+		var stat ScannerBreadthStat
+		if err := rows.Scan(&stat.IPHash, &stat.Requests, &stat.Paths); err != nil {
+			return nil, err
+		}
+		stat.Breadth = pctOf(stat.Paths, stat.Requests)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// Credential stuffing thresholds: an auth path is flagged once failed
+// logins came from at least credentialStuffingMinIPs distinct clients within
+// one hour, and at least credentialStuffingMinFailurePct of its requests in
+// the range failed
+const (
+	credentialStuffingMinIPs        = 10
+	credentialStuffingMinFailurePct = 50
+)
+
+// CredentialStuffingSignal is an auth path where many clients failed to log
+// in, as recorded with TRAIL_AUTH_PATHS
+type CredentialStuffingSignal struct {
+	Path       string
+	Failures   int64   // 401/403 responses
+	IPs        int64   // distinct clients among them
+	Requests   int64   // all requests to Path
+	FailurePct float64 // Failures as a percentage of Requests
+	PeakHour   string  // hour with the most distinct failing clients
+	PeakIPs    int64
+	Hours      int // hours with at least credentialStuffingMinIPs failing clients
+}
+
+// CredentialStuffingSignals returns the auth paths with failed logins from
+// many distinct clients in an hour and a failure share above the threshold,
+// the most widespread first. Rows folded into OtherKey past the
+// aggregator's cap are left out. Empty unless TRAIL_AUTH_PATHS is set.
+func (q *Queries) CredentialStuffingSignals(ctx context.Context, f Filter) ([]CredentialStuffingSignal, error) {
+	where, args := buildWhere(f.allHosts())
+
+	// Distinct failing clients per path and hour, for the peak
+	rows, err := q.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT path, hour, COUNT(DISTINCT ip_hash) as ips
+		FROM auth_failures
+		%s AND path != ?
+		GROUP BY path, hour
+		ORDER BY path, hour
+	`, where), append(args, aggregator.OtherKey)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byPath := make(map[string]*CredentialStuffingSignal)
+	for rows.Next() {
+		var path, hour string
+		var ips int64
+		if err := rows.Scan(&path, &hour, &ips); err != nil {
+			return nil, err
+		}
+		s := byPath[path]
+		if s == nil {
+			s = &CredentialStuffingSignal{Path: path}
+			byPath[path] = s
+		}
+		if ips > s.PeakIPs {
+			s.PeakHour, s.PeakIPs = hour, ips
+		}
+		if ips >= credentialStuffingMinIPs {
+			s.Hours++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Failures and distinct clients over the range, against all requests
+	// to the path
+	totals, err := q.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT path, SUM(count) as failures, COUNT(DISTINCT ip_hash) as ips,
+			COALESCE((SELECT SUM(count) FROM requests r %s AND r.path = a.path), 0) as total
+		FROM auth_failures a
+		%s AND path != ?
+		GROUP BY path
+	`, where, where), append(append(append([]interface{}{}, args...), args...), aggregator.OtherKey)...)
+	if err != nil {
+		return nil, err
+	}
+	defer totals.Close()
+
+	var results []CredentialStuffingSignal
+	for totals.Next() {
+		var path string
+		var failures, ips, total int64
+		if err := totals.Scan(&path, &failures, &ips, &total); err != nil {
+			return nil, err
+		}
+		s := byPath[path]
+		if s == nil || s.PeakIPs < credentialStuffingMinIPs {
+			continue
+		}
+		// requests may have folded the path into OtherKey past its cap
+		s.Failures, s.IPs, s.Requests = failures, ips, max(total, failures)
+		s.FailurePct = pctOf(failures, s.Requests)
+		if s.FailurePct < credentialStuffingMinFailurePct {
+			continue
+		}
+		results = append(results, *s)
+	}
+	if err := totals.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].PeakIPs != results[j].PeakIPs {
+			return results[i].PeakIPs > results[j].PeakIPs
+		}
+		return results[i].Failures > results[j].Failures
+	})
+	return results, nil
+}
+
+// TopNotFound returns top paths with 404 status. Pct is of all requests.
+func (q *Queries) TopNotFound(ctx context.Context, f Filter, limit int) ([]PathStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -570,7 +1462,7 @@ func (q *Queries) TopNotFound(f Filter, limit int) ([]PathStat, error) {
 	`, where)
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -584,13 +1476,62 @@ func (q *Queries) TopNotFound(f Filter, limit int) ([]PathStat, error) {
 		}
 		results = append(results, stat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	total, err := q.requestTotal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Pct = pctOf(results[i].Count, total)
+	}
+
+	return results, nil
+}
+
+// TopUserAgents returns the most frequent full User-Agent strings. Pct is of
+// all requests in raw_user_agents, which is only filled with
+// TRAIL_RAW_USER_AGENTS enabled.
+func (q *Queries) TopUserAgents(ctx context.Context, f Filter, limit int) ([]RawUserAgentStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT user_agent, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM raw_user_agents
+		%s
+		GROUP BY user_agent
+		ORDER BY total DESC
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RawUserAgentStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat RawUserAgentStat
+		if err := rows.Scan(&stat.UserAgent, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
 
 	return results, rows.Err()
 }
 
-// UserAgentBreakdown returns user agent category distribution
-func (q *Queries) UserAgentBreakdown(f Filter) ([]UserAgentStat, error) {
-	where, args := buildWhere(f)
+// UserAgentBreakdown returns user agent category distribution, with
+// categories past the breakdown limit folded into aggregator.OtherKey.
+// Pct is of all requests.
+func (q *Queries) UserAgentBreakdown(ctx context.Context, f Filter) ([]UserAgentStat, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
 		SELECT category, SUM(count) as total
@@ -600,7 +1541,7 @@ func (q *Queries) UserAgentBreakdown(f Filter) ([]UserAgentStat, error) {
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -608,29 +1549,37 @@ func (q *Queries) UserAgentBreakdown(f Filter) ([]UserAgentStat, error) {
 
 	var results []UserAgentStat
 	var grandTotal int64
+	other := UserAgentStat{Category: aggregator.OtherKey}
 	for rows.Next() {
 		var stat UserAgentStat
 		if err := rows.Scan(&stat.Category, &stat.Count); err != nil {
 			return nil, err
 		}
 		grandTotal += stat.Count
-		results = append(results, stat)
+		if len(results) < q.breakdownLimit {
+			results = append(results, stat)
+		} else {
+			other.Count += stat.Count
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if other.Count > 0 {
+		results = append(results, other)
+	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// MethodBreakdown returns HTTP method distribution
-func (q *Queries) MethodBreakdown(f Filter) ([]MethodStat, error) {
+// MethodBreakdown returns HTTP method distribution. Methods outside the
+// known set, and known ones past the breakdown limit, are grouped as
+// OtherMethod. Pct is of all requests.
+func (q *Queries) MethodBreakdown(ctx context.Context, f Filter) ([]MethodStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -641,7 +1590,7 @@ func (q *Queries) MethodBreakdown(f Filter) ([]MethodStat, error) {
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -661,17 +1610,83 @@ func (q *Queries) MethodBreakdown(f Filter) ([]MethodStat, error) {
 		return nil, err
 	}
 
+	results = groupUnknownMethods(results, q.knownMethods, q.breakdownLimit)
+
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
+	}
+
+	return results, nil
+}
+
+// groupUnknownMethods folds methods missing from known, and known ones past
+// the first limit, into one OtherMethod entry, keeping the result sorted by
+// count descending. stats must be sorted that way too.
+func groupUnknownMethods(stats []MethodStat, known map[string]bool, limit int) []MethodStat {
+	var out []MethodStat
+	other := MethodStat{Method: OtherMethod}
+	for _, st := range stats {
+		if known[st.Method] && len(out) < limit {
+			out = append(out, st)
+		} else {
+			other.Count += st.Count
 		}
 	}
+	if other.Count == 0 {
+		return out
+	}
+	i := sort.Search(len(out), func(i int) bool { return out[i].Count < other.Count })
+	out = append(out, MethodStat{})
+	copy(out[i+1:], out[i:])
+	out[i] = other
+	return out
+}
+
+// UnusualMethods returns methods outside the known set across all traffic,
+// bots and unrouted included, with Pct relative to all requests. Scanners
+// often send odd or malformed methods.
+func (q *Queries) UnusualMethods(ctx context.Context, f Filter, limit int) ([]MethodStat, error) {
+	where, args := buildWhere(Filter{From: f.From, To: f.To, Router: f.Router, Routers: f.Routers, Host: f.Host, IncludeBots: true})
 
+	query := fmt.Sprintf(`
+		SELECT method, SUM(count) as total
+		FROM requests
+		%s
+		GROUP BY method
+		ORDER BY total DESC
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MethodStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat MethodStat
+		if err := rows.Scan(&stat.Method, &stat.Count); err != nil {
+			return nil, err
+		}
+		grandTotal += stat.Count
+		if !q.knownMethods[stat.Method] && len(results) < limit {
+			results = append(results, stat)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
+	}
 	return results, nil
 }
 
-// SpecificStatusCodes returns individual status code breakdown
-func (q *Queries) SpecificStatusCodes(f Filter) ([]SpecificStatusStat, error) {
+// SpecificStatusCodes returns individual status code breakdown, with codes
+// past the breakdown limit folded into OtherStatus. Pct is of all requests.
+func (q *Queries) SpecificStatusCodes(ctx context.Context, f Filter) ([]SpecificStatusStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -691,7 +1706,7 @@ func (q *Queries) SpecificStatusCodes(f Filter) ([]SpecificStatusStat, error) {
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -699,29 +1714,36 @@ func (q *Queries) SpecificStatusCodes(f Filter) ([]SpecificStatusStat, error) {
 
 	var results []SpecificStatusStat
 	var grandTotal int64
+	other := SpecificStatusStat{Status: OtherStatus, Class: "other"}
 	for rows.Next() {
 		var stat SpecificStatusStat
 		if err := rows.Scan(&stat.Status, &stat.Class, &stat.Count); err != nil {
 			return nil, err
 		}
 		grandTotal += stat.Count
-		results = append(results, stat)
+		if len(results) < q.breakdownLimit {
+			results = append(results, stat)
+		} else {
+			other.Count += stat.Count
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if other.Count > 0 {
+		results = append(results, other)
+	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// HourOfDayDistribution returns request distribution by hour of day (0-23)
-func (q *Queries) HourOfDayDistribution(f Filter) ([]HourOfDayStat, error) {
+// HourOfDayDistribution returns request distribution by hour of day (0-23).
+// Pct is of all requests.
+func (q *Queries) HourOfDayDistribution(ctx context.Context, f Filter) ([]HourOfDayStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -734,7 +1756,7 @@ func (q *Queries) HourOfDayDistribution(f Filter) ([]HourOfDayStat, error) {
 		ORDER BY hod
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -755,16 +1777,14 @@ func (q *Queries) HourOfDayDistribution(f Filter) ([]HourOfDayStat, error) {
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
 // PathDrilldown returns method x status detail for a specific path
-func (q *Queries) PathDrilldown(f Filter, path string) ([]PathDetail, error) {
+func (q *Queries) PathDrilldown(ctx context.Context, f Filter, path string) ([]PathDetail, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -784,7 +1804,7 @@ func (q *Queries) PathDrilldown(f Filter, path string) ([]PathDetail, error) {
 	`, where)
 
 	args = append(args, path)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -802,8 +1822,9 @@ func (q *Queries) PathDrilldown(f Filter, path string) ([]PathDetail, error) {
 	return results, rows.Err()
 }
 
-// StatusClassDrilldown returns individual status codes within a class (e.g., all codes in 4xx)
-func (q *Queries) StatusClassDrilldown(f Filter, class string) ([]SpecificStatusStat, error) {
+// StatusClassDrilldown returns individual status codes within a class (e.g., all codes in 4xx).
+// Pct is of all requests in the class.
+func (q *Queries) StatusClassDrilldown(ctx context.Context, f Filter, class string) ([]SpecificStatusStat, error) {
 	where, args := buildWhere(f)
 
 	var statusMin, statusMax int
@@ -832,7 +1853,7 @@ func (q *Queries) StatusClassDrilldown(f Filter, class string) ([]SpecificStatus
 	`, class, where)
 
 	args = append(args, statusMin, statusMax)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -853,9 +1874,7 @@ func (q *Queries) StatusClassDrilldown(f Filter, class string) ([]SpecificStatus
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
@@ -867,6 +1886,7 @@ type StatusCodePathStat struct {
 	Count             int64
 	Bytes             int64
 	AvgMs             int64
+	Pct               float64
 	AltStatuses       []AltStatus
 	Suggestion        string // optional redirect hint (populated for 404s)
 	TraefikSuggestion string // optional Traefik redirect snippet
@@ -885,8 +1905,9 @@ type StatusCodeMethodStat struct {
 	Pct    float64
 }
 
-// StatusCodePaths returns top paths that return a specific status code
-func (q *Queries) StatusCodePaths(f Filter, code int, limit int) ([]StatusCodePathStat, error) {
+// StatusCodePaths returns top paths that return a specific status code.
+// Pct is of all requests with that code.
+func (q *Queries) StatusCodePaths(ctx context.Context, f Filter, code int, limit int) ([]StatusCodePathStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -894,7 +1915,8 @@ func (q *Queries) StatusCodePaths(f Filter, code int, limit int) ([]StatusCodePa
 			path,
 			SUM(count) as total_count,
 			SUM(bytes) as total_bytes,
-			CASE WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count) ELSE 0 END as avg_ms
+			CASE WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count) ELSE 0 END as avg_ms,
+			SUM(SUM(count)) OVER () as grand_total
 		FROM requests
 		%s AND status = ?
 		GROUP BY path
@@ -903,26 +1925,65 @@ func (q *Queries) StatusCodePaths(f Filter, code int, limit int) ([]StatusCodePa
 	`, where)
 
 	args = append(args, code, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var results []StatusCodePathStat
+	var grandTotal int64
 	for rows.Next() {
 		var stat StatusCodePathStat
-		if err := rows.Scan(&stat.Path, &stat.Count, &stat.Bytes, &stat.AvgMs); err != nil {
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.Bytes, &stat.AvgMs, &grandTotal); err != nil {
 			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
 
 	return results, rows.Err()
 }
 
+// SpecificStatusOverTime returns counts of one status code over time
+// (hourly or daily)
+func (q *Queries) SpecificStatusOverTime(ctx context.Context, f Filter, code int, daily bool) ([]TimeSeriesPoint, error) {
+	where, args := buildWhere(f)
+
+	selectExpr := "hour as period"
+	if daily {
+		selectExpr = "SUBSTR(hour, 1, 10) as period"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, SUM(count) as total
+		FROM requests
+		%s AND status = ?
+		GROUP BY period
+		ORDER BY period
+	`, selectExpr, where)
+
+	args = append(args, code)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []TimeSeriesPoint
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(&point.Label, &point.Count); err != nil {
+			return nil, err
+		}
+		results = append(results, point)
+	}
+
+	return results, rows.Err()
+}
+
 // PathAlternateStatuses returns other status codes a path returns, excluding the given status
-func (q *Queries) PathAlternateStatuses(f Filter, path string, excludeStatus int) ([]AltStatus, error) {
+func (q *Queries) PathAlternateStatuses(ctx context.Context, f Filter, path string, excludeStatus int) ([]AltStatus, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -935,7 +1996,7 @@ func (q *Queries) PathAlternateStatuses(f Filter, path string, excludeStatus int
 	`, where)
 
 	args = append(args, path, excludeStatus)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -947,14 +2008,183 @@ func (q *Queries) PathAlternateStatuses(f Filter, path string, excludeStatus int
 		if err := rows.Scan(&alt.Status, &alt.Count); err != nil {
 			return nil, err
 		}
-		results = append(results, alt)
+		results = append(results, alt)
+	}
+
+	return results, rows.Err()
+}
+
+// brokenLinkScan is how many of the busiest 404 paths BrokenLinkCandidates
+// checks for a working variant
+const brokenLinkScan = 200
+
+// BrokenLinkCandidate is a 404 path with a working (2xx) counterpart, which
+// suggests a broken internal link or moved content rather than a scanner
+// probe: probes hit paths that never exist in any form.
+type BrokenLinkCandidate struct {
+	Path      string
+	Count     int64  // 404 hits
+	Alternate string // the working path; equal to Path when only the method or timing differs
+	AltMethod string
+	AltCount  int64  // 2xx hits on Alternate with AltMethod
+	Reason    string // why Alternate counts as the same resource, for display
+}
+
+// pathVariants returns the paths a link to path plausibly meant: the path
+// itself, with the trailing slash toggled, and with ".html" toggled. Case
+// variants are matched separately by comparing lowercased paths.
+func pathVariants(path string) []string {
+	variants := []string{path}
+	if path != "/" {
+		if trimmed, ok := strings.CutSuffix(path, "/"); ok {
+			variants = append(variants, trimmed)
+		} else {
+			variants = append(variants, path+"/")
+		}
+	}
+	if trimmed, ok := strings.CutSuffix(path, ".html"); ok {
+		variants = append(variants, trimmed)
+	} else if !strings.HasSuffix(path, "/") {
+		variants = append(variants, path+".html")
+	}
+	return variants
+}
+
+// brokenLinkReason explains how a working path relates to a 404 path
+func brokenLinkReason(path, method, alt, altMethod string) string {
+	switch {
+	case alt == path && altMethod != method:
+		return "works with " + altMethod
+	case alt == path:
+		return "sometimes works (moved or removed?)"
+	case strings.TrimSuffix(alt, "/") == strings.TrimSuffix(path, "/"):
+		return "trailing slash"
+	case strings.TrimSuffix(alt, ".html") == strings.TrimSuffix(path, ".html"):
+		return ".html extension"
+	default:
+		return "case differs"
+	}
+}
+
+// BrokenLinkCandidates returns the busiest 404 paths that also return 2xx
+// under another method, or whose trailing-slash, ".html" or case variant
+// does. It is the batched form of PathAlternateStatuses over the top
+// brokenLinkScan 404 paths; scanner 404s drop out because they have no
+// working counterpart. Ordered by 404 hits.
+func (q *Queries) BrokenLinkCandidates(ctx context.Context, f Filter, limit int) ([]BrokenLinkCandidate, error) {
+	where, args := buildWhere(f)
+
+	// 404s per path and method, so "works with POST" can be told apart from
+	// a GET that only sometimes fails
+	notFoundQuery := fmt.Sprintf(`
+		SELECT path, method, SUM(count) as total
+		FROM requests
+		%s AND status = 404
+		GROUP BY path, method
+		ORDER BY total DESC, path
+		LIMIT ?
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, notFoundQuery, append(args, brokenLinkScan)...)
+	if err != nil {
+		return nil, err
+	}
+	type notFound struct {
+		path, method string
+		count        int64
+	}
+	var notFounds []notFound
+	lowered := make(map[string]bool)
+	for rows.Next() {
+		var nf notFound
+		if err := rows.Scan(&nf.path, &nf.method, &nf.count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		notFounds = append(notFounds, nf)
+		for _, v := range pathVariants(nf.path) {
+			lowered[strings.ToLower(v)] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(notFounds) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, 0, len(lowered))
+	okArgs := append([]interface{}{}, args...)
+	for v := range lowered {
+		placeholders = append(placeholders, "?")
+		okArgs = append(okArgs, v)
+	}
+	okQuery := fmt.Sprintf(`
+		SELECT path, method, SUM(count) as total
+		FROM requests
+		%s AND status BETWEEN 200 AND 299 AND LOWER(path) IN (%s)
+		GROUP BY path, method
+	`, where, strings.Join(placeholders, ", "))
+
+	rows, err = q.db.QueryContext(ctx, okQuery, okArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type working struct {
+		path, method string
+		count        int64
+	}
+	byLower := make(map[string][]working)
+	for rows.Next() {
+		var w working
+		if err := rows.Scan(&w.path, &w.method, &w.count); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(w.path)
+		byLower[key] = append(byLower[key], w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var results []BrokenLinkCandidate
+	listed := make(map[string]bool)
+	for _, nf := range notFounds {
+		if listed[nf.path] {
+			continue
+		}
+		var best *working
+		for _, v := range pathVariants(nf.path) {
+			for i, w := range byLower[strings.ToLower(v)] {
+				if best == nil || w.count > best.count {
+					best = &byLower[strings.ToLower(v)][i]
+				}
+			}
+		}
+		if best == nil {
+			continue
+		}
+		listed[nf.path] = true
+		results = append(results, BrokenLinkCandidate{
+			Path:      nf.path,
+			Count:     nf.count,
+			Alternate: best.path,
+			AltMethod: best.method,
+			AltCount:  best.count,
+			Reason:    brokenLinkReason(nf.path, nf.method, best.path, best.method),
+		})
+		if len(results) == limit {
+			break
+		}
 	}
-
-	return results, rows.Err()
+	return results, nil
 }
 
-// StatusCodeMethods returns method breakdown for a specific status code
-func (q *Queries) StatusCodeMethods(f Filter, code int) ([]StatusCodeMethodStat, error) {
+// StatusCodeMethods returns method breakdown for a specific status code.
+// Pct is of all requests with that code.
+func (q *Queries) StatusCodeMethods(ctx context.Context, f Filter, code int) ([]StatusCodeMethodStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -966,7 +2196,7 @@ func (q *Queries) StatusCodeMethods(f Filter, code int) ([]StatusCodeMethodStat,
 	`, where)
 
 	args = append(args, code)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -987,16 +2217,79 @@ func (q *Queries) StatusCodeMethods(f Filter, code int) ([]StatusCodeMethodStat,
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// TopPathsPaginated returns paginated top paths with sorting
-func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order string) (*PaginatedResult, error) {
+// RedirectChain is a path answering with redirects, paired with its
+// trailing-slash twin (the path with the slash added or dropped) when that
+// was requested too, since that's where such a redirect most likely leads
+type RedirectChain struct {
+	Path      string
+	Redirects int64  // 3xx responses
+	Target    string // trailing-slash twin; empty when never requested
+	TargetOK  int64  // 2xx responses of Target
+	Loop      bool   // Target only ever redirects too, likely back here
+}
+
+// Resolved reports whether the redirect lands on a page that answers 2xx
+func (r RedirectChain) Resolved() bool {
+	return r.TargetOK > 0
+}
+
+// RedirectChains returns the paths redirected most often, each paired with
+// its trailing-slash twin, so /page -> /page/ shows as one resolved pair
+// instead of a 301 row and a 200 row, and two paths redirecting to each
+// other show as a loop
+func (q *Queries) RedirectChains(ctx context.Context, f Filter, limit int) ([]RedirectChain, error) {
+	where, args := buildWhere(f)
+
+	query := fmt.Sprintf(`
+		WITH p AS (
+			SELECT path,
+				SUM(CASE WHEN status >= 300 AND status < 400 THEN count ELSE 0 END) as redirects,
+				SUM(CASE WHEN status >= 200 AND status < 300 THEN count ELSE 0 END) as ok
+			FROM requests
+			%s
+			GROUP BY path
+		)
+		SELECT a.path, a.redirects, COALESCE(b.path, ''), COALESCE(b.ok, 0), COALESCE(b.redirects, 0)
+		FROM p a
+		LEFT JOIN p b ON b.path = CASE
+			WHEN substr(a.path, -1) = '/' THEN substr(a.path, 1, length(a.path) - 1)
+			ELSE a.path || '/'
+		END
+		WHERE a.redirects > 0
+		ORDER BY a.redirects DESC, a.path
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RedirectChain
+	for rows.Next() {
+		var rc RedirectChain
+		var targetRedirects int64
+		if err := rows.Scan(&rc.Path, &rc.Redirects, &rc.Target, &rc.TargetOK, &targetRedirects); err != nil {
+			return nil, err
+		}
+		rc.Loop = targetRedirects > 0 && rc.TargetOK == 0
+		results = append(results, rc)
+	}
+
+	return results, rows.Err()
+}
+
+// TopPathsPaginated returns paginated top paths with sorting. Pct is of all
+// requests, not just the current page.
+func (q *Queries) TopPathsPaginated(ctx context.Context, f Filter, page, limit int, sort, order string) (*PaginatedResult, error) {
 	where, args := buildWhere(f)
 
 	// Validate sort column
@@ -1008,6 +2301,8 @@ func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order strin
 		sortCol = "total_bytes"
 	case "avg_ms":
 		sortCol = "avg_ms"
+	case "avg_bytes":
+		sortCol = "avg_bytes"
 	case "count":
 		sortCol = "total_count"
 	}
@@ -1026,7 +2321,7 @@ func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order strin
 	`, where)
 
 	var totalCount int64
-	err := q.db.QueryRow(countQuery, args...).Scan(&totalCount)
+	err := q.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, err
 	}
@@ -1046,7 +2341,12 @@ func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order strin
 				WHEN SUM(count) > 0 THEN SUM(duration) / SUM(count)
 				ELSE 0
 			END as avg_ms,
-			SUM(bytes) as total_bytes
+			SUM(bytes) as total_bytes,
+			CASE
+				WHEN SUM(count) > 0 THEN SUM(bytes) / SUM(count)
+				ELSE 0
+			END as avg_bytes,
+			SUM(SUM(count)) OVER () as grand_total
 		FROM requests
 		%s
 		GROUP BY path
@@ -1055,21 +2355,20 @@ func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order strin
 	`, where, sortCol, orderDir)
 
 	args = append(args, limit, offset)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Calculate grand total for percentages
 	var grandTotal int64
 	var items []PathStat
 	for rows.Next() {
 		var stat PathStat
-		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes); err != nil {
+		if err := rows.Scan(&stat.Path, &stat.Count, &stat.AvgMs, &stat.Bytes, &stat.AvgBytes, &grandTotal); err != nil {
 			return nil, err
 		}
-		grandTotal += stat.Count
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		items = append(items, stat)
 	}
 	if err := rows.Err(); err != nil {
@@ -1085,8 +2384,98 @@ func (q *Queries) TopPathsPaginated(f Filter, page, limit int, sort, order strin
 	}, nil
 }
 
+// MaxSectionDepth bounds how many leading path segments a section spans
+const MaxSectionDepth = 5
+
+// SectionStat is the traffic of every path under one section, e.g. /blog
+type SectionStat struct {
+	Section  string
+	Paths    int64 // distinct paths in the section
+	Count    int64
+	Bytes    int64
+	AvgBytes int64
+	AvgMs    int64
+	Pct      float64 // of all requests
+}
+
+// SectionBreakdown groups paths by their first depth segments, so with
+// depth 1 /blog, /blog/ and /blog/a/b all count towards /blog. The query
+// string is ignored; paths folded into OtherKey stay their own section.
+// Sections come busiest first.
+func (q *Queries) SectionBreakdown(ctx context.Context, f Filter, depth int) ([]SectionStat, error) {
+	where, args := buildWhere(f)
+	depth = max(1, min(depth, MaxSectionDepth))
+
+	rows, err := q.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT path, SUM(count), SUM(bytes), SUM(duration)
+		FROM requests
+		%s
+		GROUP BY path
+	`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bySection := make(map[string]*SectionStat)
+	durations := make(map[string]int64)
+	var grandTotal int64
+	for rows.Next() {
+		var path string
+		var count, bytes, duration int64
+		if err := rows.Scan(&path, &count, &bytes, &duration); err != nil {
+			return nil, err
+		}
+		section := sectionOf(path, depth)
+		s := bySection[section]
+		if s == nil {
+			s = &SectionStat{Section: section}
+			bySection[section] = s
+		}
+		s.Paths++
+		s.Count += count
+		s.Bytes += bytes
+		durations[section] += duration
+		grandTotal += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]SectionStat, 0, len(bySection))
+	for _, s := range bySection {
+		if s.Count > 0 {
+			s.AvgBytes = s.Bytes / s.Count
+			s.AvgMs = durations[s.Section] / s.Count
+		}
+		s.Pct = pctOf(s.Count, grandTotal)
+		results = append(results, *s)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].Section < results[j].Section
+	})
+	return results, nil
+}
+
+// sectionOf returns the first depth segments of path as its section:
+// /docs/api/v2?x=1 at depth 2 is /docs/api
+func sectionOf(path string, depth int) string {
+	if path == aggregator.OtherKey {
+		return path
+	}
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
 // PathsSummary returns aggregate stats across all paths
-func (q *Queries) PathsSummary(f Filter) (*PathsSummaryResult, error) {
+func (q *Queries) PathsSummary(ctx context.Context, f Filter) (*PathsSummaryResult, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -1110,7 +2499,7 @@ func (q *Queries) PathsSummary(f Filter) (*PathsSummaryResult, error) {
 	`, where)
 
 	var result PathsSummaryResult
-	err := q.db.QueryRow(query, args...).Scan(
+	err := q.db.QueryRowContext(ctx, query, args...).Scan(
 		&result.TotalHits,
 		&result.TotalBytes,
 		&result.AvgMs,
@@ -1120,6 +2509,9 @@ func (q *Queries) PathsSummary(f Filter) (*PathsSummaryResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	if result.TotalHits > 0 {
+		result.AvgBytes = result.TotalBytes / result.TotalHits
+	}
 
 	return &result, nil
 }
@@ -1127,7 +2519,9 @@ func (q *Queries) PathsSummary(f Filter) (*PathsSummaryResult, error) {
 // ThreatPatterns groups suspicious request paths into attack categories.
 // When suspiciousPathMode is true (combined format), it uses status >= 400
 // instead of router = 'unrouted' since combined logs have no router concept.
-func (q *Queries) ThreatPatterns(f Filter, suspiciousPathMode bool) ([]ThreatPatternStat, error) {
+// A non-empty suspiciousStatuses narrows that to exactly those status codes.
+// Pct is of all suspicious requests.
+func (q *Queries) ThreatPatterns(ctx context.Context, f Filter, suspiciousPathMode bool, suspiciousStatuses []int) ([]ThreatPatternStat, error) {
 	var conditions []string
 	var args []interface{}
 
@@ -1135,7 +2529,16 @@ func (q *Queries) ThreatPatterns(f Filter, suspiciousPathMode bool) ([]ThreatPat
 	args = append(args, f.From, f.To)
 
 	if suspiciousPathMode {
-		conditions = append(conditions, "status >= 400")
+		if len(suspiciousStatuses) == 0 {
+			conditions = append(conditions, "status >= 400")
+		} else {
+			placeholders := make([]string, len(suspiciousStatuses))
+			for i, code := range suspiciousStatuses {
+				placeholders[i] = "?"
+				args = append(args, code)
+			}
+			conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+		}
 	} else {
 		conditions = append(conditions, "router = 'unrouted'")
 	}
@@ -1159,7 +2562,7 @@ func (q *Queries) ThreatPatterns(f Filter, suspiciousPathMode bool) ([]ThreatPat
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1188,16 +2591,15 @@ func (q *Queries) ThreatPatterns(f Filter, suspiciousPathMode bool) ([]ThreatPat
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// BotVsHuman returns bot and human traffic counts from user_agents
-func (q *Queries) BotVsHuman(f Filter) (humanCount, botCount int64, botBreakdown []UserAgentStat, err error) {
+// BotVsHuman returns bot and human traffic counts from user_agents.
+// botBreakdown Pct is of all bot traffic.
+func (q *Queries) BotVsHuman(ctx context.Context, f Filter) (humanCount, botCount int64, botBreakdown []UserAgentStat, err error) {
 	where, args := buildWhere(Filter{
 		From:        f.From,
 		To:          f.To,
@@ -1212,7 +2614,7 @@ func (q *Queries) BotVsHuman(f Filter) (humanCount, botCount int64, botBreakdown
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return 0, 0, nil, err
 	}
@@ -1248,11 +2650,15 @@ func (q *Queries) BotVsHuman(f Filter) (humanCount, botCount int64, botBreakdown
 		return 0, 0, nil, err
 	}
 
+	for i := range botBreakdown {
+		botBreakdown[i].Pct = pctOf(botBreakdown[i].Count, botCount)
+	}
+
 	return humanCount, botCount, botBreakdown, nil
 }
 
 // ErrorTrends returns 5xx error counts over time (hourly or daily based on range)
-func (q *Queries) ErrorTrends(f Filter) ([]TimeSeriesPoint, error) {
+func (q *Queries) ErrorTrends(ctx context.Context, f Filter) ([]TimeSeriesPoint, error) {
 	var conditions []string
 	var args []interface{}
 
@@ -1270,7 +2676,7 @@ func (q *Queries) ErrorTrends(f Filter) ([]TimeSeriesPoint, error) {
 		ORDER BY day
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1288,8 +2694,231 @@ func (q *Queries) ErrorTrends(f Filter) ([]TimeSeriesPoint, error) {
 	return results, rows.Err()
 }
 
-// ErrorPaths returns paths with the most 5xx errors
-func (q *Queries) ErrorPaths(f Filter, limit int) ([]PathStat, error) {
+// ErrorRatePathStat is a path ranked by the share of its requests that
+// ended in a 5xx
+type ErrorRatePathStat struct {
+	Path     string
+	Requests int64
+	Errors   int64
+	Rate     float64 // Errors as a percentage of Requests
+}
+
+// HighestErrorRatePaths returns the paths whose requests most often end in a
+// 5xx, across all routers and traffic like ErrorPaths. Paths with fewer than
+// minRequests requests are skipped so a single failed hit doesn't rank first;
+// ties go to the path with more errors.
+func (q *Queries) HighestErrorRatePaths(ctx context.Context, f Filter, minRequests, limit int) ([]ErrorRatePathStat, error) {
+	query := `
+		SELECT
+			path,
+			SUM(count) as total,
+			SUM(CASE WHEN status >= 500 AND status < 600 THEN count ELSE 0 END) as errors
+		FROM requests
+		WHERE hour >= ? AND hour <= ?
+		GROUP BY path
+		HAVING errors > 0 AND total >= ?
+		ORDER BY CAST(errors AS REAL) / total DESC, errors DESC
+		LIMIT ?
+	`
+
+	rows, err := q.db.QueryContext(ctx, query, f.From, f.To, minRequests, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ErrorRatePathStat
+	for rows.Next() {
+		var stat ErrorRatePathStat
+		if err := rows.Scan(&stat.Path, &stat.Requests, &stat.Errors); err != nil {
+			return nil, err
+		}
+		stat.Rate = pctOf(stat.Errors, stat.Requests)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// KnownThreatStat summarizes requests from IPs on the TRAIL_THREAT_IPS_FILE
+// list
+type KnownThreatStat struct {
+	Requests int64
+	IPs      int64      // distinct listed IPs seen
+	Pct      float64    // of all requests in the period
+	Paths    []PathStat // most requested paths; Pct is of listed-IP requests
+}
+
+// KnownThreats returns requests from threat-listed IPs across all routers
+// and traffic, with the limit most requested paths. Zero when no list is
+// configured or nothing matched.
+func (q *Queries) KnownThreats(ctx context.Context, f Filter, limit int) (*KnownThreatStat, error) {
+	stat := &KnownThreatStat{}
+	// IPs folded into OtherKey past the aggregator's cap aren't counted
+	err := q.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(count), 0), COUNT(DISTINCT NULLIF(ip_hash, ?))
+		FROM threat_requests
+		WHERE hour >= ? AND hour <= ?
+	`, aggregator.OtherKey, f.From, f.To).Scan(&stat.Requests, &stat.IPs)
+	if err != nil || stat.Requests == 0 {
+		return stat, err
+	}
+
+	var total int64
+	if err := q.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(count), 0) FROM requests WHERE hour >= ? AND hour <= ?
+	`, f.From, f.To).Scan(&total); err != nil {
+		return nil, err
+	}
+	stat.Pct = pctOf(stat.Requests, total)
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT path, SUM(count) as total
+		FROM threat_requests
+		WHERE hour >= ? AND hour <= ?
+		GROUP BY path
+		ORDER BY total DESC
+		LIMIT ?
+	`, f.From, f.To, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p PathStat
+		if err := rows.Scan(&p.Path, &p.Count); err != nil {
+			return nil, err
+		}
+		p.Pct = pctOf(p.Count, stat.Requests)
+		stat.Paths = append(stat.Paths, p)
+	}
+
+	return stat, rows.Err()
+}
+
+// RateLimitedIPStat is a client IP (hashed) by its 429 responses
+type RateLimitedIPStat struct {
+	IPHash string // aggregator.OtherKey for IPs past the per-hour cap
+	Count  int64
+	Pct    float64 // of all 429 responses of listed clients
+}
+
+// RateLimitedIPs returns the clients that got the most 429 responses, as
+// recorded with TRAIL_RATE_LIMIT_IPS. Empty when that's off.
+func (q *Queries) RateLimitedIPs(ctx context.Context, f Filter, limit int) ([]RateLimitedIPStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT ip_hash, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM rate_limited
+		%s
+		GROUP BY ip_hash
+		ORDER BY total DESC
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RateLimitedIPStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat RateLimitedIPStat
+		if err := rows.Scan(&stat.IPHash, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// FakeCrawlers returns the requests that matched no router yet claimed a
+// search engine crawler's User-Agent (bot.SearchCrawlers): real crawlers
+// request the sites they index, scanners borrow their names
+func (q *Queries) FakeCrawlers(ctx context.Context, f Filter) (int64, error) {
+	where, args := buildWhere(f.allHosts())
+	query := fmt.Sprintf(`
+		SELECT COALESCE(SUM(count), 0) FROM user_agents
+		%s AND router = 'unrouted' AND category IN (%s)
+	`, where, strings.TrimSuffix(strings.Repeat("?, ", len(bot.SearchCrawlers)), ", "))
+	for _, name := range bot.SearchCrawlers {
+		args = append(args, name)
+	}
+
+	var count int64
+	err := q.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// Bot-only path thresholds: at least botOnlyMinRequests bot requests, with
+// humans making at most botOnlyMaxHumanPct percent of the path's traffic
+const (
+	botOnlyMinRequests = 10
+	botOnlyMaxHumanPct = 1
+)
+
+// BotOnlyPathStat is a path requested (almost) exclusively by bots
+type BotOnlyPathStat struct {
+	Path   string
+	Bots   int64
+	Humans int64
+	Pct    float64 // of all bot requests in the period
+}
+
+// BotOnlyPaths returns the paths with the most bot requests that humans
+// (next to) never request: scraping targets, feeds, honeypots. Routed
+// traffic only, as unrouted requests aren't split into humans and bots.
+func (q *Queries) BotOnlyPaths(ctx context.Context, f Filter, limit int) ([]BotOnlyPathStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	var totalBots int64
+	if err := q.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COALESCE(SUM(count), 0) FROM path_categories %s AND category = 'bot'
+	`, where), args...).Scan(&totalBots); err != nil || totalBots == 0 {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT path,
+			SUM(CASE WHEN category = 'bot' THEN count ELSE 0 END) as bots,
+			SUM(CASE WHEN category = 'human' THEN count ELSE 0 END) as humans
+		FROM path_categories
+		%s AND path != ?
+		GROUP BY path
+		HAVING bots >= ? AND humans * 100 <= (bots + humans) * ?
+		ORDER BY bots DESC, path
+		LIMIT ?
+	`, where)
+
+	args = append(args, aggregator.OtherKey, botOnlyMinRequests, botOnlyMaxHumanPct, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []BotOnlyPathStat
+	for rows.Next() {
+		var p BotOnlyPathStat
+		if err := rows.Scan(&p.Path, &p.Bots, &p.Humans); err != nil {
+			return nil, err
+		}
+		p.Pct = pctOf(p.Bots, totalBots)
+		results = append(results, p)
+	}
+	return results, rows.Err()
+}
+
+// ErrorPaths returns paths with the most 5xx errors across all routers and
+// traffic. Pct is of all requests in the period.
+func (q *Queries) ErrorPaths(ctx context.Context, f Filter, limit int) ([]PathStat, error) {
 	var conditions []string
 	var args []interface{}
 
@@ -1316,7 +2945,7 @@ func (q *Queries) ErrorPaths(f Filter, limit int) ([]PathStat, error) {
 	`, where)
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1330,12 +2959,127 @@ func (q *Queries) ErrorPaths(f Filter, limit int) ([]PathStat, error) {
 		}
 		results = append(results, stat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	total, err := q.requestTotal(ctx, Filter{From: f.From, To: f.To, IncludeBots: true})
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Pct = pctOf(results[i].Count, total)
+	}
+
+	return results, nil
+}
+
+// ErrorRequestID is one recent 5xx response with the request ID the proxy
+// assigned it, for looking the failure up in upstream logs
+type ErrorRequestID struct {
+	Time      string // RFC3339, UTC
+	Router    string
+	Path      string
+	Method    string
+	Status    int
+	RequestID string
+}
+
+// ErrorRequestIDs returns the newest 5xx responses that carried a request
+// ID. Empty unless TRAIL_REQUEST_IDS is enabled.
+func (q *Queries) ErrorRequestIDs(ctx context.Context, f Filter, limit int) ([]ErrorRequestID, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT ts, router, path, method, status, request_id
+		FROM error_requests
+		%s
+		ORDER BY ts DESC
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ErrorRequestID
+	for rows.Next() {
+		var r ErrorRequestID
+		if err := rows.Scan(&r.Time, &r.Router, &r.Path, &r.Method, &r.Status, &r.RequestID); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// RawRequest is one request kept as it was logged, see TRAIL_STORE_RAW
+type RawRequest struct {
+	Time       string // RFC3339, UTC
+	Router     string
+	Host       string
+	Path       string
+	Method     string
+	Status     int
+	Bytes      int64
+	DurationMs int64
+	IPHash     string
+	Country    string
+	Referrer   string
+	UserAgent  string
+}
+
+// RecentRequests returns the newest requests, narrowed to path and method
+// where not empty and to status where not negative (0 is a dropped
+// connection). Empty unless TRAIL_STORE_RAW is enabled.
+func (q *Queries) RecentRequests(ctx context.Context, f Filter, path, method string, status, limit int) ([]RawRequest, error) {
+	where, args := buildWhere(f)
+	if path != "" {
+		where += " AND path = ?"
+		args = append(args, path)
+	}
+	if method != "" {
+		where += " AND method = ?"
+		args = append(args, method)
+	}
+	if status >= 0 {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT ts, router, host, path, method, status, bytes, duration, ip_hash, country, referrer, user_agent
+		FROM requests_raw
+		%s
+		ORDER BY ts DESC
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RawRequest
+	for rows.Next() {
+		var r RawRequest
+		if err := rows.Scan(&r.Time, &r.Router, &r.Host, &r.Path, &r.Method, &r.Status, &r.Bytes, &r.DurationMs,
+			&r.IPHash, &r.Country, &r.Referrer, &r.UserAgent); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
 	return results, rows.Err()
 }
 
-// SlowestPaths returns paths with the highest average response time
-func (q *Queries) SlowestPaths(f Filter, limit int) ([]PathStat, error) {
+// SlowestPaths returns paths with the highest average response time.
+// Pct is of all requests.
+func (q *Queries) SlowestPaths(ctx context.Context, f Filter, limit int) ([]PathStat, error) {
 	where, args := buildWhere(f)
 
 	query := fmt.Sprintf(`
@@ -1356,7 +3100,7 @@ func (q *Queries) SlowestPaths(f Filter, limit int) ([]PathStat, error) {
 	`, where)
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1370,13 +3114,25 @@ func (q *Queries) SlowestPaths(f Filter, limit int) ([]PathStat, error) {
 		}
 		results = append(results, stat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return results, rows.Err()
+	total, err := q.requestTotal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Pct = pctOf(results[i].Count, total)
+	}
+
+	return results, nil
 }
 
-// HourOfDayVisitors returns unique visitor distribution by hour of day (0-23)
-func (q *Queries) HourOfDayVisitors(f Filter) ([]HourOfDayStat, error) {
-	where, args := buildWhere(f)
+// HourOfDayVisitors returns unique visitor distribution by hour of day (0-23).
+// Pct is of the summed hourly visitor counts.
+func (q *Queries) HourOfDayVisitors(ctx context.Context, f Filter) ([]HourOfDayStat, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
 		SELECT
@@ -1388,7 +3144,7 @@ func (q *Queries) HourOfDayVisitors(f Filter) ([]HourOfDayStat, error) {
 		ORDER BY hod
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1407,7 +3163,7 @@ func (q *Queries) HourOfDayVisitors(f Filter) ([]HourOfDayStat, error) {
 }
 
 // PathDailyTrends returns daily request counts for a set of paths
-func (q *Queries) PathDailyTrends(f Filter, paths []string) (map[string][]int64, error) {
+func (q *Queries) PathDailyTrends(ctx context.Context, f Filter, paths []string) (map[string][]int64, error) {
 	if len(paths) == 0 {
 		return nil, nil
 	}
@@ -1428,7 +3184,7 @@ func (q *Queries) PathDailyTrends(f Filter, paths []string) (map[string][]int64,
 		ORDER BY path, day
 	`, where, strings.Join(placeholders, ","))
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1461,6 +3217,20 @@ type BrowserStat struct {
 	Pct     float64
 }
 
+// HostStat represents statistics for a client-requested host
+type HostStat struct {
+	Host  string
+	Count int64
+	Pct   float64
+}
+
+// CacheStatusStat represents requests with one proxy/CDN cache status
+type CacheStatusStat struct {
+	Status string
+	Count  int64
+	Pct    float64
+}
+
 // OSStat represents statistics for an operating system
 type OSStat struct {
 	OS    string
@@ -1475,19 +3245,21 @@ type DurationBucketStat struct {
 	Pct    float64
 }
 
-// PercentileResult holds computed response time percentiles
+// PercentileResult holds computed response time percentiles.
+// Values come from the request-weighted duration histogram.
 type PercentileResult struct {
 	P50 int64
 	P95 int64
 	P99 int64
 }
 
-// CountryBreakdown returns country distribution from GeoIP data
-func (q *Queries) CountryBreakdown(f Filter, limit int) ([]CountryStat, error) {
-	where, args := buildWhere(f)
+// CountryBreakdown returns country distribution from GeoIP data. Pct is of
+// all geolocated requests, including countries outside the top limit.
+func (q *Queries) CountryBreakdown(ctx context.Context, f Filter, limit int) ([]CountryStat, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
-		SELECT country, SUM(count) as total
+		SELECT country, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
 		FROM countries
 		%s
 		GROUP BY country
@@ -1496,7 +3268,7 @@ func (q *Queries) CountryBreakdown(f Filter, limit int) ([]CountryStat, error) {
 	`, where)
 
 	args = append(args, limit)
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1506,28 +3278,54 @@ func (q *Queries) CountryBreakdown(f Filter, limit int) ([]CountryStat, error) {
 	var grandTotal int64
 	for rows.Next() {
 		var stat CountryStat
-		if err := rows.Scan(&stat.Country, &stat.Count); err != nil {
+		if err := rows.Scan(&stat.Country, &stat.Count, &grandTotal); err != nil {
 			return nil, err
 		}
-		grandTotal += stat.Count
+		stat.Pct = pctOf(stat.Count, grandTotal)
 		results = append(results, stat)
 	}
-	if err := rows.Err(); err != nil {
+
+	return results, rows.Err()
+}
+
+// CountryRouterBreakdown returns the routers one country's requests went
+// to, busiest first. Pct is of that country's requests.
+func (q *Queries) CountryRouterBreakdown(ctx context.Context, f Filter, country string) ([]RouterStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT router, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM countries
+		%s AND country = ?
+		GROUP BY router
+		ORDER BY total DESC, router
+		LIMIT ?
+	`, where)
+
+	args = append(args, country, q.breakdownLimit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
+	var results []RouterStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat RouterStat
+		if err := rows.Scan(&stat.Router, &stat.Count, &grandTotal); err != nil {
+			return nil, err
 		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
-// BrowserBreakdown returns browser distribution
-func (q *Queries) BrowserBreakdown(f Filter) ([]BrowserStat, error) {
-	where, args := buildWhere(f)
+// BrowserBreakdown returns browser distribution. Pct is of all requests.
+func (q *Queries) BrowserBreakdown(ctx context.Context, f Filter) ([]BrowserStat, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
 		SELECT browser, SUM(count) as total
@@ -1537,7 +3335,7 @@ func (q *Queries) BrowserBreakdown(f Filter) ([]BrowserStat, error) {
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1558,18 +3356,88 @@ func (q *Queries) BrowserBreakdown(f Filter) ([]BrowserStat, error) {
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// OSBreakdown returns operating system distribution
-func (q *Queries) OSBreakdown(f Filter) ([]OSStat, error) {
+// hostBreakdownLimit caps the hosts returned by HostBreakdown
+const hostBreakdownLimit = 20
+
+// HostBreakdown returns the most requested hosts. Pct is of all requests
+// that recorded a host. Empty when the log format doesn't expose one.
+func (q *Queries) HostBreakdown(ctx context.Context, f Filter) ([]HostStat, error) {
 	where, args := buildWhere(f)
 
+	query := fmt.Sprintf(`
+		SELECT host, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM hosts
+		%s
+		GROUP BY host
+		ORDER BY total DESC
+		LIMIT ?
+	`, where)
+
+	args = append(args, hostBreakdownLimit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []HostStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat HostStat
+		if err := rows.Scan(&stat.Host, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// CacheStatusBreakdown returns requests per logged cache status (HIT, MISS,
+// BYPASS, ...). Pct is of all requests that recorded a status, so the HIT
+// row is the cache-hit ratio. Empty when the log format doesn't expose one.
+func (q *Queries) CacheStatusBreakdown(ctx context.Context, f Filter) ([]CacheStatusStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT status, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM cache_status
+		%s
+		GROUP BY status
+		ORDER BY total DESC
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []CacheStatusStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat CacheStatusStat
+		if err := rows.Scan(&stat.Status, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// OSBreakdown returns operating system distribution. Pct is of all requests.
+func (q *Queries) OSBreakdown(ctx context.Context, f Filter) ([]OSStat, error) {
+	where, args := buildWhere(f.allHosts())
+
 	query := fmt.Sprintf(`
 		SELECT os, SUM(count) as total
 		FROM os_stats
@@ -1578,7 +3446,7 @@ func (q *Queries) OSBreakdown(f Filter) ([]OSStat, error) {
 		ORDER BY total DESC
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1599,17 +3467,16 @@ func (q *Queries) OSBreakdown(f Filter) ([]OSStat, error) {
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// DurationHistogram returns the response time histogram
-func (q *Queries) DurationHistogram(f Filter) ([]DurationBucketStat, error) {
-	where, args := buildWhere(f)
+// DurationHistogram returns the response time histogram. Pct is of all
+// requests.
+func (q *Queries) DurationHistogram(ctx context.Context, f Filter) ([]DurationBucketStat, error) {
+	where, args := buildWhere(f.allHosts())
 
 	query := fmt.Sprintf(`
 		SELECT bucket, SUM(count) as total
@@ -1627,7 +3494,7 @@ func (q *Queries) DurationHistogram(f Filter) ([]DurationBucketStat, error) {
 			END
 	`, where)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1648,18 +3515,22 @@ func (q *Queries) DurationHistogram(f Filter) ([]DurationBucketStat, error) {
 	}
 
 	for i := range results {
-		if grandTotal > 0 {
-			results[i].Pct = float64(results[i].Count) / float64(grandTotal) * 100
-		}
+		results[i].Pct = pctOf(results[i].Count, grandTotal)
 	}
 
 	return results, nil
 }
 
-// DurationPercentiles computes p50, p95, p99 from the duration histogram buckets.
-// Uses bucket midpoints for interpolation: 5, 30, 75, 300, 750, 2000ms.
-func (q *Queries) DurationPercentiles(f Filter) (*PercentileResult, error) {
-	hist, err := q.DurationHistogram(f)
+// DurationPercentiles computes p50, p95, p99 from the sampled durations
+// (TRAIL_DURATION_SAMPLES) when they cover every request in the range, and
+// otherwise from the duration histogram buckets, using bucket midpoints for
+// interpolation: 5, 30, 75, 300, 750, 2000ms.
+func (q *Queries) DurationPercentiles(ctx context.Context, f Filter) (*PercentileResult, error) {
+	if res, err := q.sampledPercentiles(ctx, f); err != nil || res != nil {
+		return res, err
+	}
+
+	hist, err := q.DurationHistogram(ctx, f)
 	if err != nil {
 		return nil, err
 	}
@@ -1711,8 +3582,92 @@ func (q *Queries) DurationPercentiles(f Filter) (*PercentileResult, error) {
 	}, nil
 }
 
-// BandwidthTimeSeries returns bytes transferred over time (hourly or daily)
-func (q *Queries) BandwidthTimeSeries(f Filter, daily bool) ([]TimeSeriesPoint, error) {
+// sampledPercentiles computes exact percentiles from duration_samples. Each
+// reservoir stands for the requests it saw, so its samples are weighted by
+// seen/len(samples). Returns nil when the samples don't cover all of
+// duration_hist, e.g. for hours from before sampling was enabled.
+func (q *Queries) sampledPercentiles(ctx context.Context, f Filter) (*PercentileResult, error) {
+	where, args := buildWhere(f.allHosts())
+
+	var total int64
+	if err := q.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COALESCE(SUM(count), 0) FROM duration_hist %s", where), args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	rows, err := q.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT seen, samples FROM duration_samples %s", where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type weighted struct {
+		ms     int64
+		weight float64
+	}
+	var points []weighted
+	var seenTotal int64
+	for rows.Next() {
+		var seen int64
+		var encoded string
+		if err := rows.Scan(&seen, &encoded); err != nil {
+			return nil, err
+		}
+		samples := aggregator.DecodeSamples(encoded)
+		if len(samples) == 0 {
+			continue
+		}
+		seenTotal += seen
+		w := float64(seen) / float64(len(samples))
+		for _, ms := range samples {
+			points = append(points, weighted{ms, w})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if seenTotal < total {
+		return nil, nil
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].ms < points[j].ms })
+	percentile := func(pct float64) int64 {
+		threshold := float64(seenTotal) * pct
+		var cumulative float64
+		for _, p := range points {
+			cumulative += p.weight
+			if cumulative >= threshold {
+				return p.ms
+			}
+		}
+		return points[len(points)-1].ms
+	}
+
+	return &PercentileResult{
+		P50: percentile(0.50),
+		P95: percentile(0.95),
+		P99: percentile(0.99),
+	}, nil
+}
+
+// HasDurations reports whether any request matching f recorded a duration.
+// Lines without one (e.g. Combined logs lacking request_time) are left out
+// of duration_hist, so an empty histogram alongside traffic means latency
+// data is unavailable rather than fast.
+func (q *Queries) HasDurations(ctx context.Context, f Filter) (bool, error) {
+	where, args := buildWhere(f.allHosts())
+	var exists bool
+	err := q.db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM duration_hist %s)", where), args...).Scan(&exists)
+	return exists, err
+}
+
+// BandwidthTimeSeries returns bytes transferred over time (hourly or daily).
+// The bytes are whatever size field the parser put in LogEntry.Bytes.
+func (q *Queries) BandwidthTimeSeries(ctx context.Context, f Filter, daily bool) ([]TimeSeriesPoint, error) {
 	where, args := buildWhere(f)
 
 	var groupExpr, selectExpr string
@@ -1732,7 +3687,7 @@ func (q *Queries) BandwidthTimeSeries(f Filter, daily bool) ([]TimeSeriesPoint,
 		ORDER BY %s
 	`, selectExpr, where, groupExpr, groupExpr)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1751,7 +3706,7 @@ func (q *Queries) BandwidthTimeSeries(f Filter, daily bool) ([]TimeSeriesPoint,
 }
 
 // ResponseTimeTimeSeries returns average response time over time (hourly or daily)
-func (q *Queries) ResponseTimeTimeSeries(f Filter, daily bool) ([]TimeSeriesPoint, error) {
+func (q *Queries) ResponseTimeTimeSeries(ctx context.Context, f Filter, daily bool) ([]TimeSeriesPoint, error) {
 	where, args := buildWhere(f)
 
 	var groupExpr, selectExpr string
@@ -1772,7 +3727,7 @@ func (q *Queries) ResponseTimeTimeSeries(f Filter, daily bool) ([]TimeSeriesPoin
 		ORDER BY %s
 	`, selectExpr, where, groupExpr, groupExpr)
 
-	rows, err := q.db.Query(query, args...)
+	rows, err := q.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1789,3 +3744,289 @@ func (q *Queries) ResponseTimeTimeSeries(f Filter, daily bool) ([]TimeSeriesPoin
 
 	return results, rows.Err()
 }
+
+// UpstreamStat compares a router's total response time with the time its
+// upstream took, for requests whose log line recorded both
+type UpstreamStat struct {
+	Router        string
+	Count         int64
+	AvgTotalMs    int64
+	AvgUpstreamMs int64
+	ProxyMs       int64 // AvgTotalMs - AvgUpstreamMs: time spent in the proxy and on the client side
+}
+
+// UpstreamTimes returns upstream vs total response time per router, slowest
+// upstream first. Empty when the log format has no upstream duration.
+func (q *Queries) UpstreamTimes(ctx context.Context, f Filter) ([]UpstreamStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT router, SUM(count) as total,
+			SUM(duration) / SUM(count) as avg_total,
+			SUM(upstream) / SUM(count) as avg_upstream
+		FROM upstream_times
+		%s
+		GROUP BY router
+		HAVING total > 0
+		ORDER BY avg_upstream DESC, router
+	`, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []UpstreamStat
+	for rows.Next() {
+		var stat UpstreamStat
+		if err := rows.Scan(&stat.Router, &stat.Count, &stat.AvgTotalMs, &stat.AvgUpstreamMs); err != nil {
+			return nil, err
+		}
+		stat.ProxyMs = max(stat.AvgTotalMs-stat.AvgUpstreamMs, 0)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// sizeBuckets lists the size_hist buckets smallest first, matching the
+// labels written by the aggregator
+var sizeBuckets = []string{"0-1KB", "1-10KB", "10-100KB", "100KB-1MB", "1-10MB", "10MB+"}
+
+// SizeBucketStat represents one response size bucket within a period
+type SizeBucketStat struct {
+	Bucket string
+	Count  int64
+	Pct    float64
+}
+
+// SizeHistPoint is one period of the response size histogram. Buckets holds
+// every entry of sizeBuckets in order, zero-filled.
+type SizeHistPoint struct {
+	Label   string
+	Total   int64
+	Buckets []SizeBucketStat
+}
+
+// SizeHistogramOverTime returns the response size distribution per hour or
+// day. Bucket Pct is of that period's requests, so a shift toward large
+// responses (e.g. an endpoint suddenly returning huge error pages) stands out
+// regardless of traffic volume.
+func (q *Queries) SizeHistogramOverTime(ctx context.Context, f Filter, daily bool) ([]SizeHistPoint, error) {
+	where, args := buildWhere(f.allHosts())
+
+	selectExpr := "hour as period"
+	if daily {
+		selectExpr = "SUBSTR(hour, 1, 10) as period"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, bucket, SUM(count) as total
+		FROM size_hist
+		%s
+		GROUP BY period, bucket
+		ORDER BY period
+	`, selectExpr, where)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bucketIndex := make(map[string]int, len(sizeBuckets))
+	for i, b := range sizeBuckets {
+		bucketIndex[b] = i
+	}
+
+	var results []SizeHistPoint
+	for rows.Next() {
+		var period, bucket string
+		var count int64
+		if err := rows.Scan(&period, &bucket, &count); err != nil {
+			return nil, err
+		}
+		i, ok := bucketIndex[bucket]
+		if !ok {
+			continue
+		}
+		if len(results) == 0 || results[len(results)-1].Label != period {
+			point := SizeHistPoint{Label: period, Buckets: make([]SizeBucketStat, len(sizeBuckets))}
+			for j, b := range sizeBuckets {
+				point.Buckets[j].Bucket = b
+			}
+			results = append(results, point)
+		}
+		point := &results[len(results)-1]
+		point.Buckets[i].Count += count
+		point.Total += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		for j := range results[i].Buckets {
+			results[i].Buckets[j].Pct = pctOf(results[i].Buckets[j].Count, results[i].Total)
+		}
+	}
+
+	return results, nil
+}
+
+// ParamValueStat represents one captured query-string param value
+type ParamValueStat struct {
+	Value string
+	Count int64
+	Pct   float64
+}
+
+// TopParamValues returns the most frequent values of a captured query-string
+// param (see TRAIL_CAPTURE_PARAMS), e.g. top on-site searches for "q".
+// Only human traffic is captured. Pct is of all captured values of param,
+// including those outside the top limit.
+func (q *Queries) TopParamValues(ctx context.Context, f Filter, param string, limit int) ([]ParamValueStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT value, SUM(count) as total, SUM(SUM(count)) OVER () as grand_total
+		FROM query_params
+		%s AND param = ?
+		GROUP BY value
+		ORDER BY total DESC, value
+		LIMIT ?
+	`, where)
+
+	args = append(args, param, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ParamValueStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat ParamValueStat
+		if err := rows.Scan(&stat.Value, &stat.Count, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// QueryParamStat is one query-string param of human requests
+type QueryParamStat struct {
+	Param  string
+	Count  int64 // times the param was given (once per value for params whose values are captured)
+	Values int64 // distinct values seen; 0 when only the name is captured
+	Pct    float64
+}
+
+// TopQueryParams returns the most frequent query-string params among the
+// captured ones (TRAIL_CAPTURE_PARAMS, all of them with "*"). Pct is of
+// all captured params, including those outside the top limit.
+func (q *Queries) TopQueryParams(ctx context.Context, f Filter, limit int) ([]QueryParamStat, error) {
+	where, args := buildWhere(f.allHosts())
+
+	query := fmt.Sprintf(`
+		SELECT param, SUM(count) as total, COUNT(DISTINCT NULLIF(value, '')),
+			SUM(SUM(count)) OVER () as grand_total
+		FROM query_params
+		%s
+		GROUP BY param
+		ORDER BY total DESC, param
+		LIMIT ?
+	`, where)
+
+	args = append(args, limit)
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []QueryParamStat
+	var grandTotal int64
+	for rows.Next() {
+		var stat QueryParamStat
+		if err := rows.Scan(&stat.Param, &stat.Count, &stat.Values, &grandTotal); err != nil {
+			return nil, err
+		}
+		stat.Pct = pctOf(stat.Count, grandTotal)
+		results = append(results, stat)
+	}
+
+	return results, rows.Err()
+}
+
+// RequestSeries is the request count of one label combination in an hour
+type RequestSeries struct {
+	Values []string // one per label, in the order asked for
+	Count  int64
+}
+
+// metricsColumns maps /metrics labels to requests columns
+var metricsColumns = map[string]string{
+	"router": "router",
+	"status": "CAST(status AS TEXT)",
+	"path":   "path",
+}
+
+// HourRequestSeries returns the requests of hour grouped by labels (any of
+// router, path, status). Only the maxPaths busiest paths of the hour keep
+// their own path value; the rest share aggregator.OtherKey, bounding the
+// series count. No labels yields a single series.
+func (q *Queries) HourRequestSeries(ctx context.Context, hour string, labels []string, maxPaths int) ([]RequestSeries, error) {
+	var cols []string
+	var args []interface{}
+	for _, label := range labels {
+		col, ok := metricsColumns[label]
+		if !ok {
+			return nil, fmt.Errorf("unknown metrics label %q", label)
+		}
+		if label == "path" {
+			col = `CASE WHEN path IN (
+				SELECT path FROM requests WHERE hour = ? GROUP BY path ORDER BY SUM(count) DESC, path LIMIT ?
+			) THEN path ELSE ? END`
+			args = append(args, hour, maxPaths, aggregator.OtherKey)
+		}
+		cols = append(cols, col)
+	}
+	args = append(args, hour)
+
+	query := "SELECT " + strings.Join(append(cols, "COALESCE(SUM(count), 0)"), ", ") + " FROM requests WHERE hour = ?"
+	if len(cols) > 0 {
+		groups := make([]string, len(cols))
+		for i := range cols {
+			groups[i] = strconv.Itoa(i + 1)
+		}
+		query += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []RequestSeries
+	for rows.Next() {
+		s := RequestSeries{Values: make([]string, len(cols))}
+		dest := make([]interface{}, 0, len(cols)+1)
+		for i := range s.Values {
+			dest = append(dest, &s.Values[i])
+		}
+		if err := rows.Scan(append(dest, &s.Count)...); err != nil {
+			return nil, err
+		}
+		if s.Count > 0 {
+			results = append(results, s)
+		}
+	}
+	return results, rows.Err()
+}
@@ -1,9 +1,17 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/open-wander/trail/internal/aggregator"
+	"github.com/open-wander/trail/internal/config"
 	traildb "github.com/open-wander/trail/internal/db"
 	_ "modernc.org/sqlite"
 )
@@ -149,7 +157,7 @@ func TestRequestsOverTime(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.RequestsOverTime(tt.filter)
+			got, err := q.RequestsOverTime(context.Background(), tt.filter)
 			if err != nil {
 				t.Fatalf("RequestsOverTime() error = %v", err)
 			}
@@ -212,7 +220,7 @@ func TestTopPaths(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.TopPaths(tt.filter, tt.limit)
+			got, err := q.TopPaths(context.Background(), tt.filter, tt.limit)
 			if err != nil {
 				t.Fatalf("TopPaths() error = %v", err)
 			}
@@ -270,7 +278,7 @@ func TestTopReferrers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.TopReferrers(tt.filter, tt.limit)
+			got, err := q.TopReferrers(context.Background(), tt.filter, tt.limit)
 			if err != nil {
 				t.Fatalf("TopReferrers() error = %v", err)
 			}
@@ -334,7 +342,7 @@ func TestStatusBreakdown(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.StatusBreakdown(tt.filter)
+			got, err := q.StatusBreakdown(context.Background(), tt.filter)
 			if err != nil {
 				t.Fatalf("StatusBreakdown() error = %v", err)
 			}
@@ -400,7 +408,7 @@ func TestUniqueVisitors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.UniqueVisitors(tt.filter)
+			got, err := q.UniqueVisitors(context.Background(), tt.filter)
 			if err != nil {
 				t.Fatalf("UniqueVisitors() error = %v", err)
 			}
@@ -468,7 +476,7 @@ func TestTotalStats(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.TotalStats(tt.filter)
+			got, err := q.TotalStats(context.Background(), tt.filter)
 			if err != nil {
 				t.Fatalf("TotalStats() error = %v", err)
 			}
@@ -488,6 +496,30 @@ func TestTotalStats(t *testing.T) {
 	}
 }
 
+func TestTotalStatsAvgIsRequestWeighted(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	// /hot: 99 requests at 10ms each; /cold: 1 request at 1000ms.
+	// A simple per-path average would give (10+1000)/2 = 505ms.
+	seedRequests(t, db,
+		requestRow{"2026-02-08T00:00:00Z", "api", "/hot", "GET", 200, 99, 0, 990},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/cold", "GET", 200, 1, 0, 1000},
+	)
+
+	got, err := q.TotalStats(context.Background(), Filter{
+		From: "2026-02-08T00:00:00Z",
+		To:   "2026-02-08T23:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("TotalStats() error = %v", err)
+	}
+	// (990 + 1000) / 100 = 19ms
+	if got.AvgMs != 19 {
+		t.Errorf("AvgMs = %d, want 19 (request-weighted)", got.AvgMs)
+	}
+}
+
 func TestRouters(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -500,7 +532,7 @@ func TestRouters(t *testing.T) {
 	)
 
 	// Routers() takes no arguments - returns all distinct non-empty routers
-	got, err := q.Routers()
+	got, err := q.Routers(context.Background())
 	if err != nil {
 		t.Fatalf("Routers() error = %v", err)
 	}
@@ -519,6 +551,73 @@ func TestRouters(t *testing.T) {
 	}
 }
 
+func TestDataBounds(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	minHour, maxHour, err := q.DataBounds(context.Background())
+	if err != nil {
+		t.Fatalf("DataBounds() on empty db error = %v", err)
+	}
+	if minHour != "" || maxHour != "" {
+		t.Errorf("DataBounds() on empty db = (%q, %q), want empty", minHour, maxHour)
+	}
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T14:00:00Z", "api", "/users", "GET", 200, 10, 5000, 100000},
+		requestRow{"2026-02-01T03:00:00Z", "web", "/home", "GET", 200, 5, 2500, 50000},
+		requestRow{"2026-02-10T22:00:00Z", "unrouted", "/scan", "GET", 404, 1, 100, 10},
+	)
+
+	minHour, maxHour, err = q.DataBounds(context.Background())
+	if err != nil {
+		t.Fatalf("DataBounds() error = %v", err)
+	}
+	if minHour != "2026-02-01T03:00:00Z" {
+		t.Errorf("minHour = %q, want 2026-02-01T03:00:00Z", minHour)
+	}
+	if maxHour != "2026-02-10T22:00:00Z" {
+		t.Errorf("maxHour = %q, want 2026-02-10T22:00:00Z", maxHour)
+	}
+}
+
+func TestTopPathsForHour(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T09:00:00Z", "api", "/old", "GET", 200, 500, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "api", "/users", "GET", 200, 20, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "api", "/users", "POST", 201, 5, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/home", "GET", 200, 10, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "unrouted", "/.env", "GET", 404, 50, 0, 0},
+	)
+
+	got, err := q.TopPathsForHour(context.Background(), Filter{}, "2026-02-08T10:00:00Z", 5)
+	if err != nil {
+		t.Fatalf("TopPathsForHour() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/users" || got[0].Count != 25 || got[1].Path != "/home" {
+		t.Errorf("TopPathsForHour() = %+v, want /users=25 then /home", got)
+	}
+
+	got, err = q.TopPathsForHour(context.Background(), Filter{Router: "web"}, "2026-02-08T10:00:00Z", 5)
+	if err != nil {
+		t.Fatalf("TopPathsForHour() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "/home" {
+		t.Errorf("TopPathsForHour(router=web) = %+v, want only /home", got)
+	}
+
+	got, err = q.TopPathsForHour(context.Background(), Filter{IncludeBots: true}, "2026-02-08T10:00:00Z", 1)
+	if err != nil {
+		t.Fatalf("TopPathsForHour() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "/.env" {
+		t.Errorf("TopPathsForHour(bots, limit 1) = %+v, want /.env", got)
+	}
+}
+
 func TestTopProbedPaths(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -531,7 +630,7 @@ func TestTopProbedPaths(t *testing.T) {
 	)
 
 	// TopProbedPaths only takes limit - hardcoded to unrouted router
-	got, err := q.TopProbedPaths(2)
+	got, err := q.TopProbedPaths(context.Background(), 2)
 	if err != nil {
 		t.Fatalf("TopProbedPaths() error = %v", err)
 	}
@@ -543,7 +642,7 @@ func TestTopProbedPaths(t *testing.T) {
 	}
 
 	// Verify non-unrouted paths are excluded
-	allProbed, err := q.TopProbedPaths(10)
+	allProbed, err := q.TopProbedPaths(context.Background(), 10)
 	if err != nil {
 		t.Fatalf("TopProbedPaths() error = %v", err)
 	}
@@ -566,7 +665,7 @@ func TestTopScannerIPs(t *testing.T) {
 	)
 
 	// TopScannerIPs only takes limit - hardcoded to unrouted router
-	got, err := q.TopScannerIPs(10)
+	got, err := q.TopScannerIPs(context.Background(), 10)
 	if err != nil {
 		t.Fatalf("TopScannerIPs() error = %v", err)
 	}
@@ -625,6 +724,16 @@ func TestBuildWhere(t *testing.T) {
 			wantParts:  2, // hour >= ?, hour <= ?
 			wantParams: 2,
 		},
+		{
+			name: "unrouted is real",
+			filter: Filter{
+				From:            "2026-02-08T00:00:00Z",
+				To:              "2026-02-08T23:00:00Z",
+				IncludeUnrouted: true,
+			},
+			wantParts:  2, // hour >= ?, hour <= ?
+			wantParams: 2,
+		},
 	}
 
 	for _, tt := range tests {
@@ -636,6 +745,9 @@ func TestBuildWhere(t *testing.T) {
 			if len(args) != tt.wantParams {
 				t.Errorf("buildWhere() returned %d params, want %d", len(args), tt.wantParams)
 			}
+			if parts := strings.Count(where, " AND ") + 1; parts != tt.wantParts {
+				t.Errorf("buildWhere() returned %d conditions, want %d: %s", parts, tt.wantParts, where)
+			}
 		})
 	}
 }
@@ -651,7 +763,7 @@ func TestEmptyResults(t *testing.T) {
 	}
 
 	// All queries should return empty results without errors on empty DB
-	rot, err := q.RequestsOverTime(f)
+	rot, err := q.RequestsOverTime(context.Background(), f)
 	if err != nil {
 		t.Fatalf("RequestsOverTime() error = %v", err)
 	}
@@ -659,7 +771,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("RequestsOverTime() on empty DB returned %d rows", len(rot))
 	}
 
-	paths, err := q.TopPaths(f, 10)
+	paths, err := q.TopPaths(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("TopPaths() error = %v", err)
 	}
@@ -667,7 +779,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("TopPaths() on empty DB returned %d rows", len(paths))
 	}
 
-	refs, err := q.TopReferrers(f, 10)
+	refs, err := q.TopReferrers(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("TopReferrers() error = %v", err)
 	}
@@ -675,7 +787,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("TopReferrers() on empty DB returned %d rows", len(refs))
 	}
 
-	statuses, err := q.StatusBreakdown(f)
+	statuses, err := q.StatusBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("StatusBreakdown() error = %v", err)
 	}
@@ -683,7 +795,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("StatusBreakdown() on empty DB returned %d rows", len(statuses))
 	}
 
-	visitors, err := q.UniqueVisitors(f)
+	visitors, err := q.UniqueVisitors(context.Background(), f)
 	if err != nil {
 		t.Fatalf("UniqueVisitors() error = %v", err)
 	}
@@ -691,7 +803,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("UniqueVisitors() on empty DB returned %d rows", len(visitors))
 	}
 
-	probed, err := q.TopProbedPaths(10)
+	probed, err := q.TopProbedPaths(context.Background(), 10)
 	if err != nil {
 		t.Fatalf("TopProbedPaths() error = %v", err)
 	}
@@ -699,7 +811,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("TopProbedPaths() on empty DB returned %d rows", len(probed))
 	}
 
-	scanners, err := q.TopScannerIPs(10)
+	scanners, err := q.TopScannerIPs(context.Background(), 10)
 	if err != nil {
 		t.Fatalf("TopScannerIPs() error = %v", err)
 	}
@@ -707,7 +819,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("TopScannerIPs() on empty DB returned %d rows", len(scanners))
 	}
 
-	notFound, err := q.TopNotFound(f, 10)
+	notFound, err := q.TopNotFound(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("TopNotFound() error = %v", err)
 	}
@@ -715,7 +827,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("TopNotFound() on empty DB returned %d rows", len(notFound))
 	}
 
-	agents, err := q.UserAgentBreakdown(f)
+	agents, err := q.UserAgentBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("UserAgentBreakdown() error = %v", err)
 	}
@@ -723,7 +835,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("UserAgentBreakdown() on empty DB returned %d rows", len(agents))
 	}
 
-	methods, err := q.MethodBreakdown(f)
+	methods, err := q.MethodBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("MethodBreakdown() error = %v", err)
 	}
@@ -731,7 +843,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("MethodBreakdown() on empty DB returned %d rows", len(methods))
 	}
 
-	specificStatuses, err := q.SpecificStatusCodes(f)
+	specificStatuses, err := q.SpecificStatusCodes(context.Background(), f)
 	if err != nil {
 		t.Fatalf("SpecificStatusCodes() error = %v", err)
 	}
@@ -739,7 +851,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("SpecificStatusCodes() on empty DB returned %d rows", len(specificStatuses))
 	}
 
-	hourDist, err := q.HourOfDayDistribution(f)
+	hourDist, err := q.HourOfDayDistribution(context.Background(), f)
 	if err != nil {
 		t.Fatalf("HourOfDayDistribution() error = %v", err)
 	}
@@ -747,7 +859,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("HourOfDayDistribution() on empty DB returned %d rows", len(hourDist))
 	}
 
-	drilldown, err := q.PathDrilldown(f, "/nonexistent")
+	drilldown, err := q.PathDrilldown(context.Background(), f, "/nonexistent")
 	if err != nil {
 		t.Fatalf("PathDrilldown() error = %v", err)
 	}
@@ -755,7 +867,7 @@ func TestEmptyResults(t *testing.T) {
 		t.Errorf("PathDrilldown() on empty DB returned %d rows", len(drilldown))
 	}
 
-	classDrilldown, err := q.StatusClassDrilldown(f, "4xx")
+	classDrilldown, err := q.StatusClassDrilldown(context.Background(), f, "4xx")
 	if err != nil {
 		t.Fatalf("StatusClassDrilldown() error = %v", err)
 	}
@@ -781,7 +893,7 @@ func TestTopNotFound(t *testing.T) {
 		IncludeBots: false,
 	}
 
-	got, err := q.TopNotFound(f, 10)
+	got, err := q.TopNotFound(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("TopNotFound() error = %v", err)
 	}
@@ -843,7 +955,7 @@ func TestUserAgentBreakdown(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.UserAgentBreakdown(tt.filter)
+			got, err := q.UserAgentBreakdown(context.Background(), tt.filter)
 			if err != nil {
 				t.Fatalf("UserAgentBreakdown() error = %v", err)
 			}
@@ -877,7 +989,7 @@ func TestMethodBreakdown(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.MethodBreakdown(f)
+	got, err := q.MethodBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("MethodBreakdown() error = %v", err)
 	}
@@ -897,6 +1009,120 @@ func TestMethodBreakdown(t *testing.T) {
 	}
 }
 
+func TestMethodBreakdownGroupsOther(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T00:00:00Z", "api", "/", "GET", 200, 100, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/dav", "PROPFIND", 207, 20, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "unrouted", "/", "FOO", 405, 15, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/", "POST", 200, 10, 0, 0},
+	)
+
+	f := Filter{
+		From:        "2026-02-08T00:00:00Z",
+		To:          "2026-02-08T23:00:00Z",
+		IncludeBots: true,
+	}
+
+	got, err := q.MethodBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("MethodBreakdown() error = %v", err)
+	}
+	want := []MethodStat{{Method: "GET", Count: 100}, {Method: OtherMethod, Count: 35}, {Method: "POST", Count: 10}}
+	if len(got) != len(want) {
+		t.Fatalf("MethodBreakdown() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Method != want[i].Method || got[i].Count != want[i].Count {
+			t.Errorf("MethodBreakdown()[%d] = %s/%d, want %s/%d", i, got[i].Method, got[i].Count, want[i].Method, want[i].Count)
+		}
+	}
+
+	unusual, err := q.UnusualMethods(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("UnusualMethods() error = %v", err)
+	}
+	if len(unusual) != 2 || unusual[0].Method != "PROPFIND" || unusual[1].Method != "FOO" {
+		t.Errorf("UnusualMethods() = %+v, want PROPFIND then FOO", unusual)
+	}
+
+	// Extra methods are shown individually and are no longer unusual
+	q.SetKnownMethods([]string{"propfind"})
+	got, err = q.MethodBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("MethodBreakdown() error = %v", err)
+	}
+	if len(got) != 4 || got[1].Method != "PROPFIND" || got[2].Method != OtherMethod || got[2].Count != 15 {
+		t.Errorf("MethodBreakdown() with PROPFIND known = %+v", got)
+	}
+	unusual, err = q.UnusualMethods(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("UnusualMethods() error = %v", err)
+	}
+	if len(unusual) != 1 || unusual[0].Method != "FOO" {
+		t.Errorf("UnusualMethods() with PROPFIND known = %+v, want only FOO", unusual)
+	}
+}
+
+func TestBreakdownLimit(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	q.SetBreakdownLimit(3)
+
+	// Eight made-up but known methods, busiest first
+	var extra []string
+	for i := range 8 {
+		m := fmt.Sprintf("M%d", i)
+		extra = append(extra, m)
+		seedRequests(t, db, requestRow{"2026-02-08T00:00:00Z", fmt.Sprintf("r%d", i), "/", m, 200 + i, 80 - i*10, 0, 0})
+		seedUserAgents(t, db, userAgentRow{"2026-02-08T00:00:00Z", "api", m, 80 - i*10})
+	}
+	q.SetKnownMethods(extra)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", IncludeBots: true}
+
+	methods, err := q.MethodBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("MethodBreakdown() error = %v", err)
+	}
+	var got []string
+	for _, m := range methods {
+		got = append(got, m.Method)
+	}
+	// The folded tail outweighs each kept method, so it sorts first
+	if want := []string{OtherMethod, "M0", "M1", "M2"}; !slices.Equal(got, want) {
+		t.Errorf("MethodBreakdown() = %v, want %v", got, want)
+	}
+	if other := methods[0].Count; other != 50+40+30+20+10 {
+		t.Errorf("MethodBreakdown() Other = %d, want 150", other)
+	}
+
+	statuses, err := q.SpecificStatusCodes(context.Background(), f)
+	if err != nil {
+		t.Fatalf("SpecificStatusCodes() error = %v", err)
+	}
+	if len(statuses) != 4 || statuses[3].Status != OtherStatus || statuses[3].Count != 150 {
+		t.Errorf("SpecificStatusCodes() = %+v, want 3 codes then OtherStatus with 150", statuses)
+	}
+
+	agents, err := q.UserAgentBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("UserAgentBreakdown() error = %v", err)
+	}
+	if len(agents) != 4 || agents[3].Category != aggregator.OtherKey || agents[3].Count != 150 {
+		t.Errorf("UserAgentBreakdown() = %+v, want 3 categories then %s with 150", agents, aggregator.OtherKey)
+	}
+
+	routers, err := q.Routers(context.Background())
+	if err != nil {
+		t.Fatalf("Routers() error = %v", err)
+	}
+	if want := []string{"r0", "r1", "r2"}; !slices.Equal(routers, want) {
+		t.Errorf("Routers() = %v, want the busiest %v", routers, want)
+	}
+}
+
 func TestSpecificStatusCodes(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -915,7 +1141,7 @@ func TestSpecificStatusCodes(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.SpecificStatusCodes(f)
+	got, err := q.SpecificStatusCodes(context.Background(), f)
 	if err != nil {
 		t.Fatalf("SpecificStatusCodes() error = %v", err)
 	}
@@ -931,6 +1157,32 @@ func TestSpecificStatusCodes(t *testing.T) {
 	}
 }
 
+func TestSpecificStatusCodesNonStandard(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T00:00:00Z", "api", "/users", "GET", 200, 100, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/stream", "GET", 499, 7, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/upload", "POST", 0, 3, 0, 0},
+	)
+
+	got, err := q.SpecificStatusCodes(context.Background(), Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"})
+	if err != nil {
+		t.Fatalf("SpecificStatusCodes() error = %v", err)
+	}
+	classes := map[int]string{}
+	for _, row := range got {
+		classes[row.Status] = row.Class
+	}
+	if classes[499] != "4xx" {
+		t.Errorf("status 499 class = %q, want 4xx", classes[499])
+	}
+	if classes[0] != "other" {
+		t.Errorf("status 0 class = %q, want other (and still listed)", classes[0])
+	}
+}
+
 func TestHourOfDayDistribution(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -948,7 +1200,7 @@ func TestHourOfDayDistribution(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.HourOfDayDistribution(f)
+	got, err := q.HourOfDayDistribution(context.Background(), f)
 	if err != nil {
 		t.Fatalf("HourOfDayDistribution() error = %v", err)
 	}
@@ -988,7 +1240,7 @@ func TestPathDrilldown(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.PathDrilldown(f, "/users")
+	got, err := q.PathDrilldown(context.Background(), f, "/users")
 	if err != nil {
 		t.Fatalf("PathDrilldown() error = %v", err)
 	}
@@ -1003,7 +1255,7 @@ func TestPathDrilldown(t *testing.T) {
 	}
 
 	// Drilling down on a non-existent path should return empty
-	empty, err := q.PathDrilldown(f, "/nonexistent")
+	empty, err := q.PathDrilldown(context.Background(), f, "/nonexistent")
 	if err != nil {
 		t.Fatalf("PathDrilldown() error = %v", err)
 	}
@@ -1031,7 +1283,7 @@ func TestStatusClassDrilldown(t *testing.T) {
 	}
 
 	// 2xx class should have 200 and 201
-	got2xx, err := q.StatusClassDrilldown(f, "2xx")
+	got2xx, err := q.StatusClassDrilldown(context.Background(), f, "2xx")
 	if err != nil {
 		t.Fatalf("StatusClassDrilldown(2xx) error = %v", err)
 	}
@@ -1040,7 +1292,7 @@ func TestStatusClassDrilldown(t *testing.T) {
 	}
 
 	// 4xx class should have 400 and 404
-	got4xx, err := q.StatusClassDrilldown(f, "4xx")
+	got4xx, err := q.StatusClassDrilldown(context.Background(), f, "4xx")
 	if err != nil {
 		t.Fatalf("StatusClassDrilldown(4xx) error = %v", err)
 	}
@@ -1049,7 +1301,7 @@ func TestStatusClassDrilldown(t *testing.T) {
 	}
 
 	// Invalid class should error
-	_, err = q.StatusClassDrilldown(f, "invalid")
+	_, err = q.StatusClassDrilldown(context.Background(), f, "invalid")
 	if err == nil {
 		t.Error("StatusClassDrilldown(invalid) should return error")
 	}
@@ -1074,7 +1326,7 @@ func TestTopPathsPaginated(t *testing.T) {
 	}
 
 	// Page 1, limit 2
-	result, err := q.TopPathsPaginated(f, 1, 2, "count", "desc")
+	result, err := q.TopPathsPaginated(context.Background(), f, 1, 2, "count", "desc")
 	if err != nil {
 		t.Fatalf("TopPathsPaginated() error = %v", err)
 	}
@@ -1093,7 +1345,7 @@ func TestTopPathsPaginated(t *testing.T) {
 	}
 
 	// Page 2
-	result2, err := q.TopPathsPaginated(f, 2, 2, "count", "desc")
+	result2, err := q.TopPathsPaginated(context.Background(), f, 2, 2, "count", "desc")
 	if err != nil {
 		t.Fatalf("TopPathsPaginated() page 2 error = %v", err)
 	}
@@ -1106,7 +1358,7 @@ func TestTopPathsPaginated(t *testing.T) {
 	}
 
 	// Sort by path ascending
-	resultAsc, err := q.TopPathsPaginated(f, 1, 5, "path", "asc")
+	resultAsc, err := q.TopPathsPaginated(context.Background(), f, 1, 5, "path", "asc")
 	if err != nil {
 		t.Fatalf("TopPathsPaginated() sort asc error = %v", err)
 	}
@@ -1114,6 +1366,23 @@ func TestTopPathsPaginated(t *testing.T) {
 	if len(itemsAsc) > 0 && itemsAsc[0].Path != "/a" {
 		t.Errorf("sort asc first path = %q, want /a", itemsAsc[0].Path)
 	}
+
+	// Sort by average response size; /big has few but large responses
+	seedRequests(t, db,
+		requestRow{"2026-02-08T00:00:00Z", "api", "/big", "GET", 200, 2, 4000000, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/empty", "GET", 304, 0, 0, 0},
+	)
+	resultSize, err := q.TopPathsPaginated(context.Background(), f, 1, 10, "avg_bytes", "desc")
+	if err != nil {
+		t.Fatalf("TopPathsPaginated() sort avg_bytes error = %v", err)
+	}
+	itemsSize := resultSize.Items.([]PathStat)
+	if len(itemsSize) != 7 || itemsSize[0].Path != "/big" || itemsSize[0].AvgBytes != 2000000 {
+		t.Fatalf("sort avg_bytes = %+v, want /big first at 2000000 bytes", itemsSize)
+	}
+	if last := itemsSize[len(itemsSize)-1]; last.Path != "/empty" || last.AvgBytes != 0 {
+		t.Errorf("sort avg_bytes last = %+v, want /empty at 0 bytes", last)
+	}
 }
 
 func TestPathsSummary(t *testing.T) {
@@ -1132,7 +1401,7 @@ func TestPathsSummary(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.PathsSummary(f)
+	got, err := q.PathsSummary(context.Background(), f)
 	if err != nil {
 		t.Fatalf("PathsSummary() error = %v", err)
 	}
@@ -1169,7 +1438,7 @@ func TestThreatPatterns(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.ThreatPatterns(f, false)
+	got, err := q.ThreatPatterns(context.Background(), f, false, nil)
 	if err != nil {
 		t.Fatalf("ThreatPatterns() error = %v", err)
 	}
@@ -1225,6 +1494,55 @@ func TestThreatPatterns(t *testing.T) {
 	}
 }
 
+func TestThreatPatternsSuspiciousStatuses(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	// Combined-format rows all carry router "server"
+	seedRequests(t, db,
+		requestRow{"2026-02-08T00:00:00Z", "server", "/wp-login.php", "GET", 404, 40, 0, 400},
+		requestRow{"2026-02-08T00:00:00Z", "server", "/admin", "GET", 401, 30, 0, 300},
+		requestRow{"2026-02-08T00:00:00Z", "server", "/.env", "GET", 403, 20, 0, 200},
+		requestRow{"2026-02-08T00:00:00Z", "server", "/", "GET", 200, 1000, 0, 1000},
+	)
+
+	f := Filter{
+		From:        "2026-02-08T00:00:00Z",
+		To:          "2026-02-08T23:00:00Z",
+		IncludeBots: true,
+	}
+
+	sum := func(stats []ThreatPatternStat) int64 {
+		var total int64
+		for _, tp := range stats {
+			total += tp.Count
+		}
+		return total
+	}
+
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int64
+	}{
+		{"default is status >= 400", nil, 90},
+		{"only 404", []int{404}, 40},
+		{"404 and 403", []int{404, 403}, 60},
+		{"status with no rows", []int{418}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := q.ThreatPatterns(context.Background(), f, true, tt.statuses)
+			if err != nil {
+				t.Fatalf("ThreatPatterns() error = %v", err)
+			}
+			if total := sum(got); total != tt.want {
+				t.Errorf("total = %d, want %d", total, tt.want)
+			}
+		})
+	}
+}
+
 func TestThreatPatternsEmpty(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -1235,7 +1553,7 @@ func TestThreatPatternsEmpty(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.ThreatPatterns(f, false)
+	got, err := q.ThreatPatterns(context.Background(), f, false, nil)
 	if err != nil {
 		t.Fatalf("ThreatPatterns() error = %v", err)
 	}
@@ -1262,7 +1580,7 @@ func TestBotVsHuman(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	humanCount, botCount, botBreakdown, err := q.BotVsHuman(f)
+	humanCount, botCount, botBreakdown, err := q.BotVsHuman(context.Background(), f)
 	if err != nil {
 		t.Fatalf("BotVsHuman() error = %v", err)
 	}
@@ -1293,7 +1611,7 @@ func TestBotVsHumanEmpty(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	humanCount, botCount, botBreakdown, err := q.BotVsHuman(f)
+	humanCount, botCount, botBreakdown, err := q.BotVsHuman(context.Background(), f)
 	if err != nil {
 		t.Fatalf("BotVsHuman() error = %v", err)
 	}
@@ -1305,6 +1623,44 @@ func TestBotVsHumanEmpty(t *testing.T) {
 	}
 }
 
+func TestTrafficGaps(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", Router: "api"}
+
+	if got, err := q.TrafficGaps(context.Background(), f, 2); err != nil || got != nil {
+		t.Fatalf("TrafficGaps() without data = %+v, %v; want none", got, err)
+	}
+
+	hour := func(h int) string { return fmt.Sprintf("2026-02-08T%02d:00:00Z", h) }
+	for h, count := range map[int]int{0: 1000, 1: 1000, 2: 1000, 6: 1000, 7: 1, 8: 1000, 9: 5, 10: 5, 11: 1000} {
+		seedRequests(t, db, requestRow{hour(h), "api", "/", "GET", 200, count, 0, 0})
+	}
+	// Another router keeps the data going until 14:00, after the api went quiet
+	seedRequests(t, db, requestRow{hour(14), "web", "/", "GET", 200, 50, 0, 0})
+
+	got, err := q.TrafficGaps(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("TrafficGaps() error = %v", err)
+	}
+	want := []Gap{
+		{Start: hour(3), End: hour(5), Hours: 3},
+		{Start: hour(12), End: hour(14), Hours: 3},
+		{Start: hour(9), End: hour(10), Hours: 2, Requests: 10}, // near-zero counts too
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("TrafficGaps(2) = %+v, want %+v", got, want)
+	}
+
+	// The lone quiet hour at 07:00 only shows with a 1 hour threshold
+	if got, _ := q.TrafficGaps(context.Background(), f, 1); len(got) != 4 || got[3].Start != hour(7) {
+		t.Errorf("TrafficGaps(1) = %+v, want the 07:00 hour last", got)
+	}
+	if got, _ := q.TrafficGaps(context.Background(), f, 4); len(got) != 0 {
+		t.Errorf("TrafficGaps(4) = %+v, want none", got)
+	}
+}
+
 func TestErrorTrends(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -1324,7 +1680,7 @@ func TestErrorTrends(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.ErrorTrends(f)
+	got, err := q.ErrorTrends(context.Background(), f)
 	if err != nil {
 		t.Fatalf("ErrorTrends() error = %v", err)
 	}
@@ -1363,7 +1719,7 @@ func TestErrorPaths(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.ErrorPaths(f, 10)
+	got, err := q.ErrorPaths(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("ErrorPaths() error = %v", err)
 	}
@@ -1405,7 +1761,7 @@ func TestStatusCodePaths(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.StatusCodePaths(f, 404, 10)
+	got, err := q.StatusCodePaths(context.Background(), f, 404, 10)
 	if err != nil {
 		t.Fatalf("StatusCodePaths() error = %v", err)
 	}
@@ -1421,7 +1777,7 @@ func TestStatusCodePaths(t *testing.T) {
 	}
 
 	// Limit should work
-	limited, err := q.StatusCodePaths(f, 404, 2)
+	limited, err := q.StatusCodePaths(context.Background(), f, 404, 2)
 	if err != nil {
 		t.Fatalf("StatusCodePaths(limit=2) error = %v", err)
 	}
@@ -1430,7 +1786,7 @@ func TestStatusCodePaths(t *testing.T) {
 	}
 
 	// No results for status that doesn't exist
-	empty, err := q.StatusCodePaths(f, 500, 10)
+	empty, err := q.StatusCodePaths(context.Background(), f, 500, 10)
 	if err != nil {
 		t.Fatalf("StatusCodePaths(500) error = %v", err)
 	}
@@ -1457,7 +1813,7 @@ func TestPathAlternateStatuses(t *testing.T) {
 	}
 
 	// Exclude 200, should get 304, 201, 404
-	got, err := q.PathAlternateStatuses(f, "/users", 200)
+	got, err := q.PathAlternateStatuses(context.Background(), f, "/users", 200)
 	if err != nil {
 		t.Fatalf("PathAlternateStatuses() error = %v", err)
 	}
@@ -1476,7 +1832,7 @@ func TestPathAlternateStatuses(t *testing.T) {
 	}
 
 	// Non-existent path should return empty
-	empty, err := q.PathAlternateStatuses(f, "/nonexistent", 200)
+	empty, err := q.PathAlternateStatuses(context.Background(), f, "/nonexistent", 200)
 	if err != nil {
 		t.Fatalf("PathAlternateStatuses(nonexistent) error = %v", err)
 	}
@@ -1485,6 +1841,112 @@ func TestPathAlternateStatuses(t *testing.T) {
 	}
 }
 
+func TestBrokenLinkCandidates(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	h := "2026-02-08T10:00:00Z"
+	seedRequests(t, db,
+		// Scanner probes: no working counterpart in any form
+		requestRow{h, "web", "/.env", "GET", 404, 500, 0, 0},
+		requestRow{h, "web", "/wp-login.php", "GET", 404, 300, 0, 0},
+		// Trailing slash
+		requestRow{h, "web", "/docs", "GET", 404, 40, 0, 0},
+		requestRow{h, "web", "/docs/", "GET", 200, 900, 0, 0},
+		// Case
+		requestRow{h, "web", "/About", "GET", 404, 30, 0, 0},
+		requestRow{h, "web", "/about", "GET", 200, 400, 0, 0},
+		// .html extension
+		requestRow{h, "web", "/pricing", "GET", 404, 20, 0, 0},
+		requestRow{h, "web", "/pricing.html", "GET", 200, 100, 0, 0},
+		// Same path works with another method
+		requestRow{h, "web", "/api/login", "GET", 404, 10, 0, 0},
+		requestRow{h, "web", "/api/login", "POST", 200, 80, 0, 0},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.BrokenLinkCandidates(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("BrokenLinkCandidates() error = %v", err)
+	}
+	want := []struct{ path, alt, reason string }{
+		{"/docs", "/docs/", "trailing slash"},
+		{"/About", "/about", "case differs"},
+		{"/pricing", "/pricing.html", ".html extension"},
+		{"/api/login", "/api/login", "works with POST"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("BrokenLinkCandidates() = %+v, want %d candidates without the scanner probes", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Path != w.path || got[i].Alternate != w.alt || got[i].Reason != w.reason {
+			t.Errorf("candidate %d = %s -> %s (%s), want %s -> %s (%s)",
+				i, got[i].Path, got[i].Alternate, got[i].Reason, w.path, w.alt, w.reason)
+		}
+	}
+
+	limited, err := q.BrokenLinkCandidates(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("BrokenLinkCandidates(limit 2) error = %v", err)
+	}
+	if len(limited) != 2 {
+		t.Errorf("BrokenLinkCandidates(limit 2) returned %d, want 2", len(limited))
+	}
+}
+
+func TestRedirectChains(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	h := "2026-02-08T10:00:00Z"
+	seedRequests(t, db,
+		// Resolved: slash added
+		requestRow{h, "web", "/docs", "GET", 301, 90, 0, 0},
+		requestRow{h, "web", "/docs/", "GET", 200, 900, 0, 0},
+		// Resolved: slash dropped
+		requestRow{h, "web", "/blog/", "GET", 308, 50, 0, 0},
+		requestRow{h, "web", "/blog", "GET", 200, 400, 0, 0},
+		// Loop: each redirects to the other
+		requestRow{h, "web", "/a", "GET", 301, 30, 0, 0},
+		requestRow{h, "web", "/a/", "GET", 301, 20, 0, 0},
+		// Redirects elsewhere, twin never requested
+		requestRow{h, "web", "/old", "GET", 302, 10, 0, 0},
+		requestRow{h, "web", "/new", "GET", 200, 100, 0, 0},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.RedirectChains(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("RedirectChains() error = %v", err)
+	}
+	want := []RedirectChain{
+		{Path: "/docs", Redirects: 90, Target: "/docs/", TargetOK: 900},
+		{Path: "/blog/", Redirects: 50, Target: "/blog", TargetOK: 400},
+		{Path: "/a", Redirects: 30, Target: "/a/", Loop: true},
+		{Path: "/a/", Redirects: 20, Target: "/a", Loop: true},
+		{Path: "/old", Redirects: 10},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("RedirectChains() = %+v, want %+v", got, want)
+	}
+
+	kept, merged := mergeSlashRedirects(got)
+	if len(kept) != 3 || kept[0].Path != "/a" || kept[2].Path != "/old" {
+		t.Errorf("mergeSlashRedirects() kept %+v, want the loop pair and /old", kept)
+	}
+	if merged != (SlashRedirectSummary{Paths: 2, Requests: 140}) {
+		t.Errorf("mergeSlashRedirects() merged %+v, want 2 paths with 140 requests", merged)
+	}
+
+	limited, err := q.RedirectChains(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("RedirectChains(limit 2) error = %v", err)
+	}
+	if len(limited) != 2 {
+		t.Errorf("RedirectChains(limit 2) returned %d, want 2", len(limited))
+	}
+}
+
 func TestStatusCodeMethods(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -1503,7 +1965,7 @@ func TestStatusCodeMethods(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.StatusCodeMethods(f, 404)
+	got, err := q.StatusCodeMethods(context.Background(), f, 404)
 	if err != nil {
 		t.Fatalf("StatusCodeMethods() error = %v", err)
 	}
@@ -1524,7 +1986,7 @@ func TestStatusCodeMethods(t *testing.T) {
 	}
 
 	// No results for status that doesn't exist
-	empty, err := q.StatusCodeMethods(f, 500)
+	empty, err := q.StatusCodeMethods(context.Background(), f, 500)
 	if err != nil {
 		t.Fatalf("StatusCodeMethods(500) error = %v", err)
 	}
@@ -1554,7 +2016,7 @@ func TestSlowestPaths(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.SlowestPaths(f, 10)
+	got, err := q.SlowestPaths(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("SlowestPaths() error = %v", err)
 	}
@@ -1629,7 +2091,7 @@ func TestHourOfDayVisitors(t *testing.T) {
 		visitorRow{Hour: "2026-02-08T22:00:00Z", Router: "web", IPHash: "eee"},
 	)
 
-	got, err := q.HourOfDayVisitors(f)
+	got, err := q.HourOfDayVisitors(context.Background(), f)
 	if err != nil {
 		t.Fatalf("HourOfDayVisitors() error: %v", err)
 	}
@@ -1670,7 +2132,7 @@ func TestPathDailyTrends(t *testing.T) {
 	)
 
 	// Empty paths should return nil
-	result, err := q.PathDailyTrends(f, []string{})
+	result, err := q.PathDailyTrends(context.Background(), f, []string{})
 	if err != nil {
 		t.Fatalf("PathDailyTrends(empty) error: %v", err)
 	}
@@ -1679,7 +2141,7 @@ func TestPathDailyTrends(t *testing.T) {
 	}
 
 	// Fetch trends for "/" and "/api"
-	result, err = q.PathDailyTrends(f, []string{"/", "/api"})
+	result, err = q.PathDailyTrends(context.Background(), f, []string{"/", "/api"})
 	if err != nil {
 		t.Fatalf("PathDailyTrends() error: %v", err)
 	}
@@ -1840,7 +2302,7 @@ func TestCountryBreakdown(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := q.CountryBreakdown(tt.filter, tt.limit)
+			got, err := q.CountryBreakdown(context.Background(), tt.filter, tt.limit)
 			if err != nil {
 				t.Fatalf("CountryBreakdown() error = %v", err)
 			}
@@ -1857,6 +2319,45 @@ func TestCountryBreakdown(t *testing.T) {
 	}
 }
 
+func TestCountryRouterBreakdown(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedCountries(t, db,
+		countryRow{"2026-02-08T00:00:00Z", "web", "US", 300},
+		countryRow{"2026-02-08T01:00:00Z", "api", "US", 500},
+		countryRow{"2026-02-08T00:00:00Z", "web", "DE", 200},
+		countryRow{"2026-02-08T00:00:00Z", "unrouted", "US", 1000},
+	)
+
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+	got, err := q.CountryRouterBreakdown(context.Background(), f, "US")
+	if err != nil {
+		t.Fatalf("CountryRouterBreakdown() error = %v", err)
+	}
+	want := []RouterStat{{Router: "api", Count: 500, Pct: 62.5}, {Router: "web", Count: 300, Pct: 37.5}}
+	if !slices.Equal(got, want) {
+		t.Errorf("CountryRouterBreakdown(US) = %+v, want %+v", got, want)
+	}
+
+	f.IncludeBots = true
+	got, err = q.CountryRouterBreakdown(context.Background(), f, "US")
+	if err != nil {
+		t.Fatalf("CountryRouterBreakdown() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Router != "unrouted" {
+		t.Errorf("CountryRouterBreakdown(US) with bots = %+v, want unrouted first of 3", got)
+	}
+
+	got, err = q.CountryRouterBreakdown(context.Background(), f, "FR")
+	if err != nil {
+		t.Fatalf("CountryRouterBreakdown() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("CountryRouterBreakdown(FR) = %+v, want none", got)
+	}
+}
+
 func TestBrowserBreakdown(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
@@ -1874,7 +2375,7 @@ func TestBrowserBreakdown(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.BrowserBreakdown(f)
+	got, err := q.BrowserBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("BrowserBreakdown() error = %v", err)
 	}
@@ -1912,7 +2413,7 @@ func TestOSBreakdown(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.OSBreakdown(f)
+	got, err := q.OSBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("OSBreakdown() error = %v", err)
 	}
@@ -1943,7 +2444,7 @@ func TestDurationHistogram(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.DurationHistogram(f)
+	got, err := q.DurationHistogram(context.Background(), f)
 	if err != nil {
 		t.Fatalf("DurationHistogram() error = %v", err)
 	}
@@ -1979,7 +2480,7 @@ func TestDurationPercentiles(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.DurationPercentiles(f)
+	got, err := q.DurationPercentiles(context.Background(), f)
 	if err != nil {
 		t.Fatalf("DurationPercentiles() error = %v", err)
 	}
@@ -1996,30 +2497,68 @@ func TestDurationPercentiles(t *testing.T) {
 	}
 }
 
-func TestDurationPercentilesEmpty(t *testing.T) {
+func TestDurationPercentilesSampled(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", IncludeBots: true}
 
-	f := Filter{
-		From:        "2026-02-08T00:00:00Z",
-		To:          "2026-02-08T23:00:00Z",
-		IncludeBots: true,
+	seedDurationHist(t, db,
+		durationHistRow{"2026-02-08T00:00:00Z", "web", "0-10ms", 90},
+		durationHistRow{"2026-02-08T00:00:00Z", "web", "500-1000ms", 10},
+		durationHistRow{"2026-02-08T01:00:00Z", "web", "100-500ms", 100},
+	)
+
+	// Samples for only one of the hours: the histogram is used
+	if _, err := db.Exec(`INSERT INTO duration_samples (hour, router, seen, samples) VALUES
+		('2026-02-08T00:00:00Z', 'web', 100, '2,3,4,4,4,5,6,7,8,900')`); err != nil {
+		t.Fatalf("seed duration_samples: %v", err)
+	}
+	got, err := q.DurationPercentiles(context.Background(), f)
+	if err != nil {
+		t.Fatalf("DurationPercentiles() error = %v", err)
+	}
+	if got.P50 != 300 || got.P99 != 750 {
+		t.Errorf("DurationPercentiles() with partial samples = %+v, want histogram midpoints 300 and 750", got)
 	}
 
-	got, err := q.DurationPercentiles(f)
+	// Full coverage: exact values, each hour weighted by its requests
+	if _, err := db.Exec(`INSERT INTO duration_samples (hour, router, seen, samples) VALUES
+		('2026-02-08T01:00:00Z', 'web', 100, '120,130,140,150,160')`); err != nil {
+		t.Fatalf("seed duration_samples: %v", err)
+	}
+	got, err = q.DurationPercentiles(context.Background(), f)
 	if err != nil {
 		t.Fatalf("DurationPercentiles() error = %v", err)
 	}
-	if got.P50 != 0 || got.P95 != 0 || got.P99 != 0 {
-		t.Errorf("DurationPercentiles() on empty DB = %+v, want all zeros", got)
+	if got.P50 != 120 || got.P95 != 160 || got.P99 != 900 {
+		t.Errorf("DurationPercentiles() with samples = %+v, want P50 120, P95 160, P99 900", got)
 	}
 }
 
-func TestBandwidthTimeSeries(t *testing.T) {
+func TestDurationPercentilesEmpty(t *testing.T) {
 	db := testDB(t)
 	q := NewQueries(db)
 
-	seedRequests(t, db,
+	f := Filter{
+		From:        "2026-02-08T00:00:00Z",
+		To:          "2026-02-08T23:00:00Z",
+		IncludeBots: true,
+	}
+
+	got, err := q.DurationPercentiles(context.Background(), f)
+	if err != nil {
+		t.Fatalf("DurationPercentiles() error = %v", err)
+	}
+	if got.P50 != 0 || got.P95 != 0 || got.P99 != 0 {
+		t.Errorf("DurationPercentiles() on empty DB = %+v, want all zeros", got)
+	}
+}
+
+func TestBandwidthTimeSeries(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
 		requestRow{"2026-02-08T00:00:00Z", "web", "/", "GET", 200, 100, 50000, 1000000},
 		requestRow{"2026-02-08T01:00:00Z", "web", "/", "GET", 200, 50, 25000, 500000},
 		requestRow{"2026-02-08T01:00:00Z", "web", "/api", "GET", 200, 30, 15000, 300000},
@@ -2031,7 +2570,7 @@ func TestBandwidthTimeSeries(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.BandwidthTimeSeries(f, false)
+	got, err := q.BandwidthTimeSeries(context.Background(), f, false)
 	if err != nil {
 		t.Fatalf("BandwidthTimeSeries() error = %v", err)
 	}
@@ -2065,7 +2604,7 @@ func TestResponseTimeTimeSeries(t *testing.T) {
 		IncludeBots: true,
 	}
 
-	got, err := q.ResponseTimeTimeSeries(f, false)
+	got, err := q.ResponseTimeTimeSeries(context.Background(), f, false)
 	if err != nil {
 		t.Fatalf("ResponseTimeTimeSeries() error = %v", err)
 	}
@@ -2091,7 +2630,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 	}
 
 	// All new queries should return empty results without errors on empty DB
-	countries, err := q.CountryBreakdown(f, 10)
+	countries, err := q.CountryBreakdown(context.Background(), f, 10)
 	if err != nil {
 		t.Fatalf("CountryBreakdown() error = %v", err)
 	}
@@ -2099,7 +2638,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("CountryBreakdown() on empty DB returned %d rows", len(countries))
 	}
 
-	browsers, err := q.BrowserBreakdown(f)
+	browsers, err := q.BrowserBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("BrowserBreakdown() error = %v", err)
 	}
@@ -2107,7 +2646,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("BrowserBreakdown() on empty DB returned %d rows", len(browsers))
 	}
 
-	osStats, err := q.OSBreakdown(f)
+	osStats, err := q.OSBreakdown(context.Background(), f)
 	if err != nil {
 		t.Fatalf("OSBreakdown() error = %v", err)
 	}
@@ -2115,7 +2654,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("OSBreakdown() on empty DB returned %d rows", len(osStats))
 	}
 
-	hist, err := q.DurationHistogram(f)
+	hist, err := q.DurationHistogram(context.Background(), f)
 	if err != nil {
 		t.Fatalf("DurationHistogram() error = %v", err)
 	}
@@ -2123,7 +2662,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("DurationHistogram() on empty DB returned %d rows", len(hist))
 	}
 
-	bw, err := q.BandwidthTimeSeries(f, false)
+	bw, err := q.BandwidthTimeSeries(context.Background(), f, false)
 	if err != nil {
 		t.Fatalf("BandwidthTimeSeries() error = %v", err)
 	}
@@ -2131,7 +2670,7 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("BandwidthTimeSeries() on empty DB returned %d rows", len(bw))
 	}
 
-	rt, err := q.ResponseTimeTimeSeries(f, false)
+	rt, err := q.ResponseTimeTimeSeries(context.Background(), f, false)
 	if err != nil {
 		t.Fatalf("ResponseTimeTimeSeries() error = %v", err)
 	}
@@ -2139,3 +2678,1070 @@ func TestNewQueriesEmptyResults(t *testing.T) {
 		t.Errorf("ResponseTimeTimeSeries() on empty DB returned %d rows", len(rt))
 	}
 }
+
+func TestTopParamValues(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		hour, router, param, value string
+		count                      int
+	}{
+		{"2026-02-08T10:00:00Z", "web", "q", "shoes", 5},
+		{"2026-02-08T11:00:00Z", "web", "q", "shoes", 3},
+		{"2026-02-08T11:00:00Z", "web", "q", "boots", 4},
+		{"2026-02-08T11:00:00Z", "web", "category", "shoes", 9},
+		{"2026-02-09T11:00:00Z", "web", "q", "hats", 50},
+	} {
+		if _, err := db.Exec(`INSERT INTO query_params (hour, router, param, value, count) VALUES (?, ?, ?, ?, ?)`,
+			r.hour, r.router, r.param, r.value, r.count); err != nil {
+			t.Fatalf("seed query_params: %v", err)
+		}
+	}
+
+	got, err := q.TopParamValues(context.Background(), Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}, "q", 10)
+	if err != nil {
+		t.Fatalf("TopParamValues() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Value != "shoes" || got[0].Count != 8 || got[1].Value != "boots" {
+		t.Errorf("TopParamValues() = %+v, want shoes=8 then boots=4", got)
+	}
+}
+
+func TestTopQueryParams(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		hour, param, value string
+		count              int
+	}{
+		{"2026-02-08T10:00:00Z", "q", "shoes", 5},
+		{"2026-02-08T11:00:00Z", "q", "boots", 4},
+		{"2026-02-08T11:00:00Z", "utm_source", "", 12},
+		{"2026-02-08T11:00:00Z", "page", "", 3},
+		{"2026-02-09T11:00:00Z", "page", "", 50},
+	} {
+		if _, err := db.Exec(`INSERT INTO query_params (hour, router, param, value, count) VALUES (?, 'web', ?, ?, ?)`,
+			r.hour, r.param, r.value, r.count); err != nil {
+			t.Fatalf("seed query_params: %v", err)
+		}
+	}
+
+	got, err := q.TopQueryParams(context.Background(), Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}, 2)
+	if err != nil {
+		t.Fatalf("TopQueryParams() error = %v", err)
+	}
+	want := []QueryParamStat{
+		{Param: "utm_source", Count: 12, Pct: 50},
+		{Param: "q", Count: 9, Values: 2, Pct: 37.5},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("TopQueryParams() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSizeHistogramOverTime(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		hour, bucket string
+		count        int
+	}{
+		{"2026-02-08T10:00:00Z", "0-1KB", 90},
+		{"2026-02-08T10:00:00Z", "10-100KB", 10},
+		{"2026-02-08T11:00:00Z", "0-1KB", 20},
+		{"2026-02-08T11:00:00Z", "10MB+", 80},
+	} {
+		if _, err := db.Exec(`INSERT INTO size_hist (hour, router, bucket, count) VALUES (?, 'web', ?, ?)`,
+			r.hour, r.bucket, r.count); err != nil {
+			t.Fatalf("seed size_hist: %v", err)
+		}
+	}
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.SizeHistogramOverTime(context.Background(), f, false)
+	if err != nil {
+		t.Fatalf("SizeHistogramOverTime() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("SizeHistogramOverTime() returned %d periods, want 2", len(got))
+	}
+	for _, p := range got {
+		if len(p.Buckets) != len(sizeBuckets) || p.Buckets[0].Bucket != "0-1KB" {
+			t.Fatalf("period %s buckets = %+v, want all of sizeBuckets in order", p.Label, p.Buckets)
+		}
+	}
+	if last := got[1].Buckets[len(sizeBuckets)-1]; last.Count != 80 || last.Pct != 80 {
+		t.Errorf("11:00 10MB+ = %+v, want 80 requests at 80%%", last)
+	}
+
+	daily, err := q.SizeHistogramOverTime(context.Background(), f, true)
+	if err != nil {
+		t.Fatalf("SizeHistogramOverTime(daily) error = %v", err)
+	}
+	if len(daily) != 1 || daily[0].Label != "2026-02-08" || daily[0].Total != 200 || daily[0].Buckets[0].Count != 110 {
+		t.Errorf("SizeHistogramOverTime(daily) = %+v, want one day of 200 with 110 at 0-1KB", daily)
+	}
+}
+
+func TestPctDenominators(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T10:00:00Z", "web", "/", "GET", 200, 600, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/about", "GET", 200, 300, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/gone", "GET", 404, 100, 0, 0},
+	)
+	seedCountries(t, db,
+		countryRow{"2026-02-08T10:00:00Z", "web", "US", 500},
+		countryRow{"2026-02-08T10:00:00Z", "web", "DE", 300},
+		countryRow{"2026-02-08T10:00:00Z", "web", "JP", 200},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	// Limited lists are relative to the full total, not the rows returned
+	paths, err := q.TopPaths(context.Background(), f, 1)
+	if err != nil {
+		t.Fatalf("TopPaths() error = %v", err)
+	}
+	if len(paths) != 1 || paths[0].Pct != 60 {
+		t.Errorf("TopPaths() = %+v, want / at 60%%", paths)
+	}
+	countries, err := q.CountryBreakdown(context.Background(), f, 1)
+	if err != nil {
+		t.Fatalf("CountryBreakdown() error = %v", err)
+	}
+	if len(countries) != 1 || countries[0].Pct != 50 {
+		t.Errorf("CountryBreakdown() = %+v, want US at 50%%", countries)
+	}
+
+	// Subset lists are relative to all requests
+	notFound, err := q.TopNotFound(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("TopNotFound() error = %v", err)
+	}
+	if len(notFound) != 1 || notFound[0].Pct != 10 {
+		t.Errorf("TopNotFound() = %+v, want /gone at 10%%", notFound)
+	}
+
+	classes, err := q.StatusBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("StatusBreakdown() error = %v", err)
+	}
+	for _, c := range classes {
+		want := map[string]float64{"2xx": 90, "4xx": 10}[c.Class]
+		if c.Pct != want {
+			t.Errorf("StatusBreakdown() %s Pct = %v, want %v", c.Class, c.Pct, want)
+		}
+	}
+}
+
+func TestRouterGroups(t *testing.T) {
+	db := testDB(t)
+	seedRequests(t, db,
+		requestRow{"2026-02-08T10:00:00Z", "web", "/", "GET", 200, 900, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "api", "/", "GET", 200, 80, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "cron", "/", "GET", 200, 15, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "health", "/", "GET", 200, 4, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "unrouted", "/", "GET", 404, 1, 0, 0},
+	)
+	s := &Server{config: &config.Config{RouterMinPct: 5}, queries: NewQueries(db)}
+
+	totals, err := s.queries.RouterTotals(context.Background())
+	if err != nil {
+		t.Fatalf("RouterTotals() error = %v", err)
+	}
+	if len(totals) != 5 || totals[0].Router != "web" || totals[0].Count != 900 {
+		t.Errorf("RouterTotals() = %+v, want web=900 first", totals)
+	}
+
+	options, err := s.routerOptions(context.Background(), "")
+	if err != nil {
+		t.Fatalf("routerOptions() error = %v", err)
+	}
+	if want := []string{"api", "unrouted", "web", OtherRoutersKey}; !slices.Equal(options, want) {
+		t.Errorf("routerOptions() = %v, want %v", options, want)
+	}
+
+	// A grouped router picked by name stays in the list
+	options, _ = s.routerOptions(context.Background(), "cron")
+	if want := []string{"api", "unrouted", "web", "cron", OtherRoutersKey}; !slices.Equal(options, want) {
+		t.Errorf("routerOptions(cron) = %v, want %v", options, want)
+	}
+
+	f := s.expandRouterGroup(context.Background(), Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", Router: OtherRoutersKey})
+	stats, err := s.queries.TotalStats(context.Background(), f)
+	if err != nil {
+		t.Fatalf("TotalStats() error = %v", err)
+	}
+	if stats.Requests != 19 {
+		t.Errorf("requests for %s = %d, want 19 (cron + health)", OtherRoutersKey, stats.Requests)
+	}
+
+	// Without a threshold nothing is grouped and every router is listed
+	s.config.RouterMinPct = 0
+	options, _ = s.routerOptions(context.Background(), "")
+	if len(options) != 5 || slices.Contains(options, OtherRoutersKey) {
+		t.Errorf("routerOptions() without threshold = %v", options)
+	}
+}
+
+func TestHasDurations(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.HasDurations(context.Background(), f)
+	if err != nil {
+		t.Fatalf("HasDurations() error = %v", err)
+	}
+	if got {
+		t.Error("HasDurations() = true on an empty duration_hist, want false")
+	}
+
+	if _, err := db.Exec(`INSERT INTO duration_hist (hour, router, bucket, count) VALUES ('2026-02-08T10:00:00Z', 'web', '0-10ms', 5)`); err != nil {
+		t.Fatalf("seed duration_hist: %v", err)
+	}
+	got, err = q.HasDurations(context.Background(), f)
+	if err != nil {
+		t.Fatalf("HasDurations() error = %v", err)
+	}
+	if !got {
+		t.Error("HasDurations() = false with timed rows in range, want true")
+	}
+}
+
+func TestTopPathsSince(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		bucket, router, path string
+		count                int
+	}{
+		{"2026-02-08T09:50:00Z", "web", "/old", 500}, // before the window
+		{"2026-02-08T10:00:00Z", "web", "/", 30},
+		{"2026-02-08T10:10:00Z", "web", "/", 10},
+		{"2026-02-08T10:10:00Z", "web", "/about", 20},
+		{"2026-02-08T10:10:00Z", "unrouted", "/.env", 99},
+	} {
+		if _, err := db.Exec(`INSERT INTO requests_fine (bucket, router, path, method, status, count, bytes, duration)
+			VALUES (?, ?, ?, 'GET', 200, ?, 0, 0)`, r.bucket, r.router, r.path, r.count); err != nil {
+			t.Fatalf("seed requests_fine: %v", err)
+		}
+	}
+	since := "2026-02-08T10:00:00Z"
+
+	paths, err := q.TopPathsSince(context.Background(), Filter{}, since, 5)
+	if err != nil {
+		t.Fatalf("TopPathsSince() error = %v", err)
+	}
+	if len(paths) != 2 || paths[0].Path != "/" || paths[0].Count != 40 {
+		t.Fatalf("TopPathsSince() = %+v, want / (40) then /about, without /old or unrouted", paths)
+	}
+	if paths[0].Pct < 66.6 || paths[0].Pct > 66.7 {
+		t.Errorf("TopPathsSince() top Pct = %v, want 40 of 60", paths[0].Pct)
+	}
+
+	points, err := q.FineRequestsSince(context.Background(), Filter{}, since)
+	if err != nil {
+		t.Fatalf("FineRequestsSince() error = %v", err)
+	}
+	if len(points) != 2 || points[0].Count != 30 || points[1].Count != 30 {
+		t.Errorf("FineRequestsSince() = %+v, want 30 per bucket", points)
+	}
+}
+
+func TestQueriesContext(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	seedRequests(t, db, requestRow{"2026-02-08T10:00:00Z", "web", "/", "GET", 200, 5, 0, 0})
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := q.TopPaths(ctx, f, 10); err != nil {
+		t.Fatalf("TopPaths() with live context error = %v", err)
+	}
+
+	cancel()
+	if _, err := q.TopPaths(ctx, f, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("TopPaths() after cancel error = %v, want context.Canceled", err)
+	}
+	if _, err := q.TotalStats(ctx, f); !errors.Is(err, context.Canceled) {
+		t.Errorf("TotalStats() after cancel error = %v, want context.Canceled", err)
+	}
+
+	// Other calls are unaffected
+	if _, err := q.TopPaths(context.Background(), f, 10); err != nil {
+		t.Errorf("TopPaths() with another context error = %v", err)
+	}
+}
+
+func TestErrorRequestIDs(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		ts, router, id string
+	}{
+		{"2026-02-08T10:05:00Z", "web", "req-aaaa-1"},
+		{"2026-02-08T10:45:00Z", "web", "req-aaaa-2"},
+		{"2026-02-08T11:15:00Z", "api", "req-bbbb-1"},
+		{"2026-02-09T10:00:00Z", "web", "req-later"}, // outside the range
+	} {
+		if _, err := db.Exec(`INSERT INTO error_requests (hour, ts, router, path, method, status, request_id)
+			VALUES (?, ?, ?, '/api', 'GET', 502, ?)`, r.ts[:13]+":00:00Z", r.ts, r.router, r.id); err != nil {
+			t.Fatalf("seed error_requests: %v", err)
+		}
+	}
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.ErrorRequestIDs(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("ErrorRequestIDs() error = %v", err)
+	}
+	if len(got) != 3 || got[0].RequestID != "req-bbbb-1" || got[2].RequestID != "req-aaaa-1" {
+		t.Fatalf("ErrorRequestIDs() = %+v, want the 3 in range, newest first", got)
+	}
+
+	f.Router = "web"
+	got, err = q.ErrorRequestIDs(context.Background(), f, 1)
+	if err != nil {
+		t.Fatalf("ErrorRequestIDs() error = %v", err)
+	}
+	if len(got) != 1 || got[0].RequestID != "req-aaaa-2" || got[0].Status != 502 {
+		t.Errorf("ErrorRequestIDs(web, 1) = %+v, want req-aaaa-2", got)
+	}
+}
+
+func TestRecentRequests(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	for _, r := range []struct {
+		ts, path, method string
+		status           int
+	}{
+		{"2026-02-08T10:05:00Z", "/api", "GET", 200},
+		{"2026-02-08T10:45:00Z", "/api", "POST", 500},
+		{"2026-02-08T11:15:00Z", "/", "GET", 200},
+		{"2026-02-08T11:20:00Z", "/api", "GET", 0},   // dropped connection
+		{"2026-02-09T10:00:00Z", "/api", "GET", 200}, // outside the range
+	} {
+		if _, err := db.Exec(`INSERT INTO requests_raw (hour, ts, router, path, method, status, ip_hash)
+			VALUES (?, ?, 'web', ?, ?, ?, 'abcd')`, r.ts[:13]+":00:00Z", r.ts, r.path, r.method, r.status); err != nil {
+			t.Fatalf("seed requests_raw: %v", err)
+		}
+	}
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	tests := []struct {
+		name   string
+		path   string
+		method string
+		status int
+		want   []string // timestamps, newest first
+	}{
+		{"all", "", "", -1, []string{"2026-02-08T11:20:00Z", "2026-02-08T11:15:00Z", "2026-02-08T10:45:00Z", "2026-02-08T10:05:00Z"}},
+		{"path", "/api", "", -1, []string{"2026-02-08T11:20:00Z", "2026-02-08T10:45:00Z", "2026-02-08T10:05:00Z"}},
+		{"path method status", "/api", "GET", 200, []string{"2026-02-08T10:05:00Z"}},
+		{"status 0", "/api", "GET", 0, []string{"2026-02-08T11:20:00Z"}},
+	}
+	for _, tt := range tests {
+		got, err := q.RecentRequests(context.Background(), f, tt.path, tt.method, tt.status, 10)
+		if err != nil {
+			t.Fatalf("%s: RecentRequests() error = %v", tt.name, err)
+		}
+		var times []string
+		for _, r := range got {
+			times = append(times, r.Time)
+		}
+		if !slices.Equal(times, tt.want) {
+			t.Errorf("%s: RecentRequests() = %v, want %v", tt.name, times, tt.want)
+		}
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	h := "2026-02-08T10:00:00Z"
+	seedRequests(t, db,
+		requestRow{h, "web", "/", "GET", 200, 70, 0, 0},
+		requestRow{h, "web", "/old", "GET", 301, 10, 0, 0},
+		requestRow{h, "web", "/missing", "GET", 404, 15, 0, 0},
+		requestRow{h, "web", "/boom", "GET", 500, 5, 0, 0},
+		requestRow{h, "unrouted", "/.env", "GET", 404, 900, 0, 0},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.SuccessRate(context.Background(), f)
+	if err != nil {
+		t.Fatalf("SuccessRate() error = %v", err)
+	}
+	if got != 80 {
+		t.Errorf("SuccessRate() = %v, want 80 (2xx+3xx of routed traffic)", got)
+	}
+
+	q.SetSuccessCriteria(500, true)
+	if got, _ = q.SuccessRate(context.Background(), f); got < 94.1 || got > 94.2 {
+		t.Errorf("SuccessRate(below 500, ignore 404) = %v, want 80 of 85", got)
+	}
+
+	if got, _ = q.SuccessRate(context.Background(), Filter{From: "2026-03-01T00:00:00Z", To: "2026-03-01T23:00:00Z"}); got != 0 {
+		t.Errorf("SuccessRate() without traffic = %v, want 0", got)
+	}
+
+	// Lines logged without a status are stored as 0 and aren't successes
+	seedRequests(t, db, requestRow{"2026-02-09T10:00:00Z", "web", "/", "GET", 0, 1, 0, 0}, requestRow{"2026-02-09T10:00:00Z", "web", "/", "GET", 200, 3, 0, 0})
+	if got, _ = q.SuccessRate(context.Background(), Filter{From: "2026-02-09T00:00:00Z", To: "2026-02-09T23:00:00Z"}); got != 75 {
+		t.Errorf("SuccessRate() with a status-less line = %v, want 75", got)
+	}
+}
+
+func TestHostBreakdown(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.HostBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("HostBreakdown() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("HostBreakdown() on a format without hosts = %+v, want empty", got)
+	}
+
+	if _, err := db.Exec(`INSERT INTO hosts (hour, router, host, count) VALUES
+		('2026-02-08T10:00:00Z', 'web', 'example.com', 6),
+		('2026-02-08T11:00:00Z', 'web', 'example.com', 3),
+		('2026-02-08T10:00:00Z', 'web', 'blog.example.com', 1),
+		('2026-02-08T10:00:00Z', 'api', 'api.example.com', 10),
+		('2026-02-09T10:00:00Z', 'web', 'late.example.com', 50)`); err != nil {
+		t.Fatalf("seed hosts: %v", err)
+	}
+
+	got, err = q.HostBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("HostBreakdown() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Host != "api.example.com" || got[1].Host != "example.com" || got[1].Count != 9 {
+		t.Fatalf("HostBreakdown() = %+v, want api, example, blog", got)
+	}
+	if got[0].Pct != 50 {
+		t.Errorf("api.example.com Pct = %v, want 50", got[0].Pct)
+	}
+
+	// Per-domain traffic within one router
+	f.Router = "web"
+	got, err = q.HostBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("HostBreakdown() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Host != "example.com" || got[0].Pct != 90 {
+		t.Errorf("HostBreakdown(web) = %+v, want example.com at 90%%", got)
+	}
+}
+
+func TestHostFilter(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	if _, err := db.Exec(`INSERT INTO requests (hour, router, host, path, method, status, count, bytes, duration) VALUES
+		('2026-02-08T10:00:00Z', 'server', 'example.com', '/', 'GET', 200, 6, 600, 60),
+		('2026-02-08T10:00:00Z', 'server', 'blog.example.com', '/', 'GET', 200, 3, 300, 30),
+		('2026-02-08T10:00:00Z', 'server', 'blog.example.com', '/post', 'GET', 404, 1, 0, 0),
+		('2026-02-08T10:00:00Z', 'server', '', '/', 'GET', 200, 2, 200, 20)`); err != nil {
+		t.Fatal(err)
+	}
+	seedVisitors(t, db,
+		visitorRow{"2026-02-08T10:00:00Z", "server", "a"},
+		visitorRow{"2026-02-08T10:00:00Z", "server", "b"},
+	)
+
+	hosts, err := q.Hosts(context.Background())
+	if err != nil {
+		t.Fatalf("Hosts() error = %v", err)
+	}
+	if !slices.Equal(hosts, []string{"blog.example.com", "example.com"}) {
+		t.Errorf("Hosts() = %v, want the two named hosts", hosts)
+	}
+
+	f.Host = "blog.example.com"
+	stats, err := q.TotalStats(context.Background(), f)
+	if err != nil {
+		t.Fatalf("TotalStats() error = %v", err)
+	}
+	// Visitors don't record the host, so they cover every host
+	if stats.Requests != 4 || stats.Bytes != 300 || stats.Visitors != 2 {
+		t.Errorf("TotalStats(host) = %+v, want 4 requests, 300 bytes, 2 visitors", stats)
+	}
+	paths, err := q.TopPaths(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("TopPaths() error = %v", err)
+	}
+	if len(paths) != 2 || paths[0].Path != "/" || paths[0].Count != 3 {
+		t.Errorf("TopPaths(host) = %+v, want / (3) and /post", paths)
+	}
+	top, err := q.TopPathsForHour(context.Background(), f, "2026-02-08T10:00:00Z", 10)
+	if err != nil {
+		t.Fatalf("TopPathsForHour() error = %v", err)
+	}
+	if len(top) != 2 || top[0].Count != 3 {
+		t.Errorf("TopPathsForHour(host) = %+v, want / (3) and /post", top)
+	}
+
+	// Panels on tables without a host column still load
+	if _, err := q.TopReferrers(context.Background(), f, 10); err != nil {
+		t.Errorf("TopReferrers(host) error = %v", err)
+	}
+	if _, err := q.CountryBreakdown(context.Background(), f, 10); err != nil {
+		t.Errorf("CountryBreakdown(host) error = %v", err)
+	}
+}
+
+func TestTopUserAgents(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	if _, err := db.Exec(`INSERT INTO raw_user_agents (hour, router, user_agent, count) VALUES
+		('2026-02-08T10:00:00Z', 'web', 'python-requests/2.31.0', 6),
+		('2026-02-08T11:00:00Z', 'web', 'python-requests/2.31.0', 2),
+		('2026-02-08T10:00:00Z', 'api', 'curl/8.4.0', 7),
+		('2026-02-08T10:00:00Z', 'api', 'Go-http-client/1.1', 5),
+		('2026-02-09T10:00:00Z', 'web', 'Wget/1.21', 50)`); err != nil {
+		t.Fatalf("seed raw_user_agents: %v", err)
+	}
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.TopUserAgents(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("TopUserAgents() error = %v", err)
+	}
+	if len(got) != 2 || got[0].UserAgent != "python-requests/2.31.0" || got[0].Count != 8 || got[1].UserAgent != "curl/8.4.0" {
+		t.Fatalf("TopUserAgents(2) = %+v, want python-requests then curl", got)
+	}
+	// Pct covers the UAs beyond the limit too
+	if got[0].Pct != 40 {
+		t.Errorf("python-requests Pct = %v, want 40", got[0].Pct)
+	}
+}
+
+func TestHighestErrorRatePaths(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedRequests(t, db,
+		// Busy path: many errors, tiny rate
+		requestRow{"2026-02-08T00:00:00Z", "api", "/search", "GET", 200, 100000, 0, 0},
+		requestRow{"2026-02-08T00:00:00Z", "api", "/search", "GET", 500, 50, 0, 0},
+		// Broken endpoint: every request fails
+		requestRow{"2026-02-08T00:00:00Z", "api", "/export", "POST", 500, 20, 0, 0},
+		// Half failing
+		requestRow{"2026-02-08T01:00:00Z", "web", "/checkout", "POST", 200, 15, 0, 0},
+		requestRow{"2026-02-08T02:00:00Z", "web", "/checkout", "POST", 502, 15, 0, 0},
+		// Below the request floor
+		requestRow{"2026-02-08T00:00:00Z", "api", "/once", "GET", 500, 3, 0, 0},
+		// No errors at all
+		requestRow{"2026-02-08T00:00:00Z", "api", "/healthy", "GET", 200, 500, 0, 0},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.HighestErrorRatePaths(context.Background(), f, 20, 10)
+	if err != nil {
+		t.Fatalf("HighestErrorRatePaths() error = %v", err)
+	}
+	var paths []string
+	for _, p := range got {
+		paths = append(paths, p.Path)
+	}
+	if strings.Join(paths, ",") != "/export,/checkout,/search" {
+		t.Fatalf("HighestErrorRatePaths() paths = %v, want /export, /checkout, /search", paths)
+	}
+	if got[0].Rate != 100 || got[0].Errors != 20 || got[0].Requests != 20 {
+		t.Errorf("/export = %+v, want 20 of 20 at 100%%", got[0])
+	}
+	if got[1].Rate != 50 {
+		t.Errorf("/checkout Rate = %v, want 50", got[1].Rate)
+	}
+
+	// Below the default floor /once ties /export at 100%; more errors wins
+	got, err = q.HighestErrorRatePaths(context.Background(), f, 1, 2)
+	if err != nil {
+		t.Fatalf("HighestErrorRatePaths() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/export" || got[1].Path != "/once" {
+		t.Errorf("HighestErrorRatePaths(floor 1) = %+v, want /export then /once", got)
+	}
+}
+
+func TestVisits(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+
+	seedVisitors(t, db,
+		// a: 10-12 is one visit (seen on two routers at 11), back at 15 for a second
+		visitorRow{"2026-02-08T10:00:00Z", "web", "a"},
+		visitorRow{"2026-02-08T11:00:00Z", "web", "a"},
+		visitorRow{"2026-02-08T11:00:00Z", "api", "a"},
+		visitorRow{"2026-02-08T12:00:00Z", "web", "a"},
+		visitorRow{"2026-02-08T15:00:00Z", "web", "a"},
+		// b: 23:00 into the next day's 00:00 is still one visit
+		visitorRow{"2026-02-08T23:00:00Z", "web", "b"},
+		visitorRow{"2026-02-09T00:00:00Z", "web", "b"},
+		// c: two hours apart
+		visitorRow{"2026-02-08T10:00:00Z", "api", "c"},
+		visitorRow{"2026-02-08T12:00:00Z", "api", "c"},
+	)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-09T23:00:00Z"}
+
+	tests := []struct {
+		gap    int
+		router string
+		want   int64
+	}{
+		{gap: 1, want: 5},                // a: 2, b: 1, c: 2
+		{gap: 2, want: 4},                // c's 2-hour gap now continues the visit
+		{gap: 3, want: 3},                // a's 15:00 return too
+		{gap: 1, router: "api", want: 3}, // a once at 11, c twice
+	}
+	for _, tt := range tests {
+		q.SetVisitGap(tt.gap)
+		f.Router = tt.router
+		got, err := q.Visits(context.Background(), f)
+		if err != nil {
+			t.Fatalf("Visits() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Visits(gap %d, router %q) = %d, want %d", tt.gap, tt.router, got, tt.want)
+		}
+	}
+}
+
+func TestCacheStatusBreakdown(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.CacheStatusBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("CacheStatusBreakdown() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("CacheStatusBreakdown() on a format without cache status = %+v, want empty", got)
+	}
+
+	if _, err := db.Exec(`INSERT INTO cache_status (hour, router, status, count) VALUES
+		('2026-02-08T10:00:00Z', 'web', 'HIT', 50),
+		('2026-02-08T11:00:00Z', 'web', 'HIT', 25),
+		('2026-02-08T10:00:00Z', 'web', 'MISS', 20),
+		('2026-02-08T10:00:00Z', 'api', 'BYPASS', 5),
+		('2026-02-09T10:00:00Z', 'web', 'MISS', 500)`); err != nil {
+		t.Fatalf("seed cache_status: %v", err)
+	}
+
+	got, err = q.CacheStatusBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("CacheStatusBreakdown() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Status != "HIT" || got[0].Count != 75 || got[0].Pct != 75 {
+		t.Fatalf("CacheStatusBreakdown() = %+v, want HIT 75 at 75%%, MISS, BYPASS", got)
+	}
+
+	f.Router = "api"
+	got, err = q.CacheStatusBreakdown(context.Background(), f)
+	if err != nil {
+		t.Fatalf("CacheStatusBreakdown() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Status != "BYPASS" || got[0].Pct != 100 {
+		t.Errorf("CacheStatusBreakdown(api) = %+v, want BYPASS at 100%%", got)
+	}
+}
+
+func TestKnownThreats(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.KnownThreats(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("KnownThreats() error = %v", err)
+	}
+	if got.Requests != 0 || got.Paths != nil {
+		t.Errorf("KnownThreats() without matches = %+v, want zero", got)
+	}
+
+	seedRequests(t, db, requestRow{"2026-02-08T10:00:00Z", "web", "/", "GET", 200, 90, 0, 0})
+	if _, err := db.Exec(`INSERT INTO threat_requests (hour, router, ip_hash, path, count) VALUES
+		('2026-02-08T10:00:00Z', 'unrouted', 'aaaa', '/wp-login.php', 6),
+		('2026-02-08T10:00:00Z', 'unrouted', 'bbbb', '/wp-login.php', 2),
+		('2026-02-08T11:00:00Z', 'web', 'aaaa', '/.env', 2),
+		('2026-02-08T11:00:00Z', 'web', '(other)', '(other)', 5),
+		('2026-02-09T10:00:00Z', 'web', 'cccc', '/late', 50)`); err != nil {
+		t.Fatalf("seed threat_requests: %v", err)
+	}
+
+	got, err = q.KnownThreats(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("KnownThreats() error = %v", err)
+	}
+	if got.Requests != 15 || got.IPs != 2 {
+		t.Errorf("KnownThreats() = %d requests from %d IPs, want 15 from 2", got.Requests, got.IPs)
+	}
+	if len(got.Paths) != 2 || got.Paths[0].Path != "/wp-login.php" || got.Paths[0].Count != 8 {
+		t.Errorf("KnownThreats() paths = %+v, want /wp-login.php first", got.Paths)
+	}
+}
+
+func TestRateLimitQueries(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", IncludeBots: true}
+
+	seedRequests(t, db,
+		requestRow{"2026-02-08T10:00:00Z", "web", "/api/login", "POST", 429, 30, 0, 0},
+		requestRow{"2026-02-08T14:00:00Z", "web", "/api/login", "POST", 429, 5, 0, 0},
+		requestRow{"2026-02-08T14:00:00Z", "web", "/api/search", "GET", 429, 10, 0, 0},
+		requestRow{"2026-02-08T14:00:00Z", "web", "/", "GET", 200, 100, 0, 0},
+	)
+
+	hourly, err := q.SpecificStatusOverTime(context.Background(), f, 429, false)
+	if err != nil {
+		t.Fatalf("SpecificStatusOverTime() error = %v", err)
+	}
+	if len(hourly) != 2 || hourly[0].Count != 30 || hourly[1].Count != 15 {
+		t.Errorf("SpecificStatusOverTime(hourly) = %+v, want 30 then 15", hourly)
+	}
+	daily, err := q.SpecificStatusOverTime(context.Background(), f, 429, true)
+	if err != nil {
+		t.Fatalf("SpecificStatusOverTime(daily) error = %v", err)
+	}
+	if len(daily) != 1 || daily[0].Label != "2026-02-08" || daily[0].Count != 45 {
+		t.Errorf("SpecificStatusOverTime(daily) = %+v, want 45 on 2026-02-08", daily)
+	}
+
+	ips, err := q.RateLimitedIPs(context.Background(), f, 10)
+	if err != nil || len(ips) != 0 {
+		t.Fatalf("RateLimitedIPs() without rows = %+v, %v; want none", ips, err)
+	}
+	if _, err := db.Exec(`INSERT INTO rate_limited (hour, router, ip_hash, count) VALUES
+		('2026-02-08T10:00:00Z', 'web', 'aaaa', 30),
+		('2026-02-08T14:00:00Z', 'web', 'aaaa', 5),
+		('2026-02-08T14:00:00Z', 'web', 'bbbb', 10),
+		('2026-02-09T10:00:00Z', 'web', 'cccc', 99)`); err != nil {
+		t.Fatalf("seed rate_limited: %v", err)
+	}
+	ips, err = q.RateLimitedIPs(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("RateLimitedIPs() error = %v", err)
+	}
+	if len(ips) != 2 || ips[0].IPHash != "aaaa" || ips[0].Count != 35 || ips[1].Pct < 22 || ips[1].Pct > 23 {
+		t.Errorf("RateLimitedIPs() = %+v, want aaaa (35) then bbbb (~22%%)", ips)
+	}
+}
+
+func TestScannerBreadth(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	if _, err := db.Exec(`INSERT INTO scanner_paths (hour, router, ip_hash, path, count) VALUES
+		('2026-02-08T10:00:00Z', 'unrouted', 'wide', '/.env', 1),
+		('2026-02-08T10:00:00Z', 'unrouted', 'wide', '/.git/config', 1),
+		('2026-02-08T11:00:00Z', 'unrouted', 'wide', '/.env', 1),
+		('2026-02-08T11:00:00Z', 'unrouted', 'wide', '/wp-login.php', 1),
+		('2026-02-08T10:00:00Z', 'unrouted', 'narrow', '/wp-login.php', 500),
+		('2026-02-08T10:00:00Z', 'unrouted', '(other)', '(other)', 900),
+		('2026-02-09T10:00:00Z', 'unrouted', 'late', '/a', 1)`); err != nil {
+		t.Fatalf("seed scanner_paths: %v", err)
+	}
+
+	got, err := q.ScannerBreadth(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("ScannerBreadth() error = %v", err)
+	}
+	if len(got) != 2 || got[0].IPHash != "wide" || got[0].Paths != 3 || got[0].Requests != 4 || got[0].Breadth != 75 {
+		t.Fatalf("ScannerBreadth() = %+v, want wide (3 paths in 4 requests) first", got)
+	}
+	if got[1].IPHash != "narrow" || got[1].Paths != 1 || got[1].Breadth != 0.2 {
+		t.Errorf("ScannerBreadth() second = %+v, want narrow at 0.2%%", got[1])
+	}
+}
+
+func TestBotOnlyPaths(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	got, err := q.BotOnlyPaths(context.Background(), f, 10)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("BotOnlyPaths() without traffic = %+v, %v; want none", got, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO path_categories (hour, router, path, category, count) VALUES
+		('2026-02-08T10:00:00Z', 'web', '/feed.xml', 'bot', 300),
+		('2026-02-08T11:00:00Z', 'web', '/feed.xml', 'bot', 200),
+		('2026-02-08T10:00:00Z', 'web', '/feed.xml', 'human', 2),
+		('2026-02-08T10:00:00Z', 'web', '/trap', 'bot', 20),
+		('2026-02-08T10:00:00Z', 'web', '/', 'bot', 400),
+		('2026-02-08T10:00:00Z', 'web', '/', 'human', 900),
+		('2026-02-08T10:00:00Z', 'web', '/rare', 'bot', 5),
+		('2026-02-08T10:00:00Z', 'web', '(other)', 'bot', 75),
+		('2026-02-09T10:00:00Z', 'web', '/late', 'bot', 50)`); err != nil {
+		t.Fatalf("seed path_categories: %v", err)
+	}
+
+	got, err = q.BotOnlyPaths(context.Background(), f, 10)
+	if err != nil {
+		t.Fatalf("BotOnlyPaths() error = %v", err)
+	}
+	// "/" has humans, /rare too few bot requests, (other) stands for many paths
+	if len(got) != 2 || got[0].Path != "/feed.xml" || got[1].Path != "/trap" {
+		t.Fatalf("BotOnlyPaths() = %+v, want /feed.xml then /trap", got)
+	}
+	if got[0].Bots != 500 || got[0].Humans != 2 || got[0].Pct != 50 {
+		t.Errorf("/feed.xml = %+v, want 500 bot and 2 human requests, 50%% of bot traffic", got[0])
+	}
+}
+
+func TestFakeCrawlers(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z", IncludeBots: true}
+
+	if _, err := db.Exec(`INSERT INTO user_agents (hour, router, category, count) VALUES
+		('2026-02-08T10:00:00Z', 'unrouted', 'googlebot', 7),
+		('2026-02-08T11:00:00Z', 'unrouted', 'bingbot', 3),
+		('2026-02-08T10:00:00Z', 'unrouted', 'Chrome', 50),
+		('2026-02-08T10:00:00Z', 'unrouted', 'ahrefsbot', 40),
+		('2026-02-08T10:00:00Z', 'web', 'googlebot', 900),
+		('2026-02-09T10:00:00Z', 'unrouted', 'googlebot', 20)`); err != nil {
+		t.Fatalf("seed user_agents: %v", err)
+	}
+
+	// Crawlers on a router are real; SEO tools aren't search engines
+	got, err := q.FakeCrawlers(context.Background(), f)
+	if err != nil {
+		t.Fatalf("FakeCrawlers() error = %v", err)
+	}
+	if got != 10 {
+		t.Errorf("FakeCrawlers() = %d, want 10", got)
+	}
+}
+
+func TestUpstreamTimes(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	if _, err := db.Exec(`INSERT INTO upstream_times (hour, router, count, duration, upstream) VALUES
+		('2026-02-08T10:00:00Z', 'web', 10, 1000, 800),
+		('2026-02-08T11:00:00Z', 'web', 10, 3000, 2400),
+		('2026-02-08T10:00:00Z', 'api', 4, 400, 400),
+		('2026-02-09T10:00:00Z', 'late', 1, 9000, 9000)`); err != nil {
+		t.Fatalf("seed upstream_times: %v", err)
+	}
+
+	got, err := q.UpstreamTimes(context.Background(), f)
+	if err != nil {
+		t.Fatalf("UpstreamTimes() error = %v", err)
+	}
+	want := []UpstreamStat{
+		{Router: "web", Count: 20, AvgTotalMs: 200, AvgUpstreamMs: 160, ProxyMs: 40},
+		{Router: "api", Count: 4, AvgTotalMs: 100, AvgUpstreamMs: 100, ProxyMs: 0},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("UpstreamTimes() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPathConcentration(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	share, gini, err := q.PathConcentration(context.Background(), f)
+	if err != nil {
+		t.Fatalf("PathConcentration() error = %v", err)
+	}
+	if share != 0 || gini != 0 {
+		t.Errorf("PathConcentration() without traffic = %v, %v, want 0, 0", share, gini)
+	}
+
+	// One hot path and nine with a request each; the folded (other) row is left out
+	rows := []requestRow{
+		{"2026-02-08T10:00:00Z", "web", "/hot", "GET", 200, 60, 0, 0},
+		{"2026-02-08T11:00:00Z", "web", "/hot", "GET", 200, 31, 0, 0},
+		{"2026-02-08T10:00:00Z", "web", "(other)", "GET", 200, 500, 0, 0},
+	}
+	for i := 0; i < 9; i++ {
+		rows = append(rows, requestRow{"2026-02-08T10:00:00Z", "web", fmt.Sprintf("/cold%d", i), "GET", 200, 1, 0, 0})
+	}
+	seedRequests(t, db, rows...)
+
+	share, gini, err = q.PathConcentration(context.Background(), f)
+	if err != nil {
+		t.Fatalf("PathConcentration() error = %v", err)
+	}
+	if share != 91 {
+		t.Errorf("top decile share = %v, want 91", share)
+	}
+	if gini < 0.8 || gini > 0.82 {
+		t.Errorf("gini = %v, want 0.81", gini)
+	}
+}
+
+func TestConcentration(t *testing.T) {
+	tests := []struct {
+		counts    []int64
+		wantShare float64
+		wantGini  float64
+	}{
+		{nil, 0, 0},
+		{[]int64{5}, 100, 0},
+		{[]int64{10, 10, 10, 10}, 25, 0},
+		{[]int64{100, 0, 0, 0}, 100, 0.75}, // n-1/n for one path taking all
+	}
+	for _, tt := range tests {
+		share, gini := concentration(tt.counts)
+		if share != tt.wantShare || math.Abs(gini-tt.wantGini) > 1e-9 {
+			t.Errorf("concentration(%v) = %v, %v, want %v, %v", tt.counts, share, gini, tt.wantShare, tt.wantGini)
+		}
+	}
+}
+
+func TestGoalAttribution(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	if _, err := db.Exec(`INSERT INTO visitor_entries (hour, router, ip_hash, referrer, entry_path, goal) VALUES
+		('2026-02-08T10:00:00Z', 'web', 'a', 'news.ycombinator.com', '/pricing', '/signup'),
+		('2026-02-08T10:00:00Z', 'web', 'b', 'news.ycombinator.com', '/blog', ''),
+		('2026-02-08T10:00:00Z', 'web', 'c', '', '/pricing', '/signup'),
+		('2026-02-08T11:00:00Z', 'web', 'a', '(internal)', '/signup', '/signup'),
+		('2026-02-08T11:00:00Z', 'web', 'd', 'google.com', '/blog', ''),
+		('2026-02-08T11:00:00Z', 'web', 'e', 'google.com', '/', '/old-goal'),
+		('2026-02-09T10:00:00Z', 'web', 'f', 'late.example', '/pricing', '/signup')`); err != nil {
+		t.Fatalf("seed visitor_entries: %v", err)
+	}
+
+	got, err := q.GoalAttribution(context.Background(), f, "/signup")
+	if err != nil {
+		t.Fatalf("GoalAttribution() error = %v", err)
+	}
+	if got.Visits != 6 || got.Conversions != 3 || got.Rate != 50 {
+		t.Fatalf("GoalAttribution() = %d of %d (%.1f%%), want 3 of 6 (50%%)", got.Conversions, got.Visits, got.Rate)
+	}
+	if len(got.Referrers) != 3 || got.Referrers[0].Source != "news.ycombinator.com" || got.Referrers[0].Rate != 50 {
+		t.Fatalf("Referrers = %+v, want news.ycombinator.com (1 of 2) first of 3", got.Referrers)
+	}
+	if got.EntryPaths[0].Source != "/pricing" || got.EntryPaths[0].Conversions != 2 || got.EntryPaths[0].Rate != 100 {
+		t.Errorf("EntryPaths[0] = %+v, want /pricing with 2 of 2", got.EntryPaths[0])
+	}
+	if len(got.EntryPaths) != 2 {
+		t.Errorf("EntryPaths = %+v, want only paths with conversions", got.EntryPaths)
+	}
+
+	none, err := q.GoalAttribution(context.Background(), f, "/never")
+	if err != nil || none.Conversions != 0 || none.Referrers != nil {
+		t.Errorf("GoalAttribution(/never) = %+v, %v, want no conversions", none, err)
+	}
+}
+
+func TestCredentialStuffingSignals(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	f := Filter{From: "2026-02-08T00:00:00Z", To: "2026-02-08T23:00:00Z"}
+
+	fail := func(hour, path string, ips int) {
+		t.Helper()
+		for i := 0; i < ips; i++ {
+			if _, err := db.Exec(`INSERT INTO auth_failures (hour, router, ip_hash, path, count) VALUES (?, 'web', ?, ?, 2)`,
+				hour, fmt.Sprintf("ip%d", i), path); err != nil {
+				t.Fatalf("seed auth_failures: %v", err)
+			}
+		}
+	}
+	// /login: 12 clients in one hour, 3 the next, mostly failing
+	fail("2026-02-08T10:00:00Z", "/login", 12)
+	fail("2026-02-08T11:00:00Z", "/login", 3)
+	// /api/auth: 10 clients, but most requests succeed
+	fail("2026-02-08T10:00:00Z", "/api/auth", 10)
+	// /admin/login: few clients
+	fail("2026-02-08T10:00:00Z", "/admin/login", 4)
+	seedRequests(t, db,
+		requestRow{"2026-02-08T10:00:00Z", "web", "/login", "POST", 401, 24, 0, 0},
+		requestRow{"2026-02-08T11:00:00Z", "web", "/login", "POST", 401, 6, 0, 0},
+		requestRow{"2026-02-08T11:00:00Z", "web", "/login", "POST", 200, 10, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/api/auth", "POST", 401, 20, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/api/auth", "POST", 200, 500, 0, 0},
+		requestRow{"2026-02-08T10:00:00Z", "web", "/admin/login", "POST", 401, 8, 0, 0},
+	)
+
+	got, err := q.CredentialStuffingSignals(context.Background(), f)
+	if err != nil {
+		t.Fatalf("CredentialStuffingSignals() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("CredentialStuffingSignals() = %+v, want only /login", got)
+	}
+	s := got[0]
+	if s.Path != "/login" || s.Failures != 30 || s.IPs != 12 || s.Requests != 40 || s.FailurePct != 75 {
+		t.Errorf("CredentialStuffingSignals()[0] = %+v, want /login with 30 of 40 failing from 12 clients", s)
+	}
+	if s.PeakHour != "2026-02-08T10:00:00Z" || s.PeakIPs != 12 || s.Hours != 1 {
+		t.Errorf("CredentialStuffingSignals()[0] peak = %s with %d clients over %d hours, want 10:00 with 12 over 1", s.PeakHour, s.PeakIPs, s.Hours)
+	}
+}
+
+func TestSectionBreakdown(t *testing.T) {
+	db := testDB(t)
+	q := NewQueries(db)
+	h := "2026-02-08T10:00:00Z"
+	seedRequests(t, db,
+		requestRow{h, "web", "/blog", "GET", 200, 10, 1000, 100},
+		requestRow{h, "web", "/blog/a?ref=x", "GET", 200, 20, 2000, 200},
+		requestRow{h, "web", "/blog/2024/b", "GET", 200, 10, 1000, 300},
+		requestRow{h, "web", "/docs/api/v1", "GET", 200, 30, 3000, 900},
+		requestRow{h, "web", "/", "GET", 200, 5, 500, 50},
+		requestRow{h, "web", "(other)", "GET", 200, 25, 0, 0},
+	)
+	f := Filter{From: h, To: h}
+
+	got, err := q.SectionBreakdown(context.Background(), f, 1)
+	if err != nil {
+		t.Fatalf("SectionBreakdown() error = %v", err)
+	}
+	want := []struct {
+		section      string
+		paths, count int64
+	}{{"/blog", 3, 40}, {"/docs", 1, 30}, {"(other)", 1, 25}, {"/", 1, 5}}
+	if len(got) != len(want) {
+		t.Fatalf("SectionBreakdown(1) = %+v, want %d sections", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Section != w.section || got[i].Paths != w.paths || got[i].Count != w.count {
+			t.Errorf("SectionBreakdown(1)[%d] = %+v, want %s with %d paths and %d requests", i, got[i], w.section, w.paths, w.count)
+		}
+	}
+	if got[0].AvgMs != 15 || got[0].AvgBytes != 100 || got[0].Pct != 40 {
+		t.Errorf("SectionBreakdown(1) /blog = %+v, want 15 ms, 100 B avg, 40%%", got[0])
+	}
+
+	got, err = q.SectionBreakdown(context.Background(), f, 2)
+	if err != nil {
+		t.Fatalf("SectionBreakdown() error = %v", err)
+	}
+	sections := map[string]int64{}
+	for _, s := range got {
+		sections[s.Section] = s.Count
+	}
+	if sections["/docs/api"] != 30 || sections["/blog/a"] != 20 || sections["/blog/2024"] != 10 || sections["/blog"] != 10 {
+		t.Errorf("SectionBreakdown(2) = %v, want /docs/api, /blog/a, /blog/2024 and /blog apart", sections)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"math"
+)
+
+// scoreFactor is one weighted input to SecurityScore. Weight is the most
+// points the factor can subtract from 100; Full is the level at which the
+// whole weight applies (penalties scale linearly below it).
+type scoreFactor struct {
+	Weight float64
+	Full   float64
+}
+
+// securityScoreWeights tunes SecurityScore. Weights sum to 100 so a site
+// maxing out every factor scores 0.
+var securityScoreWeights = struct {
+	Unrouted     scoreFactor // share of requests no router matched, in %
+	HighSignal   scoreFactor // share of requests probing env files / admin panels, in %
+	ServerErrors scoreFactor // 5xx share of requests, in %
+	FakeCrawlers scoreFactor // share of requests from fake crawlers (Queries.FakeCrawlers), in %
+}{
+	Unrouted:     scoreFactor{Weight: 30, Full: 50},
+	HighSignal:   scoreFactor{Weight: 30, Full: 1},
+	ServerErrors: scoreFactor{Weight: 25, Full: 5},
+	FakeCrawlers: scoreFactor{Weight: 15, Full: 2},
+}
+
+// highSignalCategories are threat categories that indicate targeted probing
+// (secrets and admin surfaces) rather than generic noise
+var highSignalCategories = map[string]bool{
+	"Environment":  true,
+	"Admin Panels": true,
+}
+
+// penalty returns the points a factor subtracts for value
+func (f scoreFactor) penalty(value float64) float64 {
+	if value <= 0 || f.Full <= 0 {
+		return 0
+	}
+	return f.Weight * math.Min(value/f.Full, 1)
+}
+
+// SecurityScore condenses the security page into a 0-100 score (higher is
+// better) and the human-readable factors that lowered it. Weights live in
+// securityScoreWeights.
+func SecurityScore(data SecurityData) (int, []string) {
+	if data.TotalTraffic == 0 {
+		return 100, nil
+	}
+	total := float64(data.TotalTraffic)
+	w := securityScoreWeights
+
+	var factors []string
+	score := 100.0
+	apply := func(p float64, format string, args ...any) {
+		if p < 0.5 {
+			return
+		}
+		score -= p
+		factors = append(factors, fmt.Sprintf(format, args...)+fmt.Sprintf(" (-%d)", int(math.Round(p))))
+	}
+
+	unroutedPct := float64(data.TotalUnrouted) / total * 100
+	apply(w.Unrouted.penalty(unroutedPct), "Unrouted/scanner traffic is %.1f%% of requests", unroutedPct)
+
+	var highSignal int64
+	for _, tp := range data.ThreatPatterns {
+		if highSignalCategories[tp.Category] {
+			highSignal += tp.Count
+		}
+	}
+	if highSignal > 0 {
+		// Any targeted probing costs half the weight; volume adds the rest
+		highPct := float64(highSignal) / total * 100
+		p := w.HighSignal.Weight/2 + w.HighSignal.penalty(highPct)/2
+		apply(p, "%s requests probed env files or admin panels", formatNumber(highSignal))
+	}
+
+	errPct := float64(data.Total5xx) / total * 100
+	apply(w.ServerErrors.penalty(errPct), "5xx error rate is %.2f%%", errPct)
+
+	fakePct := float64(data.FakeCrawlers) / total * 100
+	apply(w.FakeCrawlers.penalty(fakePct), "%s unrouted requests claimed to be search engine crawlers", formatNumber(data.FakeCrawlers))
+
+	return int(math.Round(math.Max(score, 0))), factors
+}
+
+// scoreLevel buckets a security score for display: "good", "warn" or "bad"
+func scoreLevel(score int) string {
+	switch {
+	case score >= 80:
+		return "good"
+	case score >= 50:
+		return "warn"
+	default:
+		return "bad"
+	}
+}
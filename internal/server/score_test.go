@@ -0,0 +1,104 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecurityScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        SecurityData
+		want        int
+		wantFactors []string // substrings, one per expected factor in order
+	}{
+		{
+			name: "no traffic",
+			data: SecurityData{},
+			want: 100,
+		},
+		{
+			name: "clean site",
+			data: SecurityData{TotalTraffic: 10000, BotPct: 20},
+			want: 100,
+		},
+		{
+			name:        "half unrouted caps that factor",
+			data:        SecurityData{TotalTraffic: 1000, TotalUnrouted: 500},
+			want:        70,
+			wantFactors: []string{"Unrouted/scanner traffic is 50.0% of requests (-30)"},
+		},
+		{
+			name: "single env probe costs half the high-signal weight",
+			data: SecurityData{
+				TotalTraffic:   100000,
+				TotalUnrouted:  1,
+				ThreatPatterns: []ThreatPatternStat{{Category: "Environment", Count: 1}},
+			},
+			want:        85,
+			wantFactors: []string{"1 requests probed env files or admin panels (-15)"},
+		},
+		{
+			name: "bot share alone costs nothing",
+			data: SecurityData{TotalTraffic: 1000, BotPct: 90},
+			want: 100,
+		},
+		{
+			name: "5xx and fake crawlers",
+			data: SecurityData{TotalTraffic: 1000, Total5xx: 25, FakeCrawlers: 10},
+			// 2.5% of 5% -> 12.5; fake crawlers 1% of 2% -> 7.5
+			want:        80,
+			wantFactors: []string{"5xx error rate is 2.50%", "10 unrouted requests claimed to be search engine crawlers"},
+		},
+		{
+			name: "everything bad floors at zero",
+			data: SecurityData{
+				TotalTraffic:   100,
+				TotalUnrouted:  90,
+				Total5xx:       50,
+				FakeCrawlers:   10,
+				ThreatPatterns: []ThreatPatternStat{{Category: "Admin Panels", Count: 40}},
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, factors := SecurityScore(tt.data)
+			if got != tt.want {
+				t.Errorf("SecurityScore() = %d, want %d (factors %v)", got, tt.want, factors)
+			}
+			if tt.wantFactors == nil {
+				return
+			}
+			if len(factors) != len(tt.wantFactors) {
+				t.Fatalf("factors = %v, want %d entries", factors, len(tt.wantFactors))
+			}
+			for i, want := range tt.wantFactors {
+				if !strings.Contains(factors[i], want) {
+					t.Errorf("factor[%d] = %q, want it to contain %q", i, factors[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreLevel(t *testing.T) {
+	tests := []struct {
+		score int
+		want  string
+	}{
+		{100, "good"},
+		{80, "good"},
+		{79, "warn"},
+		{50, "warn"},
+		{49, "bad"},
+		{0, "bad"},
+	}
+	for _, tt := range tests {
+		if got := scoreLevel(tt.score); got != tt.want {
+			t.Errorf("scoreLevel(%d) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"fmt"
 	"html/template"
@@ -16,26 +18,78 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/open-wander/trail/internal/backfill"
 	"github.com/open-wander/trail/internal/config"
+	"github.com/open-wander/trail/internal/parser"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Server represents the HTTP server instance
 type Server struct {
-	app          *fiber.App
-	db           *sql.DB
-	config       *config.Config
-	queries      *Queries
-	tmpl         *template.Template
-	overviewTmpl *template.Template
-	securityTmpl *template.Template
-	staticFS     fs.FS
+	app               *fiber.App
+	db                *sql.DB
+	config            *config.Config
+	queries           *Queries
+	tmpl              *template.Template
+	overviewTmpl      *template.Template
+	securityTmpl      *template.Template
+	compareTmpl       *template.Template
+	routerCompareTmpl *template.Template
+	summaryTmpl       *template.Template
+	staticFS          fs.FS
+	flusher           Flusher                      // optional, backs /api/admin/flush and Freshness
+	parser            *parser.Parser               // optional, backs /api/admin/format
+	backfill          *backfill.Progress           // optional, reported by /healthz
+	ingest            Pauser                       // optional, backs /api/admin/pause and /api/admin/resume
+	ingestLines       chan<- string                // optional, receives lines pushed to /api/ingest
+	sessionKey        []byte                       // signs login cookies, see TRAIL_SESSION_LOGIN
+	checkCredentials  func(user, pass string) bool // nil when no auth is configured
+}
+
+// Flusher writes buffered log entries to the database on demand and reports
+// when it last did. Implemented by *aggregator.Aggregator.
+type Flusher interface {
+	Flush(ctx context.Context) (int, error)
+	LastFlush() time.Time
+}
+
+// Pauser stops and restarts reading the log without losing its position.
+// Implemented by *tailer.Tailer and tailer.Group.
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// SetPauser enables the /api/admin/pause and /api/admin/resume endpoints
+// and reports the paused state in /healthz and the sidebar
+func (s *Server) SetPauser(p Pauser) {
+	s.ingest = p
+}
+
+// SetFlusher enables the /api/admin/flush endpoint and sharpens the data
+// freshness indicator to the last flush rather than the newest hour bucket
+func (s *Server) SetFlusher(f Flusher) {
+	s.flusher = f
+}
+
+// SetParser enables the /api/admin/format endpoints, which re-run format
+// detection and switch the live parser's format without a restart
+func (s *Server) SetParser(p *parser.Parser) {
+	s.parser = p
+}
+
+// SetBackfillProgress reports the startup backfill's progress in /healthz,
+// so an import running in the background can be watched
+func (s *Server) SetBackfillProgress(p *backfill.Progress) {
+	s.backfill = p
 }
 
 // New creates a new Server instance with the given configuration and database.
 // templatesFS and staticFS are embedded filesystems rooted at the project root
-// (i.e. containing "templates/" and "static/" subdirectories).
-func New(cfg *config.Config, database *sql.DB, templatesFS, staticFS fs.FS) *Server {
+// (i.e. containing "templates/" and "static/" subdirectories). It fails when
+// a template doesn't parse.
+func New(cfg *config.Config, database *sql.DB, templatesFS, staticFS fs.FS) (*Server, error) {
 	app := fiber.New(fiber.Config{
 		AppName:               "Trail Analytics",
 		DisableStartupMessage: false,
@@ -43,35 +97,58 @@ func New(cfg *config.Config, database *sql.DB, templatesFS, staticFS fs.FS) *Ser
 
 	// Initialize queries
 	queries := NewQueries(database)
+	queries.SetKnownMethods(cfg.ExtraMethods)
+	queries.SetSuccessCriteria(cfg.SuccessStatusBelow, cfg.SuccessIgnore404)
+	queries.SetVisitGap(cfg.VisitGapHours)
+	queries.SetBreakdownLimit(cfg.MaxBreakdownRows)
 
 	// Sub into templates/ directory so patterns are just filenames
 	tmplFS, err := fs.Sub(templatesFS, "templates")
 	if err != nil {
-		log.Fatalf("Failed to open embedded templates: %v", err)
+		return nil, fmt.Errorf("failed to open templates: %w", err)
+	}
+
+	// Customized templates replace the embedded ones as a whole
+	if cfg.TemplateDir != "" {
+		dirFS := os.DirFS(cfg.TemplateDir)
+		missing, err := missingTemplates(tmplFS, dirFS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TRAIL_TEMPLATE_DIR: %w", err)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("TRAIL_TEMPLATE_DIR %s is missing templates: %s", cfg.TemplateDir, strings.Join(missing, ", "))
+		}
+		tmplFS = dirFS
 	}
 
 	// Load and parse templates with helper functions
 	funcMap := template.FuncMap{
-		"formatBytes":     formatBytes,
-		"formatNumber":    formatNumber,
-		"pct":             pct,
-		"statusColor":     statusColor,
-		"formatPct":       formatPct,
-		"add":             func(a, b int) int { return a + b },
-		"sub":             func(a, b int) int { return a - b },
-		"statusCodeColor": statusCodeColor,
-		"intRange":        intRange,
-		"formatTimeLabel": formatTimeLabel,
-		"formatDate":      formatDate,
-		"conicGradient":   conicGradient,
-		"sparklineSVG":    sparklineSVG,
-		"formatDelta":     formatDelta,
-		"deltaClass":      deltaClass,
-		"deltaArrow":      deltaArrow,
+		"formatBytes":      formatBytes,
+		"formatNumber":     formatNumber,
+		"pct":              pct,
+		"statusColor":      statusColor,
+		"formatPct":        formatPct,
+		"add":              func(a, b int) int { return a + b },
+		"sub":              func(a, b int) int { return a - b },
+		"statusCodeColor":  statusCodeColor,
+		"statusLabel":      statusLabel,
+		"sizeBucketColor":  sizeBucketColor,
+		"intRange":         intRange,
+		"formatTimeLabel":  formatTimeLabel,
+		"formatDate":       formatDate,
+		"conicGradient":    conicGradient,
+		"sparklineSVG":     sparklineSVG,
+		"formatDelta":      formatDelta,
+		"formatPointDelta": formatPointDelta,
+		"deltaClass":       deltaClass,
+		"deltaArrow":       deltaArrow,
+		"latencyColor": func(ms int64) string {
+			return latencyColor(ms, cfg.LatencyWarnMs, cfg.LatencyCritMs)
+		},
 	}
 
 	// Parse overview templates (layout + overview + tab partials)
-	overviewTmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(tmplFS,
+	overviewTmpl, err := parseTemplates(tmplFS, funcMap,
 		"layout.html",
 		"overview.html",
 		"overview_tab_summary.html",
@@ -79,42 +156,114 @@ func New(cfg *config.Config, database *sql.DB, templatesFS, staticFS fs.FS) *Ser
 		"overview_tab_status.html",
 		"overview_tab_devices.html",
 		"overview_tab_performance.html",
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse security templates (layout + security + tab partials)
-	securityTmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(tmplFS,
+	securityTmpl, err := parseTemplates(tmplFS, funcMap,
 		"layout.html",
 		"security.html",
 		"security_tab_summary.html",
 		"security_tab_errors.html",
 		"security_tab_performance.html",
-	))
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse compare templates (layout + compare page)
+	compareTmpl, err := parseTemplates(tmplFS, funcMap,
+		"layout.html",
+		"compare.html",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse router compare templates (layout + router compare page)
+	routerCompareTmpl, err := parseTemplates(tmplFS, funcMap,
+		"layout.html",
+		"compare_routers.html",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse executive summary templates (layout + summary page)
+	summaryTmpl, err := parseTemplates(tmplFS, funcMap,
+		"layout.html",
+		"summary.html",
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse all templates for backward compatibility with partials
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(tmplFS, "*.html"))
+	tmpl, err := parseTemplates(tmplFS, funcMap, "*.html")
+	if err != nil {
+		return nil, err
+	}
 
 	// Sub into static/ directory for file serving
 	staticSub, err := fs.Sub(staticFS, "static")
 	if err != nil {
-		log.Fatalf("Failed to open embedded static files: %v", err)
+		return nil, fmt.Errorf("failed to open static files: %w", err)
 	}
 
 	s := &Server{
-		app:          app,
-		db:           database,
-		config:       cfg,
-		queries:      queries,
-		tmpl:         tmpl,
-		overviewTmpl: overviewTmpl,
-		securityTmpl: securityTmpl,
-		staticFS:     staticSub,
+		app:               app,
+		db:                database,
+		config:            cfg,
+		queries:           queries,
+		tmpl:              tmpl,
+		overviewTmpl:      overviewTmpl,
+		securityTmpl:      securityTmpl,
+		compareTmpl:       compareTmpl,
+		routerCompareTmpl: routerCompareTmpl,
+		summaryTmpl:       summaryTmpl,
+		staticFS:          staticSub,
+	}
+	if cfg.SessionLogin {
+		s.sessionKey = sessionKey(cfg.SessionSecret)
 	}
 
 	// Configure middleware and routes
 	s.setupMiddleware()
 	s.setupRoutes()
 
-	return s
+	return s, nil
+}
+
+// missingTemplates returns the templates of required that dir lacks
+func missingTemplates(required, dir fs.FS) ([]string, error) {
+	names, err := fs.Glob(required, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(dir, "."); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, name := range names {
+		if _, err := fs.Stat(dir, name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// parseTemplates parses one page's template files (or patterns) with the
+// helper functions, naming the offending file when one doesn't parse
+func parseTemplates(tmplFS fs.FS, funcMap template.FuncMap, patterns ...string) (*template.Template, error) {
+	t := template.New("").Funcs(funcMap)
+	for _, pattern := range patterns {
+		if _, err := t.ParseFS(tmplFS, pattern); err != nil {
+			return nil, fmt.Errorf("template %s failed to parse: %w", pattern, err)
+		}
+	}
+	return t, nil
 }
 
 // setupMiddleware configures middleware for the application
@@ -124,15 +273,49 @@ func (s *Server) setupMiddleware() {
 		Root: http.FS(s.staticFS),
 	}))
 
+	// Log pushes authenticate with their own bearer token, not the
+	// dashboard's credentials, so the route comes before the auth middleware
+	if s.config.IngestToken != "" {
+		s.app.Post("/api/ingest", s.handleIngest)
+	}
+
 	// Basic auth middleware (if configured)
 	if authMiddleware := s.createAuthMiddleware(); authMiddleware != nil {
 		s.app.Use(authMiddleware)
 	}
 }
 
-// createAuthMiddleware creates basic auth middleware based on configuration
+// createAuthMiddleware creates basic auth middleware based on configuration,
+// wrapped to also accept a login cookie when TRAIL_SESSION_LOGIN is set.
 // Returns nil if no authentication is configured
 func (s *Server) createAuthMiddleware() fiber.Handler {
+	authorizer := s.credentialChecker()
+	if authorizer == nil {
+		return nil
+	}
+	s.checkCredentials = authorizer
+
+	basic := basicauth.New(basicauth.Config{Authorizer: authorizer})
+	if s.sessionKey != nil {
+		return s.sessionMiddleware(basic)
+	}
+	return basic
+}
+
+// requireAuth answers 403 when no credentials are configured, for endpoints
+// that must never be open even on a dashboard that is
+func (s *Server) requireAuth(c *fiber.Ctx) error {
+	if s.checkCredentials == nil {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "admin endpoints require TRAIL_AUTH_USER and TRAIL_AUTH_PASS, or TRAIL_HTPASSWD_FILE",
+		})
+	}
+	return c.Next()
+}
+
+// credentialChecker returns the username/password check for the configured
+// credentials, or nil if no authentication is configured
+func (s *Server) credentialChecker() func(user, pass string) bool {
 	// Priority 1: htpasswd file
 	if s.config.HtpasswdFile != "" {
 		users, err := parseHtpasswd(s.config.HtpasswdFile)
@@ -141,24 +324,22 @@ func (s *Server) createAuthMiddleware() fiber.Handler {
 			return nil
 		}
 
-		return basicauth.New(basicauth.Config{
-			Authorizer: func(user, pass string) bool {
-				hashedPass, exists := users[user]
-				if !exists {
-					return false
-				}
-				return verifyPassword(pass, hashedPass)
-			},
-		})
+		return func(user, pass string) bool {
+			hashedPass, exists := users[user]
+			if !exists {
+				return false
+			}
+			return verifyPassword(pass, hashedPass)
+		}
 	}
 
 	// Priority 2: environment variable credentials
 	if s.config.AuthUser != "" && s.config.AuthPass != "" {
-		return basicauth.New(basicauth.Config{
-			Users: map[string]string{
-				s.config.AuthUser: s.config.AuthPass,
-			},
-		})
+		return func(user, pass string) bool {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.config.AuthUser)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(s.config.AuthPass)) == 1
+			return userOK && passOK
+		}
 	}
 
 	// No authentication configured
@@ -231,28 +412,79 @@ func verifyPassword(plaintext, hashed string) bool {
 	return false
 }
 
-// setupRoutes configures all HTTP routes
+// queryTimeout bounds the database work of a single dashboard request. With
+// one SQLite connection, a query stuck behind a long write would otherwise
+// hold its handler goroutine indefinitely and queue every request after it.
+const queryTimeout = 30 * time.Second
+
+// withQueryTimeout bounds the request's user context with queryTimeout.
+// Handlers pass c.UserContext() to their queries, which are then abandoned
+// at the deadline instead of piling up.
+func withQueryTimeout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), queryTimeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// setupRoutes configures all HTTP routes. Handlers that read dashboard
+// metrics run under withQueryTimeout.
 func (s *Server) setupRoutes() {
+	// Health check for uptime probes
+	s.app.Get("/healthz", withQueryTimeout, s.handleHealthz)
+
+	// Prometheus scrape target
+	s.app.Get("/metrics", withQueryTimeout, s.handleMetrics)
+
 	// Dashboard pages
-	s.app.Get("/", s.handleOverview)
-	s.app.Get("/security", s.handleSecurity)
+	s.app.Get("/", withQueryTimeout, s.handleOverview)
+	s.app.Get("/security", withQueryTimeout, s.handleSecurity)
+	s.app.Get("/compare", withQueryTimeout, s.handleCompare)
+	s.app.Get("/compare/routers", withQueryTimeout, s.handleCompareRouters)
+	s.app.Get("/summary", withQueryTimeout, s.handleSummary)
 
 	// API endpoints (htmx partials)
-	s.app.Get("/api/overview", s.handleAPIOverview)
-	s.app.Get("/api/security", s.handleAPISecurity)
-	s.app.Get("/api/filters", s.handleAPIFilters)
+	s.app.Get("/api/overview", withQueryTimeout, s.handleAPIOverview)
+	s.app.Get("/api/security", withQueryTimeout, s.handleAPISecurity)
+	s.app.Get("/api/filters", withQueryTimeout, s.handleAPIFilters)
+
+	// JSON endpoints
+	s.app.Get("/api/bounds", withQueryTimeout, s.handleAPIBounds)
 
 	// Drilldown endpoints
-	s.app.Get("/api/drilldown/path", s.handlePathDrilldown)
-	s.app.Get("/api/drilldown/status", s.handleStatusDrilldown)
-	s.app.Get("/api/drilldown/status-code", s.handleStatusCodeDrilldown)
+	s.app.Get("/api/drilldown/path", withQueryTimeout, s.handlePathDrilldown)
+	s.app.Get("/api/drilldown/status", withQueryTimeout, s.handleStatusDrilldown)
+	s.app.Get("/api/drilldown/status-code", withQueryTimeout, s.handleStatusCodeDrilldown)
+	s.app.Get("/api/drilldown/country", withQueryTimeout, s.handleCountryDrilldown)
+	s.app.Get("/api/drilldown/raw", withQueryTimeout, s.handleRawDrilldown)
 
 	// Paginated panel endpoints
-	s.app.Get("/api/panel/paths", s.handlePanelPaths)
-	s.app.Get("/api/panel/referrers", s.handlePanelReferrers)
-	s.app.Get("/api/panel/not-found", s.handlePanelNotFound)
-
-	// Logout endpoint
+	s.app.Get("/api/panel/paths", withQueryTimeout, s.handlePanelPaths)
+	s.app.Get("/api/panel/sections", withQueryTimeout, s.handlePanelSections)
+	s.app.Get("/api/panel/referrers", withQueryTimeout, s.handlePanelReferrers)
+	s.app.Get("/api/panel/not-found", withQueryTimeout, s.handlePanelNotFound)
+	s.app.Get("/api/panel/now", withQueryTimeout, s.handlePanelNow)
+	s.app.Get("/api/panel/recent", withQueryTimeout, s.handlePanelRecent)
+
+	// CSV/JSON downloads of dashboard data
+	s.app.Get("/api/export/paths", withQueryTimeout, s.handleExportPaths)
+
+	// Admin endpoints, refused unless credentials are configured since the
+	// database holds the IP salt and, with TRAIL_STORE_RAW, single requests
+	s.app.Get("/api/admin/export", s.requireAuth, s.handleAdminExport)
+	s.app.Get("/api/admin/backup.db", s.requireAuth, s.handleAdminBackup)
+	s.app.Post("/api/admin/flush", s.requireAuth, s.handleAdminFlush)
+	s.app.Post("/api/admin/pause", s.requireAuth, s.handleAdminPause)
+	s.app.Post("/api/admin/resume", s.requireAuth, s.handleAdminResume)
+	s.app.Get("/api/admin/format", s.requireAuth, s.handleAdminFormat)
+	s.app.Post("/api/admin/format", s.requireAuth, s.handleAdminSetFormat)
+	s.app.Get("/api/debug/config", s.requireAuth, s.handleDebugConfig)
+
+	// Login form for session cookies, and logout
+	if s.sessionKey != nil && s.checkCredentials != nil {
+		s.app.Get("/login", s.handleLogin)
+		s.app.Post("/login", s.handleLogin)
+	}
 	s.app.Get("/logout", s.handleLogout)
 }
 
@@ -387,6 +619,21 @@ func applyRedirectSuggestions(paths []PathStat) {
 	}
 }
 
+// latencyColor returns the CSS color for a latency in ms: green below warn,
+// amber from warn, red from crit. Without thresholds it keeps the text color.
+func latencyColor(ms int64, warn, crit int) string {
+	switch {
+	case warn <= 0 || crit <= 0:
+		return "inherit"
+	case ms >= int64(crit):
+		return "var(--error)"
+	case ms >= int64(warn):
+		return "var(--warning)"
+	default:
+		return "var(--success)"
+	}
+}
+
 // statusColor returns CSS color variable for status code class
 func statusColor(class string) string {
 	switch class {
@@ -403,13 +650,50 @@ func statusColor(class string) string {
 	}
 }
 
+// sizeBucketColors runs from green for small responses to red and purple
+// for the multi-megabyte ones worth investigating
+var sizeBucketColors = map[string]string{
+	"0-1KB":     "#3fb950",
+	"1-10KB":    "#06b6d4",
+	"10-100KB":  "#58a6ff",
+	"100KB-1MB": "#d29922",
+	"1-10MB":    "#f85149",
+	"10MB+":     "#8b5cf6",
+}
+
+// sizeBucketColor returns the chart color for a response size bucket
+func sizeBucketColor(bucket string) string {
+	if c, ok := sizeBucketColors[bucket]; ok {
+		return c
+	}
+	return "var(--text-secondary)"
+}
+
 // formatPct formats a float64 percentage to one decimal place
 func formatPct(p float64) string {
 	return fmt.Sprintf("%.1f%%", p)
 }
 
+// statusLabels name status codes that proxies and load balancers log for
+// dropped or abandoned connections. They say more about clients and networks
+// than about the site, so they get their own label and a neutral color.
+var statusLabels = map[int]string{
+	0:   "No response",
+	444: "Closed, no response",
+	460: "Client closed (ELB)",
+	499: "Client closed request",
+}
+
+// statusLabel returns the label for a non-standard status code, or ""
+func statusLabel(status int) string {
+	return statusLabels[status]
+}
+
 // statusCodeColor returns CSS color for an individual status code
 func statusCodeColor(status int) string {
+	if _, ok := statusLabels[status]; ok {
+		return "var(--text-secondary)"
+	}
 	switch {
 	case status >= 200 && status < 300:
 		return "var(--success)"
@@ -476,6 +760,14 @@ func formatDelta(d float64) string {
 	return "0.0%"
 }
 
+// formatPointDelta formats a change between two percentages as "+0.4 pp"
+func formatPointDelta(d float64) string {
+	if d > 0 {
+		return fmt.Sprintf("+%.1f pp", d)
+	}
+	return fmt.Sprintf("%.1f pp", d)
+}
+
 // deltaClass returns a CSS class name based on the delta direction
 func deltaClass(d float64) string {
 	if d > 0.5 {
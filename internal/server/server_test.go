@@ -1,12 +1,90 @@
 package server
 
 import (
+	"bytes"
+	"database/sql"
+	"io"
+	"io/fs"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	trail "github.com/open-wander/trail"
+	"github.com/open-wander/trail/internal/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// newTestServer creates a Server with the embedded templates and static files
+func newTestServer(t *testing.T, cfg *config.Config, db *sql.DB) *Server {
+	t.Helper()
+	srv, err := New(cfg, db, trail.TemplatesFS, trail.StaticFS)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return srv
+}
+
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	embedded, err := fs.Sub(trail.TemplatesFS, "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.CopyFS(dir, embedded); err != nil {
+		t.Fatal(err)
+	}
+	layout := filepath.Join(dir, "layout.html")
+	data, err := os.ReadFile(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(layout, bytes.Replace(data, []byte("<body"), []byte(`<body data-brand="acme"`), 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, &config.Config{TemplateDir: dir}, testDB(t))
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/summary", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `data-brand="acme"`) {
+		t.Error("GET /summary didn't render the customized layout")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "summary.html")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(&config.Config{TemplateDir: dir}, testDB(t), trail.TemplatesFS, trail.StaticFS)
+	if err == nil || !strings.Contains(err.Error(), "missing templates: summary.html") {
+		t.Errorf("New() with an incomplete TRAIL_TEMPLATE_DIR error = %v, want summary.html missing", err)
+	}
+
+	_, err = New(&config.Config{TemplateDir: filepath.Join(dir, "nope")}, testDB(t), trail.TemplatesFS, trail.StaticFS)
+	if err == nil {
+		t.Error("New() with a nonexistent TRAIL_TEMPLATE_DIR succeeded, want an error")
+	}
+}
+
+func TestNewTemplateError(t *testing.T) {
+	broken := fstest.MapFS{
+		"templates/layout.html":   {Data: []byte(`{{define "layout.html"}}{{block "content" .}}{{end}}{{end}}`)},
+		"templates/overview.html": {Data: []byte(`{{define "content"}}{{if .Stats}}{{end}}`)},
+		"static/app.js":           {Data: []byte("")},
+	}
+	_, err := New(&config.Config{}, testDB(t), broken, broken)
+	if err == nil {
+		t.Fatal("New() with a malformed template succeeded, want an error")
+	}
+	if !strings.Contains(err.Error(), "template overview.html failed to parse") {
+		t.Errorf("New() error = %q, want it to name overview.html", err)
+	}
+}
+
 func TestParseHtpasswd(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -176,3 +254,41 @@ func indexOf(s, substr string) int {
 	}
 	return -1
 }
+
+func TestRecentRequestViews(t *testing.T) {
+	db := testDB(t)
+	now := time.Now().UTC()
+	if _, err := db.Exec(`INSERT INTO requests_raw (hour, ts, router, path, method, status, ip_hash, referrer)
+		VALUES (?, ?, 'web', '/pricing?a=1&b=2', 'GET', 200, 'abcd1234', 'news.example.com')`,
+		now.Truncate(time.Hour).Format(time.RFC3339), now.Format(time.RFC3339)); err != nil {
+		t.Fatalf("seed requests_raw: %v", err)
+	}
+	seedRequests(t, db, requestRow{now.Truncate(time.Hour).Format(time.RFC3339), "web", "/pricing?a=1&b=2", "GET", 200, 1, 0, 0})
+	srv := newTestServer(t, &config.Config{StoreRaw: true}, db)
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := srv.app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s = %d: %s", url, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	if body := get("/api/panel/recent"); !strings.Contains(body, "/pricing") || !strings.Contains(body, "news.example.com") {
+		t.Errorf("recent requests panel lacks the stored request:\n%s", body)
+	}
+	if body := get("/api/drilldown/path?path=%2Fpricing%3Fa%3D1%26b%3D2"); !strings.Contains(body, `/api/drilldown/raw?path=%2Fpricing%3Fa%3D1%26b%3D2&method=GET&status=200`) {
+		t.Errorf("path drilldown rows don't drill down to single requests:\n%s", body)
+	}
+	if body := get("/api/drilldown/raw?path=%2Fpricing%3Fa%3D1%26b%3D2&method=GET&status=200"); !strings.Contains(body, "abcd1234") {
+		t.Errorf("raw drilldown lacks the stored request:\n%s", body)
+	}
+	if body := get("/api/drilldown/raw?path=%2Fpricing%3Fa%3D1%26b%3D2&status=404"); strings.Contains(body, "abcd1234") {
+		t.Errorf("raw drilldown for 404 shows a 200 request:\n%s", body)
+	}
+}
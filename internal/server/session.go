@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sessionCookie names the cookie holding a signed dashboard login
+const sessionCookie = "trail_session"
+
+// sessionKey returns the key session cookies are signed with: the
+// configured secret, or a random one that lasts until restart
+func sessionKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate session key: %v", err)
+	}
+	return key
+}
+
+// signSession returns a cookie value naming user, valid until expires:
+// base64(user|unix expiry) "." hex HMAC-SHA256 of that payload
+func signSession(key []byte, user string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession returns the user a cookie value was signed for, or ""
+// when the signature doesn't match or the session has expired
+func verifySession(key []byte, value string, now time.Time) string {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return ""
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ""
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ""
+	}
+	i := strings.LastIndexByte(string(raw), '|')
+	if i < 0 {
+		return ""
+	}
+	user := string(raw[:i])
+	unix, err := strconv.ParseInt(string(raw[i+1:]), 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return ""
+	}
+	return user
+}
+
+// sessionMiddleware accepts a valid session cookie, falling back to basic
+// auth for API clients. Browsers without either are sent to the login form;
+// htmx requests get an HX-Redirect so an expired session reloads the page.
+func (s *Server) sessionMiddleware(basic fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Path() == "/login" {
+			return c.Next()
+		}
+		if verifySession(s.sessionKey, c.Cookies(sessionCookie), time.Now()) != "" {
+			return c.Next()
+		}
+		if c.Get(fiber.HeaderAuthorization) != "" {
+			return basic(c)
+		}
+		if c.Get("HX-Request") == "true" {
+			c.Set("HX-Redirect", "/login")
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		if c.Method() == fiber.MethodGet && strings.Contains(c.Get(fiber.HeaderAccept), "text/html") {
+			return c.Redirect("/login?next=" + url.QueryEscape(c.OriginalURL()))
+		}
+		return basic(c)
+	}
+}
+
+// LoginData represents data for the login form
+type LoginData struct {
+	Next  string
+	Error string
+}
+
+// handleLogin serves the login form (GET) and checks submitted
+// credentials (POST), setting the session cookie on success
+func (s *Server) handleLogin(c *fiber.Ctx) error {
+	data := LoginData{Next: safeNext(c.Query("next", c.FormValue("next")))}
+
+	if c.Method() == fiber.MethodPost {
+		user := c.FormValue("username")
+		if s.checkCredentials(user, c.FormValue("password")) {
+			expires := time.Now().Add(time.Duration(s.config.SessionTTLHours) * time.Hour)
+			c.Cookie(&fiber.Cookie{
+				Name:     sessionCookie,
+				Value:    signSession(s.sessionKey, user, expires),
+				Path:     "/",
+				Expires:  expires,
+				HTTPOnly: true,
+				Secure:   c.Protocol() == "https",
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+			return c.Redirect(data.Next)
+		}
+		data.Error = "Invalid username or password"
+		c.Status(fiber.StatusUnauthorized)
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "login.html", data); err != nil {
+		log.Printf("Error rendering login template: %v", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// safeNext returns next when it is a local path to return to after login,
+// and "/" otherwise, so the form can't redirect off-site
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") || strings.HasPrefix(next, "/login") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	key := []byte("k")
+	now := time.Now()
+	value := signSession(key, "admin", now.Add(time.Hour))
+
+	if got := verifySession(key, value, now); got != "admin" {
+		t.Errorf("verifySession() = %q, want admin", got)
+	}
+	if got := verifySession(key, value, now.Add(2*time.Hour)); got != "" {
+		t.Errorf("verifySession() after expiry = %q, want empty", got)
+	}
+	if got := verifySession([]byte("other"), value, now); got != "" {
+		t.Errorf("verifySession() with another key = %q, want empty", got)
+	}
+
+	// Re-signing the payload for another user without the key fails
+	_, sig, _ := strings.Cut(value, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("root|9999999999")) + "." + sig
+	for _, v := range []string{forged, "", "garbage", value + "00"} {
+		if got := verifySession(key, v, now); got != "" {
+			t.Errorf("verifySession(%q) = %q, want empty", v, got)
+		}
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	for next, want := range map[string]string{
+		"/security?tab=errors": "/security?tab=errors",
+		"":                     "/",
+		"https://evil.example": "/",
+		"//evil.example":       "/",
+		`/\evil.example`:       "/",
+		"/login?next=/":        "/",
+	} {
+		if got := safeNext(next); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
+
+func TestSessionLogin(t *testing.T) {
+	db := testDB(t)
+	srv := newTestServer(t, &config.Config{
+		Listen:          ":0",
+		AuthUser:        "admin",
+		AuthPass:        "secret",
+		SessionLogin:    true,
+		SessionTTLHours: 1,
+	}, db)
+
+	do := func(req *http.Request) *http.Response {
+		t.Helper()
+		resp, err := srv.app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+		}
+		return resp
+	}
+	browserGet := func(target string, cookie *http.Cookie) *http.Response {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", "text/html")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return do(req)
+	}
+	login := func(user, pass string) *http.Response {
+		form := url.Values{"username": {user}, "password": {pass}, "next": {"/security"}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(req)
+	}
+
+	// A browser without a session is sent to the form
+	resp := browserGet("/security?tab=errors&range=7d", nil)
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/login?next=%2Fsecurity%3Ftab%3Derrors%26range%3D7d" {
+		t.Fatalf("GET /security = %d to %q, want redirect to login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp := browserGet("/login", nil); resp.StatusCode != 200 {
+		t.Fatalf("GET /login = %d, want 200", resp.StatusCode)
+	}
+
+	if resp := login("admin", "wrong"); resp.StatusCode != 401 || len(resp.Cookies()) != 0 {
+		t.Errorf("bad login = %d with %d cookies, want 401 without a cookie", resp.StatusCode, len(resp.Cookies()))
+	}
+
+	resp = login("admin", "secret")
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/security" {
+		t.Fatalf("login = %d to %q, want redirect to /security", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatalf("login cookies = %v, want an HttpOnly %s", resp.Cookies(), sessionCookie)
+	}
+	if resp := browserGet("/security", session); resp.StatusCode != 200 {
+		t.Errorf("GET /security with session = %d, want 200", resp.StatusCode)
+	}
+
+	// A tampered cookie is a missing one
+	tampered := &http.Cookie{Name: sessionCookie, Value: session.Value + "0"}
+	if resp := browserGet("/security", tampered); resp.StatusCode != 302 {
+		t.Errorf("GET /security with tampered session = %d, want redirect", resp.StatusCode)
+	}
+
+	// htmx requests with an expired session reload into the form
+	req := httptest.NewRequest("GET", "/api/overview", nil)
+	req.Header.Set("HX-Request", "true")
+	if resp := do(req); resp.StatusCode != 401 || resp.Header.Get("HX-Redirect") != "/login" {
+		t.Errorf("htmx request = %d with HX-Redirect %q, want 401 to /login", resp.StatusCode, resp.Header.Get("HX-Redirect"))
+	}
+
+	// API clients keep using basic auth
+	req = httptest.NewRequest("GET", "/api/bounds", nil)
+	if resp := do(req); resp.StatusCode != 401 {
+		t.Errorf("API request without credentials = %d, want 401", resp.StatusCode)
+	}
+	req = httptest.NewRequest("GET", "/api/bounds", nil)
+	req.SetBasicAuth("admin", "secret")
+	if resp := do(req); resp.StatusCode != 200 {
+		t.Errorf("API request with basic auth = %d, want 200", resp.StatusCode)
+	}
+
+	resp = browserGet("/logout", session)
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/login" {
+		t.Errorf("GET /logout = %d to %q, want redirect to /login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			t.Errorf("logout cookie = %q, want it cleared", c.Value)
+		}
+	}
+}
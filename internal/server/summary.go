@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// summaryTopPaths is how many paths the executive summary lists
+const summaryTopPaths = 5
+
+// SummaryData represents the data for the executive summary page: the
+// headline numbers of the overview and security dashboards on one sheet
+type SummaryData struct {
+	Stats           *TotalStat
+	Comparison      *ComparisonStat
+	SuccessRate     float64
+	SuccessDelta    float64 // percentage points vs the previous period
+	HasSuccessDelta bool
+	TopPaths        []PathStat
+	MaxPath         int64
+	ErrorRate       float64            // 5xx share of all requests, bots included
+	ErrorTrend      []int64            // daily 5xx counts, as on the security page
+	BotPct          float64            // bot share of all requests
+	TopThreat       *ThreatPatternStat // nil without threat traffic
+	Period          string             // e.g. "2026-02-01 00:00 to 2026-02-07 23:00"
+	Range           string
+	CustomFrom      string
+	CustomTo        string
+	Router          string
+	Page            string
+	Freshness       Freshness
+}
+
+// handleSummary serves the executive summary page
+func (s *Server) handleSummary(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	data, err := s.getSummaryData(c)
+	if err != nil {
+		log.Printf("Error loading summary data: %v", err)
+		return c.Status(500).SendString("Error loading summary")
+	}
+
+	data.Freshness = s.freshness(ctx)
+
+	var buf bytes.Buffer
+	if err := s.summaryTmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// getSummaryData fetches the summary's numbers with the same queries as the
+// overview and security pages, skipping their panels. Traffic numbers follow
+// the bots toggle; security numbers always include bots, as on /security.
+func (s *Server) getSummaryData(c *fiber.Ctx) (*SummaryData, error) {
+	ctx := c.UserContext()
+	filter, rangeParam := s.requestFilter(c)
+	data := &SummaryData{
+		Period:     periodLabel(filter),
+		Range:      rangeParam,
+		CustomFrom: c.Query("custom_from", ""),
+		CustomTo:   c.Query("custom_to", ""),
+		Router:     c.Query("router", ""),
+		Page:       "summary",
+	}
+
+	stats, err := s.queries.TotalStats(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch total stats: %w", err)
+	}
+	data.Stats = stats
+
+	prevFilter := previousPeriodFilter(filter, rangeParam)
+	prevStats, err := s.queries.TotalStats(ctx, prevFilter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch previous period stats: %v", err)
+		prevStats = nil
+	}
+	data.Comparison = computeComparison(stats, prevStats)
+	data.SuccessRate, data.SuccessDelta, data.HasSuccessDelta = s.successRates(ctx, filter, prevFilter, prevStats)
+
+	if data.TopPaths, err = s.queries.TopPaths(ctx, filter, summaryTopPaths); err != nil {
+		return nil, fmt.Errorf("failed to fetch top paths: %w", err)
+	}
+	data.MaxPath = 1
+	for _, p := range data.TopPaths {
+		data.MaxPath = max(data.MaxPath, p.Count)
+	}
+
+	secFilter := filter
+	secFilter.IncludeBots = true
+
+	statuses, err := s.queries.StatusBreakdown(ctx, secFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status breakdown: %w", err)
+	}
+	for _, st := range statuses {
+		if st.Class == "5xx" {
+			data.ErrorRate = st.Pct
+		}
+	}
+
+	errorTrends, err := s.queries.ErrorTrends(ctx, secFilter)
+	if err != nil {
+		log.Printf("Warning: failed to fetch error trends: %v", err)
+	}
+	for _, p := range errorTrends {
+		data.ErrorTrend = append(data.ErrorTrend, p.Count)
+	}
+
+	humanCount, botCount, _, err := s.queries.BotVsHuman(ctx, secFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bot breakdown: %w", err)
+	}
+	data.BotPct = pctOf(botCount, humanCount+botCount)
+
+	threats, err := s.queries.ThreatPatterns(ctx, secFilter, s.suspiciousPathMode(), s.config.SuspiciousStatuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch threat patterns: %w", err)
+	}
+	for i := range threats {
+		if threats[i].Count > 0 && (data.TopThreat == nil || threats[i].Count > data.TopThreat.Count) {
+			data.TopThreat = &threats[i]
+		}
+	}
+
+	return data, nil
+}
+
+// periodLabel describes the hours a filter covers, for the printed page
+func periodLabel(f Filter) string {
+	from, errFrom := time.Parse(time.RFC3339, f.From)
+	to, errTo := time.Parse(time.RFC3339, f.To)
+	if errFrom != nil || errTo != nil {
+		return f.From + " to " + f.To
+	}
+	return from.Format("2006-01-02 15:04") + " to " + to.Format("2006-01-02 15:04")
+}
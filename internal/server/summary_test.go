@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-wander/trail/internal/config"
+)
+
+func TestSummaryPage(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().UTC().Truncate(time.Hour).Format("2006-01-02T15:00:00Z")
+	seedRequests(t, db,
+		requestRow{hour, "web", "/", "GET", 200, 90, 0, 0},
+		requestRow{hour, "web", "/pricing", "GET", 200, 40, 0, 0},
+		requestRow{hour, "web", "/boom", "GET", 500, 10, 0, 0},
+		requestRow{hour, "unrouted", "/wp-login.php", "GET", 404, 60, 0, 0},
+	)
+	seedUserAgents(t, db,
+		userAgentRow{hour, "web", "Chrome", 140},
+		userAgentRow{hour, "unrouted", "bot", 60},
+	)
+	srv := newTestServer(t, &config.Config{}, db)
+
+	resp, err := srv.app.Test(httptest.NewRequest("GET", "/summary?range=today", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /summary: status %d: %s", resp.StatusCode, body)
+	}
+	// 140 human requests; 10 of all 200 are 5xx and 60 come from scanners
+	for _, want := range []string{"140", "/pricing", "5.0%", "30.0%", "WordPress"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("summary page missing %q", want)
+		}
+	}
+}
@@ -83,7 +83,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	}
 
 	// Requests over time should have data
-	rot, err := q.RequestsOverTime(filter)
+	rot, err := q.RequestsOverTime(context.Background(), filter)
 	if err != nil {
 		t.Fatalf("RequestsOverTime() error = %v", err)
 	}
@@ -93,7 +93,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	t.Logf("requests over time: %d hourly buckets", len(rot))
 
 	// Top paths should have data
-	paths, err := q.TopPaths(filter, 10)
+	paths, err := q.TopPaths(context.Background(), filter, 10)
 	if err != nil {
 		t.Fatalf("TopPaths() error = %v", err)
 	}
@@ -103,7 +103,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	t.Logf("top paths: %d paths, top = %q (%d hits)", len(paths), paths[0].Path, paths[0].Count)
 
 	// Status breakdown should have data
-	statuses, err := q.StatusBreakdown(filter)
+	statuses, err := q.StatusBreakdown(context.Background(), filter)
 	if err != nil {
 		t.Fatalf("StatusBreakdown() error = %v", err)
 	}
@@ -115,7 +115,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	}
 
 	// Total stats should be non-zero
-	stats, err := q.TotalStats(filter)
+	stats, err := q.TotalStats(context.Background(), filter)
 	if err != nil {
 		t.Fatalf("TotalStats() error = %v", err)
 	}
@@ -130,7 +130,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 		To:          "2026-12-31T23:00:00Z",
 		IncludeBots: false,
 	}
-	humanStats, err := q.TotalStats(humanFilter)
+	humanStats, err := q.TotalStats(context.Background(), humanFilter)
 	if err != nil {
 		t.Fatalf("TotalStats(human) error = %v", err)
 	}
@@ -140,7 +140,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	t.Logf("human only: %d requests, %d visitors", humanStats.Requests, humanStats.Visitors)
 
 	// Routers should have multiple entries
-	routers, err := q.Routers()
+	routers, err := q.Routers(context.Background())
 	if err != nil {
 		t.Fatalf("Routers() error = %v", err)
 	}
@@ -150,7 +150,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	t.Logf("routers: %v", routers)
 
 	// Referrers should have data
-	refs, err := q.TopReferrers(filter, 5)
+	refs, err := q.TopReferrers(context.Background(), filter, 5)
 	if err != nil {
 		t.Fatalf("TopReferrers() error = %v", err)
 	}
@@ -160,7 +160,7 @@ func TestSmokeImportSampleLog(t *testing.T) {
 	}
 
 	// Security: probed paths should exist (sample has scanner traffic)
-	probed, err := q.TopProbedPaths(5)
+	probed, err := q.TopProbedPaths(context.Background(), 5)
 	if err != nil {
 		t.Fatalf("TopProbedPaths() error = %v", err)
 	}
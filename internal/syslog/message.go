@@ -0,0 +1,105 @@
+package syslog
+
+import (
+	"strings"
+	"time"
+)
+
+// Payload returns the message part of a syslog line, the access log line
+// a web server sent: what follows the RFC 5424 header and structured data,
+// or the RFC 3164 timestamp, hostname and tag. A line without a <PRI>
+// prefix, e.g. piped through netcat, is taken as the message itself.
+func Payload(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	rest, ok := cutPriority(line)
+	if !ok {
+		return line
+	}
+	if after, ok := strings.CutPrefix(rest, "1 "); ok {
+		return rfc5424Payload(after)
+	}
+	return rfc3164Payload(rest)
+}
+
+// cutPriority strips a leading <PRI> of one to three digits
+func cutPriority(line string) (string, bool) {
+	if !strings.HasPrefix(line, "<") {
+		return line, false
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 || strings.Trim(line[1:end], "0123456789") != "" {
+		return line, false
+	}
+	return line[end+1:], true
+}
+
+// rfc5424Payload skips TIMESTAMP HOSTNAME APP-NAME PROCID MSGID and the
+// structured data ("-" or [id param="value"]... elements), then a BOM
+func rfc5424Payload(rest string) string {
+	for range 5 {
+		_, after, ok := strings.Cut(rest, " ")
+		if !ok {
+			return ""
+		}
+		rest = after
+	}
+	rest = skipStructuredData(rest)
+	rest = strings.TrimPrefix(rest, " ")
+	return strings.TrimPrefix(rest, "\ufeff")
+}
+
+// skipStructuredData returns what follows the SD field at the start of s.
+// Values are quoted and may contain escaped quotes and brackets.
+func skipStructuredData(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return s[1:]
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && quoted {
+				i++
+				continue
+			}
+			if c == '"' {
+				quoted = !quoted
+			} else if c == ']' && !quoted {
+				i++
+				break
+			}
+		}
+	}
+	return s[i:]
+}
+
+// rfc3164Payload skips the timestamp ("Feb  8 10:00:00", or RFC 3339 as
+// rsyslog can send) and a "host tag:" or "tag:" prefix such as nginx's
+// "web1 nginx: ". Without a recognisable tag everything after the
+// timestamp is the message.
+func rfc3164Payload(rest string) string {
+	if len(rest) >= len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err == nil {
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	if first, after, ok := strings.Cut(rest, " "); ok {
+		if _, err := time.Parse(time.RFC3339Nano, first); err == nil {
+			rest = after
+		}
+	}
+
+	msg := rest
+	for range 2 {
+		word, after, ok := strings.Cut(strings.TrimLeft(msg, " "), " ")
+		if !ok {
+			break
+		}
+		if strings.HasSuffix(word, ":") {
+			return after
+		}
+		msg = after
+	}
+	return rest
+}
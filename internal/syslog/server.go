@@ -0,0 +1,256 @@
+// Package syslog receives access logs shipped over the network as syslog
+// messages (RFC 3164 or RFC 5424, over UDP or TCP) and hands their
+// payloads on as log lines, as the tailer does for a file.
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxMessageSize bounds one message; longer TCP frames drop the connection
+// and longer UDP datagrams are truncated by the read
+const MaxMessageSize = 64 * 1024
+
+// Server listens for syslog messages on UDP, TCP or both
+type Server struct {
+	packet   net.PacketConn // nil without UDP
+	listener net.Listener   // nil without TCP
+
+	mu      sync.Mutex
+	paused  bool
+	dropped int // messages discarded while paused
+}
+
+// ParseListen splits TRAIL_SYSLOG_LISTEN into the networks to listen on
+// and the address: "udp://:514" or "tcp://:514" for one, or a bare
+// address such as ":514" for both
+func ParseListen(spec string) (networks []string, addr string, err error) {
+	networks = []string{"udp", "tcp"}
+	if scheme, rest, ok := strings.Cut(spec, "://"); ok {
+		if scheme != "udp" && scheme != "tcp" {
+			return nil, "", fmt.Errorf("unsupported scheme %q, want udp or tcp", scheme)
+		}
+		networks, spec = []string{scheme}, rest
+	}
+	if _, _, err := net.SplitHostPort(spec); err != nil {
+		return nil, "", err
+	}
+	return networks, spec, nil
+}
+
+// Listen binds the sockets named by spec (see ParseListen) right away, so
+// an address in use fails at startup rather than in Run
+func Listen(spec string) (*Server, error) {
+	networks, addr, err := ParseListen(spec)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{}
+	for _, network := range networks {
+		switch network {
+		case "udp":
+			s.packet, err = net.ListenPacket("udp", addr)
+		case "tcp":
+			s.listener, err = net.Listen("tcp", addr)
+		}
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Addrs returns the bound UDP and TCP addresses, nil for a network not
+// listened on; useful with port 0
+func (s *Server) Addrs() (udp, tcp net.Addr) {
+	if s.packet != nil {
+		udp = s.packet.LocalAddr()
+	}
+	if s.listener != nil {
+		tcp = s.listener.Addr()
+	}
+	return udp, tcp
+}
+
+// close closes the sockets
+func (s *Server) close() {
+	if s.packet != nil {
+		s.packet.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// Pause discards messages until Resume: senders can't be held back the way
+// a log file waits to be read, so what arrives meanwhile is lost
+func (s *Server) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume passes messages on again and logs how many were discarded
+func (s *Server) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused && s.dropped > 0 {
+		log.Printf("syslog: discarded %d messages while paused", s.dropped)
+	}
+	s.paused = false
+	s.dropped = 0
+}
+
+// Paused reports whether messages are being discarded
+func (s *Server) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// Run sends the payload of every message received to lines until ctx is
+// cancelled, then closes the sockets and connections.
+func (s *Server) Run(ctx context.Context, lines chan<- string) error {
+	udp, tcp := s.Addrs()
+	log.Printf("syslog: listening on udp %v, tcp %v", udp, tcp)
+
+	stop := context.AfterFunc(ctx, s.close)
+	defer stop()
+
+	var wg sync.WaitGroup
+	if s.packet != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveUDP(ctx, lines)
+		}()
+	}
+	if s.listener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveTCP(ctx, lines)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// serveUDP reads datagrams, each one or more newline-separated messages
+func (s *Server) serveUDP(ctx context.Context, lines chan<- string) {
+	buf := make([]byte, MaxMessageSize)
+	for {
+		n, _, err := s.packet.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("syslog: udp read: %v", err)
+			}
+			return
+		}
+		for msg := range bytes.SplitSeq(buf[:n], []byte("\n")) {
+			if !s.send(ctx, lines, string(msg)) {
+				return
+			}
+		}
+	}
+}
+
+// serveTCP accepts connections and reads each on its own goroutine
+func (s *Server) serveTCP(ctx context.Context, lines chan<- string) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog: tcp accept: %v", err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			defer conn.Close()
+			s.serveConn(ctx, conn, lines)
+		}()
+	}
+}
+
+// serveConn reads the messages of one TCP connection, framed by octet
+// counting or by newlines (RFC 6587)
+func (s *Server) serveConn(ctx context.Context, conn net.Conn, lines chan<- string) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), MaxMessageSize)
+	scanner.Split(splitFrames)
+	for scanner.Scan() {
+		if !s.send(ctx, lines, scanner.Text()) {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("syslog: tcp %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// send passes the payload of msg on, unless it's empty or the server is
+// paused. It reports false once ctx is cancelled.
+func (s *Server) send(ctx context.Context, lines chan<- string, msg string) bool {
+	line := Payload(msg)
+	if line == "" {
+		return true
+	}
+	s.mu.Lock()
+	if s.paused {
+		s.dropped++
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+	select {
+	case lines <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// splitFrames is a bufio.SplitFunc for RFC 6587 framing: "LEN SP MSG" when
+// a frame starts with a decimal length, otherwise one message per line.
+// Messages always start with '<' and log lines with anything but a
+// length and a space, so the two can't be confused.
+func splitFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	digits := 0
+	for digits < len(data) && digits < 8 && data[digits] >= '0' && data[digits] <= '9' {
+		digits++
+	}
+	switch {
+	case digits == len(data) && digits > 0 && digits < 8 && !atEOF:
+		return 0, nil, nil // length still arriving
+	case digits > 0 && digits < len(data) && data[digits] == ' ' && data[0] != '0':
+		n, _ := strconv.Atoi(string(data[:digits]))
+		if n > MaxMessageSize {
+			return 0, nil, bufio.ErrTooLong
+		}
+		end := digits + 1 + n
+		if end <= len(data) {
+			return end, data[digits+1 : end], nil
+		}
+		if atEOF {
+			return len(data), data[digits+1:], nil
+		}
+		return 0, nil, nil
+	}
+	return bufio.ScanLines(data, atEOF)
+}
@@ -0,0 +1,147 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+const accessLine = `1.2.3.4 - - [08/Feb/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"rfc3164 nginx", "<190>Feb  8 10:00:00 web1 nginx: " + accessLine, accessLine},
+		{"rfc3164 no hostname", "<190>Feb  8 10:00:00 nginx[42]: " + accessLine, accessLine},
+		{"rfc3164 rfc3339 timestamp", "<14>2026-02-08T10:00:00.123+00:00 edge traefik: " + accessLine, accessLine},
+		{"rfc3164 no tag", "<14>Feb  8 10:00:00 " + accessLine, accessLine},
+		{"rfc5424 nil sd", "<165>1 2026-02-08T10:00:00Z web1 nginx 42 - - " + accessLine, accessLine},
+		{"rfc5424 sd and bom", `<165>1 2026-02-08T10:00:00Z web1 traefik - ID47 [meta a="x\]y" b="1 2"][origin ip="10.0.0.1"] ` + "\ufeff" + accessLine, accessLine},
+		{"rfc5424 no message", "<165>1 2026-02-08T10:00:00Z web1 nginx 42 - -", ""},
+		{"no priority", accessLine + "\r\n", accessLine},
+		{"not a priority", "<abc>" + accessLine, "<abc>" + accessLine},
+	}
+	for _, tt := range tests {
+		if got := Payload(tt.line); got != tt.want {
+			t.Errorf("%s: Payload() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		spec     string
+		networks []string
+		addr     string
+		wantErr  bool
+	}{
+		{spec: ":514", networks: []string{"udp", "tcp"}, addr: ":514"},
+		{spec: "udp://0.0.0.0:514", networks: []string{"udp"}, addr: "0.0.0.0:514"},
+		{spec: "tcp://[::1]:6514", networks: []string{"tcp"}, addr: "[::1]:6514"},
+		{spec: "tls://:6514", wantErr: true},
+		{spec: "514", wantErr: true},
+	}
+	for _, tt := range tests {
+		networks, addr, err := ParseListen(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseListen(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(networks, tt.networks) || addr != tt.addr {
+			t.Errorf("ParseListen(%q) = %v, %q, want %v, %q", tt.spec, networks, addr, tt.networks, tt.addr)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	udpAddr, tcpAddr := s.Addrs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, lines) }()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	// UDP: one message per datagram
+	conn, err := net.Dial("udp", udpAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "<190>Feb  8 10:00:00 web1 nginx: %s\n", accessLine)
+	conn.Close()
+	expect(accessLine)
+
+	// TCP: newline framing, then octet counting on the same connection
+	conn, err = net.Dial("tcp", tcpAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "<190>Feb  8 10:00:00 web1 nginx: %s\n", "first")
+	msg := "<165>1 2026-02-08T10:00:00Z web1 nginx - - - " + accessLine
+	fmt.Fprintf(conn, "%d %s", len(msg), msg)
+	expect("first")
+	expect(accessLine)
+
+	// Paused: messages are discarded
+	s.Pause()
+	fmt.Fprintf(conn, "<190>Feb  8 10:00:00 web1 nginx: dropped\n")
+	time.Sleep(50 * time.Millisecond)
+	s.Resume()
+	fmt.Fprintf(conn, "<190>Feb  8 10:00:00 web1 nginx: kept\n")
+	expect("kept")
+	conn.Close()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	tests := []struct {
+		data    string
+		atEOF   bool
+		advance int
+		token   string
+	}{
+		{data: "5 hello6 world!", advance: 7, token: "hello"},
+		{data: "12", advance: 0},       // length incomplete
+		{data: "11 hello", advance: 0}, // message incomplete
+		{data: "<13>msg\nnext", advance: 8, token: "<13>msg"},
+		{data: "1.2.3.4 - -\n", advance: 12, token: "1.2.3.4 - -"},
+		{data: "0 x\n", advance: 4, token: "0 x"}, // no leading zero lengths
+	}
+	for _, tt := range tests {
+		advance, token, err := splitFrames([]byte(tt.data), tt.atEOF)
+		if err != nil || advance != tt.advance || string(token) != tt.token {
+			t.Errorf("splitFrames(%q) = %d, %q, %v, want %d, %q", tt.data, advance, token, err, tt.advance, tt.token)
+		}
+	}
+	if _, _, err := splitFrames([]byte(fmt.Sprintf("%d <13>", MaxMessageSize+1)), false); err == nil {
+		t.Error("splitFrames should refuse a frame over MaxMessageSize")
+	}
+}
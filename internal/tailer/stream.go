@@ -0,0 +1,89 @@
+package tailer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// Stream reads log lines from a pipe, such as standard input, to its end.
+// Unlike a file it has no position to save or rotation to follow: what was
+// read before a restart is gone, and nothing is backfilled. Pausing stops
+// reading, so a writer blocks once the pipe buffer fills.
+type Stream struct {
+	name string
+	r    io.Reader
+
+	mu     sync.Mutex
+	paused bool
+	wake   chan struct{} // signalled on Resume
+}
+
+// NewStream creates a Stream reading r, named in log messages
+func NewStream(name string, r io.Reader) *Stream {
+	return &Stream{name: name, r: r, wake: make(chan struct{}, 1)}
+}
+
+// Pause stops reading after the current line until Resume
+func (s *Stream) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume continues reading
+func (s *Stream) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Paused reports whether reading is paused
+func (s *Stream) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// Run sends each non-empty line to lines until the end of input, and
+// closes lines when it returns so a consumer can tell the stream is done.
+// A read blocked on a silent pipe only notices ctx being cancelled once
+// the next line arrives.
+func (s *Stream) Run(ctx context.Context, lines chan<- string) error {
+	defer close(lines)
+	log.Printf("tailer: reading %s", s.name)
+
+	scanner := bufio.NewScanner(s.r)
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		for s.Paused() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.wake:
+			}
+		}
+		select {
+		case lines <- line:
+			count++
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", s.name, err)
+	}
+	log.Printf("tailer: end of %s after %d lines", s.name, count)
+	return nil
+}
@@ -2,41 +2,198 @@ package tailer
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/open-wander/trail/internal/metrics"
 )
 
-// Tailer implements a poll-based log file tailer with position tracking,
-// copytruncate detection, and rotation handling via inode checks.
+// ErrCompressed is returned for a gzip-compressed active log. Gzip streams
+// can't be resumed at a byte offset, so live tailing them is unsupported;
+// rotated .gz files are still imported by backfill.
+var ErrCompressed = errors.New("live gzip tailing unsupported: point TRAIL_LOG_FILE at the uncompressed log")
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Tailer implements a log file tailer with position tracking,
+// copytruncate detection, and rotation handling via inode checks. On Linux
+// it reads as soon as inotify reports a change, polling only as a safety
+// net; elsewhere, on network filesystems, or with SetPollOnly it polls.
 type Tailer struct {
-	path     string
-	db       *sql.DB
-	interval time.Duration
+	path          string
+	db            *sql.DB
+	interval      time.Duration // polling interval without notifications
+	watchInterval time.Duration // safety polling interval with notifications
+	minGap        time.Duration // least time between reads on notifications
+	sendTimeout   time.Duration // how long a full lines channel may hold up a line before it's dropped
+	pollOnly      bool
+
+	linesRead    *metrics.Counter
+	linesDropped *metrics.Counter
+	highWater    *metrics.Gauge // most lines seen waiting in the channel
+	capacity     *metrics.Gauge
+
+	paused atomic.Bool   // checked before each tick and between lines
+	wake   chan struct{} // read now: on start and resume
 }
 
 // New creates a new Tailer for the given log file path.
-// Default polling interval is 1 second.
+// Default polling interval is 1 second, or 10 seconds while change
+// notifications work.
 func New(path string, db *sql.DB) *Tailer {
 	return &Tailer{
-		path:     path,
-		db:       db,
-		interval: 1 * time.Second,
+		path:          path,
+		db:            db,
+		interval:      1 * time.Second,
+		watchInterval: 10 * time.Second,
+		minGap:        100 * time.Millisecond,
+		sendTimeout:   5 * time.Second,
+		wake:          make(chan struct{}, 1),
+
+		linesRead:    metrics.Default.Counter("trail_tailer_lines_read_total", "Lines read from the log file.", "file", path),
+		linesDropped: metrics.Default.Counter("trail_tailer_lines_dropped_total", "Lines read but dropped because the aggregator fell behind.", "file", path),
+		highWater:    metrics.Default.Gauge("trail_tailer_channel_high_watermark", "Most lines seen waiting for the aggregator at once.", "file", path),
+		capacity:     metrics.Default.Gauge("trail_tailer_channel_capacity", "Lines that can wait for the aggregator before the tailer blocks.", "file", path),
+	}
+}
+
+// SetPollOnly disables change notifications, so the log is polled every
+// second even where inotify works. Call before Run.
+func (t *Tailer) SetPollOnly(on bool) {
+	t.pollOnly = on
+}
+
+// Group is the tailers of several log files, paused and resumed together
+type Group []*Tailer
+
+// Pause pauses every tailer in g
+func (g Group) Pause() {
+	for _, t := range g {
+		t.Pause()
+	}
+}
+
+// Resume resumes every tailer in g
+func (g Group) Resume() {
+	for _, t := range g {
+		t.Resume()
+	}
+}
+
+// Paused reports whether every tailer in g is paused
+func (g Group) Paused() bool {
+	for _, t := range g {
+		if !t.Paused() {
+			return false
+		}
+	}
+	return len(g) > 0
+}
+
+// Pause stops reading the log until Resume. A read in progress stops after
+// the line it is sending, without waiting for it; the saved position stays
+// where it ended, so lines after it are read on resume (unless the file is
+// rotated away meanwhile).
+func (t *Tailer) Pause() {
+	t.paused.Store(true)
+}
+
+// Resume continues reading from the saved position, right away
+func (t *Tailer) Resume() {
+	t.paused.Store(false)
+	t.wakeUp()
+}
+
+// wakeUp makes Run read without waiting for a change or the next poll
+func (t *Tailer) wakeUp() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Paused reports whether reading is paused
+func (t *Tailer) Paused() bool {
+	return t.paused.Load()
+}
+
+// tick runs processTick unless paused, reporting whether it ran
+func (t *Tailer) tick(lines chan<- string, savedOffset, savedInode, savedSize int64) (bool, error) {
+	if t.paused.Load() {
+		return false, nil
 	}
+	return true, t.processTick(lines, savedOffset, savedInode, savedSize)
 }
 
-// Run starts the tailer loop. It polls the log file at regular intervals,
-// detects rotations and truncations, and sends complete lines to the channel.
+// CheckFile rejects an active log the tailer can't read: a .gz path, or a
+// file whose content starts with the gzip header. A missing file is fine,
+// since the tailer waits for it to appear.
+func CheckFile(path string) error {
+	if strings.HasSuffix(path, ".gz") {
+		return fmt.Errorf("%s: %w", path, ErrCompressed)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if isGzip(f) {
+		return fmt.Errorf("%s: %w", path, ErrCompressed)
+	}
+	return nil
+}
+
+// isGzip reports whether r starts with the gzip header
+func isGzip(r io.Reader) bool {
+	head := make([]byte, len(gzipMagic))
+	n, _ := io.ReadFull(r, head)
+	return bytes.Equal(head[:n], gzipMagic)
+}
+
+// Run starts the tailer loop. It reads the log file when notified of a
+// change or at regular intervals, detects rotations and truncations, and
+// sends complete lines to the channel.
 // Blocks until ctx is cancelled or a fatal error occurs.
 func (t *Tailer) Run(ctx context.Context, lines chan<- string) error {
-	ticker := time.NewTicker(t.interval)
-	defer ticker.Stop()
-
 	log.Printf("tailer: starting for %s", t.path)
+	t.capacity.Set(int64(cap(lines)))
+
+	if err := CheckFile(t.path); err != nil {
+		return err
+	}
+
+	// Watch for changes, keeping a slow poll for events inotify misses;
+	// without a watch, poll at the normal interval
+	interval := t.interval
+	var changed <-chan struct{}
+	if !t.pollOnly {
+		if w, err := watchFile(t.path); err != nil {
+			log.Printf("tailer: polling %s every %s: %v", t.path, t.interval, err)
+		} else {
+			defer w.close()
+			changed = w.events
+			interval = t.watchInterval
+			log.Printf("tailer: watching %s for changes", t.path)
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	t.wakeUp()
+	var lastRead time.Time
 
 	// Load saved position from database
 	savedOffset, savedInode, savedSize, err := loadPosition(t.db, t.path)
@@ -44,23 +201,40 @@ func (t *Tailer) Run(ctx context.Context, lines chan<- string) error {
 		return fmt.Errorf("failed to load position: %w", err)
 	}
 
-	log.Printf("tailer: loaded position offset=%d inode=%d size=%d", savedOffset, savedInode, savedSize)
+	log.Printf("tailer: loaded position of %s offset=%d inode=%d size=%d", t.path, savedOffset, savedInode, savedSize)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("tailer: stopping (context cancelled)")
+			log.Printf("tailer: stopping %s (context cancelled)", t.path)
 			return ctx.Err()
+		case <-t.wake:
 		case <-ticker.C:
-			if err := t.processTick(lines, savedOffset, savedInode, savedSize); err != nil {
-				// Non-fatal errors (file not found, etc.) - just log and retry
-				log.Printf("tailer: tick error: %v", err)
-				continue
+		case <-changed:
+			// Under a steady stream of writes, read in batches rather
+			// than once per write
+			if wait := t.minGap - time.Since(lastRead); wait > 0 {
+				select {
+				case <-ctx.Done():
+					continue
+				case <-time.After(wait):
+				}
 			}
+		}
 
-			// Update saved position for next tick
-			savedOffset, savedInode, savedSize, _ = loadPosition(t.db, t.path)
+		lastRead = time.Now()
+		ran, err := t.tick(lines, savedOffset, savedInode, savedSize)
+		if err != nil {
+			// Non-fatal errors (file not found, etc.) - just log and retry
+			log.Printf("tailer: tick error: %v", err)
+			continue
+		}
+		if !ran {
+			continue
 		}
+
+		// Update saved position for next tick
+		savedOffset, savedInode, savedSize, _ = loadPosition(t.db, t.path)
 	}
 }
 
@@ -90,12 +264,12 @@ func (t *Tailer) processTick(lines chan<- string, savedOffset, savedInode, saved
 	switch {
 	case currentInode != savedInode:
 		// Rotation detected: new file with different inode
-		log.Printf("tailer: rotation detected (inode %d -> %d), starting from beginning", savedInode, currentInode)
+		log.Printf("tailer: rotation of %s detected (inode %d -> %d), starting from beginning", t.path, savedInode, currentInode)
 		startOffset = 0
 
 	case currentSize < savedOffset:
 		// Copytruncate detected: file was truncated in place
-		log.Printf("tailer: copytruncate detected (size %d < offset %d), starting from beginning", currentSize, savedOffset)
+		log.Printf("tailer: copytruncate of %s detected (size %d < offset %d), starting from beginning", t.path, currentSize, savedOffset)
 		startOffset = 0
 
 	default:
@@ -115,42 +289,57 @@ func (t *Tailer) processTick(lines chan<- string, savedOffset, savedInode, saved
 	}
 	defer f.Close()
 
+	// A file rotated in (or truncated and rewritten) as gzip would otherwise
+	// be fed to the parser as binary garbage
+	if startOffset == 0 && isGzip(f) {
+		return fmt.Errorf("%s: %w", t.path, ErrCompressed)
+	}
+
 	// Seek to starting offset
 	if _, err := f.Seek(startOffset, 0); err != nil {
 		return fmt.Errorf("failed to seek to offset %d: %w", startOffset, err)
 	}
 
-	// Read lines using buffered scanner
-	scanner := bufio.NewScanner(f)
+	// Read complete lines only. A last line without its newline is still
+	// being written: the offset stays at its start, so the next tick reads
+	// it again once it is finished. Pausing stops the read at the next
+	// line, which is then read on resume.
+	reader := bufio.NewReader(f)
 	lineCount := 0
 	newOffset := startOffset
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	for !t.paused.Load() {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read error: %w", err)
+		}
+		newOffset += int64(len(raw))
+
+		line := strings.TrimSuffix(strings.TrimSuffix(string(raw), "\n"), "\r")
 		if line == "" {
 			continue // Skip empty lines
 		}
+		t.linesRead.Inc()
+		t.highWater.SetMax(int64(len(lines)))
 
 		// Send line to processing channel
 		select {
 		case lines <- line:
 			lineCount++
-		case <-time.After(5 * time.Second):
-			// Channel is blocked - log warning but don't fail
-			log.Printf("tailer: warning - channel blocked, skipping line")
+		case <-time.After(t.sendTimeout):
+			// Channel is blocked - count and log it but don't fail
+			t.linesDropped.Inc()
+			log.Printf("tailer: warning - channel blocked, skipping line of %s", t.path)
 		}
-
-		// Update offset (scanner.Bytes() doesn't include newline, add 1)
-		newOffset += int64(len(scanner.Bytes())) + 1
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("scanner error: %w", err)
 	}
 
-	// Save new position to database
-	if lineCount > 0 {
-		log.Printf("tailer: processed %d lines, new offset=%d", lineCount, newOffset)
+	// Save new position to database; after a rotation or truncation also
+	// when only a partial line was found, so it isn't detected again
+	if newOffset != savedOffset || currentInode != savedInode {
+		log.Printf("tailer: processed %d lines from %s, new offset=%d", lineCount, t.path, newOffset)
 		if err := savePosition(t.db, t.path, newOffset, currentInode, currentSize); err != nil {
 			return fmt.Errorf("failed to save position: %w", err)
 		}
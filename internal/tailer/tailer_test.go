@@ -1,10 +1,15 @@
 package tailer
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -159,6 +164,232 @@ collectLoop:
 	<-errChan
 }
 
+func TestTailer_Pause(t *testing.T) {
+	database := setupTestDB(t)
+	defer database.Close()
+
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(logPath, []byte("line 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+
+	tailer := New(logPath, database)
+	tailer.interval = 20 * time.Millisecond
+	tailer.Pause()
+	if !tailer.Paused() {
+		t.Fatal("Paused() = false after Pause()")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- tailer.Run(ctx, lines)
+	}()
+
+	// Nothing is read while paused
+	select {
+	case line := <-lines:
+		t.Fatalf("read %q while paused", line)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// Lines written meanwhile arrive after resuming, in order
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("line 2\n")
+	f.Close()
+	tailer.Resume()
+
+	var collected []string
+	timeout := time.After(time.Second)
+	for len(collected) < 2 {
+		select {
+		case line := <-lines:
+			collected = append(collected, line)
+		case <-timeout:
+			t.Fatalf("after resume got %v, want line 1 and line 2", collected)
+		}
+	}
+	if collected[0] != "line 1" || collected[1] != "line 2" {
+		t.Errorf("after resume got %v, want line 1 then line 2", collected)
+	}
+
+	cancel()
+	<-errChan
+}
+
+func TestTailer_PauseMidRead(t *testing.T) {
+	database := setupTestDB(t)
+	defer database.Close()
+
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(logPath, []byte("line 1\nline 2\nline 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+
+	// Nothing drains the channel yet, so the read blocks sending line 2
+	tailer := New(logPath, database)
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		done <- tailer.processTick(lines, 0, 0, 0)
+	}()
+	if line := <-lines; line != "line 1" {
+		t.Fatalf("first line = %q, want line 1", line)
+	}
+	for tailer.linesRead.Value() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Pause and Paused don't wait for the blocked send
+	paused := make(chan struct{})
+	go func() {
+		tailer.Pause()
+		if !tailer.Paused() {
+			t.Error("Paused() = false after Pause()")
+		}
+		close(paused)
+	}()
+	select {
+	case <-paused:
+	case <-time.After(time.Second):
+		t.Fatal("Pause blocked on a read in progress")
+	}
+
+	// The line being sent goes through, then the read stops
+	if line := <-lines; line != "line 2" {
+		t.Fatalf("second line = %q, want line 2", line)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("processTick failed: %v", err)
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("read %q after pausing", line)
+	default:
+	}
+	if offset, _, _, _ := loadPosition(database, logPath); offset != 14 {
+		t.Errorf("saved offset = %d, want 14, after line 2", offset)
+	}
+}
+
+func TestTailer_WatchWakesOnChange(t *testing.T) {
+	database := setupTestDB(t)
+	defer database.Close()
+
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(logPath, []byte("line 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+	w, err := watchFile(logPath)
+	if err != nil {
+		t.Skipf("no change notifications here: %v", err)
+	}
+	w.close()
+
+	// Polling alone would take an hour: lines must arrive on notifications
+	tailer := New(logPath, database)
+	tailer.interval = time.Hour
+	tailer.watchInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- tailer.Run(ctx, lines)
+	}()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Fatalf("got %q, want %q", line, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	expect("line 1")
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("line 2\n")
+	f.Close()
+	expect("line 2")
+
+	// Rotation: the log is renamed away and a new one created in its place
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte("line 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("line 3")
+
+	cancel()
+	<-errChan
+}
+
+func TestStream(t *testing.T) {
+	s := NewStream("stdin", strings.NewReader("line 1\n\nline 2\nline 3"))
+	s.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Run(ctx, lines)
+	}()
+
+	// Nothing is read while paused
+	select {
+	case line := <-lines:
+		t.Fatalf("read %q while paused", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.Resume()
+
+	// Every line arrives, then the channel closes at the end of input
+	var collected []string
+	for line := range lines {
+		collected = append(collected, line)
+	}
+	if want := []string{"line 1", "line 2", "line 3"}; !slices.Equal(collected, want) {
+		t.Errorf("got %v, want %v", collected, want)
+	}
+	if err := <-errChan; err != nil {
+		t.Errorf("Run() = %v, want nil at end of input", err)
+	}
+}
+
+func TestGroup_Pause(t *testing.T) {
+	g := Group{New("/logs/a.log", nil), New("/logs/b.log", nil)}
+	if g.Paused() {
+		t.Fatal("Paused() = true before Pause()")
+	}
+	g.Pause()
+	if !g.Paused() || !g[0].Paused() || !g[1].Paused() {
+		t.Error("Pause() should pause every tailer")
+	}
+	g[1].Resume()
+	if g.Paused() {
+		t.Error("Paused() = true with one tailer reading")
+	}
+	g.Resume()
+	if g[0].Paused() || g[1].Paused() {
+		t.Error("Resume() should resume every tailer")
+	}
+}
+
 func TestTailer_ResumeFromOffset(t *testing.T) {
 	database := setupTestDB(t)
 	defer database.Close()
@@ -229,6 +460,93 @@ collectLoop:
 	<-errChan
 }
 
+func TestTailer_PartialLastLine(t *testing.T) {
+	database := setupTestDB(t)
+	defer database.Close()
+
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+	tailer := New(logPath, database)
+	lines := make(chan string, 10)
+
+	// readTick runs one tick from the saved position and returns the
+	// lines sent and the offset saved afterwards
+	readTick := func() ([]string, int64) {
+		t.Helper()
+		offset, inode, size, err := loadPosition(database, logPath)
+		if err != nil {
+			t.Fatalf("failed to load position: %v", err)
+		}
+		if err := tailer.processTick(lines, offset, inode, size); err != nil {
+			t.Fatalf("processTick failed: %v", err)
+		}
+		var got []string
+		for len(lines) > 0 {
+			got = append(got, <-lines)
+		}
+		offset, _, _, _ = loadPosition(database, logPath)
+		return got, offset
+	}
+
+	// The writer is part way through line 2
+	if err := os.WriteFile(logPath, []byte("line 1\nline 2 pa"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+	got, offset := readTick()
+	if !slices.Equal(got, []string{"line 1"}) || offset != 7 {
+		t.Errorf("first tick = %q at offset %d, want [line 1] at 7", got, offset)
+	}
+
+	// Nothing new is complete yet
+	got, offset = readTick()
+	if len(got) != 0 || offset != 7 {
+		t.Errorf("tick with only a partial line = %q at offset %d, want nothing at 7", got, offset)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open file for append: %v", err)
+	}
+	_, err = f.WriteString("rt\r\nline 3\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to append lines: %v", err)
+	}
+	got, offset = readTick()
+	if !slices.Equal(got, []string{"line 2 part", "line 3"}) || offset != 27 {
+		t.Errorf("tick after the line completed = %q at offset %d, want [line 2 part line 3] at 27", got, offset)
+	}
+}
+
+func TestTailer_Metrics(t *testing.T) {
+	database := setupTestDB(t)
+	defer database.Close()
+
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+	if err := os.WriteFile(logPath, []byte("line 1\nline 2\nline 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+
+	// Nothing drains the channel, so only the first line fits
+	tailer := New(logPath, database)
+	tailer.sendTimeout = 10 * time.Millisecond
+	lines := make(chan string, 1)
+	if err := tailer.processTick(lines, 0, 0, 0); err != nil {
+		t.Fatalf("processTick failed: %v", err)
+	}
+
+	if got := tailer.linesRead.Value(); got != 3 {
+		t.Errorf("lines read = %d, want 3", got)
+	}
+	if got := tailer.linesDropped.Value(); got != 2 {
+		t.Errorf("lines dropped = %d, want 2", got)
+	}
+	if got := tailer.highWater.Value(); got != 1 {
+		t.Errorf("channel high watermark = %d, want 1", got)
+	}
+}
+
 func TestTailer_AppendNewLines(t *testing.T) {
 	database := setupTestDB(t)
 	defer database.Close()
@@ -373,3 +691,40 @@ func getInode(t *testing.T, stat os.FileInfo) int64 {
 	}
 	return int64(sys.Ino)
 }
+
+func TestCheckFile_RejectsGzip(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	plain := filepath.Join(tmpDir, "access.log")
+	if err := os.WriteFile(plain, []byte("line 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+	if err := CheckFile(plain); err != nil {
+		t.Errorf("CheckFile(plain) = %v, want nil", err)
+	}
+	if err := CheckFile(filepath.Join(tmpDir, "missing.log")); err != nil {
+		t.Errorf("CheckFile(missing) = %v, want nil", err)
+	}
+	if err := CheckFile(filepath.Join(tmpDir, "access.log.gz")); !errors.Is(err, ErrCompressed) {
+		t.Errorf("CheckFile(.gz path) = %v, want ErrCompressed", err)
+	}
+
+	// gzip content under a plain name, e.g. a proxy piping through gzip
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("line 1\n"))
+	zw.Close()
+	piped := filepath.Join(tmpDir, "piped.log")
+	if err := os.WriteFile(piped, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write test log: %v", err)
+	}
+	if err := CheckFile(piped); !errors.Is(err, ErrCompressed) {
+		t.Errorf("CheckFile(gzip content) = %v, want ErrCompressed", err)
+	}
+
+	database := setupTestDB(t)
+	defer database.Close()
+	if err := New(piped, database).Run(context.Background(), make(chan string, 1)); !errors.Is(err, ErrCompressed) {
+		t.Errorf("Run() = %v, want ErrCompressed", err)
+	}
+}
@@ -0,0 +1,22 @@
+package tailer
+
+import "errors"
+
+// errNetworkFS is returned by watchFile for a log on a network filesystem
+var errNetworkFS = errors.New("network filesystem, change notifications unreliable")
+
+// fileWatch signals when a log file may have changed: written to,
+// truncated, or replaced by rotation
+type fileWatch struct {
+	events chan struct{} // capacity 1; bursts of changes coalesce
+	close  func() error
+}
+
+// notify signals events without blocking; a pending signal already covers
+// this change
+func (w *fileWatch) notify() {
+	select {
+	case w.events <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package tailer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask covers appends, truncation and the file being rotated away,
+// removed or created anew in its directory
+const watchMask = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB |
+	unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// networkFS are filesystems whose remote writes never raise inotify events
+var networkFS = map[int64]string{
+	unix.NFS_SUPER_MAGIC:  "NFS",
+	unix.SMB_SUPER_MAGIC:  "SMB",
+	unix.SMB2_SUPER_MAGIC: "SMB2",
+	unix.CIFS_SUPER_MAGIC: "CIFS",
+	unix.FUSE_SUPER_MAGIC: "FUSE",
+}
+
+// watchFile watches the directory of path with inotify, so the watch
+// survives rotation, and signals on events for path's name. It fails on
+// network filesystems, where only polling sees other hosts' writes.
+func watchFile(path string) (*fileWatch, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return nil, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	if name, ok := networkFS[int64(st.Type)]; ok {
+		return nil, fmt.Errorf("%s is on %s: %w", dir, name, errNetworkFS)
+	}
+
+	// Non-blocking, so os.File reads go through the runtime poller and
+	// Close interrupts a pending read
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, watchMask); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "inotify")
+	w := &fileWatch{events: make(chan struct{}, 1), close: f.Close}
+	go w.read(f, base)
+	return w, nil
+}
+
+// read signals w.events for each batch of events that names base, or
+// that overflowed the queue, until f is closed
+func (w *fileWatch) read(f *os.File, base string) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.notify() // fall back on the next poll rather than go quiet
+			}
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + unix.SizeofInotifyEvent
+			off = start + nameLen
+			if mask&unix.IN_Q_OVERFLOW != 0 || cString(buf[start:min(off, n)]) == base {
+				w.notify()
+			}
+		}
+	}
+}
+
+// cString returns b up to its first NUL byte
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
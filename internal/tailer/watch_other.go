@@ -0,0 +1,10 @@
+//go:build !linux
+
+package tailer
+
+import "errors"
+
+// watchFile is only implemented with inotify; other systems poll
+func watchFile(path string) (*fileWatch, error) {
+	return nil, errors.New("file change notifications are only supported on Linux")
+}
@@ -0,0 +1,47 @@
+// Package logformat lets a custom trail build parse access log formats
+// trail doesn't know. Register a LineParser from an init function in the
+// build's main package, then run app.Main:
+//
+//	func init() {
+//		logformat.Register("myproxy", logformat.LineParserFunc(parseMyProxy))
+//	}
+//
+//	func main() { app.Main() }
+//
+// The format is then selectable with TRAIL_LOG_FORMAT=myproxy and tried
+// after the built-in ones by auto-detection and TRAIL_LOG_FORMAT=multi.
+package logformat
+
+import "github.com/open-wander/trail/internal/parser"
+
+// Entry is one parsed access log line. Router groups requests like a
+// Traefik router; an empty Router counts the request as unrouted, which
+// the Security page treats as probing.
+type Entry = parser.LogEntry
+
+// LineParser parses the lines of one log format, returning an error for a
+// line not in it
+type LineParser = parser.LineParser
+
+// LineParserFunc adapts a function to a LineParser
+type LineParserFunc = parser.LineParserFunc
+
+// DurationUnit is the TRAIL_DURATION_UNIT override passed to a LineParser,
+// UnitDefault when unset
+type DurationUnit = parser.DurationUnit
+
+// Duration units
+const (
+	UnitDefault = parser.UnitDefault
+	UnitSeconds = parser.UnitSeconds
+	UnitMillis  = parser.UnitMillis
+	UnitMicros  = parser.UnitMicros
+	UnitNanos   = parser.UnitNanos
+)
+
+// Register adds a log format under name. It panics if lp is nil or the
+// name is taken (case-insensitively), including by a built-in format or
+// "auto" and "multi".
+func Register(name string, lp LineParser) {
+	parser.Register(name, lp)
+}